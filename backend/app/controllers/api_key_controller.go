@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+	"api-monitor/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIKeyController manages API keys for automation. Keys act as their owner,
+// limited to their scopes; admins can issue keys for service accounts.
+type APIKeyController struct {
+	DB *sql.DB
+}
+
+func NewAPIKeyController(db *sql.DB) *APIKeyController {
+	return &APIKeyController{DB: db}
+}
+
+// GetAPIKeys lists the current user's keys; admins can pass ?all=true to see every key
+func (kc *APIKeyController) GetAPIKeys(c *fiber.Ctx) error {
+	user := currentUser(c)
+
+	query := `
+		SELECT k.id, k.user_id, u.username, k.name, k.key_prefix, k.scopes,
+		       k.expires_at, k.last_used_at, k.revoked_at, k.created_at
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id`
+	args := []interface{}{}
+	if !(services.IsAdmin(user) && c.Query("all") == "true") {
+		query += ` WHERE k.user_id = $1`
+		args = append(args, user.ID)
+	}
+
+	rows, err := kc.DB.Query(query+` ORDER BY k.created_at DESC`, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch API keys"})
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		var scopesJSON string
+		var expiresAt, lastUsedAt, revokedAt sql.NullTime
+
+		err := rows.Scan(&key.ID, &key.UserID, &key.Username, &key.Name, &key.Prefix, &scopesJSON,
+			&expiresAt, &lastUsedAt, &revokedAt, &key.CreatedAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan API key data"})
+		}
+
+		if err := json.Unmarshal([]byte(scopesJSON), &key.Scopes); err != nil {
+			key.Scopes = []string{}
+		}
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.Time
+		}
+
+		keys = append(keys, key)
+	}
+
+	return c.JSON(fiber.Map{
+		"data": keys,
+	})
+}
+
+// CreateAPIKey issues a key. The key is only returned in this response.
+func (kc *APIKeyController) CreateAPIKey(c *fiber.Ctx) error {
+	user := currentUser(c)
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"` // 0 means the key does not expire
+		UserID        *int     `json:"user_id"`         // Admins only: issue the key for another user
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Name is required"})
+	}
+
+	if len(req.Scopes) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "At least one scope is required"})
+	}
+	for _, scope := range req.Scopes {
+		if !validScope(scope) {
+			return c.Status(400).JSON(fiber.Map{
+				"error":  "Unknown scope: " + scope,
+				"scopes": models.APIKeyScopes,
+			})
+		}
+	}
+
+	if req.ExpiresInDays < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "expires_in_days cannot be negative"})
+	}
+
+	ownerID := user.ID
+	if req.UserID != nil && *req.UserID != user.ID {
+		if !services.IsAdmin(user) {
+			return c.Status(403).JSON(fiber.Map{"error": "Only admins can create keys for other users"})
+		}
+		ownerID = *req.UserID
+	}
+
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not generate API key"})
+	}
+
+	key := models.APIKey{
+		UserID: ownerID,
+		Name:   req.Name,
+		Key:    models.APIKeyPrefix + secret,
+		Scopes: req.Scopes,
+	}
+	key.Prefix = key.Key[:len(models.APIKeyPrefix)+8]
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		key.ExpiresAt = &expiresAt
+	}
+
+	scopesJSON, _ := json.Marshal(key.Scopes)
+
+	err = kc.DB.QueryRow(`
+		INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, created_at`,
+		key.UserID, key.Name, key.Prefix, utils.HashToken(key.Key), string(scopesJSON), key.ExpiresAt).
+		Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "foreign key") {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create API key"})
+	}
+
+	recordChange(c, kc.DB, "api_key.create", "api_key", key.ID, nil, auditSnapshot(kc.DB, "api_keys", key.ID))
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "API key created successfully",
+		"data":    key,
+	})
+}
+
+// RevokeAPIKey revokes a key of the current user; admins can revoke any key
+func (kc *APIKeyController) RevokeAPIKey(c *fiber.Ctx) error {
+	user := currentUser(c)
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid API key ID"})
+	}
+
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+	args := []interface{}{id}
+	if !services.IsAdmin(user) {
+		query += ` AND user_id = $2`
+		args = append(args, user.ID)
+	}
+
+	before := auditSnapshot(kc.DB, "api_keys", id)
+	result, err := kc.DB.Exec(query, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to revoke API key"})
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to verify revocation"})
+	}
+
+	if rowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "API key not found or already revoked"})
+	}
+
+	recordChange(c, kc.DB, "api_key.revoke", "api_key", id, before, auditSnapshot(kc.DB, "api_keys", id))
+
+	return c.JSON(fiber.Map{
+		"message": "API key revoked successfully",
+	})
+}
+
+func validScope(scope string) bool {
+	for _, s := range models.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
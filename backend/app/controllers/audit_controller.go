@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const auditColumns = `id, actor_id, actor_username, action, resource_type, resource_id, ip_address,
+	details, before_state, after_state, changes, created_at`
+
+// AuditController serves the audit log to admins for change reviews. Entries are written
+// by the handlers that change configuration, see recordChange.
+type AuditController struct {
+	DB *sql.DB
+}
+
+func NewAuditController(db *sql.DB) *AuditController {
+	return &AuditController{DB: db}
+}
+
+// GetAuditLogs lists audit entries, newest first. Filters: actor_id, actor (username),
+// action (exact, or a prefix such as "endpoint.*"), resource_type, resource_id,
+// ip_address, start_date and end_date.
+func (ac *AuditController) GetAuditLogs(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	offset := c.QueryInt("offset", 0)
+
+	if limit > 200 {
+		limit = 200
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	whereConditions := []string{}
+	args := []interface{}{}
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		whereConditions = append(whereConditions, strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+
+	if actorID := c.Query("actor_id"); actorID != "" {
+		id, err := strconv.Atoi(actorID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid actor_id"})
+		}
+		addCondition("actor_id = ?", id)
+	}
+	if actor := c.Query("actor"); actor != "" {
+		addCondition("actor_username = ?", actor)
+	}
+	if action := c.Query("action"); action != "" {
+		if prefix, ok := strings.CutSuffix(action, "*"); ok {
+			addCondition("action LIKE ?", services.EscapeLike(prefix)+"%")
+		} else {
+			addCondition("action = ?", action)
+		}
+	}
+	if resourceType := c.Query("resource_type"); resourceType != "" {
+		addCondition("resource_type = ?", resourceType)
+	}
+	if resourceID := c.Query("resource_id"); resourceID != "" {
+		addCondition("resource_id = ?", resourceID)
+	}
+	if ipAddress := c.Query("ip_address"); ipAddress != "" {
+		addCondition("ip_address = ?", ipAddress)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		addCondition("created_at >= ?", startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		addCondition("created_at <= ?", endDate)
+	}
+
+	whereClause := ""
+	if len(whereConditions) > 0 {
+		whereClause = "WHERE " + strings.Join(whereConditions, " AND ")
+	}
+
+	var totalCount int
+	err := ac.DB.QueryRow("SELECT COUNT(*) FROM audit_logs "+whereClause, args...).Scan(&totalCount)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to count audit logs"})
+	}
+
+	query := `SELECT ` + auditColumns + ` FROM audit_logs ` + whereClause + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := ac.DB.Query(query, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch audit logs"})
+	}
+	defer rows.Close()
+
+	entries := []models.AuditLog{}
+	for rows.Next() {
+		entry, err := scanAuditLog(rows)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan audit log data"})
+		}
+		entries = append(entries, entry)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":   entries,
+		"total":  totalCount,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// GetAuditLog returns a single audit entry
+func (ac *AuditController) GetAuditLog(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid audit log ID"})
+	}
+
+	entry, err := scanAuditLog(ac.DB.QueryRow(`SELECT `+auditColumns+` FROM audit_logs WHERE id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "Audit log not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch audit log"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": entry,
+	})
+}
+
+func scanAuditLog(row interface{ Scan(...interface{}) error }) (models.AuditLog, error) {
+	var entry models.AuditLog
+	var actorID sql.NullInt64
+	var details, before, after, changes []byte
+
+	err := row.Scan(&entry.ID, &actorID, &entry.ActorUsername, &entry.Action, &entry.ResourceType,
+		&entry.ResourceID, &entry.IPAddress, &details, &before, &after, &changes, &entry.CreatedAt)
+	if err != nil {
+		return entry, err
+	}
+
+	if actorID.Valid {
+		id := int(actorID.Int64)
+		entry.ActorID = &id
+	}
+
+	for _, field := range []struct {
+		raw    []byte
+		target interface{}
+	}{
+		{details, &entry.Details},
+		{before, &entry.Before},
+		{after, &entry.After},
+		{changes, &entry.Changes},
+	} {
+		if len(field.raw) > 0 {
+			if err := json.Unmarshal(field.raw, field.target); err != nil {
+				return entry, err
+			}
+		}
+	}
+
+	return entry, nil
+}
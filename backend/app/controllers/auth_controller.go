@@ -1,15 +1,17 @@
 package controllers
 
 import (
-	"crypto/rand"
 	"database/sql"
-	"encoding/hex"
 	"log"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
 	"api-monitor/app/models"
+	"api-monitor/app/services"
 	"api-monitor/config"
+	"api-monitor/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -17,62 +19,190 @@ import (
 )
 
 type AuthController struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Throttle *services.LoginThrottle
 }
 
 func NewAuthController(db *sql.DB) *AuthController {
 	return &AuthController{
-		DB: db,
+		DB:       db,
+		Throttle: services.NewLoginThrottle(db),
 	}
 }
 
 // Login endpoint
 func (ac *AuthController) Login(c *fiber.Ctx) error {
+	if !config.LocalLoginEnabled() {
+		return c.Status(403).JSON(fiber.Map{"error": "Password login is disabled, use single sign-on"})
+	}
+
 	var req models.LoginRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	log.Printf("Login attempt for username: %s", req.Username)
+	// Throttled and locked out clients get the same answer so the response does not
+	// reveal whether the username exists
+	retryAfter, err := ac.Throttle.Check(c.IP(), req.Username)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if retryAfter > 0 {
+		return tooManyAttempts(c, retryAfter)
+	}
 
 	// Get user from database
 	var user models.User
-	err := ac.DB.QueryRow(`
-		SELECT id, username, password, role, is_active, created_at, updated_at
+	err = ac.DB.QueryRow(`
+		SELECT id, username, password, role, is_active, created_at, updated_at, totp_enabled, two_factor_required
 		FROM users WHERE username = $1 AND is_active = true`, req.Username).
-		Scan(&user.ID, &user.Username, &user.Password, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt)
+		Scan(&user.ID, &user.Username, &user.Password, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+			&user.TwoFactorEnabled, &user.TwoFactorRequired)
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("User not found: %s", req.Username)
-			return c.Status(401).JSON(fiber.Map{"error": "Invalid credentials"})
-		}
+	if err != nil && err != sql.ErrNoRows {
 		log.Printf("Database error: %v", err)
 		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
 	}
 
-	log.Printf("User found: %s, checking password...", user.Username)
-
 	// Check password
-	if !ac.checkPassword(req.Password, user.Password) {
-		log.Printf("Password check failed for user: %s", user.Username)
+	if err == sql.ErrNoRows || !checkPassword(req.Password, user.Password) {
+		if err := ac.Throttle.RecordFailure(c.IP(), req.Username); err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+		}
 		return c.Status(401).JSON(fiber.Map{"error": "Invalid credentials"})
 	}
 
+	// Tokens are only issued after the second factor (or its enrollment when required).
+	// The failure counter is reset by Verify once the second factor passed too.
+	if user.TwoFactorEnabled || twoFactorRequired(user) {
+		challenge, err := createLoginChallenge(ac.DB, user)
+		if err != nil {
+			log.Printf("Failed to create login challenge: %v", err)
+			return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+		}
+		log.Printf("Password accepted for user: %s, waiting for second factor", user.Username)
+		return c.JSON(challenge)
+	}
+
+	if err := ac.Throttle.RecordSuccess(user.Username); err != nil {
+		log.Printf("Failed to reset login throttle: %v", err)
+	}
+
 	log.Printf("Login successful for user: %s", user.Username)
 
-	// Generate JWT token
-	token, err := ac.generateJWT(user)
+	// Open a session and issue access + refresh tokens
+	response, err := startSession(ac.DB, c, user)
 	if err != nil {
+		log.Printf("Failed to start session: %v", err)
 		return c.Status(500).JSON(fiber.Map{"error": "Could not generate token"})
 	}
 
-	// Return response without password
-	user.Password = ""
-	return c.JSON(models.LoginResponse{
-		Token: token,
-		User:  user,
-	})
+	return c.JSON(response)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// Refresh tokens are single use: presenting one that was already used means it leaked,
+// so the whole session is revoked.
+func (ac *AuthController) Refresh(c *fiber.Ctx) error {
+	var req models.RefreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.RefreshToken == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "refresh_token is required"})
+	}
+
+	tx, err := ac.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	var tokenID int
+	var sessionID string
+	var usedAt, revokedAt sql.NullTime
+	var tokenExpiresAt time.Time
+	var accountRevoked bool
+	var user models.User
+	err = tx.QueryRow(`
+		SELECT r.id, r.used_at, r.expires_at, s.id, s.revoked_at,
+		       u.id, u.username, u.role, u.is_active, u.created_at, u.updated_at,
+		       (u.tokens_revoked_at IS NOT NULL AND u.tokens_revoked_at > s.created_at)
+		FROM refresh_tokens r
+		JOIN user_sessions s ON s.id = r.session_id
+		JOIN users u ON u.id = s.user_id
+		WHERE r.token_hash = $1
+		FOR UPDATE OF r, s`, utils.HashToken(req.RefreshToken)).
+		Scan(&tokenID, &usedAt, &tokenExpiresAt, &sessionID, &revokedAt,
+			&user.ID, &user.Username, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+			&accountRevoked)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(401).JSON(fiber.Map{"error": "Invalid refresh token"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	switch checkRefreshToken(usedAt, revokedAt, tokenExpiresAt, accountRevoked, user.IsActive, time.Now()) {
+	case refreshReused:
+		log.Printf("Refresh token reuse detected for user %s, revoking session %s", user.Username, sessionID)
+		if err := revokeSession(tx, sessionID, "refresh token reuse"); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+		}
+		if err := tx.Commit(); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+		}
+		return c.Status(401).JSON(fiber.Map{"error": "Refresh token reuse detected, session revoked"})
+	case refreshRejected:
+		return c.Status(401).JSON(fiber.Map{"error": "Session expired or revoked"})
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1", tokenID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	_, err = tx.Exec(`
+		UPDATE user_sessions SET user_agent = $1, ip_address = $2
+		WHERE id = $3`, clientUserAgent(c), c.IP(), sessionID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	response, err := issueTokens(tx, user, sessionID)
+	if err != nil {
+		log.Printf("Failed to refresh session: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Could not generate token"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	return c.JSON(response)
+}
+
+// refreshCheck is what presenting a refresh token leads to
+type refreshCheck int
+
+const (
+	refreshAllowed  refreshCheck = iota
+	refreshReused                // Already used while the session is live: the token leaked
+	refreshRejected              // Expired, revoked or of an inactive account
+)
+
+// checkRefreshToken decides whether a refresh token may be exchanged. A used token of a
+// revoked session is only rejected, the session was already dealt with.
+func checkRefreshToken(usedAt, sessionRevokedAt sql.NullTime, expiresAt time.Time, accountRevoked, active bool, now time.Time) refreshCheck {
+	if usedAt.Valid && !sessionRevokedAt.Valid {
+		return refreshReused
+	}
+	if usedAt.Valid || sessionRevokedAt.Valid || accountRevoked || !active || now.After(expiresAt) {
+		return refreshRejected
+	}
+	return refreshAllowed
 }
 
 // Logout endpoint
@@ -122,6 +252,14 @@ func (ac *AuthController) Logout(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to logout"})
 	}
 
+	// End the session so its refresh token can no longer be used
+	if claims.SessionID != "" {
+		if err := revokeSession(ac.DB, claims.SessionID, "logout"); err != nil {
+			log.Printf("Failed to revoke session: %v", err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to logout"})
+		}
+	}
+
 	log.Printf("User logged out: %s (token blacklisted)", userObj.Username)
 
 	return c.JSON(fiber.Map{
@@ -130,40 +268,94 @@ func (ac *AuthController) Logout(c *fiber.Ctx) error {
 	})
 }
 
-// Register endpoint
+// RegistrationInfo tells clients which registration mode is active
+func (ac *AuthController) RegistrationInfo(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"mode": config.GetRegistrationMode(),
+	})
+}
+
+// Register endpoint. Depending on REGISTRATION_MODE registration is disabled, requires
+// an invitation (the role comes from the invitation) or is open and creates a viewer.
 func (ac *AuthController) Register(c *fiber.Ctx) error {
 	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		Role     string `json:"role"`
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		Role        string `json:"role"`
+		InviteToken string `json:"invite_token"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
+	mode := config.GetRegistrationMode()
+	if mode == config.RegistrationDisabled || !config.LocalLoginEnabled() {
+		return c.Status(403).JSON(fiber.Map{"error": "Registration is disabled"})
+	}
+
+	// Roles are granted by invitations or admins, never chosen by the client
+	if req.Role != "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Role cannot be set during registration"})
+	}
+
 	// Validate input
 	if req.Username == "" || req.Password == "" {
 		return c.Status(400).JSON(fiber.Map{"error": "Username and password are required"})
 	}
 
-	if req.Role == "" {
-		req.Role = "user" // Default role
+	if mode == config.RegistrationInviteOnly && req.InviteToken == "" {
+		return c.Status(403).JSON(fiber.Map{"error": "An invitation is required to register"})
 	}
 
 	// Hash password
-	hashedPassword, err := ac.hashPassword(req.Password)
+	hashedPassword, err := hashPassword(req.Password)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not hash password"})
 	}
 
+	tx, err := ac.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	// Open registration creates a viewer of the registration team
+	role := "user"
+	var teamID sql.NullInt64
+	teamRole := models.TeamRoleViewer
+	var invitationID int
+
+	if req.InviteToken != "" {
+		var invitationTeamRole sql.NullString
+		err = tx.QueryRow(`
+			SELECT id, role, team_id, team_role FROM invitations
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+			FOR UPDATE`, utils.HashToken(req.InviteToken)).
+			Scan(&invitationID, &role, &teamID, &invitationTeamRole)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.Status(403).JSON(fiber.Map{"error": "Invalid or expired invitation"})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+		}
+		if invitationTeamRole.Valid {
+			teamRole = invitationTeamRole.String
+		}
+	} else {
+		err = tx.QueryRow(`SELECT id FROM teams WHERE name = $1`, config.GetRegistrationTeam()).Scan(&teamID)
+		if err != nil && err != sql.ErrNoRows {
+			return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+		}
+	}
+
 	// Insert user into database
 	var user models.User
-	err = ac.DB.QueryRow(`
+	err = tx.QueryRow(`
 		INSERT INTO users (username, password, role, is_active, created_at, updated_at)
 		VALUES ($1, $2, $3, true, NOW(), NOW())
 		RETURNING id, username, role, is_active, created_at, updated_at`,
-		req.Username, hashedPassword, req.Role).
+		req.Username, hashedPassword, role).
 		Scan(&user.ID, &user.Username, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
@@ -173,61 +365,58 @@ func (ac *AuthController) Register(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not create user"})
 	}
 
-	// Generate JWT token
-	token, err := ac.generateJWT(user)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not generate token"})
+	if teamID.Valid {
+		_, err = tx.Exec(`
+			INSERT INTO team_members (team_id, user_id, role, created_at)
+			VALUES ($1, $2, $3, NOW())`, teamID.Int64, user.ID, teamRole)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not add user to team"})
+		}
 	}
 
-	return c.Status(201).JSON(models.LoginResponse{
-		Token: token,
-		User:  user,
-	})
-}
-
-// Generate JWT token
-func (ac *AuthController) generateJWT(user models.User) (string, error) {
-	// Generate unique JTI (JWT ID)
-	jti, err := ac.generateJTI()
-	if err != nil {
-		return "", err
+	if invitationID != 0 {
+		_, err = tx.Exec(`
+			UPDATE invitations SET used_at = NOW(), used_by = $1
+			WHERE id = $2`, user.ID, invitationID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not redeem invitation"})
+		}
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
-
-	claims := models.JWTClaims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Role:     user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ID:        jti,
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create user"})
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(config.GetJWTSecret())
-}
+	log.Printf("User registered: %s (role %s)", user.Username, user.Role)
 
-// Generate unique JTI (JWT ID)
-func (ac *AuthController) generateJTI() (string, error) {
-	bytes := make([]byte, 16)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
+	// Open a session and issue access + refresh tokens
+	response, err := startSession(ac.DB, c, user)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Could not generate token"})
 	}
-	return hex.EncodeToString(bytes), nil
+
+	return c.Status(201).JSON(response)
 }
 
 // Hash password
-func (ac *AuthController) hashPassword(password string) (string, error) {
+func hashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
 }
 
 // Check password
-func (ac *AuthController) checkPassword(password, hash string) bool {
+func checkPassword(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// tooManyAttempts answers a throttled login with 429 and a Retry-After header in seconds
+func tooManyAttempts(c *fiber.Ctx, retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Set("Retry-After", strconv.Itoa(seconds))
+	return c.Status(429).JSON(fiber.Map{
+		"error":       "Too many login attempts, please try again later",
+		"retry_after": seconds,
+	})
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestCheckRefreshToken(t *testing.T) {
+	now := time.Now()
+	used := sql.NullTime{Time: now.Add(-time.Minute), Valid: true}
+	unset := sql.NullTime{}
+	valid := now.Add(time.Hour)
+
+	tests := []struct {
+		name            string
+		usedAt, revoked sql.NullTime
+		expiresAt       time.Time
+		accountRevoked  bool
+		active          bool
+		want            refreshCheck
+	}{
+		{"unused token of a live session", unset, unset, valid, false, true, refreshAllowed},
+		{"used token of a live session", used, unset, valid, false, true, refreshReused},
+		{"used token, expired as well", used, unset, now.Add(-time.Hour), false, true, refreshReused},
+		{"used token of a revoked session", used, used, valid, false, true, refreshRejected},
+		{"unused token of a revoked session", unset, used, valid, false, true, refreshRejected},
+		{"expired token", unset, unset, now.Add(-time.Second), false, true, refreshRejected},
+		{"tokens of the account revoked", unset, unset, valid, true, true, refreshRejected},
+		{"deactivated account", unset, unset, valid, false, false, refreshRejected},
+	}
+	for _, tt := range tests {
+		got := checkRefreshToken(tt.usedAt, tt.revoked, tt.expiresAt, tt.accountRevoked, tt.active, now)
+		if got != tt.want {
+			t.Errorf("%s: checkRefreshToken = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// secretMask replaces stored secrets in responses. Sending it back on update keeps the stored value.
+const secretMask = "********"
+
+type AuthProfileController struct {
+	DB      *sql.DB
+	Monitor *services.MonitorService
+}
+
+func NewAuthProfileController(db *sql.DB, monitor *services.MonitorService) *AuthProfileController {
+	return &AuthProfileController{
+		DB:      db,
+		Monitor: monitor,
+	}
+}
+
+// GetAuthProfiles retrieves the auth profiles of the user's teams with secrets masked
+func (ac *AuthProfileController) GetAuthProfiles(c *fiber.Ctx) error {
+	query := services.AuthProfileSelect
+	scope, args := services.TeamScope(currentUser(c), "team_id", models.TeamRoleViewer, 1)
+	if scope != "" {
+		query += " WHERE " + scope
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := ac.DB.Query(query, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch auth profiles",
+		})
+	}
+	defer rows.Close()
+
+	profiles := []models.AuthProfile{}
+	for rows.Next() {
+		profile, err := services.ScanAuthProfile(rows)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to scan auth profile data",
+			})
+		}
+		profiles = append(profiles, maskAuthProfile(profile))
+	}
+
+	return c.JSON(fiber.Map{
+		"data": profiles,
+	})
+}
+
+// CreateAuthProfile creates a new auth profile
+func (ac *AuthProfileController) CreateAuthProfile(c *fiber.Ctx) error {
+	var profile models.AuthProfile
+	if err := c.BodyParser(&profile); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if msg := validateAuthProfile(profile); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	teamID, ok, err := resolveTeam(c, ac.DB, profile.TeamID)
+	if !ok {
+		return err
+	}
+	profile.TeamID = &teamID
+
+	configJSON, err := services.EncodeAuthProfileConfig(profile.Config)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to encrypt auth profile secrets"})
+	}
+
+	err = ac.DB.QueryRow(`
+		INSERT INTO auth_profiles (name, type, config, is_active, team_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING id, created_at, updated_at`,
+		profile.Name, profile.Type, configJSON, profile.IsActive, profile.TeamID,
+	).Scan(&profile.ID, &profile.CreatedAt, &profile.UpdatedAt)
+
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{"error": "Auth profile name already exists"})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create auth profile",
+		})
+	}
+
+	recordChange(c, ac.DB, "auth_profile.create", "auth_profile", profile.ID, nil, auditSnapshot(ac.DB, "auth_profiles", profile.ID))
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "Auth profile created successfully",
+		"data":    maskAuthProfile(profile),
+	})
+}
+
+// UpdateAuthProfile updates an existing auth profile
+func (ac *AuthProfileController) UpdateAuthProfile(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid auth profile ID"})
+	}
+
+	currentTeamID, ok, err := authorizeTeamRow(c, ac.DB, "auth_profiles", id, models.TeamRoleEditor, "Auth profile not found")
+	if !ok {
+		return err
+	}
+
+	existing, err := services.FindAuthProfile(ac.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "Auth profile not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch auth profile"})
+	}
+	before := auditSnapshot(ac.DB, "auth_profiles", id)
+
+	var profile models.AuthProfile
+	if err := c.BodyParser(&profile); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Keep stored secrets the client only saw masked
+	profile.Config.ClientSecret = unmask(profile.Config.ClientSecret, existing.Config.ClientSecret)
+	profile.Config.RefreshToken = unmask(profile.Config.RefreshToken, existing.Config.RefreshToken)
+	profile.Config.Password = unmask(profile.Config.Password, existing.Config.Password)
+	profile.Config.KeyValue = unmask(profile.Config.KeyValue, existing.Config.KeyValue)
+
+	if msg := validateAuthProfile(profile); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	if profile.TeamID, ok, err = moveTeam(c, ac.DB, id, currentTeamID, profile.TeamID, "auth_profile_id"); !ok {
+		return err
+	}
+
+	configJSON, err := services.EncodeAuthProfileConfig(profile.Config)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to encrypt auth profile secrets"})
+	}
+
+	err = ac.DB.QueryRow(`
+		UPDATE auth_profiles
+		SET name = $1, type = $2, config = $3, is_active = $4, team_id = $5, updated_at = NOW()
+		WHERE id = $6
+		RETURNING id, created_at, updated_at`,
+		profile.Name, profile.Type, configJSON, profile.IsActive, profile.TeamID, id,
+	).Scan(&profile.ID, &profile.CreatedAt, &profile.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "Auth profile not found"})
+		}
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{"error": "Auth profile name already exists"})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update auth profile",
+		})
+	}
+
+	ac.Monitor.Tokens.Invalidate(id)
+	recordChange(c, ac.DB, "auth_profile.update", "auth_profile", id, before, auditSnapshot(ac.DB, "auth_profiles", id))
+
+	return c.JSON(fiber.Map{
+		"message": "Auth profile updated successfully",
+		"data":    maskAuthProfile(profile),
+	})
+}
+
+// DeleteAuthProfile deletes an auth profile; endpoints using it keep running without credentials
+func (ac *AuthProfileController) DeleteAuthProfile(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid auth profile ID"})
+	}
+
+	if _, ok, err := authorizeTeamRow(c, ac.DB, "auth_profiles", id, models.TeamRoleEditor, "Auth profile not found"); !ok {
+		return err
+	}
+
+	before := auditSnapshot(ac.DB, "auth_profiles", id)
+	result, err := ac.DB.Exec("DELETE FROM auth_profiles WHERE id = $1", id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to delete auth profile",
+		})
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to verify deletion",
+		})
+	}
+
+	if rowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Auth profile not found",
+		})
+	}
+
+	ac.Monitor.Tokens.Invalidate(id)
+	recordChange(c, ac.DB, "auth_profile.delete", "auth_profile", id, before, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Auth profile deleted successfully",
+	})
+}
+
+func validateAuthProfile(profile models.AuthProfile) string {
+	if profile.Name == "" {
+		return "Name is required"
+	}
+
+	cfg := profile.Config
+	switch profile.Type {
+	case models.AuthTypeOAuth2ClientCredentials:
+		if cfg.TokenURL == "" || cfg.ClientID == "" {
+			return "token_url and client_id are required for OAuth2 client credentials"
+		}
+	case models.AuthTypeOAuth2RefreshToken:
+		if cfg.TokenURL == "" || cfg.RefreshToken == "" {
+			return "token_url and refresh_token are required for OAuth2 refresh token"
+		}
+	case models.AuthTypeBasic:
+		if cfg.Username == "" {
+			return "username is required for basic auth"
+		}
+	case models.AuthTypeAPIKey:
+		if cfg.KeyName == "" || cfg.KeyValue == "" {
+			return "key_name and key_value are required for API key auth"
+		}
+		if cfg.KeyIn != "" && cfg.KeyIn != "header" && cfg.KeyIn != "query" {
+			return "key_in must be header or query"
+		}
+	default:
+		return "Type must be one of oauth2_client_credentials, oauth2_refresh_token, basic, api_key"
+	}
+
+	return ""
+}
+
+func maskAuthProfile(profile models.AuthProfile) models.AuthProfile {
+	profile.Config.ClientSecret = mask(profile.Config.ClientSecret)
+	profile.Config.RefreshToken = mask(profile.Config.RefreshToken)
+	profile.Config.Password = mask(profile.Config.Password)
+	profile.Config.KeyValue = mask(profile.Config.KeyValue)
+	return profile
+}
+
+func mask(value string) string {
+	if value == "" {
+		return ""
+	}
+	return secretMask
+}
+
+func unmask(value, stored string) string {
+	if value == secretMask {
+		return stored
+	}
+	return value
+}
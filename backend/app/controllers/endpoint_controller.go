@@ -3,14 +3,21 @@ package controllers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"api-monitor/app/models"
 	"api-monitor/app/services"
+	"api-monitor/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
 )
 
+const invalidKeyMessage = "key may only contain lower case letters, digits, '.', '-' and '_' (at most 100 characters)"
+
 type EndpointController struct {
 	DB      *sql.DB
 	Monitor *services.MonitorService
@@ -23,15 +30,53 @@ func NewEndpointController(db *sql.DB, monitor *services.MonitorService) *Endpoi
 	}
 }
 
+// GetEndpoints lists the endpoints the user can see. Filters: ids (comma separated),
+// team_id, selector (label selector such as "env=prod,!deprecated"), group (includes
+// subgroups), q (part of the name, key or URL) and is_active. sort takes a column name,
+// "-" for descending (default "-created_at"). Without a limit every match is returned.
 func (ec *EndpointController) GetEndpoints(c *fiber.Ctx) error {
-	query := `
-		SELECT id, name, url, method, headers, body, timeout_seconds, 
-		       check_interval_seconds, is_active, proxy_id, created_at, updated_at
-		FROM api_endpoints 
-		ORDER BY created_at DESC
-	`
+	filter, err := endpointFilterFromQuery(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	orderBy, err := services.EndpointOrderBy(c.Query("sort", "-created_at"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	limit := c.QueryInt("limit", 0)
+	offset := c.QueryInt("offset", 0)
+	if limit > 500 {
+		limit = 500
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	whereClause, args, err := endpointWhere(c, filter, models.TeamRoleViewer)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var totalCount int
+	err = ec.DB.QueryRow("SELECT COUNT(*) FROM api_endpoints e "+whereClause, args...).Scan(&totalCount)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to count endpoints",
+		})
+	}
+
+	query := services.EndpointSelect + " " + whereClause + " ORDER BY " + orderBy
+	if limit > 0 {
+		query += " LIMIT $" + strconv.Itoa(len(args)+1) + " OFFSET $" + strconv.Itoa(len(args)+2)
+		args = append(args, limit, offset)
+	}
 
-	rows, err := ec.DB.Query(query)
+	rows, err := ec.DB.Query(query, args...)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to fetch endpoints",
@@ -41,51 +86,85 @@ func (ec *EndpointController) GetEndpoints(c *fiber.Ctx) error {
 
 	var endpoints []models.APIEndpoint
 	for rows.Next() {
-		var endpoint models.APIEndpoint
-		var proxyID sql.NullInt64
-		var headersJSON sql.NullString
-
-		err := rows.Scan(
-			&endpoint.ID,
-			&endpoint.Name,
-			&endpoint.URL,
-			&endpoint.Method,
-			&headersJSON,
-			&endpoint.Body,
-			&endpoint.TimeoutSeconds,
-			&endpoint.CheckIntervalSeconds,
-			&endpoint.IsActive,
-			&proxyID,
-			&endpoint.CreatedAt,
-			&endpoint.UpdatedAt,
-		)
+		endpoint, err := services.ScanEndpoint(rows)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{
 				"error": "Failed to scan endpoint data: " + err.Error(),
 			})
 		}
 
-		// Handle headers JSON
-		endpoint.Headers = make(map[string]string)
-		if headersJSON.Valid && headersJSON.String != "" {
-			// Try to parse JSON headers
-			if err := json.Unmarshal([]byte(headersJSON.String), &endpoint.Headers); err != nil {
-				// If JSON parsing fails, initialize empty map
-				endpoint.Headers = make(map[string]string)
-			}
-		}
+		// Proxy credentials are served by the proxy API only
+		endpoint.Proxy = nil
+
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":   endpoints,
+		"total":  totalCount,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// GetEndpointGroups lists the groups in use with the number of endpoints directly in each
+func (ec *EndpointController) GetEndpointGroups(c *fiber.Ctx) error {
+	whereClause, args, err := endpointWhere(c, services.EndpointFilter{TeamID: queryTeamID(c)}, models.TeamRoleViewer)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rows, err := ec.DB.Query(`
+		SELECT e.group_path, COUNT(*) FROM api_endpoints e `+whereClause+`
+		GROUP BY e.group_path
+		ORDER BY e.group_path`, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint groups"})
+	}
+	defer rows.Close()
 
-		// Handle proxy ID
-		if proxyID.Valid {
-			proxyIDInt := int(proxyID.Int64)
-			endpoint.ProxyID = &proxyIDInt
+	groups := []fiber.Map{}
+	for rows.Next() {
+		var group string
+		var count int
+		if err := rows.Scan(&group, &count); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan endpoint groups"})
 		}
+		groups = append(groups, fiber.Map{"group": group, "endpoints": count})
+	}
 
-		endpoints = append(endpoints, endpoint)
+	return c.JSON(fiber.Map{
+		"data": groups,
+	})
+}
+
+// GetEndpointLabels lists the label keys in use with their values, for building selectors
+func (ec *EndpointController) GetEndpointLabels(c *fiber.Ctx) error {
+	whereClause, args, err := endpointWhere(c, services.EndpointFilter{TeamID: queryTeamID(c)}, models.TeamRoleViewer)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rows, err := ec.DB.Query(`
+		SELECT DISTINCT label.key, label.value
+		FROM api_endpoints e, jsonb_each_text(e.labels) AS label `+whereClause+`
+		ORDER BY label.key, label.value`, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint labels"})
+	}
+	defer rows.Close()
+
+	labels := map[string][]string{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan endpoint labels"})
+		}
+		labels[key] = append(labels[key], value)
 	}
 
 	return c.JSON(fiber.Map{
-		"data": endpoints,
+		"data": labels,
 	})
 }
 
@@ -96,62 +175,76 @@ func (ec *EndpointController) CreateEndpoint(c *fiber.Ctx) error {
 	}
 
 	// Validate required fields
-	if endpoint.Name == "" || endpoint.URL == "" {
+	if ok, err := validateEndpointType(c, &endpoint); !ok {
+		return err
+	}
+	if ok, err := ec.validateResponseSchema(c, &endpoint); !ok {
+		return err
+	}
+	if endpoint.Name == "" || (endpoint.URL == "" && endpoint.Type == models.EndpointTypeHTTP) {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Name and URL are required",
 		})
 	}
 
-	// Convert headers map to JSON string
-	var headersJSON string
-	if len(endpoint.Headers) > 0 {
-		headersBytes, err := json.Marshal(endpoint.Headers)
-		if err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid headers format",
-			})
-		}
-		headersJSON = string(headersBytes)
-	} else {
-		headersJSON = "{}"
+	teamID, ok, err := resolveTeam(c, ec.DB, endpoint.TeamID)
+	if !ok {
+		return err
 	}
+	endpoint.TeamID = &teamID
 
-	query := `
-		INSERT INTO api_endpoints (name, url, method, headers, body, timeout_seconds, 
-		                          check_interval_seconds, is_active, proxy_id, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
-		RETURNING id, created_at, updated_at
-	`
+	if ok, err := ec.authorizeReferences(c, &endpoint, teamID); !ok {
+		return err
+	}
 
-	var proxyID interface{}
-	if endpoint.ProxyID != nil {
-		proxyID = *endpoint.ProxyID
+	if ok, err := validateEndpointLabels(c, &endpoint); !ok {
+		return err
 	}
 
-	err := ec.DB.QueryRow(
-		query,
-		endpoint.Name,
-		endpoint.URL,
-		endpoint.Method,
-		headersJSON,
-		endpoint.Body,
-		endpoint.TimeoutSeconds,
-		endpoint.CheckIntervalSeconds,
-		endpoint.IsActive,
-		proxyID,
-	).Scan(&endpoint.ID, &endpoint.CreatedAt, &endpoint.UpdatedAt)
+	if endpoint.Key == "" {
+		endpoint.Key, err = services.UniqueEndpointKey(ec.DB, teamID, services.Slugify(endpoint.Name))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+		}
+	} else if !services.ValidEndpointKey(endpoint.Key) {
+		return c.Status(400).JSON(fiber.Map{"error": invalidKeyMessage})
+	}
 
+	tx, err := ec.DB.Begin()
 	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if err := insertEndpointRow(tx, &endpoint); err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{"error": "Another endpoint of the team already uses this key"})
+		}
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to create endpoint: " + err.Error(),
 		})
 	}
 
+	endpoint.Version, err = services.RecordEndpointVersion(tx, endpoint.ID, currentUser(c), models.EndpointChangeCreate, nil)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save endpoint version"})
+	}
+
+	if err := issuePingToken(c, tx, &endpoint, false); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to issue ping URL"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
 	// Schedule the endpoint for monitoring if it's active
 	if endpoint.IsActive {
-		ec.Monitor.ScheduleEndpoint(endpoint)
+		ec.scheduleEndpoint(endpoint)
 	}
 
+	recordChange(c, ec.DB, "endpoint.create", "endpoint", endpoint.ID, nil, auditSnapshot(ec.DB, "api_endpoints", endpoint.ID))
+
 	return c.Status(201).JSON(fiber.Map{
 		"message": "Endpoint created successfully",
 		"data":    endpoint,
@@ -165,78 +258,98 @@ func (ec *EndpointController) UpdateEndpoint(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
 	}
 
+	currentTeamID, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleEditor)
+	if !ok {
+		return err
+	}
+	before := auditSnapshot(ec.DB, "api_endpoints", endpointID)
+
 	var endpoint models.APIEndpoint
 	if err := c.BodyParser(&endpoint); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	// Validate required fields
-	if endpoint.Name == "" || endpoint.URL == "" {
+	if ok, err := validateEndpointType(c, &endpoint); !ok {
+		return err
+	}
+	if ok, err := ec.validateResponseSchema(c, &endpoint); !ok {
+		return err
+	}
+	if endpoint.Name == "" || (endpoint.URL == "" && endpoint.Type == models.EndpointTypeHTTP) {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Name and URL are required",
 		})
 	}
 
-	// Convert headers map to JSON string
-	var headersJSON string
-	if len(endpoint.Headers) > 0 {
-		headersBytes, err := json.Marshal(endpoint.Headers)
-		if err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid headers format",
-			})
-		}
-		headersJSON = string(headersBytes)
-	} else {
-		headersJSON = "{}"
+	if endpoint.Key != "" && !services.ValidEndpointKey(endpoint.Key) {
+		return c.Status(400).JSON(fiber.Map{"error": invalidKeyMessage})
 	}
 
-	query := `
-		UPDATE api_endpoints 
-		SET name = $1, url = $2, method = $3, headers = $4, body = $5, 
-		    timeout_seconds = $6, check_interval_seconds = $7, is_active = $8, 
-		    proxy_id = $9, updated_at = NOW()
-		WHERE id = $10
-		RETURNING id, created_at, updated_at
-	`
+	if ok, err := validateEndpointLabels(c, &endpoint); !ok {
+		return err
+	}
 
-	var proxyID interface{}
-	if endpoint.ProxyID != nil {
-		proxyID = *endpoint.ProxyID
+	// Moving an endpoint requires edit rights on the destination team as well
+	if endpoint.TeamID == nil && currentTeamID.Valid {
+		teamID := int(currentTeamID.Int64)
+		endpoint.TeamID = &teamID
+	} else if endpoint.TeamID != nil && (!currentTeamID.Valid || int(currentTeamID.Int64) != *endpoint.TeamID) {
+		teamID, ok, err := resolveTeam(c, ec.DB, endpoint.TeamID)
+		if !ok {
+			return err
+		}
+		endpoint.TeamID = &teamID
 	}
 
-	err = ec.DB.QueryRow(
-		query,
-		endpoint.Name,
-		endpoint.URL,
-		endpoint.Method,
-		headersJSON,
-		endpoint.Body,
-		endpoint.TimeoutSeconds,
-		endpoint.CheckIntervalSeconds,
-		endpoint.IsActive,
-		proxyID,
-		endpointID,
-	).Scan(&endpoint.ID, &endpoint.CreatedAt, &endpoint.UpdatedAt)
+	if endpoint.TeamID != nil {
+		if ok, err := ec.authorizeReferences(c, &endpoint, *endpoint.TeamID); !ok {
+			return err
+		}
+	}
 
+	tx, err := ec.DB.Begin()
 	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if err := updateEndpointRow(tx, endpointID, &endpoint); err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(404).JSON(fiber.Map{
 				"error": "Endpoint not found",
 			})
 		}
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{"error": "Another endpoint of the team already uses this key"})
+		}
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to update endpoint",
 		})
 	}
 
+	endpoint.Version, err = services.RecordEndpointVersion(tx, endpointID, currentUser(c), models.EndpointChangeUpdate, nil)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save endpoint version"})
+	}
+
+	if err := issuePingToken(c, tx, &endpoint, false); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to issue ping URL"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
 	// Update monitoring schedule
 	if endpoint.IsActive {
-		ec.Monitor.ScheduleEndpoint(endpoint)
+		ec.scheduleEndpoint(endpoint)
 	} else {
 		ec.Monitor.UnscheduleEndpoint(endpoint.ID)
 	}
 
+	recordChange(c, ec.DB, "endpoint.update", "endpoint", endpointID, before, auditSnapshot(ec.DB, "api_endpoints", endpointID))
+
 	return c.JSON(fiber.Map{
 		"message": "Endpoint updated successfully",
 		"data":    endpoint,
@@ -250,6 +363,11 @@ func (ec *EndpointController) DeleteEndpoint(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
 	}
 
+	if _, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleEditor); !ok {
+		return err
+	}
+	before := auditSnapshot(ec.DB, "api_endpoints", endpointID)
+
 	query := "DELETE FROM api_endpoints WHERE id = $1"
 	result, err := ec.DB.Exec(query, endpointID)
 	if err != nil {
@@ -274,6 +392,8 @@ func (ec *EndpointController) DeleteEndpoint(c *fiber.Ctx) error {
 	// Unschedule the endpoint from monitoring
 	ec.Monitor.UnscheduleEndpoint(endpointID)
 
+	recordChange(c, ec.DB, "endpoint.delete", "endpoint", endpointID, before, nil)
+
 	return c.Status(200).JSON(fiber.Map{
 		"message": "Endpoint deleted successfully",
 	})
@@ -286,6 +406,11 @@ func (ec *EndpointController) ToggleEndpoint(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
 	}
 
+	if _, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleEditor); !ok {
+		return err
+	}
+	before := auditSnapshot(ec.DB, "api_endpoints", endpointID)
+
 	query := `
 		UPDATE api_endpoints 
 		SET is_active = NOT is_active, updated_at = NOW()
@@ -309,34 +434,15 @@ func (ec *EndpointController) ToggleEndpoint(c *fiber.Ctx) error {
 	// Update monitoring schedule based on new status
 	if isActive {
 		// Get the full endpoint data to schedule it
-		var endpoint models.APIEndpoint
-		endpointQuery := `
-			SELECT id, name, url, method, COALESCE(headers, '{}'), COALESCE(body, ''), 
-			       timeout_seconds, check_interval_seconds, is_active, proxy_id
-			FROM api_endpoints WHERE id = $1`
-
-		var headersJSON string
-		var proxyID sql.NullInt64
-
-		err = ec.DB.QueryRow(endpointQuery, endpointID).Scan(
-			&endpoint.ID, &endpoint.Name, &endpoint.URL, &endpoint.Method,
-			&headersJSON, &endpoint.Body, &endpoint.TimeoutSeconds,
-			&endpoint.CheckIntervalSeconds, &endpoint.IsActive, &proxyID)
-
-		if err == nil {
-			// Parse headers
-			json.Unmarshal([]byte(headersJSON), &endpoint.Headers)
-			if proxyID.Valid {
-				proxyIDInt := int(proxyID.Int64)
-				endpoint.ProxyID = &proxyIDInt
-			}
-
+		if endpoint, err := services.FindEndpoint(ec.DB, endpointID); err == nil {
 			ec.Monitor.ScheduleEndpoint(endpoint)
 		}
 	} else {
 		ec.Monitor.UnscheduleEndpoint(endpointID)
 	}
 
+	recordChange(c, ec.DB, "endpoint.toggle", "endpoint", endpointID, before, auditSnapshot(ec.DB, "api_endpoints", endpointID))
+
 	return c.Status(200).JSON(fiber.Map{
 		"message": "Endpoint status toggled successfully",
 		"data": fiber.Map{
@@ -354,6 +460,10 @@ func (ec *EndpointController) GetEndpointLogs(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
 	}
 
+	if _, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleViewer); !ok {
+		return err
+	}
+
 	// Parse query parameters
 	limit := c.QueryInt("limit", 25)
 	offset := c.QueryInt("offset", 0)
@@ -361,6 +471,9 @@ func (ec *EndpointController) GetEndpointLogs(c *fiber.Ctx) error {
 	endDate := c.Query("end_date", "")
 	minResponseTime := c.Query("min_response_time", "")
 	statusCode := c.Query("status_code", "")
+	version := c.Query("version", "")
+	checkStatus := c.Query("status", "")
+	schemaValid := c.Query("schema_valid", "")
 
 	// Validate limit
 	if limit > 100 {
@@ -411,6 +524,27 @@ func (ec *EndpointController) GetEndpointLogs(c *fiber.Ctx) error {
 		}
 	}
 
+	if version != "" {
+		if v, err := strconv.Atoi(version); err == nil {
+			whereConditions = append(whereConditions, "endpoint_version = $"+strconv.Itoa(argIndex))
+			args = append(args, v)
+			argIndex++
+		}
+	}
+
+	if checkStatus != "" {
+		whereConditions = append(whereConditions, services.CheckStatusExpression+" = $"+strconv.Itoa(argIndex))
+		args = append(args, checkStatus)
+		argIndex++
+	}
+
+	// Only checks whose response was validated against a schema
+	if schemaValid == "true" {
+		whereConditions = append(whereConditions, "jsonb_array_length(schema_errors) = 0")
+	} else if schemaValid == "false" {
+		whereConditions = append(whereConditions, "jsonb_array_length(schema_errors) > 0")
+	}
+
 	whereClause := ""
 	if len(whereConditions) > 0 {
 		whereClause = "WHERE "
@@ -423,7 +557,7 @@ func (ec *EndpointController) GetEndpointLogs(c *fiber.Ctx) error {
 	}
 
 	// Get total count
-	countQuery := "SELECT COUNT(*) FROM api_check_logs " + whereClause
+	countQuery := "SELECT COUNT(*) FROM api_check_logs l " + whereClause
 	var totalCount int
 	err = ec.DB.QueryRow(countQuery, args...).Scan(&totalCount)
 	if err != nil {
@@ -434,9 +568,9 @@ func (ec *EndpointController) GetEndpointLogs(c *fiber.Ctx) error {
 
 	// Get logs with pagination
 	query := `
-		SELECT id, endpoint_id, status_code, response_time_ms, response_body, 
-		       response_headers, error_message, checked_at
-		FROM api_check_logs ` + whereClause + `
+		SELECT id, endpoint_id, endpoint_version, status_code, response_time_ms, response_body, 
+		       response_headers, error_message, ` + services.CheckStatusExpression + `, blocked_by, schema_errors, response_capture_id, details, checked_at
+		FROM api_check_logs l ` + whereClause + `
 		ORDER BY checked_at DESC
 		LIMIT $` + strconv.Itoa(argIndex) + ` OFFSET $` + strconv.Itoa(argIndex+1)
 
@@ -453,16 +587,23 @@ func (ec *EndpointController) GetEndpointLogs(c *fiber.Ctx) error {
 	var logs []models.APICheckLog
 	for rows.Next() {
 		var log models.APICheckLog
-		var statusCode, responseTimeMs sql.NullInt64
+		var endpointVersion, statusCode, responseTimeMs, blockedBy, captureID sql.NullInt64
+		var schemaErrors, details []byte
 
 		err := rows.Scan(
 			&log.ID,
 			&log.EndpointID,
+			&endpointVersion,
 			&statusCode,
 			&responseTimeMs,
 			&log.ResponseBody,
 			&log.ResponseHeaders,
 			&log.ErrorMessage,
+			&log.Status,
+			&blockedBy,
+			&schemaErrors,
+			&captureID,
+			&details,
 			&log.CheckedAt,
 		)
 		if err != nil {
@@ -471,12 +612,30 @@ func (ec *EndpointController) GetEndpointLogs(c *fiber.Ctx) error {
 			})
 		}
 
+		if endpointVersion.Valid {
+			v := int(endpointVersion.Int64)
+			log.EndpointVersion = &v
+		}
 		if statusCode.Valid {
 			log.StatusCode = int(statusCode.Int64)
 		}
 		if responseTimeMs.Valid {
 			log.ResponseTimeMs = int(responseTimeMs.Int64)
 		}
+		if blockedBy.Valid {
+			id := int(blockedBy.Int64)
+			log.BlockedBy = &id
+		}
+		if len(schemaErrors) > 0 {
+			json.Unmarshal(schemaErrors, &log.SchemaErrors)
+		}
+		if captureID.Valid {
+			id := int(captureID.Int64)
+			log.ResponseCaptureID = &id
+		}
+		if len(details) > 0 {
+			json.Unmarshal(details, &log.Details)
+		}
 
 		logs = append(logs, log)
 	}
@@ -488,3 +647,1380 @@ func (ec *EndpointController) GetEndpointLogs(c *fiber.Ctx) error {
 		"offset": offset,
 	})
 }
+
+// GetCheckResponse returns the full response stored for a check log. With ?raw=true the
+// body is downloaded as is, with the content type of the response when it was captured.
+func (ec *EndpointController) GetCheckResponse(c *fiber.Ctx) error {
+	endpointID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
+	}
+	logID, err := strconv.Atoi(c.Params("logId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid log ID"})
+	}
+
+	if _, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleViewer); !ok {
+		return err
+	}
+
+	response, err := services.FindStoredResponse(ec.DB, endpointID, logID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "No response was stored for this check"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch stored response"})
+	}
+
+	if c.QueryBool("raw") {
+		var headers map[string]string
+		json.Unmarshal([]byte(response.Headers), &headers)
+		contentType := headers["Content-Type"]
+		if contentType == "" {
+			contentType = fiber.MIMETextPlainCharsetUTF8
+		}
+		// A download, so captured HTML is never rendered on the API's origin
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		c.Attachment(fmt.Sprintf("check-%d-response", logID))
+		return c.SendString(response.Body)
+	}
+
+	return c.JSON(fiber.Map{
+		"data": response,
+	})
+}
+
+// GetEndpointUptime summarizes the checks of an endpoint between start_date and end_date
+// (default the last 24 hours). Blocked checks and auth errors are counted but left out of
+// the uptime: the endpoint was unreachable because a dependency was down, or was not
+// requested because its credentials could not be acquired.
+func (ec *EndpointController) GetEndpointUptime(c *fiber.Ctx) error {
+	endpointID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
+	}
+
+	if _, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleViewer); !ok {
+		return err
+	}
+
+	var startDate, endDate interface{} = time.Now().Add(-24 * time.Hour), time.Now()
+	if value := c.Query("start_date"); value != "" {
+		startDate = value
+	}
+	if value := c.Query("end_date"); value != "" {
+		endDate = value
+	}
+
+	var checks, up, down, blocked, authErrors int
+	var averageResponseTime sql.NullFloat64
+	err = ec.DB.QueryRow(`
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE status = 'up'),
+		       COUNT(*) FILTER (WHERE status = 'down'),
+		       COUNT(*) FILTER (WHERE status = 'blocked'),
+		       COUNT(*) FILTER (WHERE status = 'auth_error'),
+		       AVG(response_time_ms) FILTER (WHERE status = 'up')
+		FROM (
+			SELECT `+services.CheckStatusExpression+` AS status, l.response_time_ms
+			FROM api_check_logs l
+			WHERE l.endpoint_id = $1 AND l.checked_at >= $2 AND l.checked_at <= $3
+		) checks`, endpointID, startDate, endDate).Scan(&checks, &up, &down, &blocked, &authErrors, &averageResponseTime)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Failed to compute uptime, check start_date and end_date"})
+	}
+
+	var uptimePercent, averageResponseTimeMs interface{}
+	if up+down > 0 {
+		uptimePercent = float64(up) * 100 / float64(up+down)
+	}
+	if averageResponseTime.Valid {
+		averageResponseTimeMs = int(averageResponseTime.Float64)
+	}
+
+	return c.JSON(fiber.Map{
+		"data": fiber.Map{
+			"endpoint_id":          endpointID,
+			"start_date":           startDate,
+			"end_date":             endDate,
+			"checks":               checks,
+			"up":                   up,
+			"down":                 down,
+			"blocked":              blocked,
+			"auth_errors":          authErrors,
+			"uptime_percent":       uptimePercent,
+			"avg_response_time_ms": averageResponseTimeMs,
+		},
+	})
+}
+
+// GetEndpointContentChanges lists the content changed events of an endpoint, newest
+// first. ?change_type=shape only returns changes of the JSON shape.
+func (ec *EndpointController) GetEndpointContentChanges(c *fiber.Ctx) error {
+	endpointID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
+	}
+
+	if _, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleViewer); !ok {
+		return err
+	}
+
+	limit := c.QueryInt("limit", 25)
+	offset := c.QueryInt("offset", 0)
+	if limit > 100 {
+		limit = 100
+	}
+	if limit < 1 {
+		limit = 25
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	whereClause := "WHERE endpoint_id = $1"
+	args := []interface{}{endpointID}
+	switch changeType := c.Query("change_type"); changeType {
+	case "":
+	case models.ContentChangeShape, models.ContentChangeContent:
+		whereClause += " AND change_type = $2"
+		args = append(args, changeType)
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "change_type must be shape or content"})
+	}
+
+	var totalCount int
+	if err := ec.DB.QueryRow("SELECT COUNT(*) FROM content_changes "+whereClause, args...).Scan(&totalCount); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to count content changes"})
+	}
+
+	rows, err := ec.DB.Query(services.ContentChangeSelect+" "+whereClause+
+		" ORDER BY detected_at DESC, id DESC LIMIT "+strconv.Itoa(limit)+" OFFSET "+strconv.Itoa(offset), args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch content changes"})
+	}
+	defer rows.Close()
+
+	changes := []models.ContentChange{}
+	for rows.Next() {
+		change, err := services.ScanContentChange(rows)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan content change data"})
+		}
+		changes = append(changes, change)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":   changes,
+		"total":  totalCount,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// GetEndpointSnapshot returns the latest response snapshot of an endpoint, or the one
+// given by ?snapshot_id=, e.g. to show both sides of a content change
+func (ec *EndpointController) GetEndpointSnapshot(c *fiber.Ctx) error {
+	endpointID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
+	}
+
+	if _, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleViewer); !ok {
+		return err
+	}
+
+	var row *sql.Row
+	if c.Query("snapshot_id") != "" {
+		snapshotID, err := strconv.Atoi(c.Query("snapshot_id"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid snapshot ID"})
+		}
+		row = ec.DB.QueryRow(services.ResponseSnapshotSelect+`
+			WHERE endpoint_id = $1 AND id = $2`, endpointID, snapshotID)
+	} else {
+		row = ec.DB.QueryRow(services.ResponseSnapshotSelect+`
+			WHERE endpoint_id = $1 ORDER BY id DESC LIMIT 1`, endpointID)
+	}
+
+	snapshot, err := services.ScanResponseSnapshot(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "Response snapshot not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch response snapshot"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": snapshot,
+	})
+}
+
+// GetEndpointVersions lists the saved definitions of an endpoint, newest first, each with
+// the fields changed compared to the version before it
+func (ec *EndpointController) GetEndpointVersions(c *fiber.Ctx) error {
+	endpointID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
+	}
+
+	if _, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleViewer); !ok {
+		return err
+	}
+
+	limit := c.QueryInt("limit", 25)
+	offset := c.QueryInt("offset", 0)
+	if limit > 100 {
+		limit = 100
+	}
+	if limit < 1 {
+		limit = 25
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var totalCount, currentVersion int
+	err = ec.DB.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM endpoint_versions WHERE endpoint_id = $1), version
+		FROM api_endpoints WHERE id = $1`, endpointID).Scan(&totalCount, &currentVersion)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to count endpoint versions"})
+	}
+
+	// One extra row so the oldest version on the page can be compared with its predecessor
+	rows, err := ec.DB.Query(services.EndpointVersionSelect+`
+		WHERE endpoint_id = $1
+		ORDER BY version DESC
+		LIMIT $2 OFFSET $3`, endpointID, limit+1, offset)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint versions"})
+	}
+	defer rows.Close()
+
+	versions := []models.EndpointVersion{}
+	for rows.Next() {
+		version, err := services.ScanEndpointVersion(rows)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan endpoint version data"})
+		}
+		versions = append(versions, version)
+	}
+
+	for i := range versions {
+		if i+1 < len(versions) {
+			versions[i].Changes = services.DiffEndpointDefinitions(versions[i+1].Definition, versions[i].Definition)
+		}
+	}
+	if len(versions) > limit {
+		versions = versions[:limit]
+	}
+
+	return c.JSON(fiber.Map{
+		"data":            versions,
+		"current_version": currentVersion,
+		"total":           totalCount,
+		"limit":           limit,
+		"offset":          offset,
+	})
+}
+
+// GetEndpointVersion returns one version of an endpoint and its diff to another version,
+// by default the one before it (?compare=<version>)
+func (ec *EndpointController) GetEndpointVersion(c *fiber.Ctx) error {
+	endpointID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
+	}
+
+	versionNumber, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid version"})
+	}
+
+	if _, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleViewer); !ok {
+		return err
+	}
+
+	version, err := services.FindEndpointVersion(ec.DB, endpointID, versionNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "Endpoint version not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint version"})
+	}
+
+	compareNumber := c.QueryInt("compare", versionNumber-1)
+	response := fiber.Map{"data": version}
+
+	compare, err := services.FindEndpointVersion(ec.DB, endpointID, compareNumber)
+	switch {
+	case err == nil:
+		version.Changes = services.DiffEndpointDefinitions(compare.Definition, version.Definition)
+		response["data"] = version
+		response["compare"] = compareNumber
+	case err == sql.ErrNoRows:
+		if c.Query("compare") != "" {
+			return c.Status(404).JSON(fiber.Map{"error": "Endpoint version to compare with not found"})
+		}
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint version"})
+	}
+
+	return c.JSON(response)
+}
+
+// RestoreEndpointVersion makes an earlier definition current again. The restore is saved as
+// a new version, the endpoint keeps its active state and is rescheduled.
+func (ec *EndpointController) RestoreEndpointVersion(c *fiber.Ctx) error {
+	endpointID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
+	}
+
+	versionNumber, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid version"})
+	}
+
+	currentTeamID, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleEditor)
+	if !ok {
+		return err
+	}
+
+	version, err := services.FindEndpointVersion(ec.DB, endpointID, versionNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "Endpoint version not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint version"})
+	}
+
+	current, err := services.FindEndpoint(ec.DB, endpointID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint"})
+	}
+
+	definition := version.Definition
+	endpoint := models.APIEndpoint{
+		Name:                 definition.Name,
+		URL:                  definition.URL,
+		Method:               definition.Method,
+		Headers:              definition.Headers,
+		Body:                 definition.Body,
+		TimeoutSeconds:       definition.TimeoutSeconds,
+		CheckIntervalSeconds: definition.CheckIntervalSeconds,
+		IsActive:             current.IsActive,
+		ProxyID:              definition.ProxyID,
+		AuthProfileID:        definition.AuthProfileID,
+		TLSProfileID:         definition.TLSProfileID,
+		TeamID:               definition.TeamID,
+		Labels:               definition.Labels,
+		Group:                definition.Group,
+		Type:                 definition.Type,
+		GraceSeconds:         definition.GraceSeconds,
+	}
+	if endpoint.Type == "" {
+		endpoint.Type = models.EndpointTypeHTTP
+	}
+	if definition.ContentTracking != nil {
+		endpoint.ContentTracking = *definition.ContentTracking
+	}
+	if definition.ResponseCapture != nil {
+		endpoint.ResponseCapture = *definition.ResponseCapture
+	}
+	if definition.Transport != nil {
+		endpoint.Transport = *definition.Transport
+	}
+	endpoint.ResponseSchema = definition.ResponseSchema
+	endpoint.ResponseSchemaID = definition.ResponseSchemaID
+
+	// Going back to another team is a move and needs edit rights there as well
+	if endpoint.TeamID == nil && currentTeamID.Valid {
+		teamID := int(currentTeamID.Int64)
+		endpoint.TeamID = &teamID
+	} else if endpoint.TeamID != nil && (!currentTeamID.Valid || int(currentTeamID.Int64) != *endpoint.TeamID) {
+		teamID, ok, err := resolveTeam(c, ec.DB, endpoint.TeamID)
+		if !ok {
+			return err
+		}
+		endpoint.TeamID = &teamID
+	}
+
+	if endpoint.TeamID != nil {
+		if ok, err := ec.authorizeReferences(c, &endpoint, *endpoint.TeamID); !ok {
+			return err
+		}
+	}
+
+	before := auditSnapshot(ec.DB, "api_endpoints", endpointID)
+
+	tx, err := ec.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if err := updateEndpointRow(tx, endpointID, &endpoint); err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "Endpoint not found"})
+		}
+		if strings.Contains(err.Error(), "foreign key") {
+			return c.Status(409).JSON(fiber.Map{
+				"error": "This version uses a proxy, profile or team that no longer exists",
+			})
+		}
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{
+				"error": "Another endpoint of the version's team already uses this endpoint's key",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to restore endpoint version"})
+	}
+
+	endpoint.Version, err = services.RecordEndpointVersion(tx, endpointID, currentUser(c), models.EndpointChangeRestore, &versionNumber)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save endpoint version"})
+	}
+
+	if err := issuePingToken(c, tx, &endpoint, false); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to issue ping URL"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if endpoint.IsActive {
+		ec.scheduleEndpoint(endpoint)
+	} else {
+		ec.Monitor.UnscheduleEndpoint(endpointID)
+	}
+
+	entry := auditEntry(c, "endpoint.restore", "endpoint", endpointID)
+	entry.Details["restored_version"] = versionNumber
+	entry.Before = before
+	entry.After = auditSnapshot(ec.DB, "api_endpoints", endpointID)
+	services.RecordAudit(ec.DB, entry)
+
+	return c.JSON(fiber.Map{
+		"message": "Endpoint version restored successfully",
+		"data":    endpoint,
+	})
+}
+
+// GetEndpointGraph returns the dependency graph of the endpoints matching the list filters
+// (team_id, selector, group, q, is_active, ids), with the status of each endpoint's latest
+// check, for rendering. Edges only connect endpoints that are both in the result.
+func (ec *EndpointController) GetEndpointGraph(c *fiber.Ctx) error {
+	filter, err := endpointFilterFromQuery(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	whereClause, args, err := endpointWhere(c, filter, models.TeamRoleViewer)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	graph, err := services.LoadEndpointGraph(ec.DB, whereClause, args)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load the dependency graph"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": graph,
+	})
+}
+
+// GetEndpointDependencies lists the endpoints an endpoint depends on and the ones
+// depending on it
+func (ec *EndpointController) GetEndpointDependencies(c *fiber.Ctx) error {
+	endpointID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
+	}
+
+	if _, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleViewer); !ok {
+		return err
+	}
+
+	dependencies, err := services.FindEndpointDependencies(ec.DB, currentUser(c), endpointID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint dependencies"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": dependencies,
+	})
+}
+
+// UpdateEndpointDependencies replaces the endpoints an endpoint depends on
+// ({"depends_on": [ids]}). Dependencies can be in any team the user can see.
+func (ec *EndpointController) UpdateEndpointDependencies(c *fiber.Ctx) error {
+	endpointID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
+	}
+
+	if _, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleEditor); !ok {
+		return err
+	}
+
+	var req struct {
+		DependsOn []int `json:"depends_on"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	dependsOn := []int{}
+	seen := map[int]bool{}
+	for _, id := range req.DependsOn {
+		if id == endpointID {
+			return c.Status(400).JSON(fiber.Map{"error": "An endpoint cannot depend on itself"})
+		}
+		if !seen[id] {
+			seen[id] = true
+			dependsOn = append(dependsOn, id)
+		}
+	}
+
+	if len(dependsOn) > 0 {
+		whereClause, args, err := endpointWhere(c, services.EndpointFilter{IDs: dependsOn}, models.TeamRoleViewer)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		var visible int
+		if err := ec.DB.QueryRow("SELECT COUNT(*) FROM api_endpoints e "+whereClause, args...).Scan(&visible); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoints"})
+		}
+		if visible != len(dependsOn) {
+			return c.Status(400).JSON(fiber.Map{"error": "Dependency not found"})
+		}
+	}
+
+	previous, err := services.DependencyIDs(ec.DB, endpointID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint dependencies"})
+	}
+
+	tx, err := ec.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if err := services.SetEndpointDependencies(tx, endpointID, dependsOn); err != nil {
+		if err == services.ErrDependencyCycle {
+			return c.Status(409).JSON(fiber.Map{"error": "One of the dependencies already depends on this endpoint"})
+		}
+		if strings.Contains(err.Error(), "foreign key") {
+			return c.Status(400).JSON(fiber.Map{"error": "Dependency not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update endpoint dependencies"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	current, err := services.DependencyIDs(ec.DB, endpointID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint dependencies"})
+	}
+	recordChange(c, ec.DB, "endpoint.dependencies", "endpoint", endpointID,
+		map[string]interface{}{"depends_on": previous}, map[string]interface{}{"depends_on": current})
+
+	dependencies, err := services.FindEndpointDependencies(ec.DB, currentUser(c), endpointID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint dependencies"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Endpoint dependencies updated successfully",
+		"data":    dependencies,
+	})
+}
+
+// Actions of BulkEndpoints
+const (
+	bulkEnable      = "enable"
+	bulkDisable     = "disable"
+	bulkDelete      = "delete"
+	bulkSetInterval = "set_interval"
+	bulkSetProxy    = "set_proxy"
+)
+
+type bulkEndpointRequest struct {
+	services.EndpointFilter
+	Action               string `json:"action"`
+	CheckIntervalSeconds int    `json:"check_interval_seconds"` // For set_interval
+	ProxyID              *int   `json:"proxy_id"`               // For set_proxy, null removes the proxy
+	DryRun               bool   `json:"dry_run"`
+}
+
+// bulkTarget is an endpoint selected by a bulk action
+type bulkTarget struct {
+	ID                   int    `json:"id"`
+	Key                  string `json:"key"`
+	Name                 string `json:"name"`
+	teamID               sql.NullInt64
+	isActive             bool
+	checkIntervalSeconds int
+	proxyID              sql.NullInt64
+}
+
+// BulkEndpoints enables, disables, deletes or changes the check interval or proxy of every
+// endpoint matching a filter (the list filters: ids, team_id, selector, group, search,
+// is_active) on which the user is an editor. Endpoints already in the requested state are
+// left alone. With dry_run the endpoints that would change are returned.
+func (ec *EndpointController) BulkEndpoints(c *fiber.Ctx) error {
+	var req bulkEndpointRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	switch req.Action {
+	case bulkEnable, bulkDisable, bulkDelete, bulkSetProxy:
+	case bulkSetInterval:
+		if req.CheckIntervalSeconds <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "check_interval_seconds must be positive"})
+		}
+	default:
+		return c.Status(400).JSON(fiber.Map{
+			"error": "action must be enable, disable, delete, set_interval or set_proxy",
+		})
+	}
+
+	// An empty filter would hit every endpoint, which is never what a bulk action means
+	if req.EndpointFilter.Empty() {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Select the endpoints with ids, team_id, selector, group, search or is_active",
+		})
+	}
+
+	whereClause, args, err := endpointWhere(c, req.EndpointFilter, models.TeamRoleEditor)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rows, err := ec.DB.Query(`
+		SELECT e.id, e.key, e.name, e.team_id, e.is_active, e.check_interval_seconds, e.proxy_id
+		FROM api_endpoints e `+whereClause+`
+		ORDER BY e.id`, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoints"})
+	}
+	defer rows.Close()
+
+	matched := 0
+	targets := []bulkTarget{}
+	for rows.Next() {
+		var target bulkTarget
+		err := rows.Scan(&target.ID, &target.Key, &target.Name, &target.teamID, &target.isActive,
+			&target.checkIntervalSeconds, &target.proxyID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan endpoint data"})
+		}
+		matched++
+
+		unchanged := false
+		switch req.Action {
+		case bulkEnable:
+			unchanged = target.isActive
+		case bulkDisable:
+			unchanged = !target.isActive
+		case bulkSetInterval:
+			unchanged = target.checkIntervalSeconds == req.CheckIntervalSeconds
+		case bulkSetProxy:
+			unchanged = req.ProxyID == nil && !target.proxyID.Valid ||
+				req.ProxyID != nil && target.proxyID.Valid && int(target.proxyID.Int64) == *req.ProxyID
+		}
+		if !unchanged {
+			targets = append(targets, target)
+		}
+	}
+	rows.Close()
+
+	if req.Action == bulkSetProxy && req.ProxyID != nil {
+		for _, target := range targets {
+			if !target.teamID.Valid {
+				continue
+			}
+			if ok, err := ec.authorizeReference(c, "proxies", req.ProxyID, int(target.teamID.Int64), "Proxy"); !ok {
+				return err
+			}
+		}
+	}
+
+	if req.DryRun || len(targets) == 0 {
+		message := "Dry run, nothing was changed"
+		if !req.DryRun {
+			message = "All selected endpoints are already up to date"
+		}
+		return c.JSON(fiber.Map{
+			"message": message,
+			"data": fiber.Map{
+				"action":    req.Action,
+				"dry_run":   req.DryRun,
+				"matched":   matched,
+				"changed":   len(targets),
+				"endpoints": targets,
+			},
+		})
+	}
+
+	ids := make([]int, len(targets))
+	befores := make([]map[string]interface{}, len(targets))
+	for i, target := range targets {
+		ids[i] = target.ID
+		befores[i] = auditSnapshot(ec.DB, "api_endpoints", target.ID)
+	}
+
+	tx, err := ec.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	switch req.Action {
+	case bulkEnable, bulkDisable:
+		_, err = tx.Exec("UPDATE api_endpoints SET is_active = $1, updated_at = NOW() WHERE id = ANY($2)",
+			req.Action == bulkEnable, pq.Array(ids))
+	case bulkDelete:
+		_, err = tx.Exec("DELETE FROM api_endpoints WHERE id = ANY($1)", pq.Array(ids))
+	case bulkSetInterval:
+		_, err = tx.Exec("UPDATE api_endpoints SET check_interval_seconds = $1, updated_at = NOW() WHERE id = ANY($2)",
+			req.CheckIntervalSeconds, pq.Array(ids))
+	case bulkSetProxy:
+		_, err = tx.Exec("UPDATE api_endpoints SET proxy_id = $1, updated_at = NOW() WHERE id = ANY($2)",
+			req.ProxyID, pq.Array(ids))
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "foreign key") {
+			return c.Status(400).JSON(fiber.Map{"error": "Proxy not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update endpoints"})
+	}
+
+	// Interval and proxy are part of the definition, so those changes are new versions
+	if req.Action == bulkSetInterval || req.Action == bulkSetProxy {
+		for _, id := range ids {
+			if _, err := services.RecordEndpointVersion(tx, id, currentUser(c), models.EndpointChangeUpdate, nil); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to save endpoint version"})
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	auditAction := map[string]string{
+		bulkEnable:      "endpoint.toggle",
+		bulkDisable:     "endpoint.toggle",
+		bulkDelete:      "endpoint.delete",
+		bulkSetInterval: "endpoint.update",
+		bulkSetProxy:    "endpoint.update",
+	}[req.Action]
+
+	for i, id := range ids {
+		var after map[string]interface{}
+		if req.Action == bulkDelete {
+			ec.Monitor.UnscheduleEndpoint(id)
+		} else {
+			if endpoint, err := services.FindEndpoint(ec.DB, id); err == nil && endpoint.IsActive {
+				ec.Monitor.ScheduleEndpoint(endpoint)
+			} else {
+				ec.Monitor.UnscheduleEndpoint(id)
+			}
+			after = auditSnapshot(ec.DB, "api_endpoints", id)
+		}
+
+		entry := auditEntry(c, auditAction, "endpoint", id)
+		entry.Details["bulk"] = req.Action
+		entry.Before = befores[i]
+		entry.After = after
+		services.RecordAudit(ec.DB, entry)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Bulk action applied successfully",
+		"data": fiber.Map{
+			"action":    req.Action,
+			"dry_run":   false,
+			"matched":   matched,
+			"changed":   len(targets),
+			"endpoints": targets,
+		},
+	})
+}
+
+// RegeneratePingURL replaces the ping URL of a heartbeat endpoint; the old URL stops working
+func (ec *EndpointController) RegeneratePingURL(c *fiber.Ctx) error {
+	endpointID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
+	}
+
+	if _, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleEditor); !ok {
+		return err
+	}
+
+	endpoint, err := services.FindEndpoint(ec.DB, endpointID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint"})
+	}
+	if endpoint.Type != models.EndpointTypeHeartbeat {
+		return c.Status(400).JSON(fiber.Map{"error": "Only heartbeat endpoints have a ping URL"})
+	}
+
+	before := auditSnapshot(ec.DB, "api_endpoints", endpointID)
+	if err := issuePingToken(c, ec.DB, &endpoint, true); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to issue ping URL"})
+	}
+
+	recordChange(c, ec.DB, "endpoint.ping_url", "endpoint", endpointID, before, auditSnapshot(ec.DB, "api_endpoints", endpointID))
+
+	return c.JSON(fiber.Map{
+		"message": "Ping URL regenerated successfully",
+		"data": fiber.Map{
+			"id":       endpointID,
+			"ping_url": endpoint.PingURL,
+		},
+	})
+}
+
+// TestEndpoint runs a single check without logging it and returns the rendered
+// request for debugging, with secret values and credential headers redacted.
+// The endpoint definition is taken from the request body, or from the database
+// when an ID is given.
+func (ec *EndpointController) TestEndpoint(c *fiber.Ctx) error {
+	var endpoint models.APIEndpoint
+
+	if id := c.Params("id"); id != "" {
+		endpointID, err := strconv.Atoi(id)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid endpoint ID"})
+		}
+
+		teamID, ok, err := ec.authorizeEndpoint(c, endpointID, models.TeamRoleViewer)
+		if !ok {
+			return err
+		}
+
+		endpoint, err = services.FindEndpoint(ec.DB, endpointID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.Status(404).JSON(fiber.Map{"error": "Endpoint not found"})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint"})
+		}
+		if teamID.Valid {
+			if ok, err := ec.authorizeReferences(c, &endpoint, int(teamID.Int64)); !ok {
+				return err
+			}
+		}
+	} else {
+		if err := c.BodyParser(&endpoint); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if ok, err := validateEndpointType(c, &endpoint); !ok {
+			return err
+		}
+		if ok, err := ec.validateResponseSchema(c, &endpoint); !ok {
+			return err
+		}
+		if endpoint.URL == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "URL is required"})
+		}
+		if ok, err := ec.authorizeTestReferences(c, &endpoint); !ok {
+			return err
+		}
+	}
+
+	if endpoint.Type == models.EndpointTypeHeartbeat {
+		return c.Status(400).JSON(fiber.Map{"error": "Heartbeat endpoints are not requested, they wait for pings"})
+	}
+
+	if endpoint.TimeoutSeconds <= 0 {
+		endpoint.TimeoutSeconds = 30
+	}
+
+	rendered, err := ec.Monitor.PrepareRequest(&endpoint)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	result, err := utils.CheckRenderedRequest(endpoint, rendered)
+
+	errorMessage := ""
+	var schemaErrors []models.SchemaError
+	if err != nil {
+		errorMessage = err.Error()
+	} else {
+		schemaErrors, errorMessage = services.CheckResponseSchema(ec.DB, endpoint, result.StatusCode, result.Body)
+	}
+	rendered.RedactDetails(result.Details)
+
+	return c.JSON(fiber.Map{
+		"data": fiber.Map{
+			"request":          rendered.Redacted(),
+			"status_code":      result.StatusCode,
+			"response_time_ms": result.DurationMs,
+			"response_body":    rendered.Redact(utils.TruncateBody(result.Body)),
+			"response_headers": rendered.Redact(result.Headers),
+			"details":          result.Details,
+			"error_message":    rendered.Redact(errorMessage),
+			"schema_errors":    schemaErrors,
+		},
+	})
+}
+
+// authorizeTestReferences lets a test run of an unsaved endpoint use only the proxy,
+// profiles and library schema of the user's team. The team is team_id, or the only team
+// the user can edit when it is not given. The URL of an unsaved endpoint is chosen by the
+// caller, so sending the team's credentials or going through its proxy needs edit rights;
+// a library schema only needs read access.
+func (ec *EndpointController) authorizeTestReferences(c *fiber.Ctx, endpoint *models.APIEndpoint) (bool, error) {
+	usesCredentials := endpoint.ProxyID != nil || endpoint.AuthProfileID != nil || endpoint.TLSProfileID != nil
+	if !usesCredentials && endpoint.ResponseSchemaID == nil {
+		return true, nil
+	}
+
+	required := models.TeamRoleViewer
+	if usesCredentials {
+		required = models.TeamRoleEditor
+	}
+
+	var teamID int
+	if endpoint.TeamID != nil {
+		teamID = *endpoint.TeamID
+		ok, err := authorizeTeam(c, ec.DB, sql.NullInt64{Int64: int64(teamID), Valid: true}, required, "Team not found")
+		if !ok {
+			return false, err
+		}
+	} else {
+		var ok bool
+		var err error
+		if teamID, ok, err = resolveTeam(c, ec.DB, nil); !ok {
+			return false, err
+		}
+	}
+
+	return ec.authorizeReferences(c, endpoint, teamID)
+}
+
+// insertEndpointRow creates an endpoint, setting its ID and timestamps. The key and team
+// must already be set.
+func insertEndpointRow(q queryExecer, endpoint *models.APIEndpoint) error {
+	headersJSON := "{}"
+	if len(endpoint.Headers) > 0 {
+		headersBytes, err := json.Marshal(endpoint.Headers)
+		if err != nil {
+			return err
+		}
+		headersJSON = string(headersBytes)
+	}
+
+	labelsJSON, err := encodeLabels(endpoint.Labels)
+	if err != nil {
+		return err
+	}
+	trackingJSON, err := json.Marshal(endpoint.ContentTracking)
+	if err != nil {
+		return err
+	}
+	captureJSON, err := json.Marshal(endpoint.ResponseCapture)
+	if err != nil {
+		return err
+	}
+	transportJSON, err := json.Marshal(endpoint.Transport)
+	if err != nil {
+		return err
+	}
+	schemaJSON, err := encodeResponseSchema(endpoint.ResponseSchema)
+	if err != nil {
+		return err
+	}
+	if endpoint.Type == "" {
+		endpoint.Type = models.EndpointTypeHTTP
+	}
+
+	query := `
+		INSERT INTO api_endpoints (key, name, url, method, headers, body, timeout_seconds, 
+		                          check_interval_seconds, is_active, proxy_id, auth_profile_id, tls_profile_id,
+		                          team_id, labels, group_path, type, grace_seconds, content_tracking, response_schema,
+		                          response_schema_id, response_capture, transport, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+
+	return q.QueryRow(
+		query,
+		endpoint.Key,
+		endpoint.Name,
+		endpoint.URL,
+		endpoint.Method,
+		headersJSON,
+		endpoint.Body,
+		endpoint.TimeoutSeconds,
+		endpoint.CheckIntervalSeconds,
+		endpoint.IsActive,
+		endpoint.ProxyID,
+		endpoint.AuthProfileID,
+		endpoint.TLSProfileID,
+		endpoint.TeamID,
+		labelsJSON,
+		endpoint.Group,
+		endpoint.Type,
+		endpoint.GraceSeconds,
+		string(trackingJSON),
+		schemaJSON,
+		endpoint.ResponseSchemaID,
+		string(captureJSON),
+		string(transportJSON),
+	).Scan(&endpoint.ID, &endpoint.CreatedAt, &endpoint.UpdatedAt)
+}
+
+// updateEndpointRow saves an endpoint definition and its active state. An empty key
+// keeps the current one.
+func updateEndpointRow(q queryExecer, endpointID int, endpoint *models.APIEndpoint) error {
+	headersJSON := "{}"
+	if len(endpoint.Headers) > 0 {
+		headersBytes, err := json.Marshal(endpoint.Headers)
+		if err != nil {
+			return err
+		}
+		headersJSON = string(headersBytes)
+	}
+
+	labelsJSON, err := encodeLabels(endpoint.Labels)
+	if err != nil {
+		return err
+	}
+	trackingJSON, err := json.Marshal(endpoint.ContentTracking)
+	if err != nil {
+		return err
+	}
+	captureJSON, err := json.Marshal(endpoint.ResponseCapture)
+	if err != nil {
+		return err
+	}
+	transportJSON, err := json.Marshal(endpoint.Transport)
+	if err != nil {
+		return err
+	}
+	schemaJSON, err := encodeResponseSchema(endpoint.ResponseSchema)
+	if err != nil {
+		return err
+	}
+	if endpoint.Type == "" {
+		endpoint.Type = models.EndpointTypeHTTP
+	}
+
+	query := `
+		UPDATE api_endpoints 
+		SET name = $1, url = $2, method = $3, headers = $4, body = $5, 
+		    timeout_seconds = $6, check_interval_seconds = $7, is_active = $8, 
+		    proxy_id = $9, auth_profile_id = $10, tls_profile_id = $11, team_id = $12,
+		    key = COALESCE(NULLIF($13, ''), key), labels = $14, group_path = $15,
+		    type = $16, grace_seconds = $17, content_tracking = $18,
+		    response_schema = $19, response_schema_id = $20, response_capture = $21,
+		    transport = $22, updated_at = NOW()
+		WHERE id = $23
+		RETURNING id, key, created_at, updated_at
+	`
+
+	return q.QueryRow(
+		query,
+		endpoint.Name,
+		endpoint.URL,
+		endpoint.Method,
+		headersJSON,
+		endpoint.Body,
+		endpoint.TimeoutSeconds,
+		endpoint.CheckIntervalSeconds,
+		endpoint.IsActive,
+		endpoint.ProxyID,
+		endpoint.AuthProfileID,
+		endpoint.TLSProfileID,
+		endpoint.TeamID,
+		endpoint.Key,
+		labelsJSON,
+		endpoint.Group,
+		endpoint.Type,
+		endpoint.GraceSeconds,
+		string(trackingJSON),
+		schemaJSON,
+		endpoint.ResponseSchemaID,
+		string(captureJSON),
+		string(transportJSON),
+		endpointID,
+	).Scan(&endpoint.ID, &endpoint.Key, &endpoint.CreatedAt, &endpoint.UpdatedAt)
+}
+
+// issuePingToken gives a heartbeat endpoint a ping URL when it has none yet, or a new one
+// when replace is set, and sets its PingURL. The token is only stored hashed, so this is
+// the only time the URL is shown.
+func issuePingToken(c *fiber.Ctx, q queryExecer, endpoint *models.APIEndpoint, replace bool) error {
+	if endpoint.Type != models.EndpointTypeHeartbeat {
+		return nil
+	}
+
+	token, hash, err := services.IssuePingToken()
+	if err != nil {
+		return err
+	}
+
+	var id int
+	err = q.QueryRow(`
+		UPDATE api_endpoints SET ping_token_hash = $1
+		WHERE id = $2 AND type = $3 AND (ping_token_hash IS NULL OR $4)
+		RETURNING id`, hash, endpoint.ID, models.EndpointTypeHeartbeat, replace).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	endpoint.PingURL = pingURL(c, token)
+	return nil
+}
+
+// pingURL returns the public URL heartbeat pings are sent to
+func pingURL(c *fiber.Ctx, token string) string {
+	return c.BaseURL() + "/ping/" + token
+}
+
+// validateEndpointType defaults the endpoint type to http and checks the heartbeat timing,
+// the content tracking and transport settings, which only apply to http endpoints, and
+// the capture settings
+func validateEndpointType(c *fiber.Ctx, endpoint *models.APIEndpoint) (bool, error) {
+	switch endpoint.Type {
+	case "":
+		endpoint.Type = models.EndpointTypeHTTP
+	case models.EndpointTypeHTTP:
+	case models.EndpointTypeHeartbeat:
+		if endpoint.CheckIntervalSeconds <= 0 {
+			return false, c.Status(400).JSON(fiber.Map{"error": "Heartbeats need the expected ping period in check_interval_seconds"})
+		}
+	default:
+		return false, c.Status(400).JSON(fiber.Map{"error": "type must be http or heartbeat"})
+	}
+
+	if endpoint.GraceSeconds < 0 {
+		return false, c.Status(400).JSON(fiber.Map{"error": "grace_seconds cannot be negative"})
+	}
+
+	if endpoint.ContentTracking.Enabled && endpoint.Type != models.EndpointTypeHTTP {
+		return false, c.Status(400).JSON(fiber.Map{"error": "content_tracking is only available for http endpoints"})
+	}
+	if err := services.ValidateContentTracking(endpoint.ContentTracking); err != nil {
+		return false, c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := services.ValidateResponseCapture(endpoint.ResponseCapture); err != nil {
+		return false, c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if endpoint.ResponseCapture.Mode == models.CaptureNone {
+		endpoint.ResponseCapture.Mode = ""
+	}
+
+	endpoint.Transport = services.NormalizeTransportOptions(endpoint.Transport)
+	if endpoint.Type != models.EndpointTypeHTTP && !services.UsesDefaultTransport(endpoint.Transport) {
+		return false, c.Status(400).JSON(fiber.Map{"error": "transport is only available for http endpoints"})
+	}
+	if err := services.ValidateTransportOptions(endpoint.Transport); err != nil {
+		return false, c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return true, nil
+}
+
+// encodeResponseSchema returns the inline response schema for the response_schema column,
+// nil for NULL when the endpoint has none
+func encodeResponseSchema(schema map[string]interface{}) (interface{}, error) {
+	if schema == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// encodeLabels returns the labels as a JSON object for the labels column
+func encodeLabels(labels map[string]string) (string, error) {
+	if len(labels) == 0 {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(labels)
+	return string(encoded), err
+}
+
+// validateEndpointLabels checks the labels of an endpoint and normalizes its group path
+func validateEndpointLabels(c *fiber.Ctx, endpoint *models.APIEndpoint) (bool, error) {
+	if err := services.ValidateLabels(endpoint.Labels); err != nil {
+		return false, c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	group, err := services.NormalizeGroup(endpoint.Group)
+	if err != nil {
+		return false, c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	endpoint.Group = group
+	return true, nil
+}
+
+// endpointFilterFromQuery reads the endpoint list filters from the query string
+func endpointFilterFromQuery(c *fiber.Ctx) (services.EndpointFilter, error) {
+	filter := services.EndpointFilter{
+		TeamID:   queryTeamID(c),
+		Selector: c.Query("selector"),
+		Group:    c.Query("group"),
+		Search:   strings.TrimSpace(c.Query("q")),
+	}
+
+	if ids := c.Query("ids"); ids != "" {
+		for _, id := range strings.Split(ids, ",") {
+			endpointID, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				return filter, fmt.Errorf("invalid endpoint ID %q", id)
+			}
+			filter.IDs = append(filter.IDs, endpointID)
+		}
+	}
+
+	if isActive := c.Query("is_active"); isActive != "" {
+		active, err := strconv.ParseBool(isActive)
+		if err != nil {
+			return filter, fmt.Errorf("is_active must be true or false")
+		}
+		filter.IsActive = &active
+	}
+
+	return filter, nil
+}
+
+// queryTeamID returns the ?team_id= parameter, if given
+func queryTeamID(c *fiber.Ctx) *int {
+	teamID := c.QueryInt("team_id", 0)
+	if teamID == 0 {
+		return nil
+	}
+	return &teamID
+}
+
+// endpointWhere builds the WHERE clause selecting the filtered endpoints on which the
+// user has at least the required role
+func endpointWhere(c *fiber.Ctx, filter services.EndpointFilter, required string) (string, []interface{}, error) {
+	conditions, args, err := services.EndpointFilterConditions(filter, 1)
+	if err != nil {
+		return "", nil, err
+	}
+
+	scope, scopeArgs := services.TeamScope(currentUser(c), "e.team_id", required, len(args)+1)
+	if scope != "" {
+		conditions = append(conditions, scope)
+		args = append(args, scopeArgs...)
+	}
+
+	if len(conditions) == 0 {
+		return "", args, nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// scheduleEndpoint reloads the saved endpoint so the scheduled job gets its
+// proxy and profile settings, falling back to the request data
+func (ec *EndpointController) scheduleEndpoint(endpoint models.APIEndpoint) {
+	if saved, err := services.FindEndpoint(ec.DB, endpoint.ID); err == nil {
+		endpoint = saved
+	}
+	ec.Monitor.ScheduleEndpoint(endpoint)
+}
+
+// authorizeEndpoint checks the current user's role on the endpoint's team and returns that team
+func (ec *EndpointController) authorizeEndpoint(c *fiber.Ctx, endpointID int, required string) (sql.NullInt64, bool, error) {
+	var teamID sql.NullInt64
+	err := ec.DB.QueryRow("SELECT team_id FROM api_endpoints WHERE id = $1", endpointID).Scan(&teamID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return teamID, false, c.Status(404).JSON(fiber.Map{"error": "Endpoint not found"})
+		}
+		return teamID, false, c.Status(500).JSON(fiber.Map{"error": "Failed to fetch endpoint"})
+	}
+
+	ok, err := authorizeTeam(c, ec.DB, teamID, required, "Endpoint not found")
+	return teamID, ok, err
+}
+
+// validateResponseSchema checks that an endpoint has at most one response schema, that an
+// inline schema compiles and that a library schema exists
+func (ec *EndpointController) validateResponseSchema(c *fiber.Ctx, endpoint *models.APIEndpoint) (bool, error) {
+	if endpoint.ResponseSchema == nil && endpoint.ResponseSchemaID == nil {
+		return true, nil
+	}
+	if endpoint.Type != models.EndpointTypeHTTP {
+		return false, c.Status(400).JSON(fiber.Map{"error": "Response schemas are only available for http endpoints"})
+	}
+	if endpoint.ResponseSchema != nil && endpoint.ResponseSchemaID != nil {
+		return false, c.Status(400).JSON(fiber.Map{"error": "Use either response_schema or response_schema_id"})
+	}
+
+	if endpoint.ResponseSchema != nil {
+		if _, err := services.CompileSchema(endpoint.ResponseSchema); err != nil {
+			return false, c.Status(400).JSON(fiber.Map{"error": "response_schema is not a valid JSON Schema: " + err.Error()})
+		}
+		return true, nil
+	}
+
+	if _, err := services.FindJSONSchema(ec.DB, *endpoint.ResponseSchemaID); err != nil {
+		if err == sql.ErrNoRows {
+			return false, c.Status(400).JSON(fiber.Map{"error": "JSON schema not found"})
+		}
+		return false, c.Status(500).JSON(fiber.Map{"error": "Failed to fetch JSON schema"})
+	}
+	return true, nil
+}
+
+// authorizeReferences makes sure an endpoint only uses the proxy, profiles and library
+// schema of its own team
+func (ec *EndpointController) authorizeReferences(c *fiber.Ctx, endpoint *models.APIEndpoint, teamID int) (bool, error) {
+	for _, ref := range []struct {
+		table string
+		id    *int
+		name  string
+	}{
+		{"proxies", endpoint.ProxyID, "Proxy"},
+		{"auth_profiles", endpoint.AuthProfileID, "Auth profile"},
+		{"tls_profiles", endpoint.TLSProfileID, "TLS profile"},
+		{"json_schemas", endpoint.ResponseSchemaID, "JSON schema"},
+	} {
+		if ok, err := ec.authorizeReference(c, ref.table, ref.id, teamID, ref.name); !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// authorizeReference checks that the row id of a team-scoped table belongs to the team
+func (ec *EndpointController) authorizeReference(c *fiber.Ctx, table string, id *int, teamID int, name string) (bool, error) {
+	if id == nil || services.IsAdmin(currentUser(c)) {
+		return true, nil
+	}
+
+	var refTeamID sql.NullInt64
+	err := ec.DB.QueryRow("SELECT team_id FROM "+table+" WHERE id = $1", *id).Scan(&refTeamID)
+	if err != nil && err != sql.ErrNoRows {
+		return false, c.Status(500).JSON(fiber.Map{"error": "Failed to check endpoint references"})
+	}
+	if err == sql.ErrNoRows || !refTeamID.Valid || int(refTeamID.Int64) != teamID {
+		return false, c.Status(400).JSON(fiber.Map{"error": name + " not found in the endpoint's team"})
+	}
+
+	return true, nil
+}
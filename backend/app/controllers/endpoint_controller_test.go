@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+	"api-monitor/utils"
+)
+
+func TestTestEndpointReferences(t *testing.T) {
+	user := &models.User{ID: 4, Role: "user"}
+
+	// Every profile, proxy and schema belongs to team 2
+	references := func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if strings.HasPrefix(query, "SELECT team_id FROM ") {
+			return []string{"team_id"}, [][]driver.Value{{int64(2)}}, nil
+		}
+		return nil, nil, errors.New("unexpected query: " + query)
+	}
+
+	tests := []struct {
+		name, role, body string
+		want             int
+		wantError        string
+	}{
+		{"viewer with auth profile", models.TeamRoleViewer, `"auth_profile_id": 5`, 403, "Insufficient team permissions"},
+		{"viewer with TLS profile", models.TeamRoleViewer, `"tls_profile_id": 5`, 403, "Insufficient team permissions"},
+		{"viewer with proxy", models.TeamRoleViewer, `"proxy_id": 5`, 403, "Insufficient team permissions"},
+		{"non-member with auth profile", "", `"auth_profile_id": 5`, 404, "Team not found"},
+		{"editor with another team's profile", models.TeamRoleEditor, `"auth_profile_id": 5`, 400, "Auth profile not found in the endpoint's team"},
+		{"invalid transport", models.TeamRoleViewer, `"transport": {"http_version": "3"}`, 400, "transport.http_version must be 1.1 or 2"},
+		{"invalid inline schema", models.TeamRoleViewer, `"response_schema": {"type": 5}`, 400, "response_schema is not a valid JSON Schema"},
+	}
+	for _, tt := range tests {
+		db, _ := teamDB(t, tt.role, references)
+		ec := NewEndpointController(db, &services.MonitorService{DB: db})
+
+		body := fmt.Sprintf(`{"url": "http://127.0.0.1:1/", "team_id": 1, %s}`, tt.body)
+		status, response := request(t, user, "POST", "/test", "/test", body, ec.TestEndpoint)
+		message, _ := response["error"].(string)
+		if status != tt.want || !strings.HasPrefix(message, tt.wantError) {
+			t.Errorf("%s: %d %q, want %d %q", tt.name, status, message, tt.want, tt.wantError)
+		}
+	}
+}
+
+func TestTestEndpointNormalizesTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(utils.CloseTransports)
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	// The pinned host only matches once it is lower-cased and trimmed, as Create stores it
+	ec := NewEndpointController(nil, &services.MonitorService{})
+	body := fmt.Sprintf(`{"url": "http://pinned.test:%d/", "transport": {"resolve": {" PINNED.test ": "127.0.0.1"}}}`, port)
+	status, response := request(t, &models.User{ID: 4, Role: "user"}, "POST", "/test", "/test", body, ec.TestEndpoint)
+
+	data, _ := response["data"].(map[string]interface{})
+	if status != 200 || data["status_code"] != float64(200) || data["response_body"] != "pong" {
+		t.Errorf("test run = %d %v", status, response)
+	}
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"database/sql"
+
+	"api-monitor/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeartbeatController receives the pings of heartbeat endpoints. Ping URLs are public, the
+// secret token in the URL identifies the endpoint.
+type HeartbeatController struct {
+	DB      *sql.DB
+	Monitor *services.MonitorService
+}
+
+func NewHeartbeatController(db *sql.DB, monitor *services.MonitorService) *HeartbeatController {
+	return &HeartbeatController{
+		DB:      db,
+		Monitor: monitor,
+	}
+}
+
+// Ping records a ping sent with GET or POST to /ping/:token, /ping/:token/start,
+// /ping/:token/fail or /ping/:token/<exit code> (0 is a success). The status can also be
+// given as ?status=. A POST body is stored as the payload of the check.
+func (hc *HeartbeatController) Ping(c *fiber.Ctx) error {
+	endpoint, err := services.FindHeartbeatByToken(hc.DB, c.Params("token"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "Unknown ping URL"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch heartbeat"})
+	}
+
+	kind, exitCode, err := services.ParsePingStatus(c.Params("status", c.Query("status", services.PingSuccess)))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Paused heartbeats accept pings but do not record them
+	if !endpoint.IsActive {
+		return c.JSON(fiber.Map{"message": "Heartbeat is paused, ping ignored"})
+	}
+
+	if err := hc.Monitor.RecordPing(endpoint, kind, exitCode, string(c.Body())); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to record ping"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Ping received",
+		"data": fiber.Map{
+			"endpoint_id": endpoint.ID,
+			"status":      kind,
+		},
+	})
+}
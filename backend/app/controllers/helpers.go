@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// currentUser returns the authenticated user stored by JWTMiddleware
+func currentUser(c *fiber.Ctx) *models.User {
+	user, _ := c.Locals("user").(*models.User)
+	return user
+}
+
+// authorizeTeam checks that the current user has at least the required role in the
+// team owning a resource. When access is denied it writes the response and returns false;
+// resources the user cannot see at all are reported as not found.
+func authorizeTeam(c *fiber.Ctx, db *sql.DB, teamID sql.NullInt64, required, notFound string) (bool, error) {
+	user := currentUser(c)
+
+	// Resources without a team are only visible to admins
+	if !teamID.Valid {
+		if services.IsAdmin(user) {
+			return true, nil
+		}
+		return false, c.Status(404).JSON(fiber.Map{"error": notFound})
+	}
+
+	role, err := services.TeamRole(db, user, int(teamID.Int64))
+	if err != nil {
+		return false, c.Status(500).JSON(fiber.Map{"error": "Failed to check permissions"})
+	}
+	if role == "" {
+		return false, c.Status(404).JSON(fiber.Map{"error": notFound})
+	}
+	if !services.RoleAtLeast(role, required) {
+		return false, c.Status(403).JSON(fiber.Map{"error": "Insufficient team permissions"})
+	}
+
+	return true, nil
+}
+
+// resolveTeam picks and authorizes the team for a new or moved resource. A missing
+// team defaults to the only team the user can edit.
+func resolveTeam(c *fiber.Ctx, db *sql.DB, teamID *int) (int, bool, error) {
+	user := currentUser(c)
+
+	if teamID == nil {
+		defaultTeamID, err := services.DefaultTeamID(db, user)
+		if err != nil {
+			return 0, false, c.Status(500).JSON(fiber.Map{"error": "Failed to check permissions"})
+		}
+		if defaultTeamID == 0 {
+			return 0, false, c.Status(400).JSON(fiber.Map{"error": "team_id is required"})
+		}
+		teamID = &defaultTeamID
+	}
+
+	ok, err := authorizeTeam(c, db, sql.NullInt64{Int64: int64(*teamID), Valid: true}, models.TeamRoleEditor, "Team not found")
+	return *teamID, ok, err
+}
+
+// authorizeTeamRow looks up the team of a row in a team-scoped table and authorizes it
+// like authorizeTeam; rows that do not exist are reported as notFound
+func authorizeTeamRow(c *fiber.Ctx, db *sql.DB, table string, id int, required, notFound string) (sql.NullInt64, bool, error) {
+	var teamID sql.NullInt64
+	err := db.QueryRow("SELECT team_id FROM "+table+" WHERE id = $1", id).Scan(&teamID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return teamID, false, c.Status(404).JSON(fiber.Map{"error": notFound})
+		}
+		return teamID, false, c.Status(500).JSON(fiber.Map{"error": "Failed to check permissions"})
+	}
+
+	ok, err := authorizeTeam(c, db, teamID, required, notFound)
+	return teamID, ok, err
+}
+
+// moveTeam returns the team of an updated profile or schema: the current team when none is
+// given, otherwise the requested team, which then needs edit rights as well. Endpoints
+// only use profiles of their own team, so a profile referenced through the endpoint column
+// usedBy cannot move while endpoints of another team use it.
+func moveTeam(c *fiber.Ctx, db *sql.DB, id int, current sql.NullInt64, requested *int, usedBy string) (*int, bool, error) {
+	if requested == nil {
+		if !current.Valid {
+			return nil, true, nil
+		}
+		teamID := int(current.Int64)
+		return &teamID, true, nil
+	}
+	if current.Valid && int(current.Int64) == *requested {
+		return requested, true, nil
+	}
+
+	teamID, ok, err := resolveTeam(c, db, requested)
+	if !ok {
+		return nil, false, err
+	}
+
+	var used bool
+	err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM api_endpoints WHERE `+usedBy+` = $1 AND team_id IS DISTINCT FROM $2)`,
+		id, teamID).Scan(&used)
+	if err != nil {
+		return nil, false, c.Status(500).JSON(fiber.Map{"error": "Failed to check endpoint references"})
+	}
+	if used {
+		return nil, false, c.Status(409).JSON(fiber.Map{"error": "Endpoints of another team still use it"})
+	}
+
+	return &teamID, true, nil
+}
+
+// apiKeyAllows reports whether the request may use a scope beyond the one checked by the
+// API key middleware, for routes that touch several resources. JWT requests always may.
+func apiKeyAllows(c *fiber.Ctx, scope string) bool {
+	scopes, ok := c.Locals("apiKeyScopes").([]string)
+	if !ok {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// auditEntry starts an audit log entry for the current request with the acting user,
+// the client IP and, for API key requests, the key that was used
+func auditEntry(c *fiber.Ctx, action, resourceType string, resourceID interface{}) models.AuditLog {
+	entry := models.AuditLog{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   fmt.Sprint(resourceID),
+		IPAddress:    c.IP(),
+		Details:      map[string]interface{}{},
+	}
+
+	if user := currentUser(c); user != nil {
+		entry.ActorID = &user.ID
+		entry.ActorUsername = user.Username
+	}
+	if apiKeyID, ok := c.Locals("apiKeyID").(int); ok {
+		entry.Details["api_key_id"] = apiKeyID
+	}
+	return entry
+}
+
+// auditSnapshot returns the stored row with the given id for the audit log
+func auditSnapshot(db *sql.DB, table string, id int) map[string]interface{} {
+	return services.AuditSnapshot(db, table, "id = $1", id)
+}
+
+// recordChange audits a configuration change with the resource state before and after
+// it; before is nil for creations and after is nil for deletions
+func recordChange(c *fiber.Ctx, db *sql.DB, action, resourceType string, resourceID interface{}, before, after map[string]interface{}) {
+	entry := auditEntry(c, action, resourceType, resourceID)
+	entry.Before = before
+	entry.After = after
+	services.RecordAudit(db, entry)
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-monitor/app/fakedb"
+	"api-monitor/app/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// teamDB is a fake database where the user has role in every team and audit entries are
+// dropped; other statements go to next, which may be nil
+func teamDB(t *testing.T, role string, next fakedb.Handler) (*sql.DB, *fakedb.DB) {
+	return fakedb.Open(t, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "SELECT role FROM team_members"):
+			if role == "" {
+				return []string{"role"}, nil, nil
+			}
+			return []string{"role"}, [][]driver.Value{{role}}, nil
+		case strings.Contains(query, "SELECT to_jsonb(t)"):
+			return []string{"to_jsonb"}, nil, nil
+		case strings.Contains(query, "INSERT INTO audit_logs"):
+			return nil, nil, nil
+		}
+		if next != nil {
+			return next(query, args)
+		}
+		return nil, nil, errors.New("unexpected query: " + query)
+	})
+}
+
+// request runs handler on route as user and returns the status and the decoded JSON body
+func request(t *testing.T, user *models.User, method, route, path, body string, handler fiber.Handler) (int, map[string]interface{}) {
+	t.Helper()
+	app := fiber.New()
+	app.Add(method, route, func(c *fiber.Ctx) error {
+		c.Locals("user", user)
+		return handler(c)
+	})
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(resp.Body)
+	var decoded map[string]interface{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q", method, path, raw)
+		}
+	}
+	return resp.StatusCode, decoded
+}
+
+func TestWriteRoutesRequireEditor(t *testing.T) {
+	user := &models.User{ID: 4, Role: "user"}
+
+	// Every resource belongs to team 3; only permission lookups are expected
+	var writes []string
+	resources := func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if strings.HasPrefix(query, "SELECT team_id FROM ") {
+			return []string{"team_id"}, [][]driver.Value{{int64(3)}}, nil
+		}
+		writes = append(writes, query)
+		return nil, nil, errors.New("unexpected query: " + query)
+	}
+
+	endpoint := `{"name": "api", "url": "https://api.test/", "method": "GET", "team_id": 3}`
+	proxy := `{"name": "egress", "host": "proxy.test", "port": 3128, "team_id": 3}`
+	authProfile := `{"name": "basic", "type": "basic", "config": {"username": "u"}, "team_id": 3}`
+	tlsProfile := `{"name": "mtls", "team_id": 3}`
+	schema := `{"name": "object", "schema": {"type": "object"}, "team_id": 3}`
+
+	routes := []struct {
+		method, route, path, body string
+		handler                   func(db *sql.DB) fiber.Handler
+	}{
+		{"POST", "/endpoints", "/endpoints", endpoint, func(db *sql.DB) fiber.Handler { return NewEndpointController(db, nil).CreateEndpoint }},
+		{"PUT", "/endpoints/:id", "/endpoints/9", endpoint, func(db *sql.DB) fiber.Handler { return NewEndpointController(db, nil).UpdateEndpoint }},
+		{"DELETE", "/endpoints/:id", "/endpoints/9", "", func(db *sql.DB) fiber.Handler { return NewEndpointController(db, nil).DeleteEndpoint }},
+		{"POST", "/endpoints/:id/toggle", "/endpoints/9/toggle", "", func(db *sql.DB) fiber.Handler { return NewEndpointController(db, nil).ToggleEndpoint }},
+		{"POST", "/endpoints/:id/ping-url", "/endpoints/9/ping-url", "", func(db *sql.DB) fiber.Handler { return NewEndpointController(db, nil).RegeneratePingURL }},
+		{"PUT", "/endpoints/:id/dependencies", "/endpoints/9/dependencies", `{"depends_on": []}`, func(db *sql.DB) fiber.Handler { return NewEndpointController(db, nil).UpdateEndpointDependencies }},
+		{"POST", "/proxies", "/proxies", proxy, func(db *sql.DB) fiber.Handler { return NewProxyController(db).CreateProxy }},
+		{"PUT", "/proxies/:id", "/proxies/9", proxy, func(db *sql.DB) fiber.Handler { return NewProxyController(db).UpdateProxy }},
+		{"DELETE", "/proxies/:id", "/proxies/9", "", func(db *sql.DB) fiber.Handler { return NewProxyController(db).DeleteProxy }},
+		{"POST", "/proxies/:id/toggle", "/proxies/9/toggle", "", func(db *sql.DB) fiber.Handler { return NewProxyController(db).ToggleProxy }},
+		{"POST", "/auth-profiles", "/auth-profiles", authProfile, func(db *sql.DB) fiber.Handler { return NewAuthProfileController(db, nil).CreateAuthProfile }},
+		{"PUT", "/auth-profiles/:id", "/auth-profiles/9", authProfile, func(db *sql.DB) fiber.Handler { return NewAuthProfileController(db, nil).UpdateAuthProfile }},
+		{"DELETE", "/auth-profiles/:id", "/auth-profiles/9", "", func(db *sql.DB) fiber.Handler { return NewAuthProfileController(db, nil).DeleteAuthProfile }},
+		{"POST", "/tls-profiles", "/tls-profiles", tlsProfile, func(db *sql.DB) fiber.Handler { return NewTLSProfileController(db).CreateTLSProfile }},
+		{"PUT", "/tls-profiles/:id", "/tls-profiles/9", tlsProfile, func(db *sql.DB) fiber.Handler { return NewTLSProfileController(db).UpdateTLSProfile }},
+		{"DELETE", "/tls-profiles/:id", "/tls-profiles/9", "", func(db *sql.DB) fiber.Handler { return NewTLSProfileController(db).DeleteTLSProfile }},
+		{"POST", "/schemas", "/schemas", schema, func(db *sql.DB) fiber.Handler { return NewJSONSchemaController(db).CreateJSONSchema }},
+		{"PUT", "/schemas/:id", "/schemas/9", schema, func(db *sql.DB) fiber.Handler { return NewJSONSchemaController(db).UpdateJSONSchema }},
+		{"DELETE", "/schemas/:id", "/schemas/9", "", func(db *sql.DB) fiber.Handler { return NewJSONSchemaController(db).DeleteJSONSchema }},
+	}
+
+	for _, role := range []string{models.TeamRoleViewer, ""} {
+		want, wantError := 403, "Insufficient team permissions"
+		if role == "" {
+			want, wantError = 404, "not found"
+		}
+		for _, route := range routes {
+			writes = nil
+			db, _ := teamDB(t, role, resources)
+			status, response := request(t, user, route.method, route.route, route.path, route.body, route.handler(db))
+			message, _ := response["error"].(string)
+			if status != want || !strings.Contains(strings.ToLower(message), strings.ToLower(wantError)) || len(writes) != 0 {
+				t.Errorf("%s %s as %q: %d %q, statements %v; want %d %q and no statements",
+					route.method, route.path, role, status, message, writes, want, wantError)
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ImportController exports the endpoints and proxies of a team as a JSON/YAML monitor
+// document and imports such documents, so monitors can be kept in git. Imports are
+// idempotent: endpoints are matched by key and proxies by name, and importing the same
+// document twice changes nothing the second time.
+type ImportController struct {
+	DB      *sql.DB
+	Monitor *services.MonitorService
+}
+
+func NewImportController(db *sql.DB, monitor *services.MonitorService) *ImportController {
+	return &ImportController{
+		DB:      db,
+		Monitor: monitor,
+	}
+}
+
+// ExportMonitors returns the endpoints and proxies of a team (?team_id=, defaults to the
+// user's only team) as JSON, or as YAML with ?format=yaml. Proxy passwords are left out.
+func (ic *ImportController) ExportMonitors(c *fiber.Ctx) error {
+	teamID := c.QueryInt("team_id", 0)
+	if teamID == 0 {
+		defaultTeamID, err := services.DefaultTeamID(ic.DB, currentUser(c))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to check permissions"})
+		}
+		if defaultTeamID == 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "team_id is required"})
+		}
+		teamID = defaultTeamID
+	}
+
+	ok, err := authorizeTeam(c, ic.DB, sql.NullInt64{Int64: int64(teamID), Valid: true}, models.TeamRoleViewer, "Team not found")
+	if !ok {
+		return err
+	}
+	if !apiKeyAllows(c, "proxies:read") {
+		return c.Status(403).JSON(fiber.Map{"error": "API key is missing the required scope", "scope": "proxies:read"})
+	}
+
+	document, err := services.ExportMonitorDocument(ic.DB, teamID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to export endpoints"})
+	}
+
+	switch c.Query("format", "json") {
+	case "json":
+		return c.JSON(document)
+	case "yaml":
+		var encoded bytes.Buffer
+		encoder := yaml.NewEncoder(&encoded)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(document); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to encode export"})
+		}
+		c.Set(fiber.HeaderContentType, "application/yaml")
+		return c.Send(encoded.Bytes())
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "format must be json or yaml"})
+	}
+}
+
+// ImportMonitors creates and updates the endpoints and proxies of a monitor document
+// (JSON or YAML body) in a team. With ?dry_run=true only the plan is returned.
+func (ic *ImportController) ImportMonitors(c *fiber.Ctx) error {
+	document, err := services.ParseMonitorDocument(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return ic.importDocument(c, document, nil)
+}
+
+// ImportOpenAPI generates GET monitors from an OpenAPI 3 spec (JSON or YAML body) and
+// imports them like ImportMonitors. Options: operations (comma separated operationIds or
+// "GET /path", default all GET operations), base_url, key_prefix, timeout_seconds,
+// check_interval_seconds and dry_run.
+func (ic *ImportController) ImportOpenAPI(c *fiber.Ctx) error {
+	options := services.OpenAPIImportOptions{
+		BaseURL:              c.Query("base_url"),
+		KeyPrefix:            c.Query("key_prefix"),
+		TimeoutSeconds:       c.QueryInt("timeout_seconds", 0),
+		CheckIntervalSeconds: c.QueryInt("check_interval_seconds", 0),
+	}
+	if operations := c.Query("operations"); operations != "" {
+		options.Operations = strings.Split(operations, ",")
+	}
+
+	document, skipped, err := services.MonitorsFromOpenAPI(c.Body(), options)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return ic.importDocument(c, document, fiber.Map{
+		"document": document,
+		"skipped":  skipped,
+	})
+}
+
+// importDocument plans a document against the target team (?team_id=) and applies the
+// plan unless this is a dry run. extra is merged into the response data.
+func (ic *ImportController) importDocument(c *fiber.Ctx, document models.MonitorDocument, extra fiber.Map) error {
+	var requestedTeamID *int
+	if teamID := c.QueryInt("team_id", 0); teamID != 0 {
+		requestedTeamID = &teamID
+	}
+	teamID, ok, err := resolveTeam(c, ic.DB, requestedTeamID)
+	if !ok {
+		return err
+	}
+	if len(document.Proxies) > 0 && !apiKeyAllows(c, "proxies:write") {
+		return c.Status(403).JSON(fiber.Map{"error": "API key is missing the required scope", "scope": "proxies:write"})
+	}
+
+	plan, err := services.PlanImport(ic.DB, teamID, document)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to plan import"})
+	}
+	if len(plan.Errors) > 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error":  "The import document has errors",
+			"errors": plan.Errors,
+		})
+	}
+
+	dryRun := c.QueryBool("dry_run", false)
+	message := "Dry run, nothing was changed"
+	if !dryRun {
+		if ok, err := ic.applyPlan(c, teamID, &plan); !ok {
+			return err
+		}
+		message = "Import applied successfully"
+	}
+
+	data := fiber.Map{
+		"team_id": teamID,
+		"dry_run": dryRun,
+		"summary": plan.Summary,
+		"changes": plan.Changes,
+	}
+	for key, value := range extra {
+		data[key] = value
+	}
+
+	return c.JSON(fiber.Map{
+		"message": message,
+		"data":    data,
+	})
+}
+
+// applyPlan makes the planned changes in one transaction, then reschedules the changed
+// endpoints and audits every change. When it fails it writes the response and returns false.
+func (ic *ImportController) applyPlan(c *fiber.Ctx, teamID int, plan *models.ImportPlan) (bool, error) {
+	tables := map[string]string{"proxy": "proxies", "endpoint": "api_endpoints"}
+
+	befores := map[int]map[string]interface{}{}
+	for i, change := range plan.Changes {
+		if change.Action == models.ImportActionUpdate {
+			befores[i] = auditSnapshot(ic.DB, tables[change.ResourceType], change.ID)
+		}
+	}
+
+	tx, err := ic.DB.Begin()
+	if err != nil {
+		return false, c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	proxyIDs := map[string]int{}
+	for i := range plan.Changes {
+		change := &plan.Changes[i]
+		if change.ResourceType != "proxy" {
+			continue
+		}
+
+		proxy := services.ProxyFromDocument(*change, teamID)
+		switch change.Action {
+		case models.ImportActionCreate:
+			err = insertProxyRow(tx, &proxy)
+			change.ID = proxy.ID
+		case models.ImportActionUpdate:
+			err = updateProxyRow(tx, change.ID, &proxy)
+		}
+		if err != nil {
+			return false, importFailed(c, "proxy", change.Key, err)
+		}
+		proxyIDs[change.Key] = change.ID
+	}
+
+	for i := range plan.Changes {
+		change := &plan.Changes[i]
+		if change.ResourceType != "endpoint" || change.Action == models.ImportActionUnchanged {
+			continue
+		}
+
+		var proxyID *int
+		if name := change.Endpoint.Proxy; name != "" {
+			id, exists := proxyIDs[name]
+			if !exists {
+				err := tx.QueryRow("SELECT id FROM proxies WHERE name = $1 AND team_id = $2", name, teamID).Scan(&id)
+				if err != nil {
+					return false, importFailed(c, "endpoint", change.Key, err)
+				}
+			}
+			proxyID = &id
+		}
+
+		endpoint := services.EndpointFromDocument(*change, teamID, proxyID)
+		changeType := models.EndpointChangeUpdate
+		if change.Action == models.ImportActionCreate {
+			changeType = models.EndpointChangeCreate
+			err = insertEndpointRow(tx, &endpoint)
+			change.ID = endpoint.ID
+		} else {
+			err = updateEndpointRow(tx, change.ID, &endpoint)
+		}
+		if err == nil {
+			_, err = services.RecordEndpointVersion(tx, change.ID, currentUser(c), changeType, nil)
+		}
+		if err == nil {
+			err = issuePingToken(c, tx, &endpoint, false)
+			change.PingURL = endpoint.PingURL
+		}
+		if err != nil {
+			return false, importFailed(c, "endpoint", change.Key, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	for i, change := range plan.Changes {
+		if change.Action == models.ImportActionUnchanged {
+			continue
+		}
+
+		if change.ResourceType == "endpoint" {
+			if endpoint, err := services.FindEndpoint(ic.DB, change.ID); err == nil && endpoint.IsActive {
+				ic.Monitor.ScheduleEndpoint(endpoint)
+			} else {
+				ic.Monitor.UnscheduleEndpoint(change.ID)
+			}
+		}
+
+		entry := auditEntry(c, change.ResourceType+"."+change.Action, change.ResourceType, change.ID)
+		entry.Details["source"] = "import"
+		entry.Before = befores[i]
+		entry.After = auditSnapshot(ic.DB, tables[change.ResourceType], change.ID)
+		services.RecordAudit(ic.DB, entry)
+	}
+
+	return true, nil
+}
+
+// importFailed reports the resource an import stopped at; the transaction is rolled back
+func importFailed(c *fiber.Ctx, resourceType, key string, err error) error {
+	if strings.Contains(err.Error(), "duplicate key") {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "Import failed: " + resourceType + " " + key + " conflicts with a change made meanwhile, try again",
+		})
+	}
+	return c.Status(500).JSON(fiber.Map{
+		"error": "Import failed at " + resourceType + " " + key,
+	})
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+	"api-monitor/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// InvitationController lets admins issue single-use registration invitations
+type InvitationController struct {
+	DB *sql.DB
+}
+
+func NewInvitationController(db *sql.DB) *InvitationController {
+	return &InvitationController{DB: db}
+}
+
+// GetInvitations lists invitations, newest first. Tokens are never returned here.
+func (ic *InvitationController) GetInvitations(c *fiber.Ctx) error {
+	rows, err := ic.DB.Query(`
+		SELECT id, role, team_id, COALESCE(team_role, ''), created_by, used_by, expires_at, used_at, created_at
+		FROM invitations
+		ORDER BY created_at DESC`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch invitations"})
+	}
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		var invitation models.Invitation
+		var teamID, createdBy, usedBy sql.NullInt64
+		var usedAt sql.NullTime
+
+		err := rows.Scan(&invitation.ID, &invitation.Role, &teamID, &invitation.TeamRole,
+			&createdBy, &usedBy, &invitation.ExpiresAt, &usedAt, &invitation.CreatedAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan invitation data"})
+		}
+
+		if teamID.Valid {
+			teamIDInt := int(teamID.Int64)
+			invitation.TeamID = &teamIDInt
+		}
+		if createdBy.Valid {
+			createdByInt := int(createdBy.Int64)
+			invitation.CreatedBy = &createdByInt
+		}
+		if usedBy.Valid {
+			usedByInt := int(usedBy.Int64)
+			invitation.UsedBy = &usedByInt
+		}
+		if usedAt.Valid {
+			invitation.UsedAt = &usedAt.Time
+		}
+
+		invitations = append(invitations, invitation)
+	}
+
+	return c.JSON(fiber.Map{
+		"data": invitations,
+	})
+}
+
+// CreateInvitation issues an invitation. The token is only returned in this response.
+func (ic *InvitationController) CreateInvitation(c *fiber.Ctx) error {
+	var req struct {
+		Role           string `json:"role"`
+		TeamID         *int   `json:"team_id"`
+		TeamRole       string `json:"team_role"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.Role == "" {
+		req.Role = "user"
+	}
+	if !validUserRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": "Role must be user or admin"})
+	}
+
+	var teamRole interface{}
+	if req.TeamID != nil {
+		if req.TeamRole == "" {
+			req.TeamRole = models.TeamRoleViewer
+		}
+		if !services.ValidTeamRole(req.TeamRole) {
+			return c.Status(400).JSON(fiber.Map{"error": "Team role must be one of viewer, editor, owner"})
+		}
+		teamRole = req.TeamRole
+	}
+
+	if req.ExpiresInHours <= 0 {
+		req.ExpiresInHours = 72
+	}
+	if req.ExpiresInHours > 24*30 {
+		return c.Status(400).JSON(fiber.Map{"error": "Invitations can be valid for at most 30 days"})
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not generate invitation"})
+	}
+
+	createdBy := currentUser(c).ID
+	invitation := models.Invitation{
+		Token:     token,
+		Role:      req.Role,
+		TeamID:    req.TeamID,
+		TeamRole:  req.TeamRole,
+		CreatedBy: &createdBy,
+		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour),
+	}
+
+	err = ic.DB.QueryRow(`
+		INSERT INTO invitations (token_hash, role, team_id, team_role, created_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, created_at`,
+		utils.HashToken(token), invitation.Role, invitation.TeamID, teamRole, createdBy, invitation.ExpiresAt).
+		Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "foreign key") {
+			return c.Status(404).JSON(fiber.Map{"error": "Team not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create invitation"})
+	}
+
+	recordChange(c, ic.DB, "invitation.create", "invitation", invitation.ID, nil, auditSnapshot(ic.DB, "invitations", invitation.ID))
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "Invitation created successfully",
+		"data":    invitation,
+	})
+}
+
+// DeleteInvitation revokes an invitation that has not been used yet
+func (ic *InvitationController) DeleteInvitation(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid invitation ID"})
+	}
+
+	before := auditSnapshot(ic.DB, "invitations", id)
+	result, err := ic.DB.Exec("DELETE FROM invitations WHERE id = $1 AND used_at IS NULL", id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete invitation"})
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to verify deletion"})
+	}
+
+	if rowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Invitation not found or already used"})
+	}
+
+	recordChange(c, ic.DB, "invitation.delete", "invitation", id, before, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Invitation revoked successfully",
+	})
+}
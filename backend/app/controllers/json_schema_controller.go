@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// JSONSchemaController manages the library of JSON Schemas that endpoints validate their
+// responses against
+type JSONSchemaController struct {
+	DB *sql.DB
+}
+
+func NewJSONSchemaController(db *sql.DB) *JSONSchemaController {
+	return &JSONSchemaController{DB: db}
+}
+
+// GetJSONSchemas lists the library schemas of the user's teams by name
+func (sc *JSONSchemaController) GetJSONSchemas(c *fiber.Ctx) error {
+	query := services.JSONSchemaSelect
+	scope, args := services.TeamScope(currentUser(c), "team_id", models.TeamRoleViewer, 1)
+	if scope != "" {
+		query += " WHERE " + scope
+	}
+	query += " ORDER BY name"
+
+	rows, err := sc.DB.Query(query, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch JSON schemas"})
+	}
+	defer rows.Close()
+
+	schemas := []models.JSONSchema{}
+	for rows.Next() {
+		schema, err := services.ScanJSONSchema(rows)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan JSON schema data"})
+		}
+		schemas = append(schemas, schema)
+	}
+
+	return c.JSON(fiber.Map{
+		"data": schemas,
+	})
+}
+
+// GetJSONSchema returns one library schema
+func (sc *JSONSchemaController) GetJSONSchema(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON schema ID"})
+	}
+
+	if _, ok, err := authorizeTeamRow(c, sc.DB, "json_schemas", id, models.TeamRoleViewer, "JSON schema not found"); !ok {
+		return err
+	}
+
+	schema, err := services.FindJSONSchema(sc.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "JSON schema not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch JSON schema"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": schema,
+	})
+}
+
+// CreateJSONSchema adds a schema to the library
+func (sc *JSONSchemaController) CreateJSONSchema(c *fiber.Ctx) error {
+	var schema models.JSONSchema
+	if err := c.BodyParser(&schema); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if ok, err := validateJSONSchema(c, schema); !ok {
+		return err
+	}
+
+	teamID, ok, err := resolveTeam(c, sc.DB, schema.TeamID)
+	if !ok {
+		return err
+	}
+	schema.TeamID = &teamID
+
+	schemaJSON, err := json.Marshal(schema.Schema)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid schema"})
+	}
+
+	err = sc.DB.QueryRow(`
+		INSERT INTO json_schemas (name, description, schema, team_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING id, created_at, updated_at`,
+		schema.Name, schema.Description, string(schemaJSON), schema.TeamID,
+	).Scan(&schema.ID, &schema.CreatedAt, &schema.UpdatedAt)
+
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{"error": "JSON schema name already exists"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create JSON schema"})
+	}
+
+	recordChange(c, sc.DB, "json_schema.create", "json_schema", schema.ID, nil, auditSnapshot(sc.DB, "json_schemas", schema.ID))
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "JSON schema created successfully",
+		"data":    schema,
+	})
+}
+
+// UpdateJSONSchema replaces a library schema; endpoints using it validate against the new
+// version from their next check on
+func (sc *JSONSchemaController) UpdateJSONSchema(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON schema ID"})
+	}
+
+	currentTeamID, ok, err := authorizeTeamRow(c, sc.DB, "json_schemas", id, models.TeamRoleEditor, "JSON schema not found")
+	if !ok {
+		return err
+	}
+	before := auditSnapshot(sc.DB, "json_schemas", id)
+
+	var schema models.JSONSchema
+	if err := c.BodyParser(&schema); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if ok, err := validateJSONSchema(c, schema); !ok {
+		return err
+	}
+
+	if schema.TeamID, ok, err = moveTeam(c, sc.DB, id, currentTeamID, schema.TeamID, "response_schema_id"); !ok {
+		return err
+	}
+
+	schemaJSON, err := json.Marshal(schema.Schema)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid schema"})
+	}
+
+	err = sc.DB.QueryRow(`
+		UPDATE json_schemas
+		SET name = $1, description = $2, schema = $3, team_id = $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING id, created_at, updated_at`,
+		schema.Name, schema.Description, string(schemaJSON), schema.TeamID, id,
+	).Scan(&schema.ID, &schema.CreatedAt, &schema.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "JSON schema not found"})
+		}
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{"error": "JSON schema name already exists"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update JSON schema"})
+	}
+
+	recordChange(c, sc.DB, "json_schema.update", "json_schema", id, before, auditSnapshot(sc.DB, "json_schemas", id))
+
+	return c.JSON(fiber.Map{
+		"message": "JSON schema updated successfully",
+		"data":    schema,
+	})
+}
+
+// DeleteJSONSchema removes a schema that no endpoint uses
+func (sc *JSONSchemaController) DeleteJSONSchema(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON schema ID"})
+	}
+
+	if _, ok, err := authorizeTeamRow(c, sc.DB, "json_schemas", id, models.TeamRoleEditor, "JSON schema not found"); !ok {
+		return err
+	}
+
+	before := auditSnapshot(sc.DB, "json_schemas", id)
+	result, err := sc.DB.Exec("DELETE FROM json_schemas WHERE id = $1", id)
+	if err != nil {
+		if strings.Contains(err.Error(), "foreign key") {
+			return c.Status(409).JSON(fiber.Map{"error": "JSON schema is used by endpoints"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete JSON schema"})
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to verify deletion"})
+	}
+
+	if rowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "JSON schema not found"})
+	}
+
+	recordChange(c, sc.DB, "json_schema.delete", "json_schema", id, before, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "JSON schema deleted successfully",
+	})
+}
+
+// validateJSONSchema checks the name of a library schema and that the schema compiles
+func validateJSONSchema(c *fiber.Ctx, schema models.JSONSchema) (bool, error) {
+	if schema.Name == "" || schema.Schema == nil {
+		return false, c.Status(400).JSON(fiber.Map{"error": "Name and schema are required"})
+	}
+	if _, err := services.CompileSchema(schema.Schema); err != nil {
+		return false, c.Status(400).JSON(fiber.Map{"error": "schema is not a valid JSON Schema: " + err.Error()})
+	}
+	return true, nil
+}
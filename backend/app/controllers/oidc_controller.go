@@ -0,0 +1,369 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+	"api-monitor/config"
+	"api-monitor/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcLoginTTL limits how long a user may take at the identity provider
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcHandoffTTL limits how long the frontend has to exchange the one-time login code
+const oidcHandoffTTL = time.Minute
+
+// oidcStateCookie binds the login to the browser that started it, so a callback URL
+// of someone else's login cannot be used to sign a victim in (login CSRF)
+const oidcStateCookie = "oidc_state"
+
+// OIDCController implements single sign-on: the browser is sent to the identity provider,
+// comes back to Callback, and is then redirected to the frontend with a one-time code
+// that the frontend exchanges for the usual access and refresh tokens.
+type OIDCController struct {
+	DB       *sql.DB
+	Provider *services.OIDCProvider
+}
+
+func NewOIDCController(db *sql.DB, provider *services.OIDCProvider) *OIDCController {
+	return &OIDCController{
+		DB:       db,
+		Provider: provider,
+	}
+}
+
+// Providers tells the login page which login methods are available
+func (oc *OIDCController) Providers(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"local":          config.LocalLoginEnabled(),
+		"oidc":           oc.Provider.Config.Enabled(),
+		"oidc_login_url": "/api/v1/auth/oidc/login",
+	})
+}
+
+// Login starts the authorization-code flow with PKCE and redirects to the identity provider
+func (oc *OIDCController) Login(c *fiber.Ctx) error {
+	if !oc.Provider.Config.Enabled() {
+		return c.Status(404).JSON(fiber.Map{"error": "Single sign-on is not configured"})
+	}
+
+	state, err := utils.RandomToken(24)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not start login"})
+	}
+	nonce, err := utils.RandomToken(24)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not start login"})
+	}
+	codeVerifier, err := utils.RandomToken(48)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not start login"})
+	}
+
+	authURL, err := oc.Provider.AuthCodeURL(state, nonce, codeVerifier)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		return c.Status(502).JSON(fiber.Map{"error": "Identity provider is unavailable"})
+	}
+
+	_, err = oc.DB.Exec(`
+		INSERT INTO oidc_logins (state, nonce, code_verifier, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW())`, state, nonce, codeVerifier, time.Now().Add(oidcLoginTTL))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not start login"})
+	}
+
+	c.Cookie(oc.stateCookie(state, time.Now().Add(oidcLoginTTL)))
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// Callback receives the authorization code, verifies the ID token, provisions the user
+// and redirects the browser to the frontend with a one-time login code
+func (oc *OIDCController) Callback(c *fiber.Ctx) error {
+	if !oc.Provider.Config.Enabled() {
+		return c.Status(404).JSON(fiber.Map{"error": "Single sign-on is not configured"})
+	}
+
+	// The state is single use, the cookie is dropped whatever the outcome
+	browserState := c.Cookies(oidcStateCookie)
+	c.Cookie(oc.stateCookie("", time.Unix(0, 0)))
+
+	if providerError := c.Query("error"); providerError != "" {
+		message := c.Query("error_description", providerError)
+		return oc.redirectToFrontend(c, "sso_error", message)
+	}
+
+	state := c.Query("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(browserState), []byte(state)) != 1 {
+		return oc.redirectToFrontend(c, "sso_error", "Login was not started in this browser, please try again")
+	}
+
+	var loginID int
+	var nonce, codeVerifier string
+	err := oc.DB.QueryRow(`
+		SELECT id, nonce, code_verifier FROM oidc_logins
+		WHERE state = $1 AND login_code_hash IS NULL AND expires_at > NOW()`, state).
+		Scan(&loginID, &nonce, &codeVerifier)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return oc.redirectToFrontend(c, "sso_error", "Login expired, please try again")
+		}
+		return oc.redirectToFrontend(c, "sso_error", "Database error")
+	}
+
+	claims, err := oc.Provider.Exchange(c.Query("code"), codeVerifier, nonce)
+	if err != nil {
+		log.Printf("OIDC callback failed: %v", err)
+		return oc.redirectToFrontend(c, "sso_error", "Could not verify the identity provider response")
+	}
+
+	user, err := oc.provisionUser(claims)
+	if err != nil {
+		log.Printf("OIDC login rejected for %s: %v", services.ClaimString(claims, "sub"), err)
+		return oc.redirectToFrontend(c, "sso_error", err.Error())
+	}
+
+	loginCode, err := utils.RandomToken(32)
+	if err != nil {
+		return oc.redirectToFrontend(c, "sso_error", "Could not complete login")
+	}
+
+	result, err := oc.DB.Exec(`
+		UPDATE oidc_logins SET user_id = $1, login_code_hash = $2, expires_at = $3
+		WHERE id = $4 AND login_code_hash IS NULL`,
+		user.ID, utils.HashToken(loginCode), time.Now().Add(oidcHandoffTTL), loginID)
+	if err != nil {
+		return oc.redirectToFrontend(c, "sso_error", "Database error")
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return oc.redirectToFrontend(c, "sso_error", "Login expired, please try again")
+	}
+
+	log.Printf("OIDC login successful for user: %s", user.Username)
+	return oc.redirectToFrontend(c, "sso_code", loginCode)
+}
+
+// Exchange trades the one-time login code from Callback for access and refresh tokens
+func (oc *OIDCController) Exchange(c *fiber.Ctx) error {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.Code == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "code is required"})
+	}
+
+	var user models.User
+	err := oc.DB.QueryRow(`
+		WITH login AS (
+			DELETE FROM oidc_logins
+			WHERE login_code_hash = $1 AND expires_at > NOW()
+			RETURNING user_id
+		)
+		SELECT u.id, u.username, u.role, u.is_active, u.created_at, u.updated_at
+		FROM users u
+		JOIN login ON login.user_id = u.id
+		WHERE u.is_active = true`, utils.HashToken(req.Code)).
+		Scan(&user.ID, &user.Username, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(401).JSON(fiber.Map{"error": "Invalid or expired login code"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	response, err := startSession(oc.DB, c, user)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Could not generate token"})
+	}
+
+	return c.JSON(response)
+}
+
+// provisionUser finds the user linked to the ID token subject, or creates one just in
+// time. When admin groups are configured the role follows the identity provider on
+// every login.
+func (oc *OIDCController) provisionUser(claims jwt.MapClaims) (models.User, error) {
+	cfg := oc.Provider.Config
+	subject := services.ClaimString(claims, "sub")
+	groups := services.ClaimList(claims, cfg.GroupsClaim)
+
+	if len(cfg.AllowedGroups) > 0 && !anyGroup(groups, cfg.AllowedGroups) {
+		return models.User{}, fmt.Errorf("You are not allowed to use this application")
+	}
+
+	role := ""
+	if len(cfg.AdminGroups) > 0 {
+		role = "user"
+		if anyGroup(groups, cfg.AdminGroups) {
+			role = "admin"
+		}
+	}
+
+	tx, err := oc.DB.Begin()
+	if err != nil {
+		return models.User{}, fmt.Errorf("Database error")
+	}
+	defer tx.Rollback()
+
+	var user models.User
+	var linkedSubject sql.NullString
+	err = tx.QueryRow(`
+		SELECT id, username, role, is_active, oidc_subject, created_at, updated_at
+		FROM users WHERE oidc_subject = $1
+		FOR UPDATE`, subject).
+		Scan(&user.ID, &user.Username, &user.Role, &user.IsActive, &linkedSubject, &user.CreatedAt, &user.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		username := oidcUsername(claims, cfg.UsernameClaim)
+
+		// An existing local account is only taken over when explicitly allowed
+		err = tx.QueryRow(`
+			SELECT id, username, role, is_active, oidc_subject, created_at, updated_at
+			FROM users WHERE username = $1
+			FOR UPDATE`, username).
+			Scan(&user.ID, &user.Username, &user.Role, &user.IsActive, &linkedSubject, &user.CreatedAt, &user.UpdatedAt)
+		switch {
+		case err == nil && (linkedSubject.Valid || !cfg.LinkByUsername):
+			return models.User{}, fmt.Errorf("An account named %s already exists", username)
+		case err == nil:
+			_, err = tx.Exec("UPDATE users SET oidc_subject = $1, updated_at = NOW() WHERE id = $2", subject, user.ID)
+			if err != nil {
+				return models.User{}, fmt.Errorf("Database error")
+			}
+			log.Printf("Linked user %s to OIDC subject %s", user.Username, subject)
+		case err == sql.ErrNoRows:
+			user, err = oc.createUser(tx, username, subject, role)
+			if err != nil {
+				return models.User{}, err
+			}
+		default:
+			return models.User{}, fmt.Errorf("Database error")
+		}
+	} else if err != nil {
+		return models.User{}, fmt.Errorf("Database error")
+	}
+
+	if !user.IsActive {
+		return models.User{}, fmt.Errorf("Your account is deactivated")
+	}
+
+	if role != "" && role != user.Role {
+		_, err = tx.Exec("UPDATE users SET role = $1, updated_at = NOW() WHERE id = $2", role, user.ID)
+		if err != nil {
+			return models.User{}, fmt.Errorf("Database error")
+		}
+		log.Printf("Role of %s changed from %s to %s by identity provider groups", user.Username, user.Role, role)
+		user.Role = role
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.User{}, fmt.Errorf("Database error")
+	}
+
+	return user, nil
+}
+
+// createUser provisions a user without a local password; like open registration it
+// joins the registration team as viewer
+func (oc *OIDCController) createUser(tx *sql.Tx, username, subject, role string) (models.User, error) {
+	if role == "" {
+		role = "user"
+	}
+
+	var user models.User
+	err := tx.QueryRow(`
+		INSERT INTO users (username, password, role, is_active, oidc_subject, created_at, updated_at)
+		VALUES ($1, '', $2, true, $3, NOW(), NOW())
+		RETURNING id, username, role, is_active, created_at, updated_at`,
+		username, role, subject).
+		Scan(&user.ID, &user.Username, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return user, fmt.Errorf("Could not create user")
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO team_members (team_id, user_id, role, created_at)
+		SELECT id, $1, $2, NOW() FROM teams WHERE name = $3`,
+		user.ID, models.TeamRoleViewer, config.GetRegistrationTeam())
+	if err != nil {
+		return user, fmt.Errorf("Could not add user to team")
+	}
+
+	log.Printf("Provisioned user %s from OIDC subject %s (role %s)", user.Username, subject, user.Role)
+	return user, nil
+}
+
+// stateCookie is only sent to the callback. SameSite Lax still sends it on the top-level
+// redirect back from the identity provider.
+func (oc *OIDCController) stateCookie(state string, expires time.Time) *fiber.Cookie {
+	path := "/"
+	callback, err := url.Parse(oc.Provider.Config.RedirectURL)
+	if err == nil && callback.Path != "" {
+		path = callback.Path
+	}
+	return &fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     path,
+		Expires:  expires,
+		Secure:   err == nil && callback.Scheme == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	}
+}
+
+func (oc *OIDCController) redirectToFrontend(c *fiber.Ctx, key, value string) error {
+	target, err := url.Parse(oc.Provider.Config.FrontendURL)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Invalid OIDC_FRONTEND_URL"})
+	}
+
+	query := target.Query()
+	query.Set(key, value)
+	target.RawQuery = query.Encode()
+	return c.Redirect(target.String(), fiber.StatusFound)
+}
+
+// oidcUsername picks the username for a new user: the configured claim, then email, then sub
+func oidcUsername(claims jwt.MapClaims, claim string) string {
+	username := services.ClaimString(claims, claim)
+	if username == "" {
+		username = services.ClaimString(claims, "email")
+	}
+	if username == "" {
+		username = services.ClaimString(claims, "sub")
+	}
+
+	runes := []rune(strings.TrimSpace(username))
+	if len(runes) > 50 {
+		runes = runes[:50]
+	}
+	return string(runes)
+}
+
+func anyGroup(groups, wanted []string) bool {
+	for _, group := range groups {
+		for _, w := range wanted {
+			if group == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"api-monitor/app/fakedb"
+	"api-monitor/app/services"
+	"api-monitor/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// discoveryServer is an identity provider that only publishes its metadata
+func discoveryServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/jwks" {
+			w.Write([]byte(`{"keys":[]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func oidcTestConfig(issuer string) config.OIDCConfig {
+	return config.OIDCConfig{
+		Issuer:        issuer,
+		ClientID:      "api-monitor",
+		RedirectURL:   "https://monitor.test/api/v1/auth/oidc/callback",
+		FrontendURL:   "https://monitor.test/login",
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+	}
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	issuer := discoveryServer(t)
+	var states []driver.Value
+	db, fake := fakedb.Open(t, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "INSERT INTO oidc_logins"):
+			states = append(states, args[0])
+			return nil, nil, nil
+		case strings.Contains(query, "FROM oidc_logins"):
+			return []string{"id", "nonce", "code_verifier"}, nil, nil
+		}
+		return nil, nil, errors.New("unexpected query: " + query)
+	})
+	oc := NewOIDCController(db, services.NewOIDCProvider(oidcTestConfig(issuer.URL)))
+	app := fiber.New()
+	app.Get("/login", oc.Login)
+	app.Get("/callback", oc.Callback)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/login", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	state := location.Query().Get("state")
+	if resp.StatusCode != fiber.StatusFound || state == "" || len(states) != 1 || states[0] != state {
+		t.Fatalf("login: status %d, Location %s, stored states %v", resp.StatusCode, location, states)
+	}
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == oidcStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value != state || !cookie.HttpOnly || !cookie.Secure ||
+		cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/api/v1/auth/oidc/callback" {
+		t.Fatalf("state cookie = %+v, want an HttpOnly cookie for the callback holding %s", cookie, state)
+	}
+
+	callback := func(cookieValue string) (string, []string) {
+		req := httptest.NewRequest("GET", "/callback?code=c&state="+url.QueryEscape(state), nil)
+		if cookieValue != "" {
+			req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: cookieValue})
+		}
+		before := len(fake.Queries())
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		redirect, _ := url.Parse(resp.Header.Get("Location"))
+		cleared := false
+		for _, c := range resp.Cookies() {
+			cleared = cleared || (c.Name == oidcStateCookie && c.Value == "")
+		}
+		if !cleared {
+			t.Errorf("callback with cookie %q did not clear the state cookie", cookieValue)
+		}
+		return redirect.Query().Get("sso_error"), fake.Queries()[before:]
+	}
+
+	// Someone else's callback URL opened in the victim's browser is rejected before any lookup
+	for _, cookieValue := range []string{"", "state-of-another-login"} {
+		if message, queries := callback(cookieValue); !strings.Contains(message, "not started in this browser") || len(queries) != 0 {
+			t.Errorf("cookie %q: sso_error %q, queries %v", cookieValue, message, queries)
+		}
+	}
+
+	// With the cookie of the login the state is looked up; the fake has no pending login
+	if message, queries := callback(state); message != "Login expired, please try again" || len(queries) != 1 {
+		t.Errorf("matching cookie: sso_error %q, queries %v", message, queries)
+	}
+}
+
+type fakeOIDCUser struct {
+	id       int64
+	username string
+	role     string
+	active   bool
+	subject  driver.Value
+}
+
+// fakeOIDCUsers plays the users table for provisionUser
+type fakeOIDCUsers struct {
+	users   []*fakeOIDCUser
+	joined  []driver.Value // Arguments of the team_members insert
+	updates []string
+}
+
+func (f *fakeOIDCUsers) row(user *fakeOIDCUser) ([]string, [][]driver.Value, error) {
+	columns := []string{"id", "username", "role", "is_active", "oidc_subject", "created_at", "updated_at"}
+	if user == nil {
+		return columns, nil, nil
+	}
+	now := time.Now()
+	return columns, [][]driver.Value{{user.id, user.username, user.role, user.active, user.subject, now, now}}, nil
+}
+
+func (f *fakeOIDCUsers) find(match func(*fakeOIDCUser) bool) *fakeOIDCUser {
+	for _, user := range f.users {
+		if match(user) {
+			return user
+		}
+	}
+	return nil
+}
+
+func (f *fakeOIDCUsers) handle(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+	switch {
+	case strings.Contains(query, "WHERE oidc_subject = $1"):
+		return f.row(f.find(func(u *fakeOIDCUser) bool { return u.subject == args[0] }))
+	case strings.Contains(query, "WHERE username = $1"):
+		return f.row(f.find(func(u *fakeOIDCUser) bool { return u.username == args[0] }))
+	case strings.Contains(query, "INSERT INTO users"):
+		user := &fakeOIDCUser{id: int64(len(f.users) + 1), username: args[0].(string), role: args[1].(string),
+			active: true, subject: args[2]}
+		f.users = append(f.users, user)
+		now := time.Now()
+		return []string{"id", "username", "role", "is_active", "created_at", "updated_at"},
+			[][]driver.Value{{user.id, user.username, user.role, true, now, now}}, nil
+	case strings.Contains(query, "INSERT INTO team_members"):
+		f.joined = args
+		return nil, nil, nil
+	case strings.Contains(query, "UPDATE users SET oidc_subject"):
+		f.find(func(u *fakeOIDCUser) bool { return u.id == args[1] }).subject = args[0]
+		f.updates = append(f.updates, "oidc_subject")
+		return nil, nil, nil
+	case strings.Contains(query, "UPDATE users SET role"):
+		f.find(func(u *fakeOIDCUser) bool { return u.id == args[1] }).role = args[0].(string)
+		f.updates = append(f.updates, "role")
+		return nil, nil, nil
+	}
+	return nil, nil, errors.New("unexpected query: " + query)
+}
+
+func TestOIDCProvisionUser(t *testing.T) {
+	t.Setenv("REGISTRATION_TEAM", "Newcomers")
+
+	local := func() *fakeOIDCUser {
+		return &fakeOIDCUser{id: 7, username: "alice", role: "user", active: true}
+	}
+	linked := func(role string, active bool) *fakeOIDCUser {
+		return &fakeOIDCUser{id: 7, username: "alice", role: role, active: active, subject: "sub-1"}
+	}
+
+	cases := []struct {
+		name        string
+		existing    *fakeOIDCUser
+		configure   func(*config.OIDCConfig)
+		groups      []interface{}
+		wantErr     string
+		wantRole    string
+		wantJoined  bool
+		wantUpdates []string
+	}{
+		{name: "new user joins the registration team", wantRole: "user", wantJoined: true},
+		{name: "new user of an admin group",
+			configure: func(c *config.OIDCConfig) { c.AdminGroups = []string{"admins"} },
+			groups:    []interface{}{"staff", "admins"}, wantRole: "admin", wantJoined: true},
+		{name: "linked user keeps the role without admin groups", existing: linked("admin", true), wantRole: "admin"},
+		{name: "linked user loses admin with the group",
+			configure: func(c *config.OIDCConfig) { c.AdminGroups = []string{"admins"} },
+			existing:  linked("admin", true), groups: []interface{}{"staff"}, wantRole: "user", wantUpdates: []string{"role"}},
+		{name: "deactivated user", existing: linked("user", false), wantErr: "Your account is deactivated"},
+		{name: "local account is not taken over", existing: local(), wantErr: "An account named alice already exists"},
+		{name: "local account linked when allowed",
+			configure: func(c *config.OIDCConfig) { c.LinkByUsername = true },
+			existing:  local(), wantRole: "user", wantUpdates: []string{"oidc_subject"}},
+		{name: "account of another subject is never linked",
+			configure: func(c *config.OIDCConfig) { c.LinkByUsername = true },
+			existing:  &fakeOIDCUser{id: 7, username: "alice", role: "user", active: true, subject: "sub-2"},
+			wantErr:   "An account named alice already exists"},
+		{name: "not in an allowed group",
+			configure: func(c *config.OIDCConfig) { c.AllowedGroups = []string{"monitoring"} },
+			groups:    []interface{}{"staff"}, wantErr: "You are not allowed to use this application"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			users := &fakeOIDCUsers{}
+			if tc.existing != nil {
+				users.users = append(users.users, tc.existing)
+			}
+			db, fake := fakedb.Open(t, users.handle)
+			cfg := oidcTestConfig("https://idp.test")
+			if tc.configure != nil {
+				tc.configure(&cfg)
+			}
+			oc := NewOIDCController(db, services.NewOIDCProvider(cfg))
+
+			claims := jwt.MapClaims{"sub": "sub-1", "preferred_username": " alice "}
+			if tc.groups != nil {
+				claims["groups"] = tc.groups
+			}
+			user, err := oc.provisionUser(claims)
+
+			queries := fake.Queries()
+			committed := len(queries) > 0 && queries[len(queries)-1] == "COMMIT"
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr || committed {
+					t.Fatalf("error = %v, committed %v; want %q", err, committed, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || !committed {
+				t.Fatalf("error = %v, committed %v", err, committed)
+			}
+			if user.Username != "alice" || user.Role != tc.wantRole {
+				t.Errorf("user = %s (%s), want alice (%s)", user.Username, user.Role, tc.wantRole)
+			}
+			if stored := users.find(func(u *fakeOIDCUser) bool { return u.subject == "sub-1" }); stored == nil || stored.role != tc.wantRole {
+				t.Errorf("stored user = %+v, want linked to sub-1 with role %s", stored, tc.wantRole)
+			}
+			if joined := users.joined != nil; joined != tc.wantJoined || (joined && users.joined[2] != "Newcomers") {
+				t.Errorf("team_members insert = %v, want one for a new user into Newcomers", users.joined)
+			}
+			if strings.Join(users.updates, ",") != strings.Join(tc.wantUpdates, ",") {
+				t.Errorf("updates = %v, want %v", users.updates, tc.wantUpdates)
+			}
+		})
+	}
+}
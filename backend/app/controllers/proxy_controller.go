@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"api-monitor/app/models"
+	"api-monitor/app/services"
 	"database/sql"
 	"strconv"
 	"time"
@@ -17,15 +18,19 @@ func NewProxyController(db *sql.DB) *ProxyController {
 	return &ProxyController{db: db}
 }
 
-// GetProxies retrieves all proxies
+// GetProxies retrieves the proxies of the user's teams with passwords masked
 func (pc *ProxyController) GetProxies(c *fiber.Ctx) error {
 	query := `
-		SELECT id, name, host, port, username, password, is_active, created_at, updated_at 
-		FROM proxies 
-		ORDER BY created_at DESC
-	`
+		SELECT id, name, host, port, username, password, is_active, team_id, created_at, updated_at 
+		FROM proxies`
+
+	scope, args := services.TeamScope(currentUser(c), "team_id", models.TeamRoleViewer, 1)
+	if scope != "" {
+		query += " WHERE " + scope
+	}
+	query += " ORDER BY created_at DESC"
 
-	rows, err := pc.db.Query(query)
+	rows, err := pc.db.Query(query, args...)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to fetch proxies",
@@ -36,6 +41,7 @@ func (pc *ProxyController) GetProxies(c *fiber.Ctx) error {
 	var proxies []models.Proxy
 	for rows.Next() {
 		var proxy models.Proxy
+		var teamID sql.NullInt64
 		err := rows.Scan(
 			&proxy.ID,
 			&proxy.Name,
@@ -44,6 +50,7 @@ func (pc *ProxyController) GetProxies(c *fiber.Ctx) error {
 			&proxy.Username,
 			&proxy.Password,
 			&proxy.IsActive,
+			&teamID,
 			&proxy.CreatedAt,
 			&proxy.UpdatedAt,
 		)
@@ -52,7 +59,11 @@ func (pc *ProxyController) GetProxies(c *fiber.Ctx) error {
 				"error": "Failed to scan proxy data",
 			})
 		}
-		proxies = append(proxies, proxy)
+		if teamID.Valid {
+			teamIDInt := int(teamID.Int64)
+			proxy.TeamID = &teamIDInt
+		}
+		proxies = append(proxies, maskProxy(proxy))
 	}
 
 	return c.JSON(fiber.Map{
@@ -76,34 +87,24 @@ func (pc *ProxyController) CreateProxy(c *fiber.Ctx) error {
 		})
 	}
 
-	now := time.Now()
-	query := `
-		INSERT INTO proxies (name, host, port, username, password, is_active, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, created_at, updated_at
-	`
-
-	err := pc.db.QueryRow(
-		query,
-		proxy.Name,
-		proxy.Host,
-		proxy.Port,
-		proxy.Username,
-		proxy.Password,
-		proxy.IsActive,
-		now,
-		now,
-	).Scan(&proxy.ID, &proxy.CreatedAt, &proxy.UpdatedAt)
+	teamID, ok, err := resolveTeam(c, pc.db, proxy.TeamID)
+	if !ok {
+		return err
+	}
+	proxy.TeamID = &teamID
 
+	err = insertProxyRow(pc.db, &proxy)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to create proxy",
 		})
 	}
 
+	recordChange(c, pc.db, "proxy.create", "proxy", proxy.ID, nil, auditSnapshot(pc.db, "proxies", proxy.ID))
+
 	return c.Status(201).JSON(fiber.Map{
 		"message": "Proxy created successfully",
-		"data":    proxy,
+		"data":    maskProxy(proxy),
 	})
 }
 
@@ -116,6 +117,19 @@ func (pc *ProxyController) UpdateProxy(c *fiber.Ctx) error {
 		})
 	}
 
+	currentTeamID, ok, err := pc.authorizeProxy(c, id, models.TeamRoleEditor)
+	if !ok {
+		return err
+	}
+	var storedPassword string
+	if err := pc.db.QueryRow("SELECT password FROM proxies WHERE id = $1", id).Scan(&storedPassword); err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "Proxy not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch proxy"})
+	}
+	before := auditSnapshot(pc.db, "proxies", id)
+
 	var proxy models.Proxy
 	if err := c.BodyParser(&proxy); err != nil {
 		return c.Status(400).JSON(fiber.Map{
@@ -123,6 +137,9 @@ func (pc *ProxyController) UpdateProxy(c *fiber.Ctx) error {
 		})
 	}
 
+	// Keep the stored password the client only saw masked
+	proxy.Password = unmask(proxy.Password, storedPassword)
+
 	// Validate required fields
 	if proxy.Name == "" || proxy.Host == "" || proxy.Port == 0 {
 		return c.Status(400).JSON(fiber.Map{
@@ -130,25 +147,11 @@ func (pc *ProxyController) UpdateProxy(c *fiber.Ctx) error {
 		})
 	}
 
-	query := `
-		UPDATE proxies 
-		SET name = $1, host = $2, port = $3, username = $4, password = $5, is_active = $6, updated_at = $7
-		WHERE id = $8
-		RETURNING id, created_at, updated_at
-	`
-
-	err = pc.db.QueryRow(
-		query,
-		proxy.Name,
-		proxy.Host,
-		proxy.Port,
-		proxy.Username,
-		proxy.Password,
-		proxy.IsActive,
-		time.Now(),
-		id,
-	).Scan(&proxy.ID, &proxy.CreatedAt, &proxy.UpdatedAt)
+	if proxy.TeamID, ok, err = moveTeam(c, pc.db, id, currentTeamID, proxy.TeamID, "proxy_id"); !ok {
+		return err
+	}
 
+	err = updateProxyRow(pc.db, id, &proxy)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(404).JSON(fiber.Map{
@@ -160,9 +163,11 @@ func (pc *ProxyController) UpdateProxy(c *fiber.Ctx) error {
 		})
 	}
 
+	recordChange(c, pc.db, "proxy.update", "proxy", id, before, auditSnapshot(pc.db, "proxies", id))
+
 	return c.JSON(fiber.Map{
 		"message": "Proxy updated successfully",
-		"data":    proxy,
+		"data":    maskProxy(proxy),
 	})
 }
 
@@ -175,6 +180,11 @@ func (pc *ProxyController) DeleteProxy(c *fiber.Ctx) error {
 		})
 	}
 
+	if _, ok, err := pc.authorizeProxy(c, id, models.TeamRoleEditor); !ok {
+		return err
+	}
+	before := auditSnapshot(pc.db, "proxies", id)
+
 	query := "DELETE FROM proxies WHERE id = $1"
 	result, err := pc.db.Exec(query, id)
 	if err != nil {
@@ -196,6 +206,8 @@ func (pc *ProxyController) DeleteProxy(c *fiber.Ctx) error {
 		})
 	}
 
+	recordChange(c, pc.db, "proxy.delete", "proxy", id, before, nil)
+
 	return c.JSON(fiber.Map{
 		"message": "Proxy deleted successfully",
 	})
@@ -210,6 +222,11 @@ func (pc *ProxyController) ToggleProxy(c *fiber.Ctx) error {
 		})
 	}
 
+	if _, ok, err := pc.authorizeProxy(c, id, models.TeamRoleEditor); !ok {
+		return err
+	}
+	before := auditSnapshot(pc.db, "proxies", id)
+
 	query := `
 		UPDATE proxies 
 		SET is_active = NOT is_active, updated_at = $1
@@ -230,6 +247,8 @@ func (pc *ProxyController) ToggleProxy(c *fiber.Ctx) error {
 		})
 	}
 
+	recordChange(c, pc.db, "proxy.toggle", "proxy", id, before, auditSnapshot(pc.db, "proxies", id))
+
 	return c.JSON(fiber.Map{
 		"message": "Proxy status toggled successfully",
 		"data": fiber.Map{
@@ -238,3 +257,69 @@ func (pc *ProxyController) ToggleProxy(c *fiber.Ctx) error {
 		},
 	})
 }
+
+// insertProxyRow creates a proxy, setting its ID and timestamps
+func insertProxyRow(q queryExecer, proxy *models.Proxy) error {
+	now := time.Now()
+	query := `
+		INSERT INTO proxies (name, host, port, username, password, is_active, team_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at, updated_at
+	`
+
+	return q.QueryRow(
+		query,
+		proxy.Name,
+		proxy.Host,
+		proxy.Port,
+		proxy.Username,
+		proxy.Password,
+		proxy.IsActive,
+		proxy.TeamID,
+		now,
+		now,
+	).Scan(&proxy.ID, &proxy.CreatedAt, &proxy.UpdatedAt)
+}
+
+// updateProxyRow saves all fields of a proxy
+func updateProxyRow(q queryExecer, proxyID int, proxy *models.Proxy) error {
+	query := `
+		UPDATE proxies 
+		SET name = $1, host = $2, port = $3, username = $4, password = $5, is_active = $6, team_id = $7, updated_at = $8
+		WHERE id = $9
+		RETURNING id, created_at, updated_at
+	`
+
+	return q.QueryRow(
+		query,
+		proxy.Name,
+		proxy.Host,
+		proxy.Port,
+		proxy.Username,
+		proxy.Password,
+		proxy.IsActive,
+		proxy.TeamID,
+		time.Now(),
+		proxyID,
+	).Scan(&proxy.ID, &proxy.CreatedAt, &proxy.UpdatedAt)
+}
+
+func maskProxy(proxy models.Proxy) models.Proxy {
+	proxy.Password = mask(proxy.Password)
+	return proxy
+}
+
+// authorizeProxy checks the current user's role on the proxy's team and returns that team
+func (pc *ProxyController) authorizeProxy(c *fiber.Ctx, proxyID int, required string) (sql.NullInt64, bool, error) {
+	var teamID sql.NullInt64
+	err := pc.db.QueryRow("SELECT team_id FROM proxies WHERE id = $1", proxyID).Scan(&teamID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return teamID, false, c.Status(404).JSON(fiber.Map{"error": "Proxy not found"})
+		}
+		return teamID, false, c.Status(500).JSON(fiber.Map{"error": "Failed to fetch proxy"})
+	}
+
+	ok, err := authorizeTeam(c, pc.db, teamID, required, "Proxy not found")
+	return teamID, ok, err
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"api-monitor/app/models"
+)
+
+// proxyRows plays a proxies table with one proxy of team 1 whose password is "stored";
+// updates are kept in updated
+func proxyRows(updated *[]driver.Value) func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+	return func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "SELECT team_id FROM proxies"):
+			return []string{"team_id"}, [][]driver.Value{{int64(1)}}, nil
+		case strings.Contains(query, "SELECT password FROM proxies"):
+			return []string{"password"}, [][]driver.Value{{"stored"}}, nil
+		case strings.Contains(query, "FROM proxies"):
+			columns := []string{"id", "name", "host", "port", "username", "password", "is_active", "team_id", "created_at", "updated_at"}
+			return columns, [][]driver.Value{{int64(7), "corp", "proxy.internal", int64(3128), "user", "stored", true, int64(1), time.Now(), time.Now()}}, nil
+		case strings.Contains(query, "UPDATE proxies"):
+			*updated = args
+			return []string{"id", "created_at", "updated_at"}, [][]driver.Value{{int64(7), time.Now(), time.Now()}}, nil
+		}
+		return nil, nil, errors.New("unexpected query: " + query)
+	}
+}
+
+func TestGetProxiesMasksPasswords(t *testing.T) {
+	db, _ := teamDB(t, models.TeamRoleViewer, proxyRows(nil))
+	pc := NewProxyController(db)
+
+	status, response := request(t, &models.User{ID: 4, Role: "user"}, "GET", "/proxies", "/proxies", "", pc.GetProxies)
+	proxies, _ := response["data"].([]interface{})
+	if status != 200 || len(proxies) != 1 {
+		t.Fatalf("GetProxies = %d %v", status, response)
+	}
+	if password := proxies[0].(map[string]interface{})["password"]; password != secretMask {
+		t.Errorf("password = %v, want it masked", password)
+	}
+}
+
+func TestUpdateProxyPassword(t *testing.T) {
+	tests := []struct {
+		sent, want string
+	}{
+		{secretMask, "stored"},
+		{"rotated", "rotated"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		var updated []driver.Value
+		db, _ := teamDB(t, models.TeamRoleEditor, proxyRows(&updated))
+		pc := NewProxyController(db)
+
+		body := `{"name": "corp", "host": "proxy.internal", "port": 3128, "password": "` + tt.sent + `"}`
+		status, response := request(t, &models.User{ID: 4, Role: "user"}, "PUT", "/proxies/:id", "/proxies/7", body, pc.UpdateProxy)
+		if status != 200 || len(updated) < 5 {
+			t.Fatalf("UpdateProxy(%q) = %d %v", tt.sent, status, response)
+		}
+		if updated[4] != tt.want {
+			t.Errorf("UpdateProxy(%q) stored %v, want %q", tt.sent, updated[4], tt.want)
+		}
+		if data, _ := response["data"].(map[string]interface{}); data["password"] != mask(tt.want) {
+			t.Errorf("UpdateProxy(%q) returned password %v", tt.sent, data["password"])
+		}
+	}
+}
+
+func TestUpdateProxyTeamMove(t *testing.T) {
+	tests := []struct {
+		name      string
+		inUse     bool
+		want      int
+		wantTeam  int64
+		wantError string
+	}{
+		{"unused proxy", false, 200, 2, ""},
+		{"used by the old team's endpoints", true, 409, 0, "Endpoints of another team still use it"},
+	}
+	for _, tt := range tests {
+		var updated []driver.Value
+		rows := proxyRows(&updated)
+		db, _ := teamDB(t, models.TeamRoleEditor, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			if strings.Contains(query, "FROM api_endpoints WHERE proxy_id = $1") {
+				return []string{"exists"}, [][]driver.Value{{tt.inUse}}, nil
+			}
+			return rows(query, args)
+		})
+		pc := NewProxyController(db)
+
+		body := `{"name": "corp", "host": "proxy.internal", "port": 3128, "team_id": 2}`
+		status, response := request(t, &models.User{ID: 4, Role: "user"}, "PUT", "/proxies/:id", "/proxies/7", body, pc.UpdateProxy)
+		if status != tt.want || (tt.wantError != "" && response["error"] != tt.wantError) {
+			t.Errorf("%s: %d %v, want %d", tt.name, status, response, tt.want)
+		}
+		if tt.want == 200 && (len(updated) < 7 || updated[6] != tt.wantTeam) {
+			t.Errorf("%s: stored team %v, want %d", tt.name, updated, tt.wantTeam)
+		}
+		if tt.want != 200 && updated != nil {
+			t.Errorf("%s: proxy was updated", tt.name)
+		}
+	}
+}
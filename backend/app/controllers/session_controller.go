@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"api-monitor/app/models"
+	"api-monitor/config"
+	"api-monitor/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+type SessionController struct {
+	DB *sql.DB
+}
+
+func NewSessionController(db *sql.DB) *SessionController {
+	return &SessionController{DB: db}
+}
+
+// GetSessions lists the active sessions of the current user
+func (sc *SessionController) GetSessions(c *fiber.Ctx) error {
+	user := currentUser(c)
+	currentSession, _ := c.Locals("sessionID").(string)
+
+	rows, err := sc.DB.Query(`
+		SELECT s.id, s.user_agent, s.ip_address, s.created_at, s.last_seen_at, s.expires_at
+		FROM user_sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.user_id = $1 AND s.revoked_at IS NULL AND s.expires_at > NOW()
+		  AND (u.tokens_revoked_at IS NULL OR u.tokens_revoked_at <= s.created_at)
+		ORDER BY s.last_seen_at DESC`, user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch sessions"})
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan session data"})
+		}
+		session.Current = session.ID == currentSession
+		sessions = append(sessions, session)
+	}
+
+	return c.JSON(fiber.Map{
+		"data": sessions,
+	})
+}
+
+// RevokeSession signs the current user out of one of their sessions
+func (sc *SessionController) RevokeSession(c *fiber.Ctx) error {
+	user := currentUser(c)
+
+	var ownerID int
+	err := sc.DB.QueryRow("SELECT user_id FROM user_sessions WHERE id = $1", c.Params("id")).Scan(&ownerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch session"})
+	}
+
+	if ownerID != user.ID {
+		return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	if err := revokeSession(sc.DB, c.Params("id"), "revoked by user"); err != nil {
+		log.Printf("Failed to revoke session: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to revoke session"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session revoked successfully",
+	})
+}
+
+// queryExecer is implemented by both *sql.DB and *sql.Tx
+type queryExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// startSession records a new session for the user and issues its first token pair
+func startSession(db *sql.DB, c *fiber.Ctx, user models.User) (models.LoginResponse, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	defer tx.Rollback()
+
+	sessionID := uuid.NewString()
+	_, err = tx.Exec(`
+		INSERT INTO user_sessions (id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW(), $5)`,
+		sessionID, user.ID, clientUserAgent(c), c.IP(), time.Now().Add(config.GetRefreshTokenTTL()))
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	response, err := issueTokens(tx, user, sessionID)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	return response, tx.Commit()
+}
+
+// issueTokens signs a new access token for the session and stores a new refresh token.
+// Every refresh extends the session, so it only expires after REFRESH_TOKEN_TTL of inactivity.
+func issueTokens(q queryExecer, user models.User, sessionID string) (models.LoginResponse, error) {
+	accessToken, claims, err := generateJWT(user, sessionID)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	expiresAt := time.Now().Add(config.GetRefreshTokenTTL())
+	_, err = q.Exec(`
+		INSERT INTO refresh_tokens (session_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, NOW())`, sessionID, utils.HashToken(refreshToken), expiresAt)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	_, err = q.Exec(`
+		UPDATE user_sessions
+		SET current_jti = $1, access_expires_at = $2, last_seen_at = NOW(), expires_at = $3
+		WHERE id = $4`, claims.ID, claims.ExpiresAt.Time, expiresAt, sessionID)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	user.Password = ""
+	return models.LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(config.GetAccessTokenTTL().Seconds()),
+		User:         user,
+	}, nil
+}
+
+// revokeSession marks a session revoked and blacklists its latest access token.
+// Older access tokens of the session are rejected by the middleware's session check.
+func revokeSession(q queryExecer, sessionID, reason string) error {
+	var userID int
+	var currentJTI sql.NullString
+	var accessExpiresAt sql.NullTime
+	err := q.QueryRow(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $1
+		WHERE id = $2 AND revoked_at IS NULL
+		RETURNING user_id, current_jti, access_expires_at`, reason, sessionID).
+		Scan(&userID, &currentJTI, &accessExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil // Already revoked
+	}
+	if err != nil {
+		return err
+	}
+
+	if currentJTI.Valid && accessExpiresAt.Valid {
+		_, err = q.Exec(`
+			INSERT INTO blacklisted_tokens (token_jti, user_id, expires_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (token_jti) DO NOTHING`,
+			currentJTI.String, userID, accessExpiresAt.Time)
+	}
+	return err
+}
+
+// generateJWT signs a short-lived access token bound to a session
+func generateJWT(user models.User, sessionID string) (string, *models.JWTClaims, error) {
+	// Generate unique JTI (JWT ID)
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &models.JWTClaims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(config.GetAccessTokenTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(config.GetJWTSecret())
+	return signed, claims, err
+}
+
+func clientUserAgent(c *fiber.Ctx) string {
+	userAgent := []rune(utils.ValidateUTF8(c.Get("User-Agent")))
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	return string(userAgent)
+}
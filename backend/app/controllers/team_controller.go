@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type TeamController struct {
+	DB *sql.DB
+}
+
+func NewTeamController(db *sql.DB) *TeamController {
+	return &TeamController{DB: db}
+}
+
+// GetTeams lists the teams of the current user with their role; admins see every team
+func (tc *TeamController) GetTeams(c *fiber.Ctx) error {
+	user := currentUser(c)
+
+	var rows *sql.Rows
+	var err error
+	if services.IsAdmin(user) {
+		rows, err = tc.DB.Query(`
+			SELECT id, name, 'owner', created_at, updated_at
+			FROM teams
+			ORDER BY name`)
+	} else {
+		rows, err = tc.DB.Query(`
+			SELECT t.id, t.name, m.role, t.created_at, t.updated_at
+			FROM teams t
+			JOIN team_members m ON m.team_id = t.id AND m.user_id = $1
+			ORDER BY t.name`, user.ID)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch teams"})
+	}
+	defer rows.Close()
+
+	teams := []models.Team{}
+	for rows.Next() {
+		var team models.Team
+		if err := rows.Scan(&team.ID, &team.Name, &team.Role, &team.CreatedAt, &team.UpdatedAt); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan team data"})
+		}
+		teams = append(teams, team)
+	}
+
+	return c.JSON(fiber.Map{
+		"data": teams,
+	})
+}
+
+// CreateTeam creates a team (admin only)
+func (tc *TeamController) CreateTeam(c *fiber.Ctx) error {
+	var team models.Team
+	if err := c.BodyParser(&team); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if team.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Name is required"})
+	}
+
+	err := tc.DB.QueryRow(`
+		INSERT INTO teams (name, created_at, updated_at)
+		VALUES ($1, NOW(), NOW())
+		RETURNING id, created_at, updated_at`, team.Name).
+		Scan(&team.ID, &team.CreatedAt, &team.UpdatedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{"error": "Team name already exists"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create team"})
+	}
+
+	recordChange(c, tc.DB, "team.create", "team", team.ID, nil, auditSnapshot(tc.DB, "teams", team.ID))
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "Team created successfully",
+		"data":    team,
+	})
+}
+
+// UpdateTeam renames a team (team owners)
+func (tc *TeamController) UpdateTeam(c *fiber.Ctx) error {
+	teamID, ok, err := tc.authorize(c, models.TeamRoleOwner)
+	if !ok {
+		return err
+	}
+
+	var team models.Team
+	if err := c.BodyParser(&team); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if team.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Name is required"})
+	}
+
+	before := auditSnapshot(tc.DB, "teams", teamID)
+	err = tc.DB.QueryRow(`
+		UPDATE teams SET name = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING id, created_at, updated_at`, team.Name, teamID).
+		Scan(&team.ID, &team.CreatedAt, &team.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "Team not found"})
+		}
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{"error": "Team name already exists"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update team"})
+	}
+
+	recordChange(c, tc.DB, "team.update", "team", teamID, before, auditSnapshot(tc.DB, "teams", teamID))
+
+	return c.JSON(fiber.Map{
+		"message": "Team updated successfully",
+		"data":    team,
+	})
+}
+
+// DeleteTeam deletes a team that no longer owns endpoints or proxies (admin only)
+func (tc *TeamController) DeleteTeam(c *fiber.Ctx) error {
+	teamID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid team ID"})
+	}
+
+	before := auditSnapshot(tc.DB, "teams", teamID)
+	result, err := tc.DB.Exec("DELETE FROM teams WHERE id = $1", teamID)
+	if err != nil {
+		if strings.Contains(err.Error(), "foreign key") {
+			return c.Status(409).JSON(fiber.Map{"error": "Team still owns endpoints, proxies, profiles or schemas"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete team"})
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to verify deletion"})
+	}
+
+	if rowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Team not found"})
+	}
+
+	recordChange(c, tc.DB, "team.delete", "team", teamID, before, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Team deleted successfully",
+	})
+}
+
+// GetMembers lists the members of a team (team viewers)
+func (tc *TeamController) GetMembers(c *fiber.Ctx) error {
+	teamID, ok, err := tc.authorize(c, models.TeamRoleViewer)
+	if !ok {
+		return err
+	}
+
+	rows, err := tc.DB.Query(`
+		SELECT m.team_id, m.user_id, u.username, m.role, m.created_at
+		FROM team_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.team_id = $1
+		ORDER BY u.username`, teamID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch team members"})
+	}
+	defer rows.Close()
+
+	members := []models.TeamMember{}
+	for rows.Next() {
+		var member models.TeamMember
+		if err := rows.Scan(&member.TeamID, &member.UserID, &member.Username, &member.Role, &member.CreatedAt); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan team member data"})
+		}
+		members = append(members, member)
+	}
+
+	return c.JSON(fiber.Map{
+		"data": members,
+	})
+}
+
+// SetMember adds a user to a team or changes their role (team owners)
+func (tc *TeamController) SetMember(c *fiber.Ctx) error {
+	teamID, ok, err := tc.authorize(c, models.TeamRoleOwner)
+	if !ok {
+		return err
+	}
+
+	userID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if !services.ValidTeamRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": "Role must be one of viewer, editor, owner"})
+	}
+
+	before := tc.memberSnapshot(teamID, userID)
+
+	var member models.TeamMember
+	err = tc.DB.QueryRow(`
+		INSERT INTO team_members (team_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (team_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING team_id, user_id, role, created_at`, teamID, userID, req.Role).
+		Scan(&member.TeamID, &member.UserID, &member.Role, &member.CreatedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "foreign key") {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save team member"})
+	}
+
+	recordChange(c, tc.DB, "team.member_set", "team", teamID, before, tc.memberSnapshot(teamID, userID))
+
+	return c.JSON(fiber.Map{
+		"message": "Team member saved successfully",
+		"data":    member,
+	})
+}
+
+// RemoveMember removes a user from a team (team owners)
+func (tc *TeamController) RemoveMember(c *fiber.Ctx) error {
+	teamID, ok, err := tc.authorize(c, models.TeamRoleOwner)
+	if !ok {
+		return err
+	}
+
+	userID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	before := tc.memberSnapshot(teamID, userID)
+	result, err := tc.DB.Exec("DELETE FROM team_members WHERE team_id = $1 AND user_id = $2", teamID, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to remove team member"})
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to verify deletion"})
+	}
+
+	if rowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Team member not found"})
+	}
+
+	recordChange(c, tc.DB, "team.member_remove", "team", teamID, before, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Team member removed successfully",
+	})
+}
+
+// memberSnapshot returns a team membership for the audit log
+func (tc *TeamController) memberSnapshot(teamID, userID int) map[string]interface{} {
+	return services.AuditSnapshot(tc.DB, "team_members", "team_id = $1 AND user_id = $2", teamID, userID)
+}
+
+// authorize parses the team ID from the route and checks the current user's role in it
+func (tc *TeamController) authorize(c *fiber.Ctx, required string) (int, bool, error) {
+	teamID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return 0, false, c.Status(400).JSON(fiber.Map{"error": "Invalid team ID"})
+	}
+
+	ok, err := authorizeTeam(c, tc.DB, sql.NullInt64{Int64: int64(teamID), Valid: true}, required, "Team not found")
+	return teamID, ok, err
+}
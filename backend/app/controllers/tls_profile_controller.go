@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+	"api-monitor/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type TLSProfileController struct {
+	DB *sql.DB
+}
+
+func NewTLSProfileController(db *sql.DB) *TLSProfileController {
+	return &TLSProfileController{DB: db}
+}
+
+// GetTLSProfiles retrieves the TLS profiles of the user's teams with private keys masked
+func (tc *TLSProfileController) GetTLSProfiles(c *fiber.Ctx) error {
+	query := services.TLSProfileSelect
+	scope, args := services.TeamScope(currentUser(c), "team_id", models.TeamRoleViewer, 1)
+	if scope != "" {
+		query += " WHERE " + scope
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := tc.DB.Query(query, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch TLS profiles",
+		})
+	}
+	defer rows.Close()
+
+	profiles := []models.TLSProfile{}
+	for rows.Next() {
+		profile, err := services.ScanTLSProfile(rows)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to scan TLS profile data",
+			})
+		}
+		profile.ClientKey = mask(profile.ClientKey)
+		profiles = append(profiles, profile)
+	}
+
+	return c.JSON(fiber.Map{
+		"data": profiles,
+	})
+}
+
+// CreateTLSProfile creates a new TLS profile
+func (tc *TLSProfileController) CreateTLSProfile(c *fiber.Ctx) error {
+	var profile models.TLSProfile
+	if err := c.BodyParser(&profile); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if profile.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Name is required"})
+	}
+
+	// Reject certificates and keys that could not be used for a check
+	if _, err := utils.BuildTLSConfig(&profile); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	teamID, ok, err := resolveTeam(c, tc.DB, profile.TeamID)
+	if !ok {
+		return err
+	}
+	profile.TeamID = &teamID
+
+	clientCert, clientKey, caBundle, err := services.EncryptTLSProfile(profile)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to encrypt TLS profile"})
+	}
+
+	err = tc.DB.QueryRow(`
+		INSERT INTO tls_profiles (name, client_cert, client_key, ca_bundle, server_name, min_version,
+		                          insecure_skip_verify, team_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+		RETURNING id, created_at, updated_at`,
+		profile.Name, clientCert, clientKey, caBundle, profile.ServerName, profile.MinVersion,
+		profile.InsecureSkipVerify, profile.TeamID,
+	).Scan(&profile.ID, &profile.CreatedAt, &profile.UpdatedAt)
+
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{"error": "TLS profile name already exists"})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create TLS profile",
+		})
+	}
+
+	recordChange(c, tc.DB, "tls_profile.create", "tls_profile", profile.ID, nil, auditSnapshot(tc.DB, "tls_profiles", profile.ID))
+
+	profile.ClientKey = mask(profile.ClientKey)
+	return c.Status(201).JSON(fiber.Map{
+		"message": "TLS profile created successfully",
+		"data":    profile,
+	})
+}
+
+// UpdateTLSProfile updates an existing TLS profile
+func (tc *TLSProfileController) UpdateTLSProfile(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid TLS profile ID"})
+	}
+
+	currentTeamID, ok, err := authorizeTeamRow(c, tc.DB, "tls_profiles", id, models.TeamRoleEditor, "TLS profile not found")
+	if !ok {
+		return err
+	}
+
+	existing, err := services.FindTLSProfile(tc.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "TLS profile not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch TLS profile"})
+	}
+	before := auditSnapshot(tc.DB, "tls_profiles", id)
+
+	var profile models.TLSProfile
+	if err := c.BodyParser(&profile); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if profile.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Name is required"})
+	}
+
+	profile.ClientKey = unmask(profile.ClientKey, existing.ClientKey)
+
+	if _, err := utils.BuildTLSConfig(&profile); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if profile.TeamID, ok, err = moveTeam(c, tc.DB, id, currentTeamID, profile.TeamID, "tls_profile_id"); !ok {
+		return err
+	}
+
+	clientCert, clientKey, caBundle, err := services.EncryptTLSProfile(profile)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to encrypt TLS profile"})
+	}
+
+	err = tc.DB.QueryRow(`
+		UPDATE tls_profiles
+		SET name = $1, client_cert = $2, client_key = $3, ca_bundle = $4, server_name = $5,
+		    min_version = $6, insecure_skip_verify = $7, team_id = $8, updated_at = NOW()
+		WHERE id = $9
+		RETURNING id, created_at, updated_at`,
+		profile.Name, clientCert, clientKey, caBundle, profile.ServerName, profile.MinVersion,
+		profile.InsecureSkipVerify, profile.TeamID, id,
+	).Scan(&profile.ID, &profile.CreatedAt, &profile.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "TLS profile not found"})
+		}
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{"error": "TLS profile name already exists"})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update TLS profile",
+		})
+	}
+
+	recordChange(c, tc.DB, "tls_profile.update", "tls_profile", id, before, auditSnapshot(tc.DB, "tls_profiles", id))
+
+	profile.ClientKey = mask(profile.ClientKey)
+	return c.JSON(fiber.Map{
+		"message": "TLS profile updated successfully",
+		"data":    profile,
+	})
+}
+
+// DeleteTLSProfile deletes a TLS profile
+func (tc *TLSProfileController) DeleteTLSProfile(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid TLS profile ID"})
+	}
+
+	if _, ok, err := authorizeTeamRow(c, tc.DB, "tls_profiles", id, models.TeamRoleEditor, "TLS profile not found"); !ok {
+		return err
+	}
+
+	before := auditSnapshot(tc.DB, "tls_profiles", id)
+	result, err := tc.DB.Exec("DELETE FROM tls_profiles WHERE id = $1", id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to delete TLS profile",
+		})
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to verify deletion",
+		})
+	}
+
+	if rowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "TLS profile not found",
+		})
+	}
+
+	recordChange(c, tc.DB, "tls_profile.delete", "tls_profile", id, before, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "TLS profile deleted successfully",
+	})
+}
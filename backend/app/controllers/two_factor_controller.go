@@ -0,0 +1,572 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+	"api-monitor/config"
+	"api-monitor/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// loginChallengeTTL is how long a user has to enter the second factor after the password
+const loginChallengeTTL = 5 * time.Minute
+
+// maxChallengeAttempts limits wrong codes per login challenge
+const maxChallengeAttempts = 5
+
+// recoveryCodeCount is the number of recovery codes issued at enrollment
+const recoveryCodeCount = 10
+
+// TwoFactorController implements TOTP two-factor authentication: enrollment, the
+// second login step and recovery codes. Wrong codes count as failed logins, at login as
+// well as on the routes of a signed-in user, so a stolen access token cannot be used to
+// guess codes.
+type TwoFactorController struct {
+	DB       *sql.DB
+	Throttle *services.LoginThrottle
+}
+
+func NewTwoFactorController(db *sql.DB) *TwoFactorController {
+	return &TwoFactorController{
+		DB:       db,
+		Throttle: services.NewLoginThrottle(db),
+	}
+}
+
+type twoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// Setup starts enrollment during a login that requires two-factor authentication
+func (tc *TwoFactorController) Setup(c *fiber.Ctx) error {
+	var req twoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	user, ok, err := tc.challengeUser(c, req.ChallengeToken)
+	if !ok {
+		return err
+	}
+
+	if user.TwoFactorEnabled {
+		return c.Status(409).JSON(fiber.Map{"error": "Two-factor authentication is already enabled"})
+	}
+
+	return tc.startEnrollment(c, user)
+}
+
+// Verify completes a login with a TOTP or recovery code. During a required enrollment the
+// code activates two-factor authentication and the recovery codes are returned once.
+func (tc *TwoFactorController) Verify(c *fiber.Ctx) error {
+	var req twoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.Code == "" && req.RecoveryCode == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "code or recovery_code is required"})
+	}
+
+	user, ok, err := tc.challengeUser(c, req.ChallengeToken)
+	if !ok {
+		return err
+	}
+
+	retryAfter, err := tc.Throttle.Check(c.IP(), user.Username)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if retryAfter > 0 {
+		return tooManyAttempts(c, retryAfter)
+	}
+
+	var recoveryCodes []string
+	var verified bool
+	if user.TwoFactorEnabled {
+		verified, err = verifySecondFactor(tc.DB, user.ID, req.Code, req.RecoveryCode)
+	} else {
+		recoveryCodes, err = activateTwoFactor(tc.DB, user.ID, req.Code)
+		verified = recoveryCodes != nil
+	}
+	if err != nil {
+		log.Printf("Two-factor verification error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Could not verify code"})
+	}
+
+	if !verified {
+		_, err = tc.DB.Exec("UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = $1",
+			utils.HashToken(req.ChallengeToken))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+		}
+		if err := tc.Throttle.RecordFailure(c.IP(), user.Username); err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+		}
+		log.Printf("Invalid two-factor code for user: %s", user.Username)
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid code"})
+	}
+
+	if err := tc.Throttle.RecordSuccess(user.Username); err != nil {
+		log.Printf("Failed to reset login throttle: %v", err)
+	}
+
+	if _, err := tc.DB.Exec("DELETE FROM login_challenges WHERE token_hash = $1", utils.HashToken(req.ChallengeToken)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	log.Printf("Login successful for user: %s (two-factor)", user.Username)
+
+	user.TwoFactorEnabled = true
+	response, err := startSession(tc.DB, c, user)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Could not generate token"})
+	}
+	response.RecoveryCodes = recoveryCodes
+
+	return c.JSON(response)
+}
+
+// Status returns the two-factor state of the current user
+func (tc *TwoFactorController) Status(c *fiber.Ctx) error {
+	user, err := loadTwoFactorUser(tc.DB, currentUser(c).ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch two-factor status"})
+	}
+
+	var remaining int
+	err = tc.DB.QueryRow(`
+		SELECT COUNT(*) FROM user_recovery_codes
+		WHERE user_id = $1 AND used_at IS NULL`, user.ID).Scan(&remaining)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch two-factor status"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": fiber.Map{
+			"enabled":                  user.TwoFactorEnabled,
+			"required":                 twoFactorRequired(user),
+			"recovery_codes_remaining": remaining,
+		},
+	})
+}
+
+// Enroll generates a new secret for the current user; it is enabled by Activate
+func (tc *TwoFactorController) Enroll(c *fiber.Ctx) error {
+	user, err := loadTwoFactorUser(tc.DB, currentUser(c).ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+
+	if user.TwoFactorEnabled {
+		return c.Status(409).JSON(fiber.Map{"error": "Two-factor authentication is already enabled"})
+	}
+
+	return tc.startEnrollment(c, user)
+}
+
+// Activate enables two-factor authentication after the first valid code and returns
+// the recovery codes, which are only shown in this response
+func (tc *TwoFactorController) Activate(c *fiber.Ctx) error {
+	var req twoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var recoveryCodes []string
+	verified, ok, err := tc.verifyThrottled(c, currentUser(c).Username, func() (bool, error) {
+		var err error
+		recoveryCodes, err = activateTwoFactor(tc.DB, currentUser(c).ID, req.Code)
+		return recoveryCodes != nil, err
+	})
+	if !ok {
+		return err
+	}
+	if !verified {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid code or no pending enrollment"})
+	}
+
+	log.Printf("Two-factor authentication enabled for user: %s", currentUser(c).Username)
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication enabled",
+		"data": fiber.Map{
+			"recovery_codes": recoveryCodes,
+		},
+	})
+}
+
+// Disable turns two-factor authentication off; requires a valid code and is refused
+// while two-factor authentication is enforced for the user
+func (tc *TwoFactorController) Disable(c *fiber.Ctx) error {
+	var req twoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	user, err := loadTwoFactorUser(tc.DB, currentUser(c).ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+
+	if !user.TwoFactorEnabled {
+		return c.Status(400).JSON(fiber.Map{"error": "Two-factor authentication is not enabled"})
+	}
+	if twoFactorRequired(user) {
+		return c.Status(403).JSON(fiber.Map{"error": "Two-factor authentication is required for your account"})
+	}
+
+	verified, ok, err := tc.verifyThrottled(c, user.Username, func() (bool, error) {
+		return verifySecondFactor(tc.DB, user.ID, req.Code, req.RecoveryCode)
+	})
+	if !ok {
+		return err
+	}
+	if !verified {
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid code"})
+	}
+
+	if err := clearTwoFactor(tc.DB, user.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not disable two-factor authentication"})
+	}
+
+	log.Printf("Two-factor authentication disabled for user: %s", user.Username)
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes; requires a valid TOTP code
+func (tc *TwoFactorController) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	var req twoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	user, err := loadTwoFactorUser(tc.DB, currentUser(c).ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+
+	if !user.TwoFactorEnabled {
+		return c.Status(400).JSON(fiber.Map{"error": "Two-factor authentication is not enabled"})
+	}
+
+	verified, ok, err := tc.verifyThrottled(c, user.Username, func() (bool, error) {
+		return verifySecondFactor(tc.DB, user.ID, req.Code, "")
+	})
+	if !ok {
+		return err
+	}
+	if !verified {
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid code"})
+	}
+
+	tx, err := tc.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	recoveryCodes, err := replaceRecoveryCodes(tx, user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not generate recovery codes"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Recovery codes regenerated",
+		"data": fiber.Map{
+			"recovery_codes": recoveryCodes,
+		},
+	})
+}
+
+// verifyThrottled checks a code entered by a signed-in user under the login throttle:
+// wrong codes are recorded as failed logins and once the user is backed off or locked
+// out no code is checked. When the check cannot run it writes the response and returns
+// false; a wrong code is left to the caller.
+func (tc *TwoFactorController) verifyThrottled(c *fiber.Ctx, username string, verify func() (bool, error)) (bool, bool, error) {
+	retryAfter, err := tc.Throttle.Check(c.IP(), username)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		return false, false, c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if retryAfter > 0 {
+		return false, false, tooManyAttempts(c, retryAfter)
+	}
+
+	verified, err := verify()
+	if err != nil {
+		log.Printf("Two-factor verification error: %v", err)
+		return false, false, c.Status(500).JSON(fiber.Map{"error": "Could not verify code"})
+	}
+
+	if !verified {
+		if err := tc.Throttle.RecordFailure(c.IP(), username); err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+		}
+		log.Printf("Invalid two-factor code for user: %s", username)
+		return false, true, nil
+	}
+
+	if err := tc.Throttle.RecordSuccess(username); err != nil {
+		log.Printf("Failed to reset login throttle: %v", err)
+	}
+	return true, true, nil
+}
+
+// challengeUser resolves a login challenge token to its user. When the challenge is
+// invalid it writes the response and returns false.
+func (tc *TwoFactorController) challengeUser(c *fiber.Ctx, token string) (models.User, bool, error) {
+	if token == "" {
+		return models.User{}, false, c.Status(400).JSON(fiber.Map{"error": "challenge_token is required"})
+	}
+
+	var userID int
+	err := tc.DB.QueryRow(`
+		SELECT user_id FROM login_challenges
+		WHERE token_hash = $1 AND expires_at > NOW() AND attempts < $2`,
+		utils.HashToken(token), maxChallengeAttempts).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.User{}, false, c.Status(401).JSON(fiber.Map{"error": "Login expired, please sign in again"})
+		}
+		return models.User{}, false, c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	user, err := loadTwoFactorUser(tc.DB, userID)
+	if err != nil {
+		return models.User{}, false, c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if !user.IsActive {
+		return models.User{}, false, c.Status(401).JSON(fiber.Map{"error": "Login expired, please sign in again"})
+	}
+
+	return user, true, nil
+}
+
+// startEnrollment stores a new pending secret and returns it with its provisioning URI
+func (tc *TwoFactorController) startEnrollment(c *fiber.Ctx, user models.User) error {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not generate secret"})
+	}
+
+	encrypted, err := utils.EncryptString(secret)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not store secret"})
+	}
+
+	_, err = tc.DB.Exec(`
+		UPDATE users SET totp_secret = $1, totp_last_step = 0, updated_at = NOW()
+		WHERE id = $2 AND totp_enabled = false`, encrypted, user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not store secret"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Scan the provisioning URI with an authenticator app, then confirm with a code",
+		"data": fiber.Map{
+			"secret":           secret,
+			"provisioning_uri": utils.TOTPProvisioningURI(config.GetTOTPIssuer(), user.Username, secret),
+		},
+	})
+}
+
+// twoFactorRequired reports whether an admin or the user's role enforces two-factor authentication
+func twoFactorRequired(user models.User) bool {
+	if user.TwoFactorRequired {
+		return true
+	}
+	for _, role := range config.GetTwoFactorRequiredRoles() {
+		if role == user.Role {
+			return true
+		}
+	}
+	return false
+}
+
+// createLoginChallenge starts the second login step for a user whose password was verified
+func createLoginChallenge(db *sql.DB, user models.User) (models.TwoFactorChallenge, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return models.TwoFactorChallenge{}, err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO login_challenges (token_hash, user_id, expires_at, created_at)
+		VALUES ($1, $2, $3, NOW())`, utils.HashToken(token), user.ID, time.Now().Add(loginChallengeTTL))
+	if err != nil {
+		return models.TwoFactorChallenge{}, err
+	}
+
+	return models.TwoFactorChallenge{
+		TwoFactorRequired: true,
+		SetupRequired:     !user.TwoFactorEnabled,
+		ChallengeToken:    token,
+		ExpiresIn:         int(loginChallengeTTL.Seconds()),
+	}, nil
+}
+
+func loadTwoFactorUser(db *sql.DB, userID int) (models.User, error) {
+	var user models.User
+	err := db.QueryRow(`
+		SELECT id, username, role, is_active, created_at, updated_at, totp_enabled, two_factor_required
+		FROM users WHERE id = $1`, userID).
+		Scan(&user.ID, &user.Username, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+			&user.TwoFactorEnabled, &user.TwoFactorRequired)
+	return user, err
+}
+
+// verifySecondFactor checks a TOTP code, or else a recovery code, for a user with
+// two-factor authentication enabled. Used codes cannot be used again.
+func verifySecondFactor(db *sql.DB, userID int, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		var encrypted sql.NullString
+		var lastStep int64
+		err := db.QueryRow(`
+			SELECT totp_secret, totp_last_step FROM users
+			WHERE id = $1 AND totp_enabled = true`, userID).Scan(&encrypted, &lastStep)
+		if err == sql.ErrNoRows || !encrypted.Valid {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		secret, err := utils.DecryptString(encrypted.String)
+		if err != nil {
+			return false, fmt.Errorf("error decrypting TOTP secret: %v", err)
+		}
+
+		step, ok := utils.VerifyTOTP(secret, code, lastStep)
+		if !ok {
+			return false, nil
+		}
+
+		// Guarded by the last step so two requests cannot both use the same code
+		result, err := db.Exec(`
+			UPDATE users SET totp_last_step = $1
+			WHERE id = $2 AND totp_last_step < $1`, step, userID)
+		if err != nil {
+			return false, err
+		}
+		rowsAffected, _ := result.RowsAffected()
+		return rowsAffected == 1, nil
+	}
+
+	if recoveryCode != "" {
+		result, err := db.Exec(`
+			UPDATE user_recovery_codes SET used_at = NOW()
+			WHERE id = (
+				SELECT id FROM user_recovery_codes
+				WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+				LIMIT 1
+			) AND used_at IS NULL`, userID, utils.HashToken(utils.NormalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return false, err
+		}
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 1 {
+			log.Printf("Recovery code used by user %d", userID)
+		}
+		return rowsAffected == 1, nil
+	}
+
+	return false, nil
+}
+
+// activateTwoFactor enables a pending enrollment when the code matches its secret and
+// returns fresh recovery codes. Returns nil codes when the code is wrong or nothing is pending.
+func activateTwoFactor(db *sql.DB, userID int, code string) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var encrypted sql.NullString
+	err = tx.QueryRow(`
+		SELECT totp_secret FROM users
+		WHERE id = $1 AND totp_enabled = false
+		FOR UPDATE`, userID).Scan(&encrypted)
+	if err == sql.ErrNoRows || (err == nil && !encrypted.Valid) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.DecryptString(encrypted.String)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting TOTP secret: %v", err)
+	}
+
+	step, ok := utils.VerifyTOTP(secret, code, 0)
+	if !ok {
+		return nil, nil
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET totp_enabled = true, totp_last_step = $1, updated_at = NOW()
+		WHERE id = $2`, step, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	recoveryCodes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err := tx.Exec(`
+			INSERT INTO user_recovery_codes (user_id, code_hash, created_at)
+			VALUES ($1, $2, NOW())`, userID, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return recoveryCodes, nil
+}
+
+// clearTwoFactor removes the secret and recovery codes of a user
+func clearTwoFactor(q queryExecer, userID int) error {
+	_, err := q.Exec(`
+		UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_step = 0, updated_at = NOW()
+		WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID)
+	return err
+}
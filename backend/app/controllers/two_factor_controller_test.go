@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api-monitor/app/fakedb"
+	"api-monitor/app/models"
+	"api-monitor/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// fakeTwoFactorUser plays the users and login_throttles tables for user 4 with
+// two-factor authentication enabled
+type fakeTwoFactorUser struct {
+	mu           sync.Mutex
+	failures     map[string]int64
+	blockedUntil time.Time
+	codeChecks   int
+}
+
+func (f *fakeTwoFactorUser) handle(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	later := func(value driver.Value) {
+		if until := value.(time.Time); until.After(f.blockedUntil) {
+			f.blockedUntil = until
+		}
+	}
+
+	switch {
+	case strings.Contains(query, "SELECT GREATEST("):
+		var blocked driver.Value
+		if !f.blockedUntil.IsZero() {
+			blocked = f.blockedUntil
+		}
+		return []string{"greatest"}, [][]driver.Value{{blocked}}, nil
+	case strings.Contains(query, "INSERT INTO login_throttles"):
+		key := args[0].(string)
+		f.failures[key]++
+		return []string{"failures"}, [][]driver.Value{{f.failures[key]}}, nil
+	case strings.Contains(query, "UPDATE login_throttles SET blocked_until"):
+		later(args[0])
+		return nil, nil, nil
+	case strings.Contains(query, "UPDATE users SET locked_until"):
+		later(args[0])
+		return []string{"id"}, [][]driver.Value{{int64(4)}}, nil
+	case strings.Contains(query, "DELETE FROM login_throttles"):
+		delete(f.failures, args[0].(string))
+		return nil, nil, nil
+	case strings.Contains(query, "INSERT INTO audit_logs"):
+		return nil, nil, nil
+	case strings.Contains(query, "SELECT id, username, role"):
+		return []string{"id", "username", "role", "is_active", "created_at", "updated_at", "totp_enabled", "two_factor_required"},
+			[][]driver.Value{{int64(4), "alice", "user", true, time.Now(), time.Now(), true, false}}, nil
+	case strings.Contains(query, "SELECT totp_secret, totp_last_step"):
+		f.codeChecks++
+		return []string{"totp_secret", "totp_last_step"}, [][]driver.Value{{testTOTPSecret, int64(0)}}, nil
+	}
+	return nil, nil, errors.New("unexpected query: " + query)
+}
+
+// wrongTOTPCode returns a code that is not valid around now
+func wrongTOTPCode(t *testing.T) string {
+	t.Helper()
+	valid := map[string]bool{}
+	for _, offset := range []time.Duration{-time.Minute, -30 * time.Second, 0, 30 * time.Second, time.Minute} {
+		code, err := utils.TOTPCode(testTOTPSecret, time.Now().Add(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		valid[code] = true
+	}
+	for _, code := range []string{"000000", "111111", "222222", "333333", "444444", "555555"} {
+		if !valid[code] {
+			return code
+		}
+	}
+	t.Fatal("no wrong code found")
+	return ""
+}
+
+func twoFactorDB(t *testing.T) (*sql.DB, *fakeTwoFactorUser) {
+	fake := &fakeTwoFactorUser{failures: map[string]int64{}}
+	db, _ := fakedb.Open(t, fake.handle)
+	return db, fake
+}
+
+func TestTwoFactorRoutesThrottleWrongCodes(t *testing.T) {
+	user := &models.User{ID: 4, Username: "alice", Role: "user"}
+	code := wrongTOTPCode(t)
+
+	for name, handler := range map[string]func(tc *TwoFactorController) fiber.Handler{
+		"disable":        func(tc *TwoFactorController) fiber.Handler { return tc.Disable },
+		"recovery-codes": func(tc *TwoFactorController) fiber.Handler { return tc.RegenerateRecoveryCodes },
+	} {
+		db, fake := twoFactorDB(t)
+		tc := NewTwoFactorController(db)
+
+		var statuses []int
+		for i := 0; i < 5; i++ {
+			status, _ := request(t, user, "POST", "/2fa", "/2fa", `{"code": "`+code+`"}`, handler(tc))
+			statuses = append(statuses, status)
+		}
+
+		// Two free attempts for the username, the third failure starts the backoff
+		if want := []int{401, 401, 401, 429, 429}; !reflect.DeepEqual(statuses, want) {
+			t.Errorf("%s: statuses = %v, want %v", name, statuses, want)
+		}
+		if fake.codeChecks != 3 {
+			t.Errorf("%s: %d codes checked, want none while backed off", name, fake.codeChecks)
+		}
+	}
+
+	// Activation is throttled the same way, before the pending secret is read
+	db, fake := twoFactorDB(t)
+	fake.blockedUntil = time.Now().Add(time.Minute)
+	status, response := request(t, user, "POST", "/2fa", "/2fa", `{"code": "`+code+`"}`, NewTwoFactorController(db).Activate)
+	if status != 429 || response["retry_after"] == nil {
+		t.Errorf("activate while locked out = %d %v, want 429", status, response)
+	}
+}
@@ -0,0 +1,486 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"log"
+	"strconv"
+	"strings"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UserController implements admin user management. All routes sit behind AdminMiddleware.
+type UserController struct {
+	DB *sql.DB
+}
+
+func NewUserController(db *sql.DB) *UserController {
+	return &UserController{DB: db}
+}
+
+const userColumns = `id, username, role, is_active, created_at, updated_at, totp_enabled, two_factor_required, locked_until`
+
+// GetUsers lists all users
+func (uc *UserController) GetUsers(c *fiber.Ctx) error {
+	rows, err := uc.DB.Query(`SELECT ` + userColumns + ` FROM users ORDER BY username`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch users"})
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+			&user.TwoFactorEnabled, &user.TwoFactorRequired, &user.LockedUntil); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan user data"})
+		}
+		users = append(users, user)
+	}
+
+	return c.JSON(fiber.Map{
+		"data": users,
+	})
+}
+
+// GetUser returns a single user
+func (uc *UserController) GetUser(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	var user models.User
+	err = uc.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, userID).
+		Scan(&user.ID, &user.Username, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+			&user.TwoFactorEnabled, &user.TwoFactorRequired, &user.LockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": user,
+	})
+}
+
+// CreateUser creates a user with the given role
+func (uc *UserController) CreateUser(c *fiber.Ctx) error {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+		IsActive *bool  `json:"is_active"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.Username == "" || req.Password == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Username and password are required"})
+	}
+	if req.Role == "" {
+		req.Role = "user"
+	}
+	if !validUserRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": "Role must be user or admin"})
+	}
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not hash password"})
+	}
+
+	var user models.User
+	err = uc.DB.QueryRow(`
+		INSERT INTO users (username, password, role, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING `+userColumns,
+		req.Username, hashedPassword, req.Role, isActive).
+		Scan(&user.ID, &user.Username, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+			&user.TwoFactorEnabled, &user.TwoFactorRequired, &user.LockedUntil)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{"error": "Username already exists"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create user"})
+	}
+
+	log.Printf("User %s created by admin %s", user.Username, currentUser(c).Username)
+	recordChange(c, uc.DB, "user.create", "user", user.ID, nil, auditSnapshot(uc.DB, "users", user.ID))
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "User created successfully",
+		"data":    user,
+	})
+}
+
+// UpdateUser changes username, role and active status. Role and status changes revoke existing tokens.
+func (uc *UserController) UpdateUser(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+		IsActive *bool  `json:"is_active"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	before := auditSnapshot(uc.DB, "users", userID)
+
+	var existing models.User
+	err = uc.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, userID).
+		Scan(&existing.ID, &existing.Username, &existing.Role, &existing.IsActive, &existing.CreatedAt, &existing.UpdatedAt,
+			&existing.TwoFactorEnabled, &existing.TwoFactorRequired, &existing.LockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+
+	if req.Username == "" {
+		req.Username = existing.Username
+	}
+	if req.Role == "" {
+		req.Role = existing.Role
+	}
+	if !validUserRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": "Role must be user or admin"})
+	}
+	isActive := existing.IsActive
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	if userID == currentUser(c).ID && (req.Role != "admin" || !isActive) {
+		return c.Status(400).JSON(fiber.Map{"error": "You cannot demote or deactivate your own account"})
+	}
+
+	// Tokens carry the role, so they have to be reissued when it changes
+	revoke := req.Role != existing.Role || (existing.IsActive && !isActive)
+
+	var user models.User
+	err = uc.DB.QueryRow(`
+		UPDATE users
+		SET username = $1, role = $2, is_active = $3, updated_at = NOW(),
+		    tokens_revoked_at = CASE WHEN $4 THEN NOW() ELSE tokens_revoked_at END
+		WHERE id = $5
+		RETURNING `+userColumns,
+		req.Username, req.Role, isActive, revoke, userID).
+		Scan(&user.ID, &user.Username, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+			&user.TwoFactorEnabled, &user.TwoFactorRequired, &user.LockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(409).JSON(fiber.Map{"error": "Username already exists"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update user"})
+	}
+
+	log.Printf("User %s updated by admin %s (role=%s, active=%t)", user.Username, currentUser(c).Username, user.Role, user.IsActive)
+	recordChange(c, uc.DB, "user.update", "user", userID, before, auditSnapshot(uc.DB, "users", userID))
+
+	return c.JSON(fiber.Map{
+		"message": "User updated successfully",
+		"data":    user,
+	})
+}
+
+// ChangeRole sets a user's global role and revokes their tokens
+func (uc *UserController) ChangeRole(c *fiber.Ctx) error {
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if !validUserRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": "Role must be user or admin"})
+	}
+
+	return uc.updateAccount(c, "user.role", "role = $2", req.Role, true, "Role changed successfully")
+}
+
+// DeactivateUser disables login for a user and revokes their tokens
+func (uc *UserController) DeactivateUser(c *fiber.Ctx) error {
+	return uc.updateAccount(c, "user.deactivate", "is_active = $2", false, true, "User deactivated successfully")
+}
+
+// ActivateUser re-enables a deactivated user
+func (uc *UserController) ActivateUser(c *fiber.Ctx) error {
+	return uc.updateAccount(c, "user.activate", "is_active = $2", true, false, "User activated successfully")
+}
+
+// ResetPassword sets a new password, generating one when none is given, and revokes existing tokens.
+// A generated password is only returned in this response.
+func (uc *UserController) ResetPassword(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	generated := req.Password == ""
+	if generated {
+		bytes := make([]byte, 12)
+		if _, err := rand.Read(bytes); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not generate password"})
+		}
+		req.Password = base64.RawURLEncoding.EncodeToString(bytes)
+	}
+
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not hash password"})
+	}
+
+	before := auditSnapshot(uc.DB, "users", userID)
+	result, err := uc.DB.Exec(`
+		UPDATE users SET password = $1, tokens_revoked_at = NOW(), updated_at = NOW()
+		WHERE id = $2`, hashedPassword, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to reset password"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	log.Printf("Password of user %d reset by admin %s", userID, currentUser(c).Username)
+	recordChange(c, uc.DB, "user.reset_password", "user", userID, before, auditSnapshot(uc.DB, "users", userID))
+
+	response := fiber.Map{"message": "Password reset successfully"}
+	if generated {
+		response["password"] = req.Password
+	}
+	return c.JSON(response)
+}
+
+// ForceLogout revokes every token issued to a user, including their API keys
+func (uc *UserController) ForceLogout(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	before := auditSnapshot(uc.DB, "users", userID)
+
+	tx, err := uc.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE users SET tokens_revoked_at = NOW() WHERE id = $1`, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to revoke tokens"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	result, err = tx.Exec(`UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to revoke API keys"})
+	}
+	revokedKeys, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	log.Printf("All tokens and %d API keys of user %d revoked by admin %s", revokedKeys, userID, currentUser(c).Username)
+	recordChange(c, uc.DB, "user.logout", "user", userID, before, auditSnapshot(uc.DB, "users", userID))
+
+	return c.JSON(fiber.Map{
+		"message":          "User logged out from all sessions",
+		"revoked_api_keys": revokedKeys,
+	})
+}
+
+// RequireTwoFactor enforces (or stops enforcing) two-factor authentication for a user.
+// Users without two-factor authentication enroll at their next password login.
+func (uc *UserController) RequireTwoFactor(c *fiber.Ctx) error {
+	var req struct {
+		Required bool `json:"required"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	message := "Two-factor authentication is no longer required"
+	if req.Required {
+		message = "Two-factor authentication is now required"
+	}
+	return uc.updateAccount(c, "user.2fa_required", "two_factor_required = $2", req.Required, false, message)
+}
+
+// ResetTwoFactor removes a user's authenticator and recovery codes, e.g. after a lost
+// phone, and revokes their tokens. If two-factor authentication is required they
+// enroll again at the next login.
+func (uc *UserController) ResetTwoFactor(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	before := auditSnapshot(uc.DB, "users", userID)
+
+	tx, err := uc.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE users SET tokens_revoked_at = NOW() WHERE id = $1`, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to reset two-factor authentication"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if err := clearTwoFactor(tx, userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to reset two-factor authentication"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	log.Printf("Two-factor authentication of user %d reset by admin %s", userID, currentUser(c).Username)
+	recordChange(c, uc.DB, "user.2fa_reset", "user", userID, before, auditSnapshot(uc.DB, "users", userID))
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication reset successfully",
+	})
+}
+
+// UnlockUser lifts a login lockout before it expires and clears the user's failed attempts
+func (uc *UserController) UnlockUser(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	before := auditSnapshot(uc.DB, "users", userID)
+	username, err := services.NewLoginThrottle(uc.DB).Unlock(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to unlock user"})
+	}
+
+	log.Printf("User %s unlocked by admin %s", username, currentUser(c).Username)
+	recordChange(c, uc.DB, "user.unlock", "user", userID, before, auditSnapshot(uc.DB, "users", userID))
+
+	return c.JSON(fiber.Map{
+		"message": "User unlocked successfully",
+	})
+}
+
+// DeleteUser deletes a user account
+func (uc *UserController) DeleteUser(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if userID == currentUser(c).ID {
+		return c.Status(400).JSON(fiber.Map{"error": "You cannot delete your own account"})
+	}
+
+	before := auditSnapshot(uc.DB, "users", userID)
+	result, err := uc.DB.Exec("DELETE FROM users WHERE id = $1", userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete user"})
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to verify deletion"})
+	}
+
+	if rowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	log.Printf("User %d deleted by admin %s", userID, currentUser(c).Username)
+	recordChange(c, uc.DB, "user.delete", "user", userID, before, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "User deleted successfully",
+	})
+}
+
+// updateAccount applies a single-column change to the user in the route, optionally revoking
+// tokens, and audits it as action
+func (uc *UserController) updateAccount(c *fiber.Ctx, action, set string, value interface{}, revoke bool, message string) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if userID == currentUser(c).ID && revoke {
+		return c.Status(400).JSON(fiber.Map{"error": "You cannot demote or deactivate your own account"})
+	}
+
+	before := auditSnapshot(uc.DB, "users", userID)
+
+	query := `UPDATE users SET ` + set + `, updated_at = NOW()`
+	if revoke {
+		query += `, tokens_revoked_at = NOW()`
+	}
+	query += ` WHERE id = $1 RETURNING ` + userColumns
+
+	var user models.User
+	err = uc.DB.QueryRow(query, userID, value).
+		Scan(&user.ID, &user.Username, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+			&user.TwoFactorEnabled, &user.TwoFactorRequired, &user.LockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update user"})
+	}
+
+	log.Printf("User %s updated by admin %s: %s", user.Username, currentUser(c).Username, message)
+	recordChange(c, uc.DB, action, "user", userID, before, auditSnapshot(uc.DB, "users", userID))
+
+	return c.JSON(fiber.Map{
+		"message": message,
+		"data":    user,
+	})
+}
+
+func validUserRole(role string) bool {
+	return role == "user" || role == "admin"
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"api-monitor/app/models"
+)
+
+func TestForceLogoutRevokesAPIKeys(t *testing.T) {
+	var revokedUsers, revokedKeys []driver.Value
+	db, fake := teamDB(t, "", func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "UPDATE users SET tokens_revoked_at"):
+			revokedUsers = append(revokedUsers, args[0])
+			return nil, nil, nil
+		case strings.Contains(query, "UPDATE api_keys SET revoked_at"):
+			revokedKeys = append(revokedKeys, args[0])
+			return nil, nil, nil
+		}
+		return nil, nil, errors.New("unexpected query: " + query)
+	})
+	uc := NewUserController(db)
+	admin := &models.User{ID: 1, Username: "admin", Role: "admin"}
+
+	status, body := request(t, admin, "POST", "/users/:id/logout", "/users/7/logout", "", uc.ForceLogout)
+	if status != 200 || body["revoked_api_keys"] == nil {
+		t.Fatalf("status %d, body %v", status, body)
+	}
+	if len(revokedUsers) != 1 || revokedUsers[0] != int64(7) || len(revokedKeys) != 1 || revokedKeys[0] != int64(7) {
+		t.Errorf("revoked tokens of %v and API keys of %v, want both of user 7", revokedUsers, revokedKeys)
+	}
+	if queries := strings.Join(fake.Queries(), "\n"); !strings.Contains(queries, "COMMIT") {
+		t.Errorf("revocation was not committed:\n%s", queries)
+	}
+}
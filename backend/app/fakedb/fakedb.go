@@ -0,0 +1,125 @@
+// Package fakedb is a database/sql driver for tests that hands every statement to a
+// handler, so code written against *sql.DB can be tested without PostgreSQL.
+// Prepared statements are not supported.
+package fakedb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// Handler answers a statement sent to a fake database: the columns and rows of a
+// query, or an error. Exec statements only look at the error.
+type Handler func(query string, args []driver.Value) ([]string, [][]driver.Value, error)
+
+// DB is the connector behind a fake *sql.DB
+type DB struct {
+	mu      sync.Mutex
+	handler Handler
+	queries []string
+}
+
+// Open returns a *sql.DB backed by handler; it is closed when the test ends
+func Open(t testing.TB, handler Handler) (*sql.DB, *DB) {
+	t.Helper()
+	fake := &DB{handler: handler}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+	return db, fake
+}
+
+// Queries returns the statements run so far
+func (f *DB) Queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.queries...)
+}
+
+func (f *DB) record(query string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, query)
+}
+
+func (f *DB) run(query string, named []driver.NamedValue) ([]string, [][]driver.Value, error) {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+
+	f.mu.Lock()
+	f.queries = append(f.queries, query)
+	handler := f.handler
+	f.mu.Unlock()
+
+	return handler(query, args)
+}
+
+func (f *DB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: f}, nil }
+func (f *DB) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fake database: use fakedb.Open")
+}
+
+type fakeConn struct {
+	db *DB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake database: prepared statements are not supported")
+}
+func (c *fakeConn) Close() error { return nil }
+
+// Begin starts a transaction whose statements go to the handler like any other;
+// COMMIT and ROLLBACK are only recorded in Queries
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.record("BEGIN")
+	return fakeTx{db: c.db}, nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	columns, rows, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, _, err := c.db.run(query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type fakeTx struct {
+	db *DB
+}
+
+func (tx fakeTx) Commit() error   { tx.db.record("COMMIT"); return nil }
+func (tx fakeTx) Rollback() error { tx.db.record("ROLLBACK"); return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"api-monitor/app/models"
+	"api-monitor/config"
+	"api-monitor/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// scopeResources maps the first path segment under /api/v1 to the resource named in
+// API key scopes. Routes missing here (users, invitations, api-keys, audit) need a JWT.
+var scopeResources = map[string]string{
+	"endpoints":     "endpoints",
+	"proxies":       "proxies",
+	"auth-profiles": "profiles",
+	"tls-profiles":  "profiles",
+	"schemas":       "profiles",
+	"teams":         "teams",
+}
+
+// AuthMiddleware accepts either an API key (X-API-Key header, or a Bearer token with
+// the API key prefix) or a JWT access token
+func AuthMiddleware() fiber.Handler {
+	jwtHandler := JWTMiddleware()
+	apiKeyHandler := APIKeyMiddleware()
+
+	return func(c *fiber.Ctx) error {
+		if apiKeyFromRequest(c) != "" {
+			return apiKeyHandler(c)
+		}
+		return jwtHandler(c)
+	}
+}
+
+// APIKeyMiddleware authenticates requests made with an API key. The key acts as its
+// owner, but only for routes covered by its scopes.
+func APIKeyMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := apiKeyFromRequest(c)
+		if key == "" {
+			return c.Status(401).JSON(fiber.Map{"error": "API key required"})
+		}
+
+		db, err := config.ConnectDBWithoutMigration()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Authentication error"})
+		}
+		defer db.Close()
+
+		apiKey, user, err := findAPIKey(db, key)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.Status(401).JSON(fiber.Map{"error": "Invalid or expired API key"})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Authentication error"})
+		}
+
+		scope := requiredScope(c)
+		if scope == "" || !hasScope(apiKey.Scopes, scope) {
+			return c.Status(403).JSON(fiber.Map{"error": "API key is missing the required scope", "scope": scope})
+		}
+
+		// Store user info in context
+		c.Locals("user", user)
+		c.Locals("userID", user.ID)
+		c.Locals("username", user.Username)
+		c.Locals("role", user.Role)
+		c.Locals("apiKeyID", apiKey.ID)
+		c.Locals("apiKeyScopes", apiKey.Scopes)
+		return c.Next()
+	}
+}
+
+func apiKeyFromRequest(c *fiber.Ctx) string {
+	if key := c.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token := strings.TrimPrefix(c.Get("Authorization"), "Bearer "); strings.HasPrefix(token, models.APIKeyPrefix) {
+		return token
+	}
+	return ""
+}
+
+// findAPIKey loads an active, unexpired key of an active user and records its use
+func findAPIKey(db *sql.DB, key string) (models.APIKey, *models.User, error) {
+	var apiKey models.APIKey
+	user := &models.User{}
+
+	var scopesJSON string
+	err := db.QueryRow(`
+		SELECT k.id, k.scopes, u.id, u.username, u.role
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL
+		  AND (k.expires_at IS NULL OR k.expires_at > NOW())
+		  AND u.is_active = true`, utils.HashToken(key)).
+		Scan(&apiKey.ID, &scopesJSON, &user.ID, &user.Username, &user.Role)
+	if err != nil {
+		return apiKey, nil, err
+	}
+
+	if err := json.Unmarshal([]byte(scopesJSON), &apiKey.Scopes); err != nil {
+		return apiKey, nil, err
+	}
+
+	// Only write last_used_at once a minute for busy keys. It is informational, so a
+	// failed update does not fail the request.
+	_, err = db.Exec(`
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`, apiKey.ID)
+	if err != nil {
+		log.Printf("Could not record use of API key %d: %v", apiKey.ID, err)
+	}
+
+	return apiKey, user, nil
+}
+
+// requiredScope derives the scope for the current route: GET and HEAD need read,
+// everything else needs write. Returns "" for routes API keys cannot use.
+func requiredScope(c *fiber.Ctx) string {
+	path := strings.TrimPrefix(c.Path(), "/api/v1/")
+	segment, _, _ := strings.Cut(path, "/")
+
+	resource, exists := scopeResources[segment]
+	if !exists {
+		return ""
+	}
+
+	if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+		return resource + ":read"
+	}
+	return resource + ":write"
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
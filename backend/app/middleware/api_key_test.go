@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-monitor/app/fakedb"
+	"api-monitor/app/models"
+	"api-monitor/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// probe runs a request through a route that answers with fn's result in a header, HEAD
+// responses have no body
+func probe(t *testing.T, method, path string, headers map[string]string, fn func(c *fiber.Ctx) string) string {
+	t.Helper()
+	app := fiber.New()
+	app.All("/*", func(c *fiber.Ctx) error {
+		c.Set("X-Result", fn(c))
+		return nil
+	})
+
+	req := httptest.NewRequest(method, path, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Header.Get("X-Result")
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, path, want string
+	}{
+		{"GET", "/api/v1/endpoints", models.ScopeEndpointsRead},
+		{"HEAD", "/api/v1/endpoints/4/history", models.ScopeEndpointsRead},
+		{"POST", "/api/v1/endpoints/4/test", models.ScopeEndpointsWrite},
+		{"DELETE", "/api/v1/proxies/2", models.ScopeProxiesWrite},
+		{"GET", "/api/v1/tls-profiles", models.ScopeProfilesRead},
+		{"PUT", "/api/v1/schemas/1", models.ScopeProfilesWrite},
+		{"PATCH", "/api/v1/teams/3", models.ScopeTeamsWrite},
+		{"GET", "/api/v1/users", ""},
+		{"POST", "/api/v1/api-keys", ""},
+		{"GET", "/api/v1/audit", ""},
+		{"GET", "/api/v1/endpointsx", ""},
+	}
+	for _, tt := range tests {
+		if got := probe(t, tt.method, tt.path, nil, requiredScope); got != tt.want {
+			t.Errorf("%s %s: requiredScope = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyFromRequest(t *testing.T) {
+	key := models.APIKeyPrefix + "abc"
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"X-API-Key header", map[string]string{"X-API-Key": "anything"}, "anything"},
+		{"Bearer API key", map[string]string{"Authorization": "Bearer " + key}, key},
+		{"X-API-Key wins", map[string]string{"X-API-Key": "first", "Authorization": "Bearer " + key}, "first"},
+		{"Bearer JWT", map[string]string{"Authorization": "Bearer eyJhbGciOi"}, ""},
+		{"no credentials", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := probe(t, "GET", "/api/v1/endpoints", tt.headers, apiKeyFromRequest); got != tt.want {
+			t.Errorf("%s: apiKeyFromRequest = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	scopes := []string{models.ScopeEndpointsRead, models.ScopeProxiesWrite}
+	for scope, want := range map[string]bool{
+		models.ScopeEndpointsRead:  true,
+		models.ScopeProxiesWrite:   true,
+		models.ScopeEndpointsWrite: false, // write does not follow from read
+		models.ScopeProxiesRead:    false, // nor read from write
+		"":                         false,
+	} {
+		if got := hasScope(scopes, scope); got != want {
+			t.Errorf("hasScope(%q) = %t, want %t", scope, got, want)
+		}
+	}
+}
+
+func TestFindAPIKeyLastUsedIsBestEffort(t *testing.T) {
+	db, fake := fakedb.Open(t, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "FROM api_keys k"):
+			if args[0] != utils.HashToken("amk_valid") {
+				return []string{"id"}, nil, nil
+			}
+			return []string{"id", "scopes", "user_id", "username", "role"},
+				[][]driver.Value{{int64(3), `["endpoints:read"]`, int64(7), "ci", "user"}}, nil
+		case strings.Contains(query, "UPDATE api_keys SET last_used_at"):
+			return nil, nil, errors.New("canceling statement due to lock timeout")
+		}
+		return nil, nil, errors.New("unexpected query: " + query)
+	})
+
+	apiKey, user, err := findAPIKey(db, "amk_valid")
+	if err != nil || apiKey.ID != 3 || user.Username != "ci" || !hasScope(apiKey.Scopes, models.ScopeEndpointsRead) {
+		t.Fatalf("findAPIKey = %+v, %+v, %v; want the key although last_used_at could not be written", apiKey, user, err)
+	}
+	if queries := fake.Queries(); len(queries) != 2 {
+		t.Errorf("queries = %v, want the lookup and the last_used_at update", queries)
+	}
+
+	if _, _, err := findAPIKey(db, "amk_unknown"); err != sql.ErrNoRows {
+		t.Errorf("unknown key: %v, want sql.ErrNoRows", err)
+	}
+}
@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"api-monitor/app/models"
 	"api-monitor/config"
@@ -38,8 +40,14 @@ func JWTMiddleware() fiber.Handler {
 		}
 
 		if claims, ok := token.Claims.(*models.JWTClaims); ok && token.Valid {
-			// Check if token is blacklisted
-			if isBlacklisted, err := checkTokenBlacklist(claims.ID); err != nil {
+			db, err := config.ConnectDBWithoutMigration()
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Authentication error"})
+			}
+			defer db.Close()
+
+			// Check if token is blacklisted or was revoked for the whole account
+			if isBlacklisted, err := checkTokenBlacklist(db, claims); err != nil {
 				return c.Status(500).JSON(fiber.Map{"error": "Authentication error"})
 			} else if isBlacklisted {
 				return c.Status(401).JSON(fiber.Map{"error": "Token has been revoked"})
@@ -57,6 +65,7 @@ func JWTMiddleware() fiber.Handler {
 			c.Locals("userID", claims.UserID)
 			c.Locals("username", claims.Username)
 			c.Locals("role", claims.Role)
+			c.Locals("sessionID", claims.SessionID)
 			return c.Next()
 		}
 
@@ -64,24 +73,38 @@ func JWTMiddleware() fiber.Handler {
 	}
 }
 
-// Check if token is blacklisted
-func checkTokenBlacklist(jti string) (bool, error) {
-	db, err := config.ConnectDBWithoutMigration()
-	if err != nil {
-		return false, err
+// Check if token is blacklisted, belongs to a revoked session, or belongs to a user who
+// was deactivated, deleted or had all tokens revoked after it was issued. Revocation is
+// compared with the start of the token's session like for refresh tokens: the iat claim
+// has whole seconds only, so tokens issued in the second of a revocation would be
+// rejected however recent they are. Tokens without a session fall back to iat.
+func checkTokenBlacklist(db *sql.DB, claims *models.JWTClaims) (bool, error) {
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
 	}
-	defer db.Close()
 
-	var count int
-	err = db.QueryRow(`
-		SELECT COUNT(*) FROM blacklisted_tokens 
-		WHERE token_jti = $1 AND expires_at > NOW()`, jti).Scan(&count)
+	var revoked bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM blacklisted_tokens
+			WHERE token_jti = $1 AND expires_at > NOW()
+		) OR EXISTS (
+			SELECT 1 FROM user_sessions
+			WHERE id = $4 AND revoked_at IS NOT NULL
+		) OR NOT EXISTS (
+			SELECT 1 FROM users u
+			WHERE u.id = $2 AND u.is_active = true
+			  AND (u.tokens_revoked_at IS NULL OR COALESCE(
+			      u.tokens_revoked_at <= (SELECT created_at FROM user_sessions WHERE id = $4 AND user_id = u.id),
+			      date_trunc('second', u.tokens_revoked_at) <= $3))
+		)`, claims.ID, claims.UserID, issuedAt, claims.SessionID).Scan(&revoked)
 
 	if err != nil {
 		return false, err
 	}
 
-	return count > 0, nil
+	return revoked, nil
 }
 
 // Admin Middleware
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// APIKeyPrefix starts every API key so keys can be told apart from JWTs
+const APIKeyPrefix = "amk_"
+
+// API key scopes: <resource>:read allows GET requests, <resource>:write everything else
+const (
+	ScopeEndpointsRead  = "endpoints:read"
+	ScopeEndpointsWrite = "endpoints:write"
+	ScopeProxiesRead    = "proxies:read"
+	ScopeProxiesWrite   = "proxies:write"
+	ScopeProfilesRead   = "profiles:read"
+	ScopeProfilesWrite  = "profiles:write"
+	ScopeTeamsRead      = "teams:read"
+	ScopeTeamsWrite     = "teams:write"
+)
+
+// APIKeyScopes lists every scope a key can be granted
+var APIKeyScopes = []string{
+	ScopeEndpointsRead, ScopeEndpointsWrite,
+	ScopeProxiesRead, ScopeProxiesWrite,
+	ScopeProfilesRead, ScopeProfilesWrite,
+	ScopeTeamsRead, ScopeTeamsWrite,
+}
+
+// APIKey is a long-lived credential acting as its owner, limited to its scopes
+type APIKey struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	Username   string     `json:"username,omitempty"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"key_prefix"`
+	Key        string     `json:"key,omitempty"` // Only returned when the key is created
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
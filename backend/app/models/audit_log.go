@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditLog records who did what, from where. Configuration changes also carry the
+// resource state before and after the change and the fields that differ.
+type AuditLog struct {
+	ID            int                    `json:"id" db:"id"`
+	ActorID       *int                   `json:"actor_id" db:"actor_id"`
+	ActorUsername string                 `json:"actor_username" db:"actor_username"`
+	Action        string                 `json:"action" db:"action"`
+	ResourceType  string                 `json:"resource_type" db:"resource_type"`
+	ResourceID    string                 `json:"resource_id" db:"resource_id"`
+	IPAddress     string                 `json:"ip_address" db:"ip_address"`
+	Details       map[string]interface{} `json:"details" db:"details"`
+	Before        map[string]interface{} `json:"before,omitempty" db:"before_state"`
+	After         map[string]interface{} `json:"after,omitempty" db:"after_state"`
+	Changes       map[string]AuditChange `json:"changes,omitempty" db:"changes"`
+	CreatedAt     time.Time              `json:"created_at" db:"created_at"`
+}
+
+// AuditChange is the old and new value of one changed field
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// Auth profile types
+const (
+	AuthTypeOAuth2ClientCredentials = "oauth2_client_credentials"
+	AuthTypeOAuth2RefreshToken      = "oauth2_refresh_token"
+	AuthTypeBasic                   = "basic"
+	AuthTypeAPIKey                  = "api_key"
+)
+
+// AuthProfile holds reusable credentials that endpoints reference via auth_profile_id
+type AuthProfile struct {
+	ID          int               `json:"id" db:"id"`
+	Name        string            `json:"name" db:"name"`
+	Type        string            `json:"type" db:"type"`
+	Config      AuthProfileConfig `json:"config" db:"config"`
+	IsActive    bool              `json:"is_active" db:"is_active"`
+	LastError   string            `json:"last_error" db:"last_error"`
+	LastErrorAt *time.Time        `json:"last_error_at" db:"last_error_at"`
+	TeamID      *int              `json:"team_id" db:"team_id"`
+	CreatedAt   time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// AuthProfileConfig is stored as JSON; only the fields used by the profile type are set
+type AuthProfileConfig struct {
+	// OAuth2
+	TokenURL     string   `json:"token_url,omitempty"`
+	ClientID     string   `json:"client_id,omitempty"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+	Audience     string   `json:"audience,omitempty"`
+	RefreshToken string   `json:"refresh_token,omitempty"`
+	ClientAuth   string   `json:"client_auth,omitempty"` // "header" (default) or "body"
+
+	// Basic auth
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// API key
+	KeyName  string `json:"key_name,omitempty"`
+	KeyValue string `json:"key_value,omitempty"`
+	KeyIn    string `json:"key_in,omitempty"` // "header" (default) or "query"
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// Content change types. A shape change (fields added, removed or of another type) is
+// reported as such even though the content changed as well.
+const (
+	ContentChangeShape   = "shape"
+	ContentChangeContent = "content"
+)
+
+// ContentTracking is the opt-in setting that compares response bodies across checks.
+// IgnorePaths are JSON paths left out before comparing, such as "meta.generated_at" or
+// "items[*].updated_at".
+type ContentTracking struct {
+	Enabled     bool     `json:"enabled" yaml:"enabled"`
+	IgnorePaths []string `json:"ignore_paths,omitempty" yaml:"ignore_paths,omitempty"`
+}
+
+// ResponseSnapshot is a distinct normalized response body of an endpoint
+type ResponseSnapshot struct {
+	ID          int         `json:"id"`
+	EndpointID  int         `json:"endpoint_id"`
+	ContentHash string      `json:"content_hash"`
+	ShapeHash   string      `json:"shape_hash"`
+	Body        *string     `json:"body"`  // Nil when the body was too large to keep
+	Shape       interface{} `json:"shape"` // Types of the JSON fields, nil for other bodies
+	FirstSeenAt time.Time   `json:"first_seen_at"`
+	LastSeenAt  time.Time   `json:"last_seen_at"`
+}
+
+// ContentChange is a content changed event
+type ContentChange struct {
+	ID                 int                `json:"id"`
+	EndpointID         int                `json:"endpoint_id"`
+	CheckLogID         *int               `json:"check_log_id"`
+	ChangeType         string             `json:"change_type"`
+	PreviousSnapshotID *int               `json:"previous_snapshot_id"`
+	SnapshotID         *int               `json:"snapshot_id"`
+	Diff               []ContentDiffEntry `json:"diff"`
+	DiffTruncated      bool               `json:"diff_truncated"`
+	DetectedAt         time.Time          `json:"detected_at"`
+}
+
+// ContentDiffEntry is one difference between two snapshots: a JSON path that was added,
+// removed or changed, or for other bodies a line
+type ContentDiffEntry struct {
+	Path   string      `json:"path"`
+	Op     string      `json:"op"` // added, removed or changed
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
@@ -4,29 +4,92 @@ import (
 	"time"
 )
 
+// Endpoint types: http endpoints are polled, heartbeat endpoints wait for pings
+const (
+	EndpointTypeHTTP      = "http"
+	EndpointTypeHeartbeat = "heartbeat"
+)
+
 type APIEndpoint struct {
-	ID                   int               `json:"id" db:"id"`
-	Name                 string            `json:"name" db:"name"`
-	URL                  string            `json:"url" db:"url"`
-	Method               string            `json:"method" db:"method"`
-	Headers              map[string]string `json:"headers" db:"headers"`
-	Body                 string            `json:"body" db:"body"`
-	TimeoutSeconds       int               `json:"timeout_seconds" db:"timeout_seconds"`
-	CheckIntervalSeconds int               `json:"check_interval_seconds" db:"check_interval_seconds"`
-	IsActive             bool              `json:"is_active" db:"is_active"`
-	ProxyID              *int              `json:"proxy_id" db:"proxy_id"`
-	Proxy                *Proxy            `json:"proxy,omitempty"`
-	CreatedAt            time.Time         `json:"created_at" db:"created_at"`
-	UpdatedAt            time.Time         `json:"updated_at" db:"updated_at"`
+	ID                   int                    `json:"id" db:"id"`
+	Key                  string                 `json:"key" db:"key"` // Stable identifier within the team, used by import/export
+	Type                 string                 `json:"type" db:"type"`
+	Name                 string                 `json:"name" db:"name"`
+	URL                  string                 `json:"url" db:"url"`
+	Method               string                 `json:"method" db:"method"`
+	Headers              map[string]string      `json:"headers" db:"headers"`
+	Body                 string                 `json:"body" db:"body"`
+	TimeoutSeconds       int                    `json:"timeout_seconds" db:"timeout_seconds"`
+	CheckIntervalSeconds int                    `json:"check_interval_seconds" db:"check_interval_seconds"` // Expected ping period of heartbeats
+	GraceSeconds         int                    `json:"grace_seconds" db:"grace_seconds"`                   // How late a heartbeat ping may be
+	IsActive             bool                   `json:"is_active" db:"is_active"`
+	ProxyID              *int                   `json:"proxy_id" db:"proxy_id"`
+	Proxy                *Proxy                 `json:"proxy,omitempty"`
+	AuthProfileID        *int                   `json:"auth_profile_id" db:"auth_profile_id"`
+	TLSProfileID         *int                   `json:"tls_profile_id" db:"tls_profile_id"`
+	TLSProfile           *TLSProfile            `json:"-"`
+	TeamID               *int                   `json:"team_id" db:"team_id"`
+	Labels               map[string]string      `json:"labels" db:"labels"`
+	Group                string                 `json:"group" db:"group_path"` // Folder-style path such as "payments/checkout"
+	ContentTracking      ContentTracking        `json:"content_tracking" db:"content_tracking"`
+	ResponseCapture      ResponseCapture        `json:"response_capture" db:"response_capture"`
+	Transport            TransportOptions       `json:"transport" db:"transport"`
+	ResponseSchema       map[string]interface{} `json:"response_schema" db:"response_schema"`       // Inline JSON Schema the response must match
+	ResponseSchemaID     *int                   `json:"response_schema_id" db:"response_schema_id"` // Or a schema from the library
+	Version              int                    `json:"version" db:"version"`
+	PingURL              string                 `json:"ping_url,omitempty"` // Only set when a heartbeat's token is issued
+	CreatedAt            time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt            time.Time              `json:"updated_at" db:"updated_at"`
 }
 
+// Check statuses. A failed check is blocked rather than down while one of the endpoint's
+// dependencies is down or blocked itself. Checks that could not get the credentials of
+// their auth profile are auth errors, the endpoint itself was not requested.
+const (
+	EndpointStatusUp        = "up"
+	EndpointStatusDown      = "down"
+	EndpointStatusBlocked   = "blocked"
+	EndpointStatusAuthError = "auth_error"
+)
+
 type APICheckLog struct {
-	ID              int       `json:"id"`
-	EndpointID      int       `json:"endpoint_id"`
-	StatusCode      int       `json:"status_code"`
-	ResponseTimeMs  int       `json:"response_time_ms"`
-	ResponseBody    string    `json:"response_body"`
-	ResponseHeaders string    `json:"response_headers"`
-	ErrorMessage    string    `json:"error_message"`
-	CheckedAt       time.Time `json:"checked_at"`
+	ID                int           `json:"id"`
+	EndpointID        int           `json:"endpoint_id"`
+	EndpointVersion   *int          `json:"endpoint_version"`
+	StatusCode        int           `json:"status_code"`
+	ResponseTimeMs    int           `json:"response_time_ms"`
+	ResponseBody      string        `json:"response_body"`
+	ResponseHeaders   string        `json:"response_headers"`
+	ErrorMessage      string        `json:"error_message"`
+	Status            string        `json:"status"`
+	BlockedBy         *int          `json:"blocked_by"`          // Dependency that was down when a blocked check ran
+	SchemaErrors      []SchemaError `json:"schema_errors"`       // Nil when the endpoint has no response schema
+	ResponseCaptureID *int          `json:"response_capture_id"` // Full response, see response_capture
+	Details           *CheckDetails `json:"details"`             // Nil for checks that sent no request
+	CheckedAt         time.Time     `json:"checked_at"`
+}
+
+// CheckDetails records what a check actually sent and where the response came from
+type CheckDetails struct {
+	Request          CheckRequest        `json:"request"`
+	FinalURL         string              `json:"final_url"`
+	Redirects        []RedirectHop       `json:"redirects"`
+	Protocol         string              `json:"protocol"`          // e.g. HTTP/1.1 or HTTP/2.0
+	RemoteIP         string              `json:"remote_ip"`         // The proxy's address when the endpoint uses one
+	ReusedConnection bool                `json:"reused_connection"` // False when the check opened a new connection
+	ResponseHeaders  map[string][]string `json:"response_headers"`
+}
+
+// CheckRequest is the last request of a check as it was written, secrets redacted
+type CheckRequest struct {
+	Method  string              `json:"method"`
+	URL     string              `json:"url"`
+	Headers map[string][]string `json:"headers"`
+}
+
+// RedirectHop is a response that redirected the check
+type RedirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Location   string `json:"location"`
 }
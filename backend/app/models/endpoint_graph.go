@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// EndpointGraph is the dependency graph of a set of endpoints
+type EndpointGraph struct {
+	Nodes []EndpointGraphNode `json:"nodes"`
+	Edges []EndpointGraphEdge `json:"edges"`
+}
+
+// EndpointGraphNode is an endpoint with the outcome of its latest check
+type EndpointGraphNode struct {
+	ID            int        `json:"id"`
+	Key           string     `json:"key"`
+	Name          string     `json:"name"`
+	Group         string     `json:"group"`
+	TeamID        *int       `json:"team_id"`
+	IsActive      bool       `json:"is_active"`
+	Status        string     `json:"status"` // Empty until the endpoint has been checked
+	BlockedBy     *int       `json:"blocked_by"`
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+}
+
+// EndpointGraphEdge points from an endpoint to an endpoint it depends on
+type EndpointGraphEdge struct {
+	EndpointID  int `json:"endpoint_id"`
+	DependsOnID int `json:"depends_on_id"`
+}
+
+// EndpointDependencies lists the direct dependencies of an endpoint and the endpoints
+// depending on it
+type EndpointDependencies struct {
+	EndpointID int                 `json:"endpoint_id"`
+	DependsOn  []EndpointGraphNode `json:"depends_on"`
+	Dependents []EndpointGraphNode `json:"dependents"`
+}
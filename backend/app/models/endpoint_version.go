@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// Endpoint version change types
+const (
+	EndpointChangeCreate  = "create"
+	EndpointChangeUpdate  = "update"
+	EndpointChangeRestore = "restore"
+)
+
+// EndpointDefinition is the versioned part of an endpoint: everything that decides how it
+// is checked. Whether the endpoint is active is not part of it, toggling is audited only.
+type EndpointDefinition struct {
+	Name                 string                 `json:"name"`
+	URL                  string                 `json:"url"`
+	Method               string                 `json:"method"`
+	Headers              map[string]string      `json:"headers"`
+	Body                 string                 `json:"body"`
+	TimeoutSeconds       int                    `json:"timeout_seconds"`
+	CheckIntervalSeconds int                    `json:"check_interval_seconds"`
+	ProxyID              *int                   `json:"proxy_id"`
+	AuthProfileID        *int                   `json:"auth_profile_id"`
+	TLSProfileID         *int                   `json:"tls_profile_id"`
+	TeamID               *int                   `json:"team_id"`
+	Labels               map[string]string      `json:"labels,omitempty"`
+	Group                string                 `json:"group,omitempty"`
+	Type                 string                 `json:"type,omitempty"` // Empty for http endpoints
+	GraceSeconds         int                    `json:"grace_seconds,omitempty"`
+	ContentTracking      *ContentTracking       `json:"content_tracking,omitempty"` // Nil while tracking is off
+	ResponseCapture      *ResponseCapture       `json:"response_capture,omitempty"` // Nil while the defaults apply
+	Transport            *TransportOptions      `json:"transport,omitempty"`        // Nil while the defaults apply
+	ResponseSchema       map[string]interface{} `json:"response_schema,omitempty"`
+	ResponseSchemaID     *int                   `json:"response_schema_id,omitempty"`
+}
+
+// EndpointVersion is one saved definition of an endpoint
+type EndpointVersion struct {
+	ID                int                    `json:"id" db:"id"`
+	EndpointID        int                    `json:"endpoint_id" db:"endpoint_id"`
+	Version           int                    `json:"version" db:"version"`
+	Definition        EndpointDefinition     `json:"definition" db:"definition"`
+	ChangeType        string                 `json:"change_type" db:"change_type"`
+	RestoredFrom      *int                   `json:"restored_from,omitempty" db:"restored_from"`
+	CreatedBy         *int                   `json:"created_by" db:"created_by"`
+	CreatedByUsername string                 `json:"created_by_username" db:"created_by_username"`
+	CreatedAt         time.Time              `json:"created_at" db:"created_at"`
+	Changes           map[string]AuditChange `json:"changes,omitempty"` // Compared with the previous version
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// Invitation is a single-use, expiring registration token with a preset role
+type Invitation struct {
+	ID        int        `json:"id" db:"id"`
+	Token     string     `json:"token,omitempty"` // Only returned when the invitation is created
+	Role      string     `json:"role" db:"role"`
+	TeamID    *int       `json:"team_id" db:"team_id"`
+	TeamRole  string     `json:"team_role" db:"team_role"`
+	CreatedBy *int       `json:"created_by" db:"created_by"`
+	UsedBy    *int       `json:"used_by" db:"used_by"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// JSONSchema is a reusable JSON Schema (draft 2020-12 unless it names another draft in
+// $schema) that endpoints reference via response_schema_id
+type JSONSchema struct {
+	ID          int                    `json:"id" db:"id"`
+	Name        string                 `json:"name" db:"name"`
+	Description string                 `json:"description" db:"description"`
+	Schema      map[string]interface{} `json:"schema" db:"schema"`
+	TeamID      *int                   `json:"team_id" db:"team_id"`
+	CreatedAt   time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at" db:"updated_at"`
+}
+
+// SchemaError is one way a response body does not match its schema. Path is a JSON
+// pointer into the body, "" for the body itself.
+type SchemaError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
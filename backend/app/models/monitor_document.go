@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+)
+
+// MonitorDocumentVersion is the format version written by exports and accepted by imports
+const MonitorDocumentVersion = 1
+
+// Import actions
+const (
+	ImportActionCreate    = "create"
+	ImportActionUpdate    = "update"
+	ImportActionUnchanged = "unchanged"
+)
+
+// MonitorDocument is the JSON/YAML file format for exporting and importing the endpoints
+// and proxies of a team, e.g. to keep them in git. Nothing in it refers to database ids:
+// endpoints are identified by key, proxies and profiles by name.
+type MonitorDocument struct {
+	Version    int                `json:"version" yaml:"version"`
+	ExportedAt *time.Time         `json:"exported_at,omitempty" yaml:"exported_at,omitempty"`
+	Proxies    []DocumentProxy    `json:"proxies" yaml:"proxies"`
+	Endpoints  []DocumentEndpoint `json:"endpoints" yaml:"endpoints"`
+}
+
+// DocumentProxy is a proxy in a monitor document. Passwords are never exported; on import
+// an empty password keeps the stored one.
+type DocumentProxy struct {
+	Name     string `json:"name" yaml:"name"`
+	Host     string `json:"host" yaml:"host"`
+	Port     int    `json:"port" yaml:"port"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	IsActive *bool  `json:"is_active,omitempty" yaml:"is_active,omitempty"` // Defaults to true
+}
+
+// DocumentEndpoint is an endpoint in a monitor document. Proxy, AuthProfile, TLSProfile and
+// Schema are names; omitted timeouts and intervals use the database defaults.
+type DocumentEndpoint struct {
+	Key                  string                 `json:"key" yaml:"key"`
+	Type                 string                 `json:"type,omitempty" yaml:"type,omitempty"` // http (default) or heartbeat
+	Name                 string                 `json:"name" yaml:"name"`
+	URL                  string                 `json:"url,omitempty" yaml:"url,omitempty"` // Not used by heartbeats
+	Method               string                 `json:"method,omitempty" yaml:"method,omitempty"`
+	Headers              map[string]string      `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body                 string                 `json:"body,omitempty" yaml:"body,omitempty"`
+	TimeoutSeconds       int                    `json:"timeout_seconds,omitempty" yaml:"timeout_seconds,omitempty"`
+	CheckIntervalSeconds int                    `json:"check_interval_seconds,omitempty" yaml:"check_interval_seconds,omitempty"`
+	GraceSeconds         int                    `json:"grace_seconds,omitempty" yaml:"grace_seconds,omitempty"`
+	IsActive             *bool                  `json:"is_active,omitempty" yaml:"is_active,omitempty"` // Defaults to true
+	Proxy                string                 `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+	AuthProfile          string                 `json:"auth_profile,omitempty" yaml:"auth_profile,omitempty"`
+	TLSProfile           string                 `json:"tls_profile,omitempty" yaml:"tls_profile,omitempty"`
+	Group                string                 `json:"group,omitempty" yaml:"group,omitempty"`
+	Labels               map[string]string      `json:"labels,omitempty" yaml:"labels,omitempty"`
+	ContentTracking      *ContentTracking       `json:"content_tracking,omitempty" yaml:"content_tracking,omitempty"` // Left out while disabled
+	ResponseCapture      *ResponseCapture       `json:"response_capture,omitempty" yaml:"response_capture,omitempty"` // Left out while the defaults apply
+	Transport            *TransportOptions      `json:"transport,omitempty" yaml:"transport,omitempty"`               // Left out while the defaults apply
+	ResponseSchema       map[string]interface{} `json:"response_schema,omitempty" yaml:"response_schema,omitempty"`   // Inline JSON Schema
+	Schema               string                 `json:"schema,omitempty" yaml:"schema,omitempty"`                     // Or a library schema
+}
+
+// ImportPlan lists what importing a monitor document changes. Errors are problems in the
+// document, such as unknown profiles; a plan with errors cannot be applied.
+type ImportPlan struct {
+	Summary map[string]int `json:"summary"` // Number of changes per action
+	Changes []ImportChange `json:"changes"`
+	Errors  []string       `json:"errors,omitempty"`
+}
+
+// ImportChange is the planned action for one proxy or endpoint of a document
+type ImportChange struct {
+	ResourceType string                 `json:"resource_type"` // proxy or endpoint
+	Key          string                 `json:"key"`           // Endpoint key or proxy name
+	Action       string                 `json:"action"`
+	ID           int                    `json:"id,omitempty"` // Existing resource, set for updates and after creation
+	Changes      map[string]AuditChange `json:"changes,omitempty"`
+	PingURL      string                 `json:"ping_url,omitempty"` // Issued to new heartbeats
+
+	// Desired state, resolved against the database
+	Proxy         *DocumentProxy    `json:"-"`
+	Endpoint      *DocumentEndpoint `json:"-"`
+	AuthProfileID *int              `json:"-"`
+	TLSProfileID  *int              `json:"-"`
+	SchemaID      *int              `json:"-"`
+}
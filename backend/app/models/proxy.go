@@ -12,6 +12,7 @@ type Proxy struct {
 	Username  string    `json:"username" db:"username"`
 	Password  string    `json:"password" db:"password"`
 	IsActive  bool      `json:"is_active" db:"is_active"`
+	TeamID    *int      `json:"team_id" db:"team_id"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
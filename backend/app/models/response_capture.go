@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Response capture modes
+const (
+	CaptureNone      = "none"       // Only the excerpt in the check log (default)
+	CaptureOnFailure = "on_failure" // Keep the full response of failed and blocked checks
+	CaptureAlways    = "always"     // Keep the full response of every check
+)
+
+// ResponseCapture is the per-endpoint setting for keeping full responses. MaxBytes caps
+// the stored body, ReadLimitBytes how much of a body is read at all; zero means the
+// default.
+type ResponseCapture struct {
+	Mode           string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	MaxBytes       int    `json:"max_bytes,omitempty" yaml:"max_bytes,omitempty"`
+	ReadLimitBytes int    `json:"read_limit_bytes,omitempty" yaml:"read_limit_bytes,omitempty"`
+}
+
+// StoredResponse is a full response kept for a check log
+type StoredResponse struct {
+	ID             int       `json:"id"`
+	EndpointID     int       `json:"endpoint_id"`
+	CheckLogID     int       `json:"check_log_id"`
+	StatusCode     int       `json:"status_code"`
+	Headers        string    `json:"headers"`
+	Body           string    `json:"body"`
+	BodySize       int       `json:"body_size"`
+	CompressedSize int       `json:"compressed_size"`
+	Truncated      bool      `json:"truncated"`
+	CapturedAt     time.Time `json:"captured_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a login of a user on one device, kept alive by rotating refresh tokens
+type Session struct {
+	ID         string    `json:"id" db:"id"`
+	UserAgent  string    `json:"user_agent" db:"user_agent"`
+	IPAddress  string    `json:"ip_address" db:"ip_address"`
+	Current    bool      `json:"current"` // True for the session making the request
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" db:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+}
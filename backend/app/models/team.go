@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// Team roles, from least to most privileged
+const (
+	TeamRoleViewer = "viewer"
+	TeamRoleEditor = "editor"
+	TeamRoleOwner  = "owner"
+)
+
+type Team struct {
+	ID        int       `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Role      string    `json:"role,omitempty"` // Role of the current user
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type TeamMember struct {
+	TeamID    int       `json:"team_id" db:"team_id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Username  string    `json:"username" db:"username"`
+	Role      string    `json:"role" db:"role"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
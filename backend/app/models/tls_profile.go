@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// TLSProfile holds reusable TLS settings that endpoints reference via tls_profile_id.
+// PEM material is encrypted at rest.
+type TLSProfile struct {
+	ID                 int       `json:"id" db:"id"`
+	Name               string    `json:"name" db:"name"`
+	ClientCert         string    `json:"client_cert" db:"client_cert"`
+	ClientKey          string    `json:"client_key" db:"client_key"`
+	CABundle           string    `json:"ca_bundle" db:"ca_bundle"`
+	ServerName         string    `json:"server_name" db:"server_name"`
+	MinVersion         string    `json:"min_version" db:"min_version"` // "1.0", "1.1", "1.2" or "1.3"
+	InsecureSkipVerify bool      `json:"insecure_skip_verify" db:"insecure_skip_verify"`
+	TeamID             *int      `json:"team_id" db:"team_id"`
+	CreatedAt          time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at" db:"updated_at"`
+}
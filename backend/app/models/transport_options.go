@@ -0,0 +1,21 @@
+package models
+
+// HTTP versions an endpoint can insist on. Without one the version is negotiated.
+const (
+	HTTPVersion11 = "1.1"
+	HTTPVersion2  = "2"
+)
+
+// TransportOptions is the per-endpoint setting for how checks connect and follow
+// redirects; zero values keep the defaults. Resolve pins host names to IP addresses, so
+// a check reaches one backend behind a shared name while still sending that name as Host
+// and TLS server name.
+type TransportOptions struct {
+	DisableRedirects   bool              `json:"disable_redirects,omitempty" yaml:"disable_redirects,omitempty"`
+	MaxRedirects       int               `json:"max_redirects,omitempty" yaml:"max_redirects,omitempty"` // Default 10
+	HTTPVersion        string            `json:"http_version,omitempty" yaml:"http_version,omitempty"`
+	DisableKeepAlives  bool              `json:"disable_keep_alives,omitempty" yaml:"disable_keep_alives,omitempty"`
+	DisableCompression bool              `json:"disable_compression,omitempty" yaml:"disable_compression,omitempty"` // No Accept-Encoding: gzip
+	UserAgent          string            `json:"user_agent,omitempty" yaml:"user_agent,omitempty"`                   // Unless the headers set one
+	Resolve            map[string]string `json:"resolve,omitempty" yaml:"resolve,omitempty"`                         // Host name -> IP address
+}
@@ -14,6 +14,11 @@ type User struct {
 	IsActive  bool      `json:"is_active" db:"is_active"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+
+	TwoFactorEnabled  bool `json:"two_factor_enabled" db:"totp_enabled"`
+	TwoFactorRequired bool `json:"two_factor_required" db:"two_factor_required"`
+
+	LockedUntil *time.Time `json:"locked_until,omitempty" db:"locked_until"`
 }
 
 type LoginRequest struct {
@@ -22,13 +27,30 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Access token lifetime in seconds
+	User         User   `json:"user"`
+
+	RecoveryCodes []string `json:"recovery_codes,omitempty"` // Only after completing a required enrollment
+}
+
+// TwoFactorChallenge is returned by Login instead of tokens when a second factor is needed
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	SetupRequired     bool   `json:"setup_required"` // The user must enroll before finishing the login
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 type JWTClaims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"api-monitor/app/models"
+)
+
+// teamRoles lists team roles from least to most privileged
+var teamRoles = []string{models.TeamRoleViewer, models.TeamRoleEditor, models.TeamRoleOwner}
+
+func teamRoleRank(role string) int {
+	for i, r := range teamRoles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// ValidTeamRole reports whether role is a known team role
+func ValidTeamRole(role string) bool {
+	return teamRoleRank(role) > 0
+}
+
+// RoleAtLeast reports whether role grants at least the required team role
+func RoleAtLeast(role, required string) bool {
+	return teamRoleRank(role) >= teamRoleRank(required) && teamRoleRank(role) > 0
+}
+
+// IsAdmin reports whether the user has global access
+func IsAdmin(user *models.User) bool {
+	return user != nil && user.Role == "admin"
+}
+
+// TeamRole returns the user's role in a team, or "" when the user is not a member.
+// Admins are treated as owners of every team.
+func TeamRole(db *sql.DB, user *models.User, teamID int) (string, error) {
+	if IsAdmin(user) {
+		return models.TeamRoleOwner, nil
+	}
+	if user == nil {
+		return "", nil
+	}
+
+	var role string
+	err := db.QueryRow(`
+		SELECT role FROM team_members
+		WHERE team_id = $1 AND user_id = $2`, teamID, user.ID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// HasTeamRole reports whether the user has at least the required role in the team
+func HasTeamRole(db *sql.DB, user *models.User, teamID int, required string) (bool, error) {
+	role, err := TeamRole(db, user, teamID)
+	if err != nil {
+		return false, err
+	}
+	return RoleAtLeast(role, required), nil
+}
+
+// TeamScope returns a SQL condition limiting column to teams where the user has
+// at least the required role, using the placeholder $argIndex for the user ID.
+// Admins are not restricted, in which case the condition is "" and no argument is needed.
+func TeamScope(user *models.User, column string, required string, argIndex int) (string, []interface{}) {
+	if IsAdmin(user) {
+		return "", nil
+	}
+
+	roles := ""
+	for _, role := range teamRoles {
+		if RoleAtLeast(role, required) {
+			if roles != "" {
+				roles += ", "
+			}
+			roles += "'" + role + "'"
+		}
+	}
+
+	userID := 0
+	if user != nil {
+		userID = user.ID
+	}
+
+	return fmt.Sprintf("%s IN (SELECT team_id FROM team_members WHERE user_id = $%d AND role IN (%s))",
+		column, argIndex, roles), []interface{}{userID}
+}
+
+// DefaultTeamID picks the team for a new resource when the client did not choose one:
+// the only team the user can edit. It returns 0 when the choice is ambiguous.
+func DefaultTeamID(db *sql.DB, user *models.User) (int, error) {
+	if user == nil || IsAdmin(user) {
+		return 0, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT team_id FROM team_members
+		WHERE user_id = $1 AND role IN ('editor', 'owner')
+		LIMIT 2`, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var teamIDs []int
+	for rows.Next() {
+		var teamID int
+		if err := rows.Scan(&teamID); err != nil {
+			return 0, err
+		}
+		teamIDs = append(teamIDs, teamID)
+	}
+
+	if len(teamIDs) != 1 {
+		return 0, nil
+	}
+	return teamIDs[0], nil
+}
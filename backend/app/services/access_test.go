@@ -0,0 +1,115 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"api-monitor/app/fakedb"
+	"api-monitor/app/models"
+)
+
+func TestRoleAtLeast(t *testing.T) {
+	roles := []string{models.TeamRoleViewer, models.TeamRoleEditor, models.TeamRoleOwner}
+	for i, role := range roles {
+		for j, required := range roles {
+			if got, want := RoleAtLeast(role, required), i >= j; got != want {
+				t.Errorf("RoleAtLeast(%q, %q) = %t, want %t", role, required, got, want)
+			}
+		}
+		if RoleAtLeast("", role) || RoleAtLeast("superuser", role) {
+			t.Errorf("no or an unknown role passes as %s", role)
+		}
+	}
+	if RoleAtLeast("", "") {
+		t.Error("no membership passes when nothing is required")
+	}
+}
+
+func TestTeamScope(t *testing.T) {
+	admin := &models.User{ID: 1, Role: "admin"}
+	user := &models.User{ID: 7, Role: "user"}
+
+	if condition, args := TeamScope(admin, "e.team_id", models.TeamRoleOwner, 1); condition != "" || args != nil {
+		t.Errorf("admin: %q, %v; want no restriction", condition, args)
+	}
+
+	tests := []struct {
+		user     *models.User
+		required string
+		argIndex int
+		want     string
+		userID   int
+	}{
+		{user, models.TeamRoleViewer, 1,
+			"e.team_id IN (SELECT team_id FROM team_members WHERE user_id = $1 AND role IN ('viewer', 'editor', 'owner'))", 7},
+		{user, models.TeamRoleEditor, 3,
+			"e.team_id IN (SELECT team_id FROM team_members WHERE user_id = $3 AND role IN ('editor', 'owner'))", 7},
+		{user, models.TeamRoleOwner, 12,
+			"e.team_id IN (SELECT team_id FROM team_members WHERE user_id = $12 AND role IN ('owner'))", 7},
+		{nil, models.TeamRoleViewer, 2,
+			"e.team_id IN (SELECT team_id FROM team_members WHERE user_id = $2 AND role IN ('viewer', 'editor', 'owner'))", 0},
+	}
+	for _, tt := range tests {
+		condition, args := TeamScope(tt.user, "e.team_id", tt.required, tt.argIndex)
+		if condition != tt.want || !reflect.DeepEqual(args, []interface{}{tt.userID}) {
+			t.Errorf("TeamScope(%s, $%d) = %q, %v; want %q, [%d]", tt.required, tt.argIndex, condition, args, tt.want, tt.userID)
+		}
+	}
+}
+
+// membershipDB answers the team role query with the role of user 7 in team 3
+func membershipDB(t *testing.T, role string) (*sql.DB, *fakedb.DB) {
+	return fakedb.Open(t, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if !strings.Contains(query, "SELECT role FROM team_members") {
+			return nil, nil, errors.New("unexpected query: " + query)
+		}
+		if role == "" || args[0] != int64(3) || args[1] != int64(7) {
+			return []string{"role"}, nil, nil
+		}
+		return []string{"role"}, [][]driver.Value{{role}}, nil
+	})
+}
+
+func TestHasTeamRole(t *testing.T) {
+	admin := &models.User{ID: 1, Role: "admin"}
+	user := &models.User{ID: 7, Role: "user"}
+
+	tests := []struct {
+		name   string
+		user   *models.User
+		role   string // Team membership of user 7 in team 3
+		teamID int
+		want   map[string]bool // Required role -> allowed
+	}{
+		{"admin without membership", admin, "", 3,
+			map[string]bool{models.TeamRoleViewer: true, models.TeamRoleEditor: true, models.TeamRoleOwner: true}},
+		{"owner", user, models.TeamRoleOwner, 3,
+			map[string]bool{models.TeamRoleViewer: true, models.TeamRoleEditor: true, models.TeamRoleOwner: true}},
+		{"editor", user, models.TeamRoleEditor, 3,
+			map[string]bool{models.TeamRoleViewer: true, models.TeamRoleEditor: true, models.TeamRoleOwner: false}},
+		{"viewer", user, models.TeamRoleViewer, 3,
+			map[string]bool{models.TeamRoleViewer: true, models.TeamRoleEditor: false, models.TeamRoleOwner: false}},
+		{"no membership", user, "", 3,
+			map[string]bool{models.TeamRoleViewer: false, models.TeamRoleEditor: false, models.TeamRoleOwner: false}},
+		{"editor of another team", user, models.TeamRoleEditor, 4,
+			map[string]bool{models.TeamRoleViewer: false, models.TeamRoleEditor: false, models.TeamRoleOwner: false}},
+		{"signed out", nil, models.TeamRoleOwner, 3,
+			map[string]bool{models.TeamRoleViewer: false, models.TeamRoleEditor: false, models.TeamRoleOwner: false}},
+	}
+	for _, tt := range tests {
+		db, fake := membershipDB(t, tt.role)
+		for required, want := range tt.want {
+			allowed, err := HasTeamRole(db, tt.user, tt.teamID, required)
+			if err != nil || allowed != want {
+				t.Errorf("%s: HasTeamRole(%s) = %t, %v; want %t", tt.name, required, allowed, err, want)
+			}
+		}
+		if queries := fake.Queries(); (tt.user == admin || tt.user == nil) && len(queries) != 0 {
+			t.Errorf("%s: queried team_members %d times, admins and anonymous users need no lookup", tt.name, len(queries))
+		}
+	}
+}
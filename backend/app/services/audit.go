@@ -0,0 +1,186 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+
+	"api-monitor/app/models"
+	"api-monitor/utils"
+)
+
+// redactedValue replaces secrets in audited resource states
+const redactedValue = "[redacted]"
+
+// auditIgnoredFields change on every write and would only add noise to the diff
+var auditIgnoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// sensitiveFieldParts mark field names (and header names) whose values are never stored
+var sensitiveFieldParts = []string{
+	"password", "secret", "authorization", "cookie", "credential", "private",
+	"hash", "api_key", "apikey", "client_key", "client_cert", "ca_bundle", "key_value",
+}
+
+// RecordAudit stores an audit log entry. When the entry has a before or after state the
+// changed fields are computed and secrets are redacted. Failures are logged but never
+// fail the request that triggered the event.
+func RecordAudit(db *sql.DB, entry models.AuditLog) {
+	if entry.Details == nil {
+		entry.Details = map[string]interface{}{}
+	}
+	if entry.Changes == nil {
+		entry.Changes = AuditDiff(entry.Before, entry.After)
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO audit_logs (actor_id, actor_username, action, resource_type, resource_id, ip_address,
+		                        details, before_state, after_state, changes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())`,
+		entry.ActorID, utils.ValidateUTF8(entry.ActorUsername), entry.Action, entry.ResourceType,
+		entry.ResourceID, entry.IPAddress, auditJSON(entry.Details),
+		nullableAuditJSON(redactState(entry.Before)), nullableAuditJSON(redactState(entry.After)),
+		auditJSON(entry.Changes))
+	if err != nil {
+		log.Printf("Error recording audit event %s: %v", entry.Action, err)
+	}
+}
+
+// AuditSnapshot loads one row as a JSON object for the before or after state of an
+// audit entry. The table and condition come from code, never from the request. Returns
+// nil when the row does not exist.
+func AuditSnapshot(db *sql.DB, table, where string, args ...interface{}) map[string]interface{} {
+	var raw []byte
+	err := db.QueryRow(`SELECT to_jsonb(t) FROM `+table+` t WHERE `+where, args...).Scan(&raw)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error loading %s for the audit log: %v", table, err)
+		}
+		return nil
+	}
+
+	// Numbers stay json.Number so IDs and sizes are not turned into floats
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var state map[string]interface{}
+	if err := decoder.Decode(&state); err != nil {
+		log.Printf("Error decoding %s for the audit log: %v", table, err)
+		return nil
+	}
+	return state
+}
+
+// AuditDiff returns the top-level fields that differ between two states. Secret fields
+// are reported as changed with both values redacted. Creations and deletions have no
+// diff, their single state is the record.
+func AuditDiff(before, after map[string]interface{}) map[string]models.AuditChange {
+	changes := map[string]models.AuditChange{}
+	if before == nil || after == nil {
+		return changes
+	}
+
+	for field, change := range DiffStates(before, after) {
+		if auditIgnoredFields[field] {
+			continue
+		}
+
+		if sensitiveField(field) {
+			changes[field] = models.AuditChange{Before: redactScalar(change.Before), After: redactScalar(change.After)}
+			continue
+		}
+		changes[field] = models.AuditChange{Before: redactValue(change.Before), After: redactValue(change.After)}
+	}
+	return changes
+}
+
+// DiffStates returns the top-level fields that differ between two JSON objects
+func DiffStates(before, after map[string]interface{}) map[string]models.AuditChange {
+	fields := map[string]bool{}
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+
+	changes := map[string]models.AuditChange{}
+	for field := range fields {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			changes[field] = models.AuditChange{Before: before[field], After: after[field]}
+		}
+	}
+	return changes
+}
+
+// redactState returns a copy of a state with secret values replaced, also inside nested
+// objects such as endpoint headers
+func redactState(state map[string]interface{}) map[string]interface{} {
+	if state == nil {
+		return nil
+	}
+	return redactValue(state).(map[string]interface{})
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if sensitiveField(key) {
+				redacted[key] = redactScalar(item)
+			} else {
+				redacted[key] = redactValue(item)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactValue(item)
+		}
+		return redacted
+	}
+	return value
+}
+
+// redactScalar keeps empty values visible so "secret removed" or "secret set" can be told apart
+func redactScalar(value interface{}) interface{} {
+	if value == nil || value == "" {
+		return value
+	}
+	return redactedValue
+}
+
+func sensitiveField(name string) bool {
+	name = strings.ReplaceAll(strings.ToLower(name), "-", "_")
+	if strings.HasSuffix(name, "token") {
+		return true
+	}
+	for _, part := range sensitiveFieldParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func auditJSON(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("Error encoding audit data: %v", err)
+		return "{}"
+	}
+	return string(encoded)
+}
+
+func nullableAuditJSON(state map[string]interface{}) interface{} {
+	if state == nil {
+		return nil
+	}
+	return auditJSON(state)
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"api-monitor/app/models"
+)
+
+func TestAuditDiff(t *testing.T) {
+	before := map[string]interface{}{
+		"name":       "orders",
+		"url":        "https://api.local/orders",
+		"password":   "old",
+		"api_key":    "",
+		"updated_at": "2026-01-01",
+		"headers":    map[string]interface{}{"Authorization": "Bearer a", "Accept": "json"},
+		"removed":    true,
+	}
+	after := map[string]interface{}{
+		"name":       "orders",
+		"url":        "https://api.local/v2/orders",
+		"password":   "new",
+		"api_key":    "set",
+		"updated_at": "2026-01-02",
+		"headers":    map[string]interface{}{"Authorization": "Bearer b", "Accept": "json"},
+		"added":      json.Number("3"),
+	}
+
+	want := map[string]models.AuditChange{
+		"url":      {Before: "https://api.local/orders", After: "https://api.local/v2/orders"},
+		"password": {Before: redactedValue, After: redactedValue},
+		"api_key":  {Before: "", After: redactedValue},
+		"headers": {
+			Before: map[string]interface{}{"Authorization": redactedValue, "Accept": "json"},
+			After:  map[string]interface{}{"Authorization": redactedValue, "Accept": "json"},
+		},
+		"removed": {Before: true, After: nil},
+		"added":   {Before: nil, After: json.Number("3")},
+	}
+	if got := AuditDiff(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("AuditDiff =\n%v\nwant\n%v", got, want)
+	}
+
+	if got := AuditDiff(nil, after); len(got) != 0 {
+		t.Errorf("AuditDiff of a creation = %v, want no changes", got)
+	}
+	if got := AuditDiff(before, before); len(got) != 0 {
+		t.Errorf("AuditDiff of equal states = %v, want no changes", got)
+	}
+}
+
+func TestRedactState(t *testing.T) {
+	state := map[string]interface{}{
+		"username":      "ops",
+		"password_hash": "$2a$...",
+		"refresh_token": "abc",
+		"client_cert":   "",
+		"config": map[string]interface{}{
+			"X-Api-Key": "k",
+			"items":     []interface{}{map[string]interface{}{"secret": "s", "name": "n"}},
+		},
+	}
+	want := map[string]interface{}{
+		"username":      "ops",
+		"password_hash": redactedValue,
+		"refresh_token": redactedValue,
+		"client_cert":   "",
+		"config": map[string]interface{}{
+			"X-Api-Key": redactedValue,
+			"items":     []interface{}{map[string]interface{}{"secret": redactedValue, "name": "n"}},
+		},
+	}
+	if got := redactState(state); !reflect.DeepEqual(got, want) {
+		t.Errorf("redactState =\n%v\nwant\n%v", got, want)
+	}
+	if state["password_hash"] != "$2a$..." {
+		t.Error("redactState changed the state it was given")
+	}
+	if redactState(nil) != nil {
+		t.Error("redactState(nil) is not nil")
+	}
+}
+
+func TestSensitiveField(t *testing.T) {
+	for name, want := range map[string]bool{
+		"password":          true,
+		"Proxy-Auth-Secret": true,
+		"access_token":      true,
+		"X-API-Key":         true,
+		"ca_bundle":         true,
+		"Cookie":            true,
+		"token_count":       false,
+		"username":          false,
+		"url":               false,
+	} {
+		if got := sensitiveField(name); got != want {
+			t.Errorf("sensitiveField(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
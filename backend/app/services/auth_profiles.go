@@ -0,0 +1,343 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"api-monitor/app/models"
+	"api-monitor/utils"
+)
+
+// tokenRefreshMargin is how long before expiry a cached token is refreshed
+const tokenRefreshMargin = 60 * time.Second
+
+// tokenRequestTimeout bounds a token request, independently of the endpoint's timeout
+const tokenRequestTimeout = 30 * time.Second
+
+type cachedToken struct {
+	AccessToken      string
+	TokenType        string
+	ExpiresAt        time.Time
+	ProfileUpdatedAt time.Time
+}
+
+// TokenManager resolves auth profiles for checks, fetching and caching OAuth2
+// tokens and refreshing them shortly before they expire. Tokens are requested through
+// the proxy and with the TLS profile of the endpoint being checked.
+type TokenManager struct {
+	DB *sql.DB
+
+	mutex  sync.Mutex
+	tokens map[int]cachedToken
+	locks  map[int]*sync.Mutex
+}
+
+// AuthError marks a failure to acquire credentials, as opposed to a failing endpoint
+type AuthError struct {
+	ProfileID int
+	Err       error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("auth profile %d: token acquisition failed: %v", e.ProfileID, e.Err)
+}
+
+func NewTokenManager(db *sql.DB) *TokenManager {
+	return &TokenManager{
+		DB:     db,
+		tokens: make(map[int]cachedToken),
+		locks:  make(map[int]*sync.Mutex),
+	}
+}
+
+// Apply adds the credentials of the endpoint's auth profile to a rendered request.
+// Credential values are registered as secrets so they are redacted from logs.
+func (t *TokenManager) Apply(endpoint models.APIEndpoint, rendered *utils.RenderedRequest) error {
+	if endpoint.AuthProfileID == nil {
+		return nil
+	}
+	profileID := *endpoint.AuthProfileID
+
+	profile, err := FindAuthProfile(t.DB, profileID)
+	if err != nil {
+		return &AuthError{ProfileID: profileID, Err: fmt.Errorf("error loading profile: %v", err)}
+	}
+	if !profile.IsActive {
+		return nil
+	}
+
+	switch profile.Type {
+	case models.AuthTypeOAuth2ClientCredentials, models.AuthTypeOAuth2RefreshToken:
+		token, err := t.token(profile, endpoint)
+		if err != nil {
+			t.recordError(profile.ID, err)
+			return &AuthError{ProfileID: profile.ID, Err: err}
+		}
+		tokenType := token.TokenType
+		if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+			tokenType = "Bearer"
+		}
+		rendered.Headers["Authorization"] = tokenType + " " + token.AccessToken
+		rendered.Secrets = append(rendered.Secrets, token.AccessToken)
+
+	case models.AuthTypeBasic:
+		credentials := base64.StdEncoding.EncodeToString([]byte(profile.Config.Username + ":" + profile.Config.Password))
+		rendered.Headers["Authorization"] = "Basic " + credentials
+		rendered.Secrets = append(rendered.Secrets, credentials)
+
+	case models.AuthTypeAPIKey:
+		if profile.Config.KeyIn == "query" {
+			requestURL, err := url.Parse(rendered.URL)
+			if err != nil {
+				return &AuthError{ProfileID: profile.ID, Err: fmt.Errorf("error parsing URL for API key: %v", err)}
+			}
+			query := requestURL.Query()
+			query.Set(profile.Config.KeyName, profile.Config.KeyValue)
+			requestURL.RawQuery = query.Encode()
+			rendered.URL = requestURL.String()
+		} else {
+			rendered.Headers[profile.Config.KeyName] = profile.Config.KeyValue
+		}
+		rendered.Secrets = append(rendered.Secrets, profile.Config.KeyValue, url.QueryEscape(profile.Config.KeyValue))
+
+	default:
+		return &AuthError{ProfileID: profile.ID, Err: fmt.Errorf("unknown profile type %q", profile.Type)}
+	}
+
+	return nil
+}
+
+// Invalidate drops any cached token for the profile
+func (t *TokenManager) Invalidate(profileID int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.tokens, profileID)
+}
+
+func (t *TokenManager) profileLock(profileID int) *sync.Mutex {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	lock, exists := t.locks[profileID]
+	if !exists {
+		lock = &sync.Mutex{}
+		t.locks[profileID] = lock
+	}
+	return lock
+}
+
+// token returns a cached token or fetches a new one. Only one fetch per profile
+// runs at a time so concurrent checks share the result.
+func (t *TokenManager) token(profile models.AuthProfile, endpoint models.APIEndpoint) (cachedToken, error) {
+	lock := t.profileLock(profile.ID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	t.mutex.Lock()
+	cached, exists := t.tokens[profile.ID]
+	t.mutex.Unlock()
+
+	if exists && cached.ProfileUpdatedAt.Equal(profile.UpdatedAt) &&
+		time.Until(cached.ExpiresAt) > tokenRefreshMargin {
+		return cached, nil
+	}
+
+	token, err := t.fetchToken(profile, endpoint)
+	if err != nil {
+		return cachedToken{}, err
+	}
+
+	t.mutex.Lock()
+	t.tokens[profile.ID] = token
+	t.mutex.Unlock()
+
+	log.Printf("Fetched token for auth profile %s (expires %s)", profile.Name, token.ExpiresAt.Format(time.RFC3339))
+	return token, nil
+}
+
+func (t *TokenManager) fetchToken(profile models.AuthProfile, endpoint models.APIEndpoint) (cachedToken, error) {
+	cfg := profile.Config
+	if cfg.TokenURL == "" {
+		return cachedToken{}, fmt.Errorf("token_url is required")
+	}
+
+	form := url.Values{}
+	if profile.Type == models.AuthTypeOAuth2RefreshToken {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", cfg.RefreshToken)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if len(cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	if cfg.Audience != "" {
+		form.Set("audience", cfg.Audience)
+	}
+	if cfg.ClientAuth == "body" {
+		form.Set("client_id", cfg.ClientID)
+		form.Set("client_secret", cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequest("POST", cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return cachedToken{}, fmt.Errorf("error creating token request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if cfg.ClientAuth != "body" && cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	client, release, err := utils.NewClient(endpoint, tokenRequestTimeout)
+	if err != nil {
+		return cachedToken{}, err
+	}
+	defer release()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return cachedToken{}, fmt.Errorf("token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return cachedToken{}, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, truncate(string(body), 200))
+	}
+
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return cachedToken{}, fmt.Errorf("invalid token response: %v", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return cachedToken{}, fmt.Errorf("token response has no access_token")
+	}
+
+	expiresIn := time.Duration(tokenResp.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = time.Hour
+	}
+
+	updatedAt := profile.UpdatedAt
+
+	// Providers that rotate refresh tokens invalidate the old one, so persist the new one
+	if profile.Type == models.AuthTypeOAuth2RefreshToken && tokenResp.RefreshToken != "" &&
+		tokenResp.RefreshToken != cfg.RefreshToken {
+		profile.Config.RefreshToken = tokenResp.RefreshToken
+		configJSON, err := EncodeAuthProfileConfig(profile.Config)
+		if err == nil {
+			err = t.DB.QueryRow(`
+				UPDATE auth_profiles SET config = $1, updated_at = NOW()
+				WHERE id = $2
+				RETURNING updated_at`, configJSON, profile.ID).Scan(&updatedAt)
+		}
+		if err != nil {
+			log.Printf("Error saving rotated refresh token for auth profile %s: %v", profile.Name, err)
+		}
+	}
+
+	return cachedToken{
+		AccessToken:      tokenResp.AccessToken,
+		TokenType:        tokenResp.TokenType,
+		ExpiresAt:        time.Now().Add(expiresIn),
+		ProfileUpdatedAt: updatedAt,
+	}, nil
+}
+
+// recordError stores the last token failure on the profile so it is visible in the API
+func (t *TokenManager) recordError(profileID int, tokenErr error) {
+	_, err := t.DB.Exec(`
+		UPDATE auth_profiles SET last_error = $1, last_error_at = NOW()
+		WHERE id = $2`, utils.ValidateUTF8(tokenErr.Error()), profileID)
+	if err != nil {
+		log.Printf("Error recording auth profile error: %v", err)
+	}
+}
+
+// AuthProfileSelect loads auth profiles including their secrets; read rows with ScanAuthProfile
+const AuthProfileSelect = `
+	SELECT id, name, type, COALESCE(config, '{}'), is_active, COALESCE(last_error, ''),
+	       last_error_at, team_id, created_at, updated_at
+	FROM auth_profiles`
+
+// ScanAuthProfile reads one row produced by AuthProfileSelect and decrypts its secrets
+func ScanAuthProfile(row rowScanner) (models.AuthProfile, error) {
+	var profile models.AuthProfile
+	var configJSON string
+	var lastErrorAt sql.NullTime
+	var teamID sql.NullInt64
+
+	err := row.Scan(&profile.ID, &profile.Name, &profile.Type, &configJSON, &profile.IsActive,
+		&profile.LastError, &lastErrorAt, &teamID, &profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		return profile, err
+	}
+	profile.TeamID = nullableInt(teamID)
+
+	if err := json.Unmarshal([]byte(configJSON), &profile.Config); err != nil {
+		return profile, fmt.Errorf("invalid profile config: %v", err)
+	}
+	for name, secret := range authProfileSecrets(&profile.Config) {
+		if *secret, err = utils.DecryptString(*secret); err != nil {
+			return profile, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if lastErrorAt.Valid {
+		profile.LastErrorAt = &lastErrorAt.Time
+	}
+
+	return profile, nil
+}
+
+// EncodeAuthProfileConfig returns the JSON stored in the config column, with the secret
+// fields encrypted like the PEM material of TLS profiles
+func EncodeAuthProfileConfig(config models.AuthProfileConfig) (string, error) {
+	for name, secret := range authProfileSecrets(&config) {
+		encrypted, err := utils.EncryptString(*secret)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", name, err)
+		}
+		*secret = encrypted
+	}
+	encoded, err := json.Marshal(config)
+	return string(encoded), err
+}
+
+// authProfileSecrets returns the secret fields of a profile config by their JSON name.
+// Profiles saved before secrets were encrypted still hold plain text, DecryptString
+// returns it unchanged and the next save encrypts it.
+func authProfileSecrets(config *models.AuthProfileConfig) map[string]*string {
+	return map[string]*string{
+		"client_secret": &config.ClientSecret,
+		"refresh_token": &config.RefreshToken,
+		"password":      &config.Password,
+		"key_value":     &config.KeyValue,
+	}
+}
+
+// FindAuthProfile loads an auth profile by ID
+func FindAuthProfile(db *sql.DB, profileID int) (models.AuthProfile, error) {
+	return ScanAuthProfile(db.QueryRow(AuthProfileSelect+` WHERE id = $1`, profileID))
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max] + "..."
+	}
+	return s
+}
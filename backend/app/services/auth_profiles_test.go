@@ -0,0 +1,353 @@
+package services
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api-monitor/app/fakedb"
+	"api-monitor/app/models"
+	"api-monitor/utils"
+)
+
+// fakeAuthProfile plays the auth_profiles table with one profile; saved configs and
+// recorded errors are kept
+type fakeAuthProfile struct {
+	mu          sync.Mutex
+	profileType string
+	config      models.AuthProfileConfig
+	updatedAt   time.Time
+	lastError   string
+}
+
+func (f *fakeAuthProfile) handle(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case strings.Contains(query, "UPDATE auth_profiles SET config"):
+		var config models.AuthProfileConfig
+		if err := json.Unmarshal([]byte(args[0].(string)), &config); err != nil {
+			return nil, nil, err
+		}
+		for name, secret := range authProfileSecrets(&config) {
+			var err error
+			if *secret, err = utils.DecryptString(*secret); err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		f.config = config
+		f.updatedAt = f.updatedAt.Add(time.Second)
+		return []string{"updated_at"}, [][]driver.Value{{f.updatedAt}}, nil
+	case strings.Contains(query, "UPDATE auth_profiles SET last_error"):
+		f.lastError = args[0].(string)
+		return nil, nil, nil
+	case strings.Contains(query, "FROM auth_profiles"):
+		config, _ := json.Marshal(f.config)
+		columns := []string{"id", "name", "type", "config", "is_active", "last_error", "last_error_at", "team_id", "created_at", "updated_at"}
+		return columns, [][]driver.Value{{args[0], "profile", f.profileType, string(config), true, "", nil, int64(1), f.updatedAt, f.updatedAt}}, nil
+	}
+	return nil, nil, errors.New("unexpected query: " + query)
+}
+
+// tokenServer answers token requests with access tokens token-1, token-2 and so on,
+// valid for expiresIn seconds, and keeps the requests it received
+type tokenServer struct {
+	mu           sync.Mutex
+	expiresIn    int
+	refreshToken string // Returned with every token when set
+	forms        []url.Values
+	basicAuth    []string
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.forms = append(s.forms, r.PostForm)
+	user, password, _ := r.BasicAuth()
+	s.basicAuth = append(s.basicAuth, user+":"+password)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  fmt.Sprintf("token-%d", len(s.forms)),
+		"token_type":    "bearer",
+		"expires_in":    s.expiresIn,
+		"refresh_token": s.refreshToken,
+	})
+}
+
+func (s *tokenServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.forms)
+}
+
+// applyProfile applies profile 1 to a request for endpoint and returns the request
+func applyProfile(t *testing.T, tokens *TokenManager, endpoint models.APIEndpoint) (*utils.RenderedRequest, error) {
+	t.Helper()
+	profileID := 1
+	endpoint.AuthProfileID = &profileID
+	if endpoint.URL == "" {
+		endpoint.URL = "https://api.example.com/items"
+	}
+	rendered := &utils.RenderedRequest{URL: endpoint.URL, Headers: map[string]string{}}
+	return rendered, tokens.Apply(endpoint, rendered)
+}
+
+func TestTokenManagerCachesTokens(t *testing.T) {
+	server := &tokenServer{expiresIn: 3600}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	profile := &fakeAuthProfile{profileType: models.AuthTypeOAuth2ClientCredentials, updatedAt: time.Now(),
+		config: models.AuthProfileConfig{TokenURL: httpServer.URL, ClientID: "my client", ClientSecret: "s3cret",
+			Scopes: []string{"read", "write"}, Audience: "api"}}
+	db, _ := fakedb.Open(t, profile.handle)
+	tokens := NewTokenManager(db)
+
+	for i := 0; i < 3; i++ {
+		rendered, err := applyProfile(t, tokens, models.APIEndpoint{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rendered.Headers["Authorization"] != "Bearer token-1" || rendered.Redact("token-1") != "[REDACTED]" {
+			t.Errorf("check %d: Authorization = %q, token redacted as %q", i, rendered.Headers["Authorization"], rendered.Redact("token-1"))
+		}
+	}
+	if n := server.requests(); n != 1 {
+		t.Errorf("%d token requests for three checks, want 1", n)
+	}
+
+	// Client credentials go in the Authorization header, form encoded first
+	form := server.forms[0]
+	if form.Get("grant_type") != "client_credentials" || form.Get("scope") != "read write" ||
+		form.Get("audience") != "api" || form.Get("client_secret") != "" {
+		t.Errorf("token request form = %v", form)
+	}
+	if server.basicAuth[0] != "my+client:s3cret" {
+		t.Errorf("token request basic auth = %q", server.basicAuth[0])
+	}
+
+	// Updating the profile or invalidating the cache fetches a new token
+	profile.mu.Lock()
+	profile.updatedAt = profile.updatedAt.Add(time.Minute)
+	profile.mu.Unlock()
+	if rendered, _ := applyProfile(t, tokens, models.APIEndpoint{}); rendered.Headers["Authorization"] != "Bearer token-2" {
+		t.Errorf("after a profile update: Authorization = %q, want a new token", rendered.Headers["Authorization"])
+	}
+	tokens.Invalidate(1)
+	if rendered, _ := applyProfile(t, tokens, models.APIEndpoint{}); rendered.Headers["Authorization"] != "Bearer token-3" {
+		t.Errorf("after Invalidate: Authorization = %q, want a new token", rendered.Headers["Authorization"])
+	}
+}
+
+func TestTokenManagerRefreshesExpiringTokens(t *testing.T) {
+	// Tokens valid for less than the refresh margin are fetched again for every check
+	server := &tokenServer{expiresIn: 30}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	profile := &fakeAuthProfile{profileType: models.AuthTypeOAuth2ClientCredentials, updatedAt: time.Now(),
+		config: models.AuthProfileConfig{TokenURL: httpServer.URL, ClientID: "client", ClientSecret: "s3cret", ClientAuth: "body"}}
+	db, _ := fakedb.Open(t, profile.handle)
+	tokens := NewTokenManager(db)
+
+	for i := 0; i < 2; i++ {
+		if _, err := applyProfile(t, tokens, models.APIEndpoint{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := server.requests(); n != 2 {
+		t.Errorf("%d token requests, want 2", n)
+	}
+
+	// client_auth body sends the credentials in the form
+	if form := server.forms[0]; form.Get("client_id") != "client" || form.Get("client_secret") != "s3cret" || server.basicAuth[0] != ":" {
+		t.Errorf("token request form = %v, basic auth %q", form, server.basicAuth[0])
+	}
+}
+
+func TestTokenManagerRotatesRefreshTokens(t *testing.T) {
+	server := &tokenServer{expiresIn: 3600, refreshToken: "refresh-2"}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	profile := &fakeAuthProfile{profileType: models.AuthTypeOAuth2RefreshToken, updatedAt: time.Now(),
+		config: models.AuthProfileConfig{TokenURL: httpServer.URL, ClientID: "client", RefreshToken: "refresh-1"}}
+	db, _ := fakedb.Open(t, profile.handle)
+	tokens := NewTokenManager(db)
+
+	if _, err := applyProfile(t, tokens, models.APIEndpoint{}); err != nil {
+		t.Fatal(err)
+	}
+	if form := server.forms[0]; form.Get("grant_type") != "refresh_token" || form.Get("refresh_token") != "refresh-1" {
+		t.Errorf("token request form = %v", form)
+	}
+	if profile.config.RefreshToken != "refresh-2" {
+		t.Errorf("stored refresh token = %q, want the rotated one", profile.config.RefreshToken)
+	}
+
+	// The rotated token is cached with the new updated_at, the next check reuses it
+	if _, err := applyProfile(t, tokens, models.APIEndpoint{}); err != nil || server.requests() != 1 {
+		t.Errorf("second check: %v, %d token requests", err, server.requests())
+	}
+
+	tokens.Invalidate(1)
+	if _, err := applyProfile(t, tokens, models.APIEndpoint{}); err != nil {
+		t.Fatal(err)
+	}
+	if form := server.forms[1]; form.Get("refresh_token") != "refresh-2" {
+		t.Errorf("refresh token sent after rotation = %q", form.Get("refresh_token"))
+	}
+}
+
+func TestTokenManagerUsesEndpointTransport(t *testing.T) {
+	t.Cleanup(utils.CloseTransports)
+
+	// The token endpoint is only reachable through the endpoint's proxy
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "token.internal" {
+			http.Error(w, "unknown host", http.StatusBadGateway)
+			return
+		}
+		(&tokenServer{expiresIn: 3600}).ServeHTTP(w, r)
+	}))
+	t.Cleanup(proxy.Close)
+	proxyURL, _ := url.Parse(proxy.URL)
+	port := proxy.Listener.Addr().(*net.TCPAddr).Port
+
+	profile := &fakeAuthProfile{profileType: models.AuthTypeOAuth2ClientCredentials, updatedAt: time.Now(),
+		config: models.AuthProfileConfig{TokenURL: "http://token.internal/token", ClientID: "client"}}
+	db, _ := fakedb.Open(t, profile.handle)
+
+	if _, err := applyProfile(t, NewTokenManager(db), models.APIEndpoint{}); err == nil {
+		t.Error("token request without the proxy succeeded")
+	}
+	endpoint := models.APIEndpoint{Proxy: &models.Proxy{Host: proxyURL.Hostname(), Port: port}}
+	if rendered, err := applyProfile(t, NewTokenManager(db), endpoint); err != nil || rendered.Headers["Authorization"] != "Bearer token-1" {
+		t.Errorf("token through the proxy: %v", err)
+	}
+
+	// The token endpoint's certificate is only trusted through the endpoint's TLS profile
+	tlsServer := httptest.NewTLSServer(&tokenServer{expiresIn: 3600})
+	t.Cleanup(tlsServer.Close)
+	profile.config.TokenURL = tlsServer.URL
+
+	if _, err := applyProfile(t, NewTokenManager(db), models.APIEndpoint{}); err == nil {
+		t.Error("token request to an untrusted server succeeded")
+	}
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+	endpoint = models.APIEndpoint{TLSProfile: &models.TLSProfile{CABundle: string(caPEM), ServerName: "example.com"}}
+	if _, err := applyProfile(t, NewTokenManager(db), endpoint); err != nil {
+		t.Errorf("token with the TLS profile: %v", err)
+	}
+}
+
+func TestTokenManagerStaticCredentials(t *testing.T) {
+	profile := &fakeAuthProfile{profileType: models.AuthTypeBasic, updatedAt: time.Now(),
+		config: models.AuthProfileConfig{Username: "user", Password: "p@ss"}}
+	db, _ := fakedb.Open(t, profile.handle)
+	tokens := NewTokenManager(db)
+
+	rendered, err := applyProfile(t, tokens, models.APIEndpoint{})
+	if err != nil || rendered.Headers["Authorization"] != "Basic dXNlcjpwQHNz" {
+		t.Errorf("basic auth = %q, %v", rendered.Headers["Authorization"], err)
+	}
+
+	profile.profileType = models.AuthTypeAPIKey
+	profile.config = models.AuthProfileConfig{KeyName: "api_key", KeyValue: "k&y", KeyIn: "query"}
+	rendered, err = applyProfile(t, tokens, models.APIEndpoint{URL: "https://api.example.com/items?page=2"})
+	if err != nil || rendered.URL != "https://api.example.com/items?api_key=k%26y&page=2" {
+		t.Errorf("query API key URL = %q, %v", rendered.URL, err)
+	}
+	if rendered.Redact(rendered.URL) != "https://api.example.com/items?api_key=[REDACTED]&page=2" {
+		t.Errorf("redacted URL = %q", rendered.Redact(rendered.URL))
+	}
+
+	var authErr *AuthError
+	if _, err := applyProfile(t, tokens, models.APIEndpoint{URL: "http://[::1"}); !errors.As(err, &authErr) {
+		t.Errorf("invalid URL for a query API key: %v, want an AuthError", err)
+	}
+}
+
+func TestTokenManagerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": "invalid_client"}`, http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+
+	profile := &fakeAuthProfile{profileType: models.AuthTypeOAuth2ClientCredentials, updatedAt: time.Now(),
+		config: models.AuthProfileConfig{TokenURL: server.URL, ClientID: "client", ClientSecret: "wrong"}}
+	db, _ := fakedb.Open(t, profile.handle)
+
+	_, err := applyProfile(t, NewTokenManager(db), models.APIEndpoint{})
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || authErr.ProfileID != 1 || !strings.Contains(err.Error(), "token endpoint returned 401") {
+		t.Errorf("Apply = %v, want an AuthError for the 401", err)
+	}
+	if !strings.Contains(profile.lastError, "token endpoint returned 401") {
+		t.Errorf("last_error = %q", profile.lastError)
+	}
+}
+
+func TestCheckEndpointAuthError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	profile := &fakeAuthProfile{profileType: models.AuthTypeOAuth2ClientCredentials, updatedAt: time.Now(),
+		config: models.AuthProfileConfig{TokenURL: server.URL, ClientID: "client"}}
+	logs := newFakeCheckLogs()
+	var statuses []driver.Value
+	db, fake := fakedb.Open(t, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if strings.Contains(query, "INSERT INTO api_check_logs") {
+			statuses = append(statuses, args[8])
+		}
+		if strings.Contains(query, "api_check_logs") || strings.Contains(query, "nextval") {
+			return logs.handle(query, args)
+		}
+		return profile.handle(query, args)
+	})
+
+	results := NewResultWriter(db)
+	results.Close() // Rows are written right away
+	m := &MonitorService{DB: db, Tokens: NewTokenManager(db), Results: results, lastStatus: map[int]string{3: models.EndpointStatusUp}}
+
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	profileID := 1
+	m.checkEndpoint(models.APIEndpoint{ID: 3, Name: "orders", URL: "https://api.example.com", Method: "GET",
+		TimeoutSeconds: 5, AuthProfileID: &profileID})
+
+	if len(statuses) != 1 || statuses[0] != models.EndpointStatusAuthError {
+		t.Errorf("logged statuses = %v, want one auth_error", statuses)
+	}
+	if status, _ := m.knownStatus(3); status != models.EndpointStatusAuthError {
+		t.Errorf("status = %s", status)
+	}
+	if strings.Contains(output.String(), "is down") {
+		t.Errorf("an auth error raised a down alert:\n%s", output.String())
+	}
+	for _, query := range fake.Queries() {
+		if strings.Contains(query, "endpoint_dependencies") {
+			t.Error("the dependencies of an endpoint with an auth error were checked")
+		}
+	}
+}
@@ -0,0 +1,554 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"api-monitor/app/models"
+)
+
+const (
+	maxIgnorePaths        = 50
+	maxSnapshotBodyBytes  = 1 << 20 // Larger normalized bodies are compared by hash only
+	maxContentDiffEntries = 200
+	maxTextDiffLines      = 2000
+)
+
+// ResponseSnapshotSelect loads response snapshots; read rows with ScanResponseSnapshot
+const ResponseSnapshotSelect = `
+	SELECT id, endpoint_id, content_hash, shape_hash, body, shape, first_seen_at, last_seen_at
+	FROM response_snapshots`
+
+// ContentChangeSelect loads content changed events; read rows with ScanContentChange
+const ContentChangeSelect = `
+	SELECT id, endpoint_id, check_log_id, change_type, previous_snapshot_id, snapshot_id,
+	       diff, diff_truncated, detected_at
+	FROM content_changes`
+
+// normalizedResponse is a response body prepared for comparison
+type normalizedResponse struct {
+	body        string      // Indented JSON with sorted keys, or the trimmed text
+	value       interface{} // Decoded JSON, nil for other bodies
+	shape       interface{} // Types of the JSON fields, nil for other bodies
+	isJSON      bool
+	contentHash string
+	shapeHash   string
+}
+
+// ValidateContentTracking checks the ignore paths of a content tracking setting
+func ValidateContentTracking(tracking models.ContentTracking) error {
+	if len(tracking.IgnorePaths) > maxIgnorePaths {
+		return fmt.Errorf("content_tracking can ignore at most %d paths", maxIgnorePaths)
+	}
+	for _, path := range tracking.IgnorePaths {
+		if _, err := parseJSONPath(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseJSONPath splits a path such as "$.items[*].updated_at" into its segments; "*"
+// matches every key or array element
+func parseJSONPath(path string) ([]string, error) {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(path), "$"), ".")
+	if trimmed == "" {
+		return nil, fmt.Errorf("invalid JSON path %q", path)
+	}
+
+	segments := []string{}
+	for _, part := range strings.Split(trimmed, ".") {
+		name, indexes, _ := strings.Cut(part, "[")
+		if name != "" {
+			segments = append(segments, name)
+		}
+		if indexes != "" {
+			for _, index := range strings.Split(strings.TrimSuffix(indexes, "]"), "][") {
+				if _, err := strconv.Atoi(index); index != "*" && err != nil {
+					return nil, fmt.Errorf("invalid JSON path %q: use [*] or a number in brackets", path)
+				}
+				segments = append(segments, index)
+			}
+		} else if name == "" {
+			return nil, fmt.Errorf("invalid JSON path %q", path)
+		}
+	}
+	return segments, nil
+}
+
+// normalizeResponse decodes a JSON body, drops the ignored paths and re-encodes it with
+// sorted keys, so formatting and key order never count as changes. Other bodies are only
+// trimmed.
+func normalizeResponse(body string, ignorePaths []string) normalizedResponse {
+	var normalized normalizedResponse
+
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err == nil && !decoder.More() {
+		for _, path := range ignorePaths {
+			if segments, err := parseJSONPath(path); err == nil {
+				removeJSONPath(value, segments)
+			}
+		}
+
+		var encoded bytes.Buffer
+		encoder := json.NewEncoder(&encoded)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(value); err == nil {
+			normalized.isJSON = true
+			normalized.value = value
+			normalized.body = strings.TrimSuffix(encoded.String(), "\n")
+			normalized.shape = jsonShape(value)
+			shape, _ := json.Marshal(normalized.shape)
+			normalized.shapeHash = hashString(string(shape))
+		}
+	}
+
+	if !normalized.isJSON {
+		normalized.body = strings.TrimSpace(strings.ReplaceAll(body, "\r\n", "\n"))
+	}
+	normalized.contentHash = hashString(normalized.body)
+	return normalized
+}
+
+// removeJSONPath deletes the object fields a path points to
+func removeJSONPath(value interface{}, segments []string) {
+	if len(segments) == 0 {
+		return
+	}
+	segment, rest := segments[0], segments[1:]
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if segment != "*" && segment != key {
+				continue
+			}
+			if len(rest) == 0 {
+				delete(v, key)
+			} else {
+				removeJSONPath(child, rest)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if segment == "*" || segment == strconv.Itoa(i) {
+				removeJSONPath(child, rest)
+			}
+		}
+	}
+}
+
+// jsonShape replaces the values of a JSON document with their types. Arrays get the merged
+// shape of their elements.
+func jsonShape(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		shape := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			shape[key] = jsonShape(child)
+		}
+		return shape
+	case []interface{}:
+		if len(v) == 0 {
+			return []interface{}{}
+		}
+		element := jsonShape(v[0])
+		for _, child := range v[1:] {
+			element = mergeShapes(element, jsonShape(child))
+		}
+		return []interface{}{element}
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// mergeShapes combines the shapes of two array elements: objects get the fields of both,
+// nulls and empty arrays take the other shape and anything else is "mixed"
+func mergeShapes(a, b interface{}) interface{} {
+	if shapesCompatible(a, b) && reflect.DeepEqual(a, b) {
+		return a
+	}
+	if a == "null" || isEmptyShapeArray(a) {
+		return b
+	}
+	if b == "null" || isEmptyShapeArray(b) {
+		return a
+	}
+
+	aMap, aIsMap := a.(map[string]interface{})
+	bMap, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		merged := make(map[string]interface{}, len(aMap))
+		for key, shape := range aMap {
+			merged[key] = shape
+		}
+		for key, shape := range bMap {
+			if existing, ok := merged[key]; ok {
+				merged[key] = mergeShapes(existing, shape)
+			} else {
+				merged[key] = shape
+			}
+		}
+		return merged
+	}
+
+	aList, aIsList := a.([]interface{})
+	bList, bIsList := b.([]interface{})
+	if aIsList && bIsList {
+		return []interface{}{mergeShapes(aList[0], bList[0])}
+	}
+	return "mixed"
+}
+
+// shapeDiff lists the fields added, removed or changed in type between two shapes. Nulls
+// and empty arrays match any type so optional values do not flap.
+func shapeDiff(path string, before, after interface{}, diff *[]models.ContentDiffEntry) {
+	if !shapesCompatible(before, after) {
+		*diff = append(*diff, models.ContentDiffEntry{Path: displayPath(path), Op: "changed", Before: before, After: after})
+		return
+	}
+
+	beforeMap, isMap := before.(map[string]interface{})
+	if isMap {
+		afterMap := after.(map[string]interface{})
+		for _, key := range unionKeys(beforeMap, afterMap) {
+			childBefore, inBefore := beforeMap[key]
+			childAfter, inAfter := afterMap[key]
+			switch {
+			case !inBefore:
+				*diff = append(*diff, models.ContentDiffEntry{Path: joinPath(path, key), Op: "added", After: childAfter})
+			case !inAfter:
+				*diff = append(*diff, models.ContentDiffEntry{Path: joinPath(path, key), Op: "removed", Before: childBefore})
+			default:
+				shapeDiff(joinPath(path, key), childBefore, childAfter, diff)
+			}
+		}
+		return
+	}
+
+	beforeList, isList := before.([]interface{})
+	afterList, _ := after.([]interface{})
+	if isList && len(beforeList) > 0 && len(afterList) > 0 {
+		shapeDiff(path+"[*]", beforeList[0], afterList[0], diff)
+	}
+}
+
+// shapesCompatible reports whether two shapes are of the same kind
+func shapesCompatible(a, b interface{}) bool {
+	if a == "null" || b == "null" || isEmptyShapeArray(a) || isEmptyShapeArray(b) {
+		return true
+	}
+	_, aIsMap := a.(map[string]interface{})
+	_, bIsMap := b.(map[string]interface{})
+	_, aIsList := a.([]interface{})
+	_, bIsList := b.([]interface{})
+	switch {
+	case aIsMap || bIsMap:
+		return aIsMap && bIsMap
+	case aIsList || bIsList:
+		return aIsList && bIsList
+	default:
+		return a == b
+	}
+}
+
+func isEmptyShapeArray(shape interface{}) bool {
+	list, ok := shape.([]interface{})
+	return ok && len(list) == 0
+}
+
+// jsonDiff lists the paths whose values differ between two JSON documents
+func jsonDiff(path string, before, after interface{}, diff *[]models.ContentDiffEntry) {
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		for _, key := range unionKeys(beforeMap, afterMap) {
+			childBefore, inBefore := beforeMap[key]
+			childAfter, inAfter := afterMap[key]
+			switch {
+			case !inBefore:
+				*diff = append(*diff, models.ContentDiffEntry{Path: joinPath(path, key), Op: "added", After: childAfter})
+			case !inAfter:
+				*diff = append(*diff, models.ContentDiffEntry{Path: joinPath(path, key), Op: "removed", Before: childBefore})
+			default:
+				jsonDiff(joinPath(path, key), childBefore, childAfter, diff)
+			}
+		}
+		return
+	}
+
+	beforeList, beforeIsList := before.([]interface{})
+	afterList, afterIsList := after.([]interface{})
+	if beforeIsList && afterIsList {
+		for i := 0; i < len(beforeList) || i < len(afterList); i++ {
+			elementPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(beforeList):
+				*diff = append(*diff, models.ContentDiffEntry{Path: elementPath, Op: "added", After: afterList[i]})
+			case i >= len(afterList):
+				*diff = append(*diff, models.ContentDiffEntry{Path: elementPath, Op: "removed", Before: beforeList[i]})
+			default:
+				jsonDiff(elementPath, beforeList[i], afterList[i], diff)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*diff = append(*diff, models.ContentDiffEntry{Path: displayPath(path), Op: "changed", Before: before, After: after})
+	}
+}
+
+// textDiff lists the lines removed from and added to a text body, using the longest
+// common subsequence of lines
+func textDiff(before, after string) ([]models.ContentDiffEntry, bool) {
+	beforeLines := strings.Split(before, "\n")
+	afterLines := strings.Split(after, "\n")
+	if len(beforeLines) > maxTextDiffLines || len(afterLines) > maxTextDiffLines {
+		return []models.ContentDiffEntry{}, true
+	}
+
+	// lcs[i][j] is the length of the common subsequence of beforeLines[i:] and afterLines[j:]
+	lcs := make([][]int, len(beforeLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(afterLines)+1)
+	}
+	for i := len(beforeLines) - 1; i >= 0; i-- {
+		for j := len(afterLines) - 1; j >= 0; j-- {
+			if beforeLines[i] == afterLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	diff := []models.ContentDiffEntry{}
+	i, j := 0, 0
+	for i < len(beforeLines) || j < len(afterLines) {
+		switch {
+		case i < len(beforeLines) && j < len(afterLines) && beforeLines[i] == afterLines[j]:
+			i++
+			j++
+		case j < len(afterLines) && (i == len(beforeLines) || lcs[i][j+1] >= lcs[i+1][j]):
+			diff = append(diff, models.ContentDiffEntry{Path: fmt.Sprintf("line %d", j+1), Op: "added", After: afterLines[j]})
+			j++
+		default:
+			diff = append(diff, models.ContentDiffEntry{Path: fmt.Sprintf("line %d", i+1), Op: "removed", Before: beforeLines[i]})
+			i++
+		}
+	}
+	return diff, false
+}
+
+// trackContent compares the body of a successful check with the endpoint's latest
+// snapshot. New content becomes the next snapshot and, unless it is the first one, a
+// content changed event with the differences.
+func (m *MonitorService) trackContent(endpoint models.APIEndpoint, checkLogID int, body string) {
+	current := normalizeResponse(body, endpoint.ContentTracking.IgnorePaths)
+
+	previous, err := ScanResponseSnapshot(m.DB.QueryRow(ResponseSnapshotSelect+`
+		WHERE endpoint_id = $1 ORDER BY id DESC LIMIT 1`, endpoint.ID))
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error loading the response snapshot of endpoint %s: %v", endpoint.Name, err)
+		return
+	}
+
+	if err == nil && previous.ContentHash == current.contentHash {
+		if _, err := m.DB.Exec("UPDATE response_snapshots SET last_seen_at = NOW() WHERE id = $1", previous.ID); err != nil {
+			log.Printf("Error updating the response snapshot of endpoint %s: %v", endpoint.Name, err)
+		}
+		return
+	}
+
+	var storedBody, storedShape interface{}
+	if len(current.body) <= maxSnapshotBodyBytes {
+		storedBody = current.body
+	}
+	if current.isJSON {
+		shape, _ := json.Marshal(current.shape)
+		storedShape = string(shape)
+	}
+
+	var snapshotID int
+	err = m.DB.QueryRow(`
+		INSERT INTO response_snapshots (endpoint_id, content_hash, shape_hash, body, shape)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`, endpoint.ID, current.contentHash, current.shapeHash, storedBody, storedShape).Scan(&snapshotID)
+	if err != nil {
+		log.Printf("Error saving the response snapshot of endpoint %s: %v", endpoint.Name, err)
+		return
+	}
+
+	// The first snapshot is the baseline, there is nothing to compare it with
+	if previous.ID == 0 {
+		return
+	}
+
+	changeType, diff, truncated := compareSnapshots(previous, current)
+	if len(diff) > maxContentDiffEntries {
+		diff = diff[:maxContentDiffEntries]
+		truncated = true
+	}
+	diffJSON, _ := json.Marshal(diff)
+
+	_, err = m.DB.Exec(`
+		INSERT INTO content_changes (endpoint_id, check_log_id, change_type, previous_snapshot_id, snapshot_id, diff, diff_truncated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		endpoint.ID, checkLogID, changeType, previous.ID, snapshotID, string(diffJSON), truncated)
+	if err != nil {
+		log.Printf("Error saving the content change of endpoint %s: %v", endpoint.Name, err)
+		return
+	}
+
+	log.Printf("ALERT: %s of endpoint %s changed (%d differences)", changeType, endpoint.Name, len(diff))
+}
+
+// compareSnapshots returns the kind of change between a stored snapshot and a new body
+// and the differences. The diff is marked truncated when it could not be computed fully.
+func compareSnapshots(previous models.ResponseSnapshot, current normalizedResponse) (string, []models.ContentDiffEntry, bool) {
+	diff := []models.ContentDiffEntry{}
+
+	if previous.Body == nil {
+		return models.ContentChangeContent, diff, true
+	}
+
+	previousJSON := previous.ShapeHash != ""
+	if previousJSON != current.isJSON {
+		// The body switched between JSON and something else
+		return models.ContentChangeShape, []models.ContentDiffEntry{{
+			Path: "$", Op: "changed", Before: truncateText(*previous.Body), After: truncateText(current.body),
+		}}, false
+	}
+
+	if !current.isJSON {
+		diff, truncated := textDiff(*previous.Body, current.body)
+		return models.ContentChangeContent, diff, truncated
+	}
+
+	var previousValue interface{}
+	decoder := json.NewDecoder(strings.NewReader(*previous.Body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&previousValue); err != nil {
+		return models.ContentChangeContent, diff, true
+	}
+
+	shapeChanges := []models.ContentDiffEntry{}
+	shapeDiff("", previous.Shape, current.shape, &shapeChanges)
+	jsonDiff("", previousValue, current.value, &diff)
+
+	if len(shapeChanges) > 0 {
+		return models.ContentChangeShape, diff, false
+	}
+	return models.ContentChangeContent, diff, false
+}
+
+// ScanResponseSnapshot reads one row produced by ResponseSnapshotSelect
+func ScanResponseSnapshot(row rowScanner) (models.ResponseSnapshot, error) {
+	var snapshot models.ResponseSnapshot
+	var body sql.NullString
+	var shape []byte
+
+	err := row.Scan(&snapshot.ID, &snapshot.EndpointID, &snapshot.ContentHash, &snapshot.ShapeHash,
+		&body, &shape, &snapshot.FirstSeenAt, &snapshot.LastSeenAt)
+	if err != nil {
+		return snapshot, err
+	}
+
+	if body.Valid {
+		snapshot.Body = &body.String
+	}
+	if len(shape) > 0 {
+		json.Unmarshal(shape, &snapshot.Shape)
+	}
+	return snapshot, nil
+}
+
+// ScanContentChange reads one row produced by ContentChangeSelect
+func ScanContentChange(row rowScanner) (models.ContentChange, error) {
+	var change models.ContentChange
+	var checkLogID, previousSnapshotID, snapshotID sql.NullInt64
+	var diff []byte
+
+	err := row.Scan(&change.ID, &change.EndpointID, &checkLogID, &change.ChangeType, &previousSnapshotID,
+		&snapshotID, &diff, &change.DiffTruncated, &change.DetectedAt)
+	if err != nil {
+		return change, err
+	}
+
+	change.CheckLogID = nullableInt(checkLogID)
+	change.PreviousSnapshotID = nullableInt(previousSnapshotID)
+	change.SnapshotID = nullableInt(snapshotID)
+
+	change.Diff = []models.ContentDiffEntry{}
+	json.Unmarshal(diff, &change.Diff)
+	return change, nil
+}
+
+func nullableInt(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	v := int(value.Int64)
+	return &v
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "$"
+	}
+	return path
+}
+
+func truncateText(text string) string {
+	if len(text) > 200 {
+		return text[:200] + "..."
+	}
+	return text
+}
+
+func hashString(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
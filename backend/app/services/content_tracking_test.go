@@ -0,0 +1,162 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"api-monitor/app/models"
+)
+
+// snapshotOf stores a normalized response the way trackContent does
+func snapshotOf(t *testing.T, response normalizedResponse) models.ResponseSnapshot {
+	t.Helper()
+	snapshot := models.ResponseSnapshot{ContentHash: response.contentHash, ShapeHash: response.shapeHash}
+	body := response.body
+	snapshot.Body = &body
+	if response.isJSON {
+		encoded, _ := json.Marshal(response.shape)
+		if err := json.Unmarshal(encoded, &snapshot.Shape); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return snapshot
+}
+
+func TestParseJSONPath(t *testing.T) {
+	for path, want := range map[string][]string{
+		"$.meta.generated_at": {"meta", "generated_at"},
+		"items[*].updated_at": {"items", "*", "updated_at"},
+		" $.rows[0][*].id ":   {"rows", "0", "*", "id"},
+		"*.etag":              {"*", "etag"},
+		"$.data.list[2]":      {"data", "list", "2"},
+	} {
+		got, err := parseJSONPath(path)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("parseJSONPath(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+
+	for _, path := range []string{"", "$", "$.", "a..b", "items[x]", "items[]"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("parseJSONPath(%q) succeeded", path)
+		}
+	}
+
+	if err := ValidateContentTracking(models.ContentTracking{IgnorePaths: []string{"a", "b[*].c"}}); err != nil {
+		t.Errorf("valid ignore paths rejected: %v", err)
+	}
+	if err := ValidateContentTracking(models.ContentTracking{IgnorePaths: []string{"a", "b[y]"}}); err == nil {
+		t.Error("an invalid ignore path was accepted")
+	}
+}
+
+func TestNormalizeResponse(t *testing.T) {
+	a := normalizeResponse(`{"b": 1, "a": {"y": [1, 2], "x": "<tag>"}}`, nil)
+	b := normalizeResponse("{\n  \"a\": {\"x\": \"<tag>\", \"y\": [1,2]},\n  \"b\": 1\n}\n", nil)
+	if !a.isJSON || a.contentHash != b.contentHash || a.body != b.body {
+		t.Errorf("formatting and key order changed the normalized body:\n%s\n%s", a.body, b.body)
+	}
+	want := "{\n  \"a\": {\n    \"x\": \"<tag>\",\n    \"y\": [\n      1,\n      2\n    ]\n  },\n  \"b\": 1\n}"
+	if a.body != want {
+		t.Errorf("body = %s, want %s", a.body, want)
+	}
+
+	// Large ids keep their digits
+	if n := normalizeResponse(`{"id": 12345678901234567890}`, nil); n.body != "{\n  \"id\": 12345678901234567890\n}" {
+		t.Errorf("body = %s", n.body)
+	}
+
+	ignored := normalizeResponse(`{"meta": {"at": 1, "v": 2}, "items": [{"id": 1, "ts": 5}, {"id": 2, "ts": 6}]}`,
+		[]string{"meta.at", "items[*].ts", "missing.path"})
+	plain := normalizeResponse(`{"meta": {"v": 2}, "items": [{"id": 1}, {"id": 2}]}`, nil)
+	if ignored.contentHash != plain.contentHash {
+		t.Errorf("ignored paths were compared:\n%s", ignored.body)
+	}
+
+	text := normalizeResponse("  OK\r\nline 2 \r\n", nil)
+	if text.isJSON || text.body != "OK\nline 2" || text.shapeHash != "" {
+		t.Errorf("text body = %q, JSON %t", text.body, text.isJSON)
+	}
+	if concatenated := normalizeResponse(`{"a": 1} {"b": 2}`, nil); concatenated.isJSON {
+		t.Error("two JSON values were treated as one document")
+	}
+}
+
+func TestJSONShape(t *testing.T) {
+	response := normalizeResponse(`{"id": 1, "name": "a", "ok": true, "tags": [], "parent": null,
+		"items": [{"id": 1, "note": null}, {"id": 2, "note": "x", "extra": [1]}], "mixed": [1, "a"]}`, nil)
+	want := map[string]interface{}{
+		"id":     "number",
+		"name":   "string",
+		"ok":     "boolean",
+		"tags":   []interface{}{},
+		"parent": "null",
+		"items":  []interface{}{map[string]interface{}{"id": "number", "note": "string", "extra": []interface{}{"number"}}},
+		"mixed":  []interface{}{"mixed"},
+	}
+	if !reflect.DeepEqual(response.shape, want) {
+		t.Errorf("shape = %v, want %v", response.shape, want)
+	}
+
+	// Values do not change the shape, filling in optional values does not either
+	if other := normalizeResponse(`{"id": 9, "name": "b", "ok": false, "tags": [], "parent": null,
+		"items": [{"id": 3, "note": "y", "extra": [2]}], "mixed": ["b", 2]}`, nil); other.shapeHash != response.shapeHash {
+		t.Errorf("same shape hashed differently: %v", other.shape)
+	}
+}
+
+func TestCompareSnapshotsContent(t *testing.T) {
+	previous := snapshotOf(t, normalizeResponse(`{"status": "ok", "count": 1, "items": [1, 2]}`, nil))
+	current := normalizeResponse(`{"status": "degraded", "count": 1, "items": [1]}`, nil)
+
+	changeType, diff, truncated := compareSnapshots(previous, current)
+	if changeType != models.ContentChangeContent || truncated {
+		t.Errorf("change = %s, truncated %t; want a content change", changeType, truncated)
+	}
+	want := []models.ContentDiffEntry{
+		{Path: "items[1]", Op: "removed", Before: json.Number("2")},
+		{Path: "status", Op: "changed", Before: "ok", After: "degraded"},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff = %+v\nwant %+v", diff, want)
+	}
+}
+
+func TestCompareSnapshotsShape(t *testing.T) {
+	previous := snapshotOf(t, normalizeResponse(`{"count": 1, "data": {"a": 1}}`, nil))
+
+	changeType, diff, _ := compareSnapshots(previous, normalizeResponse(`{"count": "1", "data": {"a": 1}}`, nil))
+	if changeType != models.ContentChangeShape || len(diff) != 1 || diff[0].Path != "count" {
+		t.Errorf("type change = %s %+v, want a shape change of count", changeType, diff)
+	}
+
+	changeType, _, _ = compareSnapshots(previous, normalizeResponse(`{"count": 1, "data": {"a": 1, "b": 2}}`, nil))
+	if changeType != models.ContentChangeShape {
+		t.Errorf("added field = %s, want a shape change", changeType)
+	}
+
+	changeType, diff, _ = compareSnapshots(previous, normalizeResponse("<html>maintenance</html>", nil))
+	if changeType != models.ContentChangeShape || len(diff) != 1 || diff[0].Path != "$" || diff[0].After != "<html>maintenance</html>" {
+		t.Errorf("switch to HTML = %s %+v, want a shape change of the whole body", changeType, diff)
+	}
+}
+
+func TestCompareSnapshotsText(t *testing.T) {
+	previous := snapshotOf(t, normalizeResponse("a\nb\nc\nd", nil))
+
+	changeType, diff, truncated := compareSnapshots(previous, normalizeResponse("a\nc\nd\ne", nil))
+	want := []models.ContentDiffEntry{
+		{Path: "line 2", Op: "removed", Before: "b"},
+		{Path: "line 4", Op: "added", After: "e"},
+	}
+	if changeType != models.ContentChangeContent || truncated || !reflect.DeepEqual(diff, want) {
+		t.Errorf("text change = %s %+v, truncated %t\nwant %+v", changeType, diff, truncated, want)
+	}
+
+	// Snapshots too large to keep are compared by hash, the diff is unknown
+	previous.Body = nil
+	if _, diff, truncated := compareSnapshots(previous, normalizeResponse("x", nil)); !truncated || len(diff) != 0 {
+		t.Errorf("diff without a stored body = %+v, truncated %t", diff, truncated)
+	}
+}
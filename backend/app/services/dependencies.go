@@ -0,0 +1,293 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+
+	"api-monitor/app/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrDependencyCycle is returned when new dependencies would make an endpoint depend on itself
+var ErrDependencyCycle = errors.New("the dependencies would form a cycle")
+
+// CheckStatusExpression is the status of the check log "l". Logs saved before statuses
+// were recorded count as up when they got a 2xx or 3xx response without an error.
+const CheckStatusExpression = `COALESCE(l.status, CASE WHEN COALESCE(l.error_message, '') = '' AND l.status_code BETWEEN 200 AND 399 THEN 'up' ELSE 'down' END)`
+
+// endpointNodeSelect loads endpoints with their latest check; read rows with scanEndpointNode
+const endpointNodeSelect = `
+	SELECT e.id, e.key, e.name, e.group_path, e.team_id, e.is_active,
+	       last.status, last.blocked_by, last.checked_at
+	FROM api_endpoints e
+	LEFT JOIN LATERAL (
+		SELECT ` + CheckStatusExpression + ` AS status, l.blocked_by, l.checked_at
+		FROM api_check_logs l
+		WHERE l.endpoint_id = e.id
+		ORDER BY l.checked_at DESC
+		LIMIT 1
+	) last ON true`
+
+// CheckStatus classifies the result of a check
+func CheckStatus(statusCode int, errorMessage string) string {
+	if errorMessage == "" && statusCode >= 200 && statusCode < 400 {
+		return models.EndpointStatusUp
+	}
+	return models.EndpointStatusDown
+}
+
+// LastCheckStatus returns the status of the latest check of an endpoint, or "" when it
+// has not been checked yet
+func LastCheckStatus(db *sql.DB, endpointID int) (string, error) {
+	var status string
+	err := db.QueryRow(`
+		SELECT `+CheckStatusExpression+` FROM api_check_logs l
+		WHERE l.endpoint_id = $1
+		ORDER BY l.checked_at DESC
+		LIMIT 1`, endpointID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return status, err
+}
+
+// BlockingDependency returns an active direct dependency of the endpoint whose latest check
+// was down or blocked, or nil when all of them are up. Blocked dependencies count so a
+// failure high up in the graph blocks everything below it. Check logs are written in
+// batches, so the latest status is taken from known when it has one and only read from
+// the logs otherwise.
+func BlockingDependency(db *sql.DB, endpointID int, known func(endpointID int) (string, bool)) (*models.EndpointGraphNode, error) {
+	rows, err := db.Query(`
+		SELECT e.id, e.key, e.name, e.group_path, e.team_id, e.is_active
+		FROM api_endpoints e
+		JOIN endpoint_dependencies d ON d.depends_on_id = e.id
+		WHERE d.endpoint_id = $1 AND e.is_active = true
+		ORDER BY e.id`, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := []models.EndpointGraphNode{}
+	for rows.Next() {
+		var node models.EndpointGraphNode
+		var teamID sql.NullInt64
+		if err := rows.Scan(&node.ID, &node.Key, &node.Name, &node.Group, &teamID, &node.IsActive); err != nil {
+			return nil, err
+		}
+		node.TeamID = nullableInt(teamID)
+		nodes = append(nodes, node)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range nodes {
+		status, ok := "", false
+		if known != nil {
+			status, ok = known(nodes[i].ID)
+		}
+		if !ok {
+			if status, err = LastCheckStatus(db, nodes[i].ID); err != nil {
+				return nil, err
+			}
+		}
+		nodes[i].Status = status
+	}
+
+	return blockingNode(nodes), nil
+}
+
+// blockingNode picks the dependency that blocks an endpoint: the first one that is down,
+// otherwise the first one that is blocked itself
+func blockingNode(nodes []models.EndpointGraphNode) *models.EndpointGraphNode {
+	var blocked *models.EndpointGraphNode
+	for i := range nodes {
+		switch nodes[i].Status {
+		case models.EndpointStatusDown:
+			return &nodes[i]
+		case models.EndpointStatusBlocked:
+			if blocked == nil {
+				blocked = &nodes[i]
+			}
+		}
+	}
+	return blocked
+}
+
+// LoadEndpointGraph returns the endpoints selected by whereClause (on the "e" alias) and
+// the dependencies between them
+func LoadEndpointGraph(db *sql.DB, whereClause string, args []interface{}) (models.EndpointGraph, error) {
+	graph := models.EndpointGraph{
+		Nodes: []models.EndpointGraphNode{},
+		Edges: []models.EndpointGraphEdge{},
+	}
+
+	rows, err := db.Query(endpointNodeSelect+" "+whereClause+" ORDER BY e.id", args...)
+	if err != nil {
+		return graph, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		node, err := scanEndpointNode(rows)
+		if err != nil {
+			return graph, err
+		}
+		graph.Nodes = append(graph.Nodes, node)
+		ids = append(ids, node.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return graph, err
+	}
+
+	edges, err := db.Query(`
+		SELECT endpoint_id, depends_on_id FROM endpoint_dependencies
+		WHERE endpoint_id = ANY($1) AND depends_on_id = ANY($1)
+		ORDER BY endpoint_id, depends_on_id`, pq.Array(ids))
+	if err != nil {
+		return graph, err
+	}
+	defer edges.Close()
+
+	for edges.Next() {
+		var edge models.EndpointGraphEdge
+		if err := edges.Scan(&edge.EndpointID, &edge.DependsOnID); err != nil {
+			return graph, err
+		}
+		graph.Edges = append(graph.Edges, edge)
+	}
+	return graph, edges.Err()
+}
+
+// FindEndpointDependencies returns the direct dependencies and dependents of an endpoint
+// that the user can see
+func FindEndpointDependencies(db *sql.DB, user *models.User, endpointID int) (models.EndpointDependencies, error) {
+	dependencies := models.EndpointDependencies{EndpointID: endpointID}
+
+	scope, scopeArgs := TeamScope(user, "e.team_id", models.TeamRoleViewer, 2)
+	if scope != "" {
+		scope = " AND " + scope
+	}
+	args := append([]interface{}{endpointID}, scopeArgs...)
+
+	var err error
+	dependencies.DependsOn, err = queryEndpointNodes(db, endpointNodeSelect+`
+		WHERE e.id IN (SELECT depends_on_id FROM endpoint_dependencies WHERE endpoint_id = $1)`+scope+`
+		ORDER BY e.name, e.id`, args...)
+	if err != nil {
+		return dependencies, err
+	}
+
+	dependencies.Dependents, err = queryEndpointNodes(db, endpointNodeSelect+`
+		WHERE e.id IN (SELECT endpoint_id FROM endpoint_dependencies WHERE depends_on_id = $1)`+scope+`
+		ORDER BY e.name, e.id`, args...)
+	return dependencies, err
+}
+
+// DependencyIDs returns the ids of the endpoints an endpoint directly depends on
+func DependencyIDs(db *sql.DB, endpointID int) ([]int, error) {
+	rows, err := db.Query(`
+		SELECT depends_on_id FROM endpoint_dependencies
+		WHERE endpoint_id = $1
+		ORDER BY depends_on_id`, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SetEndpointDependencies replaces the dependencies of an endpoint. It returns
+// ErrDependencyCycle when one of the new dependencies already depends on the endpoint,
+// directly or through others.
+func SetEndpointDependencies(tx *sql.Tx, endpointID int, dependsOn []int) error {
+	// Serializes graph changes so two concurrent updates cannot close a cycle together
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('endpoint_dependencies'))"); err != nil {
+		return err
+	}
+
+	var cycle bool
+	err := tx.QueryRow(`
+		WITH RECURSIVE reachable(id) AS (
+			SELECT unnest($2::int[])
+			UNION
+			SELECT d.depends_on_id
+			FROM endpoint_dependencies d
+			JOIN reachable r ON d.endpoint_id = r.id
+			WHERE d.endpoint_id <> $1
+		)
+		SELECT EXISTS (SELECT 1 FROM reachable WHERE id = $1)`, endpointID, pq.Array(dependsOn)).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrDependencyCycle
+	}
+
+	if _, err := tx.Exec("DELETE FROM endpoint_dependencies WHERE endpoint_id = $1", endpointID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO endpoint_dependencies (endpoint_id, depends_on_id)
+		SELECT $1, unnest($2::int[])
+		ON CONFLICT DO NOTHING`, endpointID, pq.Array(dependsOn))
+	return err
+}
+
+func queryEndpointNodes(db *sql.DB, query string, args ...interface{}) ([]models.EndpointGraphNode, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := []models.EndpointGraphNode{}
+	for rows.Next() {
+		node, err := scanEndpointNode(rows)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, rows.Err()
+}
+
+func scanEndpointNode(row rowScanner) (models.EndpointGraphNode, error) {
+	var node models.EndpointGraphNode
+	var teamID, blockedBy sql.NullInt64
+	var status sql.NullString
+	var checkedAt sql.NullTime
+
+	err := row.Scan(&node.ID, &node.Key, &node.Name, &node.Group, &teamID, &node.IsActive,
+		&status, &blockedBy, &checkedAt)
+	if err != nil {
+		return node, err
+	}
+
+	if teamID.Valid {
+		id := int(teamID.Int64)
+		node.TeamID = &id
+	}
+	node.Status = status.String
+	if blockedBy.Valid {
+		id := int(blockedBy.Int64)
+		node.BlockedBy = &id
+	}
+	if checkedAt.Valid {
+		node.LastCheckedAt = &checkedAt.Time
+	}
+	return node, nil
+}
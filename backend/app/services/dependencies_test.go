@@ -0,0 +1,129 @@
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"api-monitor/app/fakedb"
+	"api-monitor/app/models"
+)
+
+// dependencyDB answers the dependency queries of BlockingDependency for endpoints 10, 11
+// and 12, with logged holding the statuses in their check logs
+func dependencyDB(t *testing.T, logged map[int64]string) (*fakedb.DB, func(map[int]string) (*models.EndpointGraphNode, error)) {
+	db, fake := fakedb.Open(t, func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "endpoint_dependencies"):
+			return []string{"id", "key", "name", "group_path", "team_id", "is_active"}, [][]driver.Value{
+				{int64(10), "a", "A", "", int64(1), true},
+				{int64(11), "b", "B", "", int64(1), true},
+				{int64(12), "c", "C", "", int64(1), true},
+			}, nil
+		case strings.Contains(query, "FROM api_check_logs l"):
+			status, ok := logged[args[0].(int64)]
+			if !ok {
+				return []string{"status"}, nil, nil
+			}
+			return []string{"status"}, [][]driver.Value{{status}}, nil
+		}
+		return nil, nil, errors.New("unexpected query: " + query)
+	})
+
+	blocking := func(known map[int]string) (*models.EndpointGraphNode, error) {
+		return BlockingDependency(db, 1, func(id int) (string, bool) {
+			status, ok := known[id]
+			return status, ok
+		})
+	}
+	return fake, blocking
+}
+
+func logReads(fake *fakedb.DB) int {
+	reads := 0
+	for _, query := range fake.Queries() {
+		if strings.Contains(query, "FROM api_check_logs l") {
+			reads++
+		}
+	}
+	return reads
+}
+
+func TestBlockingDependencyPrefersKnownStatuses(t *testing.T) {
+	// The logs still say down, the check that recovered is queued in the result writer
+	fake, blocking := dependencyDB(t, map[int64]string{10: "down", 11: "down", 12: "down"})
+
+	blocker, err := blocking(map[int]string{10: "up", 11: "up", 12: "up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocker != nil {
+		t.Errorf("blocked by %d, want no blocker while all dependencies are up", blocker.ID)
+	}
+	if reads := logReads(fake); reads != 0 {
+		t.Errorf("read the check logs %d times, want none when all statuses are known", reads)
+	}
+}
+
+func TestBlockingDependencyFallsBackToLogs(t *testing.T) {
+	fake, blocking := dependencyDB(t, map[int64]string{11: "blocked", 12: "down"})
+
+	blocker, err := blocking(map[int]string{10: "up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocker == nil || blocker.ID != 12 || blocker.Status != models.EndpointStatusDown {
+		t.Fatalf("blocker = %+v, want endpoint 12 which is down", blocker)
+	}
+	if reads := logReads(fake); reads != 2 {
+		t.Errorf("read the check logs %d times, want 2 for the unknown dependencies", reads)
+	}
+}
+
+func TestBlockingNode(t *testing.T) {
+	tests := []struct {
+		statuses []string
+		want     int
+	}{
+		{[]string{"up", "", "up"}, 0},
+		{[]string{"blocked", "up", "down"}, 12},
+		{[]string{"blocked", "blocked", "up"}, 10},
+		{[]string{"up", "down", "down"}, 11},
+	}
+	for _, tt := range tests {
+		nodes := make([]models.EndpointGraphNode, len(tt.statuses))
+		for i, status := range tt.statuses {
+			nodes[i] = models.EndpointGraphNode{ID: 10 + i, Status: status}
+		}
+
+		got := 0
+		if node := blockingNode(nodes); node != nil {
+			got = node.ID
+		}
+		if got != tt.want {
+			t.Errorf("blockingNode(%v) = %d, want %d", tt.statuses, got, tt.want)
+		}
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	tests := []struct {
+		statusCode   int
+		errorMessage string
+		want         string
+	}{
+		{200, "", models.EndpointStatusUp},
+		{304, "", models.EndpointStatusUp},
+		{199, "", models.EndpointStatusDown},
+		{404, "", models.EndpointStatusDown},
+		{503, "", models.EndpointStatusDown},
+		{200, "response does not match the schema", models.EndpointStatusDown},
+		{0, "connection refused", models.EndpointStatusDown},
+	}
+	for _, tt := range tests {
+		if got := CheckStatus(tt.statusCode, tt.errorMessage); got != tt.want {
+			t.Errorf("CheckStatus(%d, %q) = %s, want %s", tt.statusCode, tt.errorMessage, got, tt.want)
+		}
+	}
+}
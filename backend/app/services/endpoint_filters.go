@@ -0,0 +1,201 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Label keys and values are limited to the characters of Kubernetes labels, so selectors
+// never need quoting
+var (
+	labelKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,62}$`)
+	labelValuePattern = regexp.MustCompile(`^[A-Za-z0-9._/-]{0,63}$`)
+)
+
+const maxEndpointLabels = 32
+
+// endpointSortColumns are the columns the endpoint list can be sorted by
+var endpointSortColumns = map[string]string{
+	"name":                   "e.name",
+	"key":                    "e.key",
+	"url":                    "e.url",
+	"group":                  "e.group_path",
+	"is_active":              "e.is_active",
+	"check_interval_seconds": "e.check_interval_seconds",
+	"created_at":             "e.created_at",
+	"updated_at":             "e.updated_at",
+}
+
+// EndpointFilter selects endpoints for the list and bulk APIs. Every set field narrows the
+// selection.
+type EndpointFilter struct {
+	IDs      []int  `json:"ids"`
+	TeamID   *int   `json:"team_id"`
+	Selector string `json:"selector"` // Label selector, see ParseLabelSelector
+	Group    string `json:"group"`    // The group and its subgroups
+	Search   string `json:"search"`   // Part of the name, key or URL
+	IsActive *bool  `json:"is_active"`
+}
+
+// Empty reports whether the filter would select every endpoint
+func (f EndpointFilter) Empty() bool {
+	return len(f.IDs) == 0 && f.TeamID == nil && f.Selector == "" && f.Group == "" && f.Search == "" && f.IsActive == nil
+}
+
+// LabelRequirement is one term of a label selector
+type LabelRequirement struct {
+	Key      string
+	Operator string // "=", "!=", "exists" or "!exists"
+	Value    string
+}
+
+// ValidateLabels checks the keys and values of endpoint labels
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > maxEndpointLabels {
+		return fmt.Errorf("an endpoint can have at most %d labels", maxEndpointLabels)
+	}
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid label key %q: use up to 63 letters, digits, '.', '-', '_' or '/'", key)
+		}
+		if !labelValuePattern.MatchString(value) {
+			return fmt.Errorf("invalid value for label %q: use up to 63 letters, digits, '.', '-', '_' or '/'", key)
+		}
+	}
+	return nil
+}
+
+// NormalizeGroup cleans up a group path ("/payments/checkout/" becomes "payments/checkout")
+// and rejects empty path segments
+func NormalizeGroup(group string) (string, error) {
+	group = strings.Trim(strings.TrimSpace(group), "/")
+	if group == "" {
+		return "", nil
+	}
+	if len(group) > 255 {
+		return "", fmt.Errorf("group cannot be longer than 255 characters")
+	}
+
+	segments := strings.Split(group, "/")
+	for i, segment := range segments {
+		segments[i] = strings.TrimSpace(segment)
+		if segments[i] == "" {
+			return "", fmt.Errorf("group %q has an empty path segment", group)
+		}
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// ParseLabelSelector parses a comma separated label selector such as
+// "env=prod,service!=checkout,tier,!deprecated": key=value, key!=value, key (the label is
+// set) and !key (the label is not set)
+func ParseLabelSelector(selector string) ([]LabelRequirement, error) {
+	requirements := []LabelRequirement{}
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		var requirement LabelRequirement
+		switch {
+		case strings.Contains(term, "!="):
+			key, value, _ := strings.Cut(term, "!=")
+			requirement = LabelRequirement{Key: strings.TrimSpace(key), Operator: "!=", Value: strings.TrimSpace(value)}
+		case strings.Contains(term, "="):
+			key, value, _ := strings.Cut(strings.Replace(term, "==", "=", 1), "=")
+			requirement = LabelRequirement{Key: strings.TrimSpace(key), Operator: "=", Value: strings.TrimSpace(value)}
+		case strings.HasPrefix(term, "!"):
+			requirement = LabelRequirement{Key: strings.TrimSpace(term[1:]), Operator: "!exists"}
+		default:
+			requirement = LabelRequirement{Key: term, Operator: "exists"}
+		}
+
+		if !labelKeyPattern.MatchString(requirement.Key) || !labelValuePattern.MatchString(requirement.Value) {
+			return nil, fmt.Errorf("invalid label selector term %q", term)
+		}
+		requirements = append(requirements, requirement)
+	}
+	return requirements, nil
+}
+
+// EndpointFilterConditions turns a filter into SQL conditions on the "e" alias, numbering
+// placeholders from argIndex
+func EndpointFilterConditions(filter EndpointFilter, argIndex int) ([]string, []interface{}, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(argIndex+len(args)-1)
+	}
+
+	if len(filter.IDs) > 0 {
+		conditions = append(conditions, "e.id = ANY("+arg(pq.Array(filter.IDs))+")")
+	}
+	if filter.TeamID != nil {
+		conditions = append(conditions, "e.team_id = "+arg(*filter.TeamID))
+	}
+	if filter.IsActive != nil {
+		conditions = append(conditions, "e.is_active = "+arg(*filter.IsActive))
+	}
+	if filter.Search != "" {
+		conditions = append(conditions, fmt.Sprintf("(e.name ILIKE %[1]s OR e.key ILIKE %[1]s OR e.url ILIKE %[1]s)",
+			arg("%"+EscapeLike(filter.Search)+"%")))
+	}
+	if filter.Group != "" {
+		group, err := NormalizeGroup(filter.Group)
+		if err != nil {
+			return nil, nil, err
+		}
+		conditions = append(conditions, fmt.Sprintf("(e.group_path = %s OR e.group_path LIKE %s)",
+			arg(group), arg(EscapeLike(group)+"/%")))
+	}
+
+	requirements, err := ParseLabelSelector(filter.Selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, requirement := range requirements {
+		switch requirement.Operator {
+		case "=", "!=":
+			encoded, _ := json.Marshal(map[string]string{requirement.Key: requirement.Value})
+			condition := "e.labels @> " + arg(string(encoded)) + "::jsonb"
+			if requirement.Operator == "!=" {
+				condition = "NOT " + condition
+			}
+			conditions = append(conditions, condition)
+		case "exists":
+			conditions = append(conditions, "e.labels ? "+arg(requirement.Key))
+		case "!exists":
+			conditions = append(conditions, "NOT e.labels ? "+arg(requirement.Key))
+		}
+	}
+
+	return conditions, args, nil
+}
+
+// EndpointOrderBy returns the ORDER BY expression for a sort parameter such as "name" or
+// "-updated_at" (descending)
+func EndpointOrderBy(sort string) (string, error) {
+	direction := "ASC"
+	if field, descending := strings.CutPrefix(sort, "-"); descending {
+		sort = field
+		direction = "DESC"
+	}
+
+	column, ok := endpointSortColumns[sort]
+	if !ok {
+		return "", fmt.Errorf("cannot sort by %q", sort)
+	}
+	return column + " " + direction + ", e.id " + direction, nil
+}
+
+// EscapeLike escapes the LIKE wildcards in user supplied text
+func EscapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	got, err := ParseLabelSelector(" env = prod, service!=checkout,tier==gold, team, !deprecated ,, app.io/name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LabelRequirement{
+		{Key: "env", Operator: "=", Value: "prod"},
+		{Key: "service", Operator: "!=", Value: "checkout"},
+		{Key: "tier", Operator: "=", Value: "gold"},
+		{Key: "team", Operator: "exists"},
+		{Key: "deprecated", Operator: "!exists"},
+		{Key: "app.io/name", Operator: "exists"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseLabelSelector =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if got, err := ParseLabelSelector(""); err != nil || len(got) != 0 {
+		t.Errorf("empty selector = %v, %v; want no requirements", got, err)
+	}
+	if got, _ := ParseLabelSelector("env="); len(got) != 1 || got[0].Value != "" {
+		t.Errorf("env= = %+v, want a requirement on an empty value", got)
+	}
+
+	for _, selector := range []string{"=prod", "env=pr od", "!", "env='prod'", "-env", "env=a=b", "tier in (a,b)"} {
+		if _, err := ParseLabelSelector(selector); err == nil {
+			t.Errorf("ParseLabelSelector(%q) succeeded", selector)
+		}
+	}
+}
+
+func TestEndpointFilterConditions(t *testing.T) {
+	teamID := 4
+	conditions, args, err := EndpointFilterConditions(EndpointFilter{
+		TeamID:   &teamID,
+		Search:   "50%_off",
+		Group:    "/payments/",
+		Selector: "env=prod,!deprecated",
+	}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantConditions := []string{
+		"e.team_id = $3",
+		"(e.name ILIKE $4 OR e.key ILIKE $4 OR e.url ILIKE $4)",
+		"(e.group_path = $5 OR e.group_path LIKE $6)",
+		"e.labels @> $7::jsonb",
+		"NOT e.labels ? $8",
+	}
+	wantArgs := []interface{}{4, `%50\%\_off%`, "payments", "payments/%", `{"env":"prod"}`, "deprecated"}
+	if !reflect.DeepEqual(conditions, wantConditions) || !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("conditions = %q %v\nwant %q %v", conditions, args, wantConditions, wantArgs)
+	}
+
+	if _, _, err := EndpointFilterConditions(EndpointFilter{Group: "a//b"}, 1); err == nil {
+		t.Error("a group with an empty segment was accepted")
+	}
+	if _, _, err := EndpointFilterConditions(EndpointFilter{Selector: "env=a b"}, 1); err == nil {
+		t.Error("an invalid selector was accepted")
+	}
+}
+
+func TestEndpointOrderBy(t *testing.T) {
+	for sort, want := range map[string]string{
+		"name":        "e.name ASC, e.id ASC",
+		"-updated_at": "e.updated_at DESC, e.id DESC",
+		"group":       "e.group_path ASC, e.id ASC",
+	} {
+		got, err := EndpointOrderBy(sort)
+		if err != nil || got != want {
+			t.Errorf("EndpointOrderBy(%q) = %q, %v; want %q", sort, got, err, want)
+		}
+	}
+
+	// Only known columns reach the query
+	for _, sort := range []string{"", "-", "--name", "e.name", "name; DROP TABLE api_endpoints", "password"} {
+		if got, err := EndpointOrderBy(sort); err == nil {
+			t.Errorf("EndpointOrderBy(%q) = %q, want an error", sort, got)
+		}
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	if err := ValidateLabels(map[string]string{"env": "prod", "app.io/tier": "", "a-b_c": "x.y/z"}); err != nil {
+		t.Errorf("valid labels rejected: %v", err)
+	}
+	for name, labels := range map[string]map[string]string{
+		"empty key":   {"": "x"},
+		"space":       {"env": "pro d"},
+		"long value":  {"env": strings.Repeat("a", 64)},
+		"leading dot": {".env": "x"},
+	} {
+		if err := ValidateLabels(labels); err == nil {
+			t.Errorf("%s: labels %v accepted", name, labels)
+		}
+	}
+
+	tooMany := map[string]string{}
+	for i := 0; i <= maxEndpointLabels; i++ {
+		tooMany[strings.Repeat("k", i+1)] = "v"
+	}
+	if err := ValidateLabels(tooMany); err == nil {
+		t.Errorf("%d labels accepted", len(tooMany))
+	}
+}
+
+func TestNormalizeGroup(t *testing.T) {
+	for group, want := range map[string]string{
+		"":                      "",
+		" / ":                   "",
+		"/payments/checkout/":   "payments/checkout",
+		" payments / checkout ": "payments/checkout",
+	} {
+		got, err := NormalizeGroup(group)
+		if err != nil || got != want {
+			t.Errorf("NormalizeGroup(%q) = %q, %v; want %q", group, got, err, want)
+		}
+	}
+	for _, group := range []string{"a//b", "a/ /b", strings.Repeat("a", 256)} {
+		if _, err := NormalizeGroup(group); err == nil {
+			t.Errorf("NormalizeGroup(%q) succeeded", group)
+		}
+	}
+}
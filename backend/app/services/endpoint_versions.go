@@ -0,0 +1,176 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+
+	"api-monitor/app/models"
+)
+
+// EndpointVersionSelect loads endpoint versions; read rows with ScanEndpointVersion
+const EndpointVersionSelect = `
+	SELECT id, endpoint_id, version, definition, change_type, restored_from, created_by,
+	       created_by_username, created_at
+	FROM endpoint_versions`
+
+// EndpointDefinitionOf returns the versioned part of an endpoint
+func EndpointDefinitionOf(endpoint models.APIEndpoint) models.EndpointDefinition {
+	headers := endpoint.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	// Empty labels are left out so definitions saved before labels existed compare equal
+	var labels map[string]string
+	if len(endpoint.Labels) > 0 {
+		labels = endpoint.Labels
+	}
+
+	// Likewise the type is only recorded for heartbeats
+	endpointType := endpoint.Type
+	if endpointType == models.EndpointTypeHTTP {
+		endpointType = ""
+	}
+
+	// Content tracking only while it is enabled
+	var tracking *models.ContentTracking
+	if endpoint.ContentTracking.Enabled {
+		t := endpoint.ContentTracking
+		tracking = &t
+	}
+
+	var capture *models.ResponseCapture
+	if endpoint.ResponseCapture != (models.ResponseCapture{}) {
+		c := endpoint.ResponseCapture
+		capture = &c
+	}
+
+	var transport *models.TransportOptions
+	if !UsesDefaultTransport(endpoint.Transport) {
+		t := endpoint.Transport
+		transport = &t
+	}
+
+	return models.EndpointDefinition{
+		Name:                 endpoint.Name,
+		URL:                  endpoint.URL,
+		Method:               endpoint.Method,
+		Headers:              headers,
+		Body:                 endpoint.Body,
+		TimeoutSeconds:       endpoint.TimeoutSeconds,
+		CheckIntervalSeconds: endpoint.CheckIntervalSeconds,
+		ProxyID:              endpoint.ProxyID,
+		AuthProfileID:        endpoint.AuthProfileID,
+		TLSProfileID:         endpoint.TLSProfileID,
+		TeamID:               endpoint.TeamID,
+		Labels:               labels,
+		Group:                endpoint.Group,
+		Type:                 endpointType,
+		GraceSeconds:         endpoint.GraceSeconds,
+		ContentTracking:      tracking,
+		ResponseCapture:      capture,
+		Transport:            transport,
+		ResponseSchema:       endpoint.ResponseSchema,
+		ResponseSchemaID:     endpoint.ResponseSchemaID,
+	}
+}
+
+// RecordEndpointVersion saves the current definition of an endpoint as its next version
+// and returns the endpoint's version. Nothing is saved when the definition equals the
+// latest version, e.g. when an update resubmitted the same values. Call it in the
+// transaction that changed the endpoint so the row is locked and version numbers cannot
+// race.
+func RecordEndpointVersion(tx *sql.Tx, endpointID int, actor *models.User, changeType string, restoredFrom *int) (int, error) {
+	endpoint, err := ScanEndpoint(tx.QueryRow(EndpointSelect+` WHERE e.id = $1 FOR UPDATE OF e`, endpointID))
+	if err != nil {
+		return 0, err
+	}
+	definition := EndpointDefinitionOf(endpoint)
+
+	latest, err := ScanEndpointVersion(tx.QueryRow(EndpointVersionSelect+`
+		WHERE endpoint_id = $1 ORDER BY version DESC LIMIT 1`, endpointID))
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if err == nil && reflect.DeepEqual(latest.Definition, definition) {
+		return latest.Version, nil
+	}
+
+	version := latest.Version + 1
+	definitionJSON, err := json.Marshal(definition)
+	if err != nil {
+		return 0, err
+	}
+
+	var actorID interface{}
+	actorUsername := ""
+	if actor != nil {
+		actorID = actor.ID
+		actorUsername = actor.Username
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO endpoint_versions (endpoint_id, version, definition, change_type, restored_from,
+		                               created_by, created_by_username, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())`,
+		endpointID, version, string(definitionJSON), changeType, restoredFrom, actorID, actorUsername)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec("UPDATE api_endpoints SET version = $1 WHERE id = $2", version, endpointID); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// ScanEndpointVersion reads one row produced by EndpointVersionSelect
+func ScanEndpointVersion(row rowScanner) (models.EndpointVersion, error) {
+	var version models.EndpointVersion
+	var definitionJSON []byte
+	var restoredFrom, createdBy sql.NullInt64
+
+	err := row.Scan(&version.ID, &version.EndpointID, &version.Version, &definitionJSON, &version.ChangeType,
+		&restoredFrom, &createdBy, &version.CreatedByUsername, &version.CreatedAt)
+	if err != nil {
+		return version, err
+	}
+
+	if err := json.Unmarshal(definitionJSON, &version.Definition); err != nil {
+		return version, err
+	}
+	if version.Definition.Headers == nil {
+		version.Definition.Headers = map[string]string{}
+	}
+
+	if restoredFrom.Valid {
+		restoredFromInt := int(restoredFrom.Int64)
+		version.RestoredFrom = &restoredFromInt
+	}
+	if createdBy.Valid {
+		createdByInt := int(createdBy.Int64)
+		version.CreatedBy = &createdByInt
+	}
+
+	return version, nil
+}
+
+// FindEndpointVersion loads one version of an endpoint
+func FindEndpointVersion(db *sql.DB, endpointID, version int) (models.EndpointVersion, error) {
+	return ScanEndpointVersion(db.QueryRow(EndpointVersionSelect+`
+		WHERE endpoint_id = $1 AND version = $2`, endpointID, version))
+}
+
+// DiffEndpointDefinitions returns the fields that differ between two definitions
+func DiffEndpointDefinitions(before, after models.EndpointDefinition) map[string]models.AuditChange {
+	return DiffStates(definitionState(before), definitionState(after))
+}
+
+func definitionState(definition models.EndpointDefinition) map[string]interface{} {
+	encoded, _ := json.Marshal(definition)
+
+	var state map[string]interface{}
+	json.Unmarshal(encoded, &state)
+	return state
+}
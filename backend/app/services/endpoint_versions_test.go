@@ -0,0 +1,89 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"api-monitor/app/models"
+)
+
+func TestEndpointDefinitionOfDefaults(t *testing.T) {
+	definition := EndpointDefinitionOf(models.APIEndpoint{
+		Name:            "orders",
+		URL:             "https://api.local/orders",
+		Method:          "GET",
+		Type:            models.EndpointTypeHTTP,
+		Labels:          map[string]string{},
+		ContentTracking: models.ContentTracking{IgnorePaths: []string{"$.now"}},
+	})
+
+	if definition.Headers == nil || len(definition.Headers) != 0 {
+		t.Errorf("Headers = %v, want an empty map", definition.Headers)
+	}
+	if definition.Labels != nil || definition.Type != "" || definition.ContentTracking != nil ||
+		definition.ResponseCapture != nil || definition.Transport != nil {
+		t.Errorf("defaults were recorded: %+v", definition)
+	}
+
+	// The latest version is read back from JSON and compared with DeepEqual, an unchanged
+	// endpoint must not produce a new version
+	encoded, _ := json.Marshal(definition)
+	var stored models.EndpointDefinition
+	if err := json.Unmarshal(encoded, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Headers == nil {
+		stored.Headers = map[string]string{} // As ScanEndpointVersion does
+	}
+	if !reflect.DeepEqual(stored, definition) {
+		t.Errorf("definition changed in a JSON round trip:\n%+v\n%+v", stored, definition)
+	}
+}
+
+func TestEndpointDefinitionOfSettings(t *testing.T) {
+	definition := EndpointDefinitionOf(models.APIEndpoint{
+		Type:            models.EndpointTypeHeartbeat,
+		Labels:          map[string]string{"env": "prod"},
+		ContentTracking: models.ContentTracking{Enabled: true},
+		ResponseCapture: models.ResponseCapture{Mode: models.CaptureAlways},
+		Transport:       models.TransportOptions{DisableKeepAlives: true},
+	})
+
+	if definition.Type != models.EndpointTypeHeartbeat || definition.Labels["env"] != "prod" ||
+		definition.ContentTracking == nil || definition.ResponseCapture == nil ||
+		definition.Transport == nil || !definition.Transport.DisableKeepAlives {
+		t.Errorf("settings were not recorded: %+v", definition)
+	}
+}
+
+func TestDiffEndpointDefinitions(t *testing.T) {
+	proxyID := 3
+	before := EndpointDefinitionOf(models.APIEndpoint{
+		Name:    "orders",
+		URL:     "https://api.local/orders",
+		Headers: map[string]string{"Accept": "application/json"},
+	})
+	after := before
+	after.URL = "https://api.local/v2/orders"
+	after.Headers = map[string]string{"Accept": "application/json", "X-Trace": "1"}
+	after.ProxyID = &proxyID
+
+	changes := DiffEndpointDefinitions(before, after)
+	if len(changes) != 3 {
+		t.Fatalf("changes = %v, want url, headers and proxy_id", changes)
+	}
+	if changes["url"].Before != "https://api.local/orders" || changes["url"].After != "https://api.local/v2/orders" {
+		t.Errorf("url change = %+v", changes["url"])
+	}
+	if changes["proxy_id"].Before != nil || changes["proxy_id"].After != float64(3) {
+		t.Errorf("proxy_id change = %+v", changes["proxy_id"])
+	}
+	if _, ok := changes["headers"]; !ok {
+		t.Error("the header change is missing")
+	}
+
+	if changes := DiffEndpointDefinitions(before, before); len(changes) != 0 {
+		t.Errorf("equal definitions differ in %v", changes)
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"api-monitor/app/models"
+)
+
+// EndpointSelect loads endpoints together with their proxy when the proxy is active.
+// Append WHERE / ORDER BY clauses using the "e" alias and read rows with ScanEndpoint.
+const EndpointSelect = `
+	SELECT e.id, e.key, e.name, e.url, e.method, COALESCE(e.headers, '{}'), COALESCE(e.body, ''),
+	       e.timeout_seconds, e.check_interval_seconds, e.is_active, e.proxy_id,
+	       e.auth_profile_id, e.tls_profile_id, e.team_id, e.labels, e.group_path, e.type,
+	       e.grace_seconds, e.content_tracking, e.response_capture, e.transport, e.response_schema, e.response_schema_id, e.version, e.created_at, e.updated_at,
+	       p.host, p.port, p.username, p.password
+	FROM api_endpoints e
+	LEFT JOIN proxies p ON e.proxy_id = p.id AND p.is_active = true`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// ScanEndpoint reads one row produced by EndpointSelect
+func ScanEndpoint(row rowScanner) (models.APIEndpoint, error) {
+	var endpoint models.APIEndpoint
+	var headersJSON, labelsJSON, trackingJSON, captureJSON, transportJSON string
+	var proxyID, authProfileID, tlsProfileID, teamID, responseSchemaID sql.NullInt64
+	var responseSchema []byte
+	var proxyHost, proxyUsername, proxyPassword sql.NullString
+	var proxyPort sql.NullInt64
+
+	err := row.Scan(&endpoint.ID, &endpoint.Key, &endpoint.Name, &endpoint.URL, &endpoint.Method,
+		&headersJSON, &endpoint.Body, &endpoint.TimeoutSeconds, &endpoint.CheckIntervalSeconds,
+		&endpoint.IsActive, &proxyID, &authProfileID, &tlsProfileID, &teamID, &labelsJSON, &endpoint.Group,
+		&endpoint.Type, &endpoint.GraceSeconds, &trackingJSON, &captureJSON, &transportJSON, &responseSchema, &responseSchemaID, &endpoint.Version, &endpoint.CreatedAt, &endpoint.UpdatedAt,
+		&proxyHost, &proxyPort, &proxyUsername, &proxyPassword)
+	if err != nil {
+		return endpoint, err
+	}
+
+	endpoint.Headers = make(map[string]string)
+	if err := json.Unmarshal([]byte(headersJSON), &endpoint.Headers); err != nil {
+		endpoint.Headers = make(map[string]string)
+	}
+
+	endpoint.Labels = make(map[string]string)
+	if err := json.Unmarshal([]byte(labelsJSON), &endpoint.Labels); err != nil {
+		endpoint.Labels = make(map[string]string)
+	}
+
+	json.Unmarshal([]byte(trackingJSON), &endpoint.ContentTracking)
+	json.Unmarshal([]byte(captureJSON), &endpoint.ResponseCapture)
+	json.Unmarshal([]byte(transportJSON), &endpoint.Transport)
+	if len(responseSchema) > 0 {
+		json.Unmarshal(responseSchema, &endpoint.ResponseSchema)
+	}
+	if responseSchemaID.Valid {
+		id := int(responseSchemaID.Int64)
+		endpoint.ResponseSchemaID = &id
+	}
+
+	// Set proxy data if available
+	if proxyID.Valid {
+		proxyIDInt := int(proxyID.Int64)
+		endpoint.ProxyID = &proxyIDInt
+		if proxyHost.Valid {
+			endpoint.Proxy = &models.Proxy{
+				ID:       proxyIDInt,
+				Host:     proxyHost.String,
+				Port:     int(proxyPort.Int64),
+				Username: proxyUsername.String,
+				Password: proxyPassword.String,
+				IsActive: true,
+			}
+		}
+	}
+
+	if authProfileID.Valid {
+		authProfileIDInt := int(authProfileID.Int64)
+		endpoint.AuthProfileID = &authProfileIDInt
+	}
+
+	if tlsProfileID.Valid {
+		tlsProfileIDInt := int(tlsProfileID.Int64)
+		endpoint.TLSProfileID = &tlsProfileIDInt
+	}
+
+	if teamID.Valid {
+		teamIDInt := int(teamID.Int64)
+		endpoint.TeamID = &teamIDInt
+	}
+
+	return endpoint, nil
+}
+
+// FindEndpoint loads a single endpoint by ID
+func FindEndpoint(db *sql.DB, endpointID int) (models.APIEndpoint, error) {
+	return ScanEndpoint(db.QueryRow(EndpointSelect+` WHERE e.id = $1`, endpointID))
+}
+
+// endpointKeyPattern is the format of endpoint keys: lower case letters, digits, dots,
+// dashes and underscores
+var endpointKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,99}$`)
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ValidEndpointKey reports whether key can identify an endpoint
+func ValidEndpointKey(key string) bool {
+	return endpointKeyPattern.MatchString(key)
+}
+
+// Slugify turns a name into an endpoint key, the same way migration 017 derived the keys
+// of existing endpoints
+func Slugify(name string) string {
+	slug := slugSeparators.ReplaceAllString(strings.ToLower(name), "-")
+	slug = strings.Trim(slug, "-")
+	if len(slug) > 80 {
+		slug = strings.TrimRight(slug[:80], "-")
+	}
+	if slug == "" {
+		return "endpoint"
+	}
+	return slug
+}
+
+// UniqueEndpointKey returns base, or base with a numeric suffix, whichever is not used
+// by another endpoint of the team yet
+func UniqueEndpointKey(db *sql.DB, teamID int, base string) (string, error) {
+	key := base
+	for i := 2; ; i++ {
+		var exists bool
+		err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM api_endpoints WHERE team_id = $1 AND key = $2)`,
+			teamID, key).Scan(&exists)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return key, nil
+		}
+		key = fmt.Sprintf("%s-%d", base, i)
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+
+	"api-monitor/app/models"
+	"api-monitor/utils"
+)
+
+// Heartbeat ping kinds
+const (
+	PingStart   = "start"   // The job started, the next success or failure measures its duration
+	PingSuccess = "success" // The job finished successfully
+	PingFail    = "fail"    // The job failed
+)
+
+// ParsePingStatus returns the kind of a ping from the status in its URL: start, success,
+// fail or the exit code of the job, where 0 is a success
+func ParsePingStatus(status string) (string, int, error) {
+	switch status {
+	case PingStart, PingSuccess, PingFail:
+		return status, 0, nil
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil || code < 0 || code > 255 {
+		return "", 0, fmt.Errorf("status must be start, success, fail or an exit code")
+	}
+	if code != 0 {
+		return PingFail, code, nil
+	}
+	return PingSuccess, 0, nil
+}
+
+// IssuePingToken returns a new ping URL token and the hash stored for it
+func IssuePingToken() (string, string, error) {
+	token, err := utils.RandomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	return token, utils.HashToken(token), nil
+}
+
+// FindHeartbeatByToken returns the heartbeat endpoint a ping URL token belongs to
+func FindHeartbeatByToken(db *sql.DB, token string) (models.APIEndpoint, error) {
+	return ScanEndpoint(db.QueryRow(EndpointSelect+`
+		WHERE e.ping_token_hash = $1 AND e.type = $2`, utils.HashToken(token), models.EndpointTypeHeartbeat))
+}
+
+// RecordPing handles a ping of a heartbeat endpoint. Start pings only remember when the
+// job started; success and failure pings are logged as checks with the job duration as
+// response time and the payload as response body. exitCode is used in the error message of
+// failures when it is not zero.
+func (m *MonitorService) RecordPing(endpoint models.APIEndpoint, kind string, exitCode int, payload string) error {
+	if kind == PingStart {
+		_, err := m.DB.Exec(`
+			INSERT INTO heartbeat_states (endpoint_id, started_at) VALUES ($1, NOW())
+			ON CONFLICT (endpoint_id) DO UPDATE SET started_at = NOW()`, endpoint.ID)
+		return err
+	}
+
+	// The CTE sees the state before the upsert, so the start of the finished job is returned
+	var durationMs sql.NullInt64
+	err := m.DB.QueryRow(`
+		WITH previous AS (SELECT started_at FROM heartbeat_states WHERE endpoint_id = $1)
+		INSERT INTO heartbeat_states (endpoint_id, last_ping_at, started_at) VALUES ($1, NOW(), NULL)
+		ON CONFLICT (endpoint_id) DO UPDATE SET last_ping_at = NOW(), started_at = NULL
+		RETURNING (SELECT (EXTRACT(EPOCH FROM NOW() - started_at) * 1000)::bigint FROM previous)`,
+		endpoint.ID).Scan(&durationMs)
+	if err != nil {
+		return err
+	}
+
+	status := models.EndpointStatusUp
+	errorMessage := ""
+	if kind == PingFail {
+		status = models.EndpointStatusDown
+		errorMessage = "The job reported a failure"
+		if exitCode != 0 {
+			errorMessage = fmt.Sprintf("The job exited with code %d", exitCode)
+		}
+	}
+
+	m.logCheck(endpoint, status, 0, int(durationMs.Int64), payload, "", errorMessage, nil, nil)
+	return nil
+}
+
+// CheckHeartbeats logs a failed check for every active heartbeat that has not been pinged
+// within its period plus grace time, counted from its last ping or from its last change
+// (e.g. being enabled). While the heartbeat stays silent another failure is logged every
+// period.
+func (m *MonitorService) CheckHeartbeats() {
+	rows, err := m.DB.Query(`
+		SELECT e.id
+		FROM api_endpoints e
+		LEFT JOIN heartbeat_states s ON s.endpoint_id = e.id
+		LEFT JOIN LATERAL (
+			SELECT l.checked_at FROM api_check_logs l
+			WHERE l.endpoint_id = e.id
+			ORDER BY l.checked_at DESC
+			LIMIT 1
+		) last ON true
+		WHERE e.type = $1 AND e.is_active = true
+		  AND GREATEST(s.last_ping_at, e.updated_at) + make_interval(secs => e.check_interval_seconds + e.grace_seconds) < NOW()
+		  AND (last.checked_at IS NULL OR last.checked_at + make_interval(secs => e.check_interval_seconds) <= NOW())`,
+		models.EndpointTypeHeartbeat)
+	if err != nil {
+		log.Printf("Error looking for late heartbeats: %v", err)
+		return
+	}
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("Error scanning late heartbeat: %v", err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		endpoint, err := FindEndpoint(m.DB, id)
+		if err != nil {
+			log.Printf("Error loading heartbeat %d: %v", id, err)
+			continue
+		}
+
+		m.logCheck(endpoint, models.EndpointStatusDown, 0, 0, "", "",
+			fmt.Sprintf("No ping received within %d seconds (period %ds, grace %ds)",
+				endpoint.CheckIntervalSeconds+endpoint.GraceSeconds, endpoint.CheckIntervalSeconds, endpoint.GraceSeconds), nil, nil)
+	}
+}
@@ -0,0 +1,30 @@
+package services
+
+import "testing"
+
+func TestParsePingStatus(t *testing.T) {
+	tests := []struct {
+		status   string
+		kind     string
+		exitCode int
+	}{
+		{"start", PingStart, 0},
+		{"success", PingSuccess, 0},
+		{"fail", PingFail, 0},
+		{"0", PingSuccess, 0},
+		{"1", PingFail, 1},
+		{"255", PingFail, 255},
+	}
+	for _, tt := range tests {
+		kind, exitCode, err := ParsePingStatus(tt.status)
+		if err != nil || kind != tt.kind || exitCode != tt.exitCode {
+			t.Errorf("ParsePingStatus(%q) = %s, %d, %v; want %s, %d", tt.status, kind, exitCode, err, tt.kind, tt.exitCode)
+		}
+	}
+
+	for _, status := range []string{"", "ok", "FAIL", "-1", "256", "1.5", " 1"} {
+		if kind, _, err := ParsePingStatus(status); err == nil {
+			t.Errorf("ParsePingStatus(%q) = %s, want an error", status, kind)
+		}
+	}
+}
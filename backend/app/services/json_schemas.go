@@ -0,0 +1,193 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"api-monitor/app/models"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+)
+
+const (
+	schemaResourceURL = "urn:api-monitor:response-schema"
+	maxSchemaErrors   = 50
+)
+
+// JSONSchemaSelect loads library schemas; read rows with ScanJSONSchema
+const JSONSchemaSelect = `
+	SELECT id, name, description, schema, team_id, created_at, updated_at
+	FROM json_schemas`
+
+// compiledSchemas caches compiled schemas by the hash of their JSON, so checks only
+// compile a schema again after it changed
+var compiledSchemas sync.Map
+
+// ScanJSONSchema reads one row produced by JSONSchemaSelect
+func ScanJSONSchema(row rowScanner) (models.JSONSchema, error) {
+	var schema models.JSONSchema
+	var schemaJSON []byte
+	var teamID sql.NullInt64
+
+	err := row.Scan(&schema.ID, &schema.Name, &schema.Description, &schemaJSON, &teamID, &schema.CreatedAt, &schema.UpdatedAt)
+	if err != nil {
+		return schema, err
+	}
+	schema.TeamID = nullableInt(teamID)
+
+	err = json.Unmarshal(schemaJSON, &schema.Schema)
+	return schema, err
+}
+
+// FindJSONSchema loads a library schema by ID
+func FindJSONSchema(db *sql.DB, schemaID int) (models.JSONSchema, error) {
+	return ScanJSONSchema(db.QueryRow(JSONSchemaSelect+` WHERE id = $1`, schemaID))
+}
+
+// CompileSchema compiles a JSON Schema. Schemas without $schema are draft 2020-12, formats
+// such as "email" or "date-time" are asserted and references to other documents are not
+// loaded.
+func CompileSchema(schema map[string]interface{}) (*jsonschema.Schema, error) {
+	encoded, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	key := sha256.Sum256(encoded)
+	if compiled, ok := compiledSchemas.Load(key); ok {
+		return compiled.(*jsonschema.Schema), nil
+	}
+
+	// The compiler expects numbers as json.Number, as its own decoder returns them
+	document, err := jsonschema.UnmarshalJSON(strings.NewReader(string(encoded)))
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft2020)
+	compiler.AssertFormat()
+	compiler.UseLoader(jsonschema.SchemeURLLoader{})
+	if err := compiler.AddResource(schemaResourceURL, document); err != nil {
+		return nil, err
+	}
+
+	compiled, err := compiler.Compile(schemaResourceURL)
+	if err != nil {
+		return nil, err
+	}
+	compiledSchemas.Store(key, compiled)
+	return compiled, nil
+}
+
+// ResponseSchemaOf returns the schema an endpoint's responses must match: its own one or
+// the library schema it references. It returns nil when the endpoint has neither.
+func ResponseSchemaOf(db *sql.DB, endpoint models.APIEndpoint) (map[string]interface{}, error) {
+	if endpoint.ResponseSchema != nil {
+		return endpoint.ResponseSchema, nil
+	}
+	if endpoint.ResponseSchemaID == nil {
+		return nil, nil
+	}
+
+	schema, err := FindJSONSchema(db, *endpoint.ResponseSchemaID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading JSON schema %d: %v", *endpoint.ResponseSchemaID, err)
+	}
+	return schema.Schema, nil
+}
+
+// ValidateResponse validates a response body against the endpoint's schema. It returns
+// nil when the endpoint has no schema and an empty list when the body matches.
+func ValidateResponse(db *sql.DB, endpoint models.APIEndpoint, body string) ([]models.SchemaError, error) {
+	schema, err := ResponseSchemaOf(db, endpoint)
+	if err != nil || schema == nil {
+		return nil, err
+	}
+
+	compiled, err := CompileSchema(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %v", err)
+	}
+	return ValidateBody(compiled, body), nil
+}
+
+// ValidateBody validates a response body against a compiled schema and returns at most
+// maxSchemaErrors errors, the most specific ones
+func ValidateBody(schema *jsonschema.Schema, body string) []models.SchemaError {
+	instance, err := jsonschema.UnmarshalJSON(strings.NewReader(body))
+	if err != nil {
+		return []models.SchemaError{{Path: "", Message: "the response body is not valid JSON"}}
+	}
+
+	schemaErrors := []models.SchemaError{}
+	err = schema.Validate(instance)
+	if err == nil {
+		return schemaErrors
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []models.SchemaError{{Path: "", Message: err.Error()}}
+	}
+
+	for _, unit := range validationErr.BasicOutput().Errors {
+		// Group errors only say that a nested keyword failed, which is listed on its own
+		if unit.Error == nil {
+			continue
+		}
+		if _, group := unit.Error.Kind.(*kind.Group); group {
+			continue
+		}
+		schemaErrors = append(schemaErrors, models.SchemaError{
+			Path:    unit.InstanceLocation,
+			Message: unit.Error.String(),
+		})
+		if len(schemaErrors) == maxSchemaErrors {
+			break
+		}
+	}
+	if len(schemaErrors) == 0 {
+		schemaErrors = append(schemaErrors, models.SchemaError{Path: "", Message: validationErr.Error()})
+	}
+	return schemaErrors
+}
+
+// CheckResponseSchema validates the body of a successful response and returns the schema
+// errors (nil when nothing was validated) and the error message of the check, "" when the
+// body matches
+func CheckResponseSchema(db *sql.DB, endpoint models.APIEndpoint, statusCode int, body string) ([]models.SchemaError, string) {
+	if CheckStatus(statusCode, "") != models.EndpointStatusUp {
+		return nil, ""
+	}
+
+	schemaErrors, err := ValidateResponse(db, endpoint, body)
+	if err != nil {
+		return nil, "Error validating the response: " + err.Error()
+	}
+	if len(schemaErrors) > 0 {
+		return schemaErrors, SchemaErrorMessage(schemaErrors)
+	}
+	return schemaErrors, ""
+}
+
+// SchemaErrorMessage summarizes schema errors as the error message of a check
+func SchemaErrorMessage(schemaErrors []models.SchemaError) string {
+	first := schemaErrors[0]
+	path := first.Path
+	if path == "" {
+		path = "/"
+	}
+
+	message := fmt.Sprintf("Response does not match the JSON schema: %s: %s", path, first.Message)
+	if len(schemaErrors) > 1 {
+		message += fmt.Sprintf(" (and %d more)", len(schemaErrors)-1)
+	}
+	return message
+}
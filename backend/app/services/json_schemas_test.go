@@ -0,0 +1,106 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"api-monitor/app/models"
+)
+
+var orderSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []interface{}{"id", "email"},
+	"properties": map[string]interface{}{
+		"id":    map[string]interface{}{"type": "integer", "maximum": 9007199254740993},
+		"email": map[string]interface{}{"type": "string", "format": "email"},
+		"items": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+	},
+}
+
+func TestCompileSchema(t *testing.T) {
+	compiled, err := CompileSchema(orderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := CompileSchema(orderSchema); again != compiled {
+		t.Error("an unchanged schema was compiled again")
+	}
+
+	for name, schema := range map[string]map[string]interface{}{
+		"unknown type":   {"type": "integr"},
+		"invalid regexp": {"type": "string", "pattern": "("},
+		"remote $ref":    {"$ref": "https://example.com/schema.json"},
+	} {
+		if _, err := CompileSchema(schema); err == nil {
+			t.Errorf("%s: CompileSchema succeeded", name)
+		}
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	compiled, err := CompileSchema(orderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errors := ValidateBody(compiled, `{"id": 9007199254740993, "email": "a@example.com", "items": ["x"]}`); len(errors) != 0 {
+		t.Errorf("a matching body has errors: %+v", errors)
+	}
+
+	errors := ValidateBody(compiled, `{"id": 9007199254740994, "email": "not an email", "items": ["x", 2]}`)
+	paths := map[string]bool{}
+	for _, e := range errors {
+		paths[e.Path] = true
+	}
+	if len(errors) != 3 || !paths["/id"] || !paths["/email"] || !paths["/items/1"] {
+		t.Errorf("errors = %+v, want one each for /id, /email and /items/1", errors)
+	}
+
+	if errors := ValidateBody(compiled, `{"id": 1}`); len(errors) != 1 || errors[0].Path != "" || !strings.Contains(errors[0].Message, "email") {
+		t.Errorf("missing property errors = %+v", errors)
+	}
+	if errors := ValidateBody(compiled, "<html>"); len(errors) != 1 || errors[0].Message != "the response body is not valid JSON" {
+		t.Errorf("non-JSON body errors = %+v", errors)
+	}
+
+	many := `{"id": 1, "email": "a@example.com", "items": [` + strings.Repeat(`1, `, 80) + `1]}`
+	if errors := ValidateBody(compiled, many); len(errors) != maxSchemaErrors {
+		t.Errorf("%d errors, want at most %d", len(errors), maxSchemaErrors)
+	}
+}
+
+func TestCheckResponseSchema(t *testing.T) {
+	endpoint := models.APIEndpoint{ResponseSchema: orderSchema}
+
+	schemaErrors, message := CheckResponseSchema(nil, endpoint, 200, `{"id": 1}`)
+	if len(schemaErrors) != 1 || !strings.HasPrefix(message, "Response does not match the JSON schema: /: ") {
+		t.Errorf("CheckResponseSchema = %+v, %q", schemaErrors, message)
+	}
+	if schemaErrors, message := CheckResponseSchema(nil, endpoint, 200, `{"id": 1, "email": "a@example.com"}`); schemaErrors == nil || len(schemaErrors) != 0 || message != "" {
+		t.Errorf("matching body = %+v, %q; want no errors", schemaErrors, message)
+	}
+
+	// Failed responses are not validated
+	if schemaErrors, message := CheckResponseSchema(nil, endpoint, 500, `{}`); schemaErrors != nil || message != "" {
+		t.Errorf("failed response = %+v, %q; want nothing validated", schemaErrors, message)
+	}
+	if schemaErrors, message := CheckResponseSchema(nil, models.APIEndpoint{}, 200, `{}`); schemaErrors != nil || message != "" {
+		t.Errorf("endpoint without schema = %+v, %q", schemaErrors, message)
+	}
+
+	invalid := models.APIEndpoint{ResponseSchema: map[string]interface{}{"type": 5}}
+	if _, message := CheckResponseSchema(nil, invalid, 200, `{}`); !strings.HasPrefix(message, "Error validating the response: invalid JSON schema") {
+		t.Errorf("invalid schema message = %q", message)
+	}
+}
+
+func TestSchemaErrorMessage(t *testing.T) {
+	message := SchemaErrorMessage([]models.SchemaError{
+		{Path: "/items/0", Message: "got number, want string"},
+		{Path: "/id", Message: "got string, want integer"},
+		{Path: "", Message: "missing property 'email'"},
+	})
+	if message != "Response does not match the JSON schema: /items/0: got number, want string (and 2 more)" {
+		t.Errorf("message = %q", message)
+	}
+}
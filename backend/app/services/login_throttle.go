@@ -0,0 +1,190 @@
+package services
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-monitor/app/models"
+	"api-monitor/config"
+)
+
+// failureWindow is how long failed attempts are remembered; counters older than this start over
+const failureWindow = time.Hour
+
+// usernameFreeAttempts is the number of failures for one username before backoff starts
+const usernameFreeAttempts = 2
+
+// LoginThrottle protects password logins against brute force. Failures are counted per IP
+// and per username in Postgres so every backend replica sees the same counters. Each
+// failure past the free attempts doubles the wait before the next attempt, and too many
+// failures for one username lock the account for a while.
+type LoginThrottle struct {
+	DB     *sql.DB
+	Config config.LoginThrottleConfig
+}
+
+func NewLoginThrottle(db *sql.DB) *LoginThrottle {
+	return &LoginThrottle{
+		DB:     db,
+		Config: config.GetLoginThrottleConfig(),
+	}
+}
+
+// Check returns how long the client has to wait before it may try to log in again,
+// or zero when the attempt is allowed
+func (t *LoginThrottle) Check(ip, username string) (time.Duration, error) {
+	var blockedUntil sql.NullTime
+	err := t.DB.QueryRow(`
+		SELECT GREATEST(
+			(SELECT MAX(blocked_until) FROM login_throttles WHERE throttle_key IN ($1, $2)),
+			(SELECT locked_until FROM users WHERE username = $3)
+		)`, ipKey(ip), usernameKey(username), username).Scan(&blockedUntil)
+	if err != nil {
+		return 0, err
+	}
+
+	if blockedUntil.Valid && blockedUntil.Time.After(time.Now()) {
+		return time.Until(blockedUntil.Time), nil
+	}
+	return 0, nil
+}
+
+// RecordFailure counts a failed login. When the username reaches the configured number
+// of failures an existing account is locked and the lockout is audited.
+func (t *LoginThrottle) RecordFailure(ip, username string) error {
+	ipFailures, err := t.increment(ipKey(ip), t.Config.IPFreeAttempts)
+	if err != nil {
+		return err
+	}
+
+	userFailures, err := t.increment(usernameKey(username), usernameFreeAttempts)
+	if err != nil {
+		return err
+	}
+
+	if ipFailures > t.Config.IPFreeAttempts {
+		log.Printf("Login backoff for IP %s after %d failures", ip, ipFailures)
+	}
+
+	if userFailures < t.Config.MaxFailures {
+		return nil
+	}
+
+	var userID int
+	err = t.DB.QueryRow(`
+		UPDATE users SET locked_until = $1
+		WHERE username = $2 AND (locked_until IS NULL OR locked_until < NOW())
+		RETURNING id`, time.Now().Add(t.Config.LockoutDuration), username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil // Unknown user or already locked
+	}
+	if err != nil {
+		return err
+	}
+
+	// The counter starts over so the account is not locked again right after the lockout
+	if _, err := t.DB.Exec("DELETE FROM login_throttles WHERE throttle_key = $1", usernameKey(username)); err != nil {
+		return err
+	}
+
+	log.Printf("Account %s locked for %s after %d failed logins", username, t.Config.LockoutDuration, userFailures)
+	RecordAudit(t.DB, models.AuditLog{
+		Action:       "auth.lockout",
+		ResourceType: "user",
+		ResourceID:   strconv.Itoa(userID),
+		IPAddress:    ip,
+		Details: map[string]interface{}{
+			"username":        username,
+			"failures":        userFailures,
+			"locked_for":      t.Config.LockoutDuration.String(),
+			"last_attempt_ip": ip,
+		},
+	})
+	return nil
+}
+
+// RecordSuccess clears the username counter after a successful login. The IP counter is
+// left to expire so one valid account cannot be used to reset it.
+func (t *LoginThrottle) RecordSuccess(username string) error {
+	_, err := t.DB.Exec("DELETE FROM login_throttles WHERE throttle_key = $1", usernameKey(username))
+	return err
+}
+
+// Unlock lifts a lockout and clears the user's failure counter
+func (t *LoginThrottle) Unlock(userID int) (string, error) {
+	var username string
+	err := t.DB.QueryRow(`
+		UPDATE users SET locked_until = NULL
+		WHERE id = $1
+		RETURNING username`, userID).Scan(&username)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = t.DB.Exec("DELETE FROM login_throttles WHERE throttle_key = $1", usernameKey(username))
+	return username, err
+}
+
+// Cleanup removes counters that are past the failure window and no longer block anyone
+func (t *LoginThrottle) Cleanup() error {
+	_, err := t.DB.Exec(`
+		DELETE FROM login_throttles
+		WHERE last_failure_at < $1 AND (blocked_until IS NULL OR blocked_until < NOW())`,
+		time.Now().Add(-failureWindow))
+	return err
+}
+
+// increment adds a failure to a counter and sets its backoff; returns the failure count
+func (t *LoginThrottle) increment(key string, freeAttempts int) (int, error) {
+	var failures int
+	err := t.DB.QueryRow(`
+		INSERT INTO login_throttles (throttle_key, failures, last_failure_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (throttle_key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < $2 THEN 1
+			                ELSE login_throttles.failures + 1 END,
+			last_failure_at = NOW()
+		RETURNING failures`, key, time.Now().Add(-failureWindow)).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+
+	if delay := t.backoff(failures, freeAttempts); delay > 0 {
+		_, err = t.DB.Exec(`
+			UPDATE login_throttles SET blocked_until = $1
+			WHERE throttle_key = $2`, time.Now().Add(delay), key)
+	}
+	return failures, err
+}
+
+// backoff returns BackoffBase * 2^(failures - freeAttempts - 1), capped at BackoffMax
+func (t *LoginThrottle) backoff(failures, freeAttempts int) time.Duration {
+	excess := failures - freeAttempts
+	if excess <= 0 {
+		return 0
+	}
+
+	delay := t.Config.BackoffBase
+	for i := 1; i < excess && delay < t.Config.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > t.Config.BackoffMax {
+		delay = t.Config.BackoffMax
+	}
+	return delay
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func usernameKey(username string) string {
+	key := "user:" + strings.ToLower(username)
+	if len(key) > 255 {
+		key = key[:255]
+	}
+	return key
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"api-monitor/config"
+)
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	throttle := &LoginThrottle{Config: config.LoginThrottleConfig{
+		BackoffBase: time.Second,
+		BackoffMax:  time.Minute,
+	}}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0}, // still within the free attempts
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{8, 32 * time.Second},
+		{9, time.Minute}, // 64s is capped
+		{1000, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := throttle.backoff(tt.failures, 2); got != tt.want {
+			t.Errorf("backoff(%d, 2) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottleKeys(t *testing.T) {
+	if got := usernameKey("Alice"); got != "user:alice" {
+		t.Errorf("usernameKey(Alice) = %q, want user:alice", got)
+	}
+	if usernameKey("alice") != usernameKey("ALICE") {
+		t.Error("username keys must not depend on case")
+	}
+	if got := usernameKey(strings.Repeat("a", 400)); len(got) != 255 {
+		t.Errorf("long username key has %d bytes, want 255", len(got))
+	}
+	if ipKey("10.0.0.1") == usernameKey("10.0.0.1") {
+		t.Error("IP and username keys must not collide")
+	}
+}
@@ -3,9 +3,11 @@ package services
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"api-monitor/app/models"
 	"api-monitor/utils"
@@ -18,6 +20,12 @@ type MonitorService struct {
 	Cron       *cron.Cron
 	ActiveJobs map[int]cron.EntryID
 	JobMutex   sync.RWMutex
+	Tokens     *TokenManager
+	Results    *ResultWriter
+
+	// Latest status of each endpoint, its check log may still be queued
+	statusMutex sync.Mutex
+	lastStatus  map[int]string
 }
 
 func NewMonitorService(db *sql.DB) *MonitorService {
@@ -25,6 +33,9 @@ func NewMonitorService(db *sql.DB) *MonitorService {
 		DB:         db,
 		Cron:       cron.New(),
 		ActiveJobs: make(map[int]cron.EntryID),
+		Tokens:     NewTokenManager(db),
+		Results:    NewResultWriter(db),
+		lastStatus: make(map[int]string),
 	}
 }
 
@@ -32,27 +43,32 @@ func (m *MonitorService) Start() {
 	m.Cron.Start()
 	m.LoadActiveEndpoints()
 
-	// Schedule daily cleanup of old logs (run at 2 AM)
+	// Look for late heartbeats twice a minute
+	m.Cron.AddFunc("@every 30s", m.CheckHeartbeats)
+
+	// Schedule daily cleanup of old logs and expired sessions (run at 2 AM)
 	m.Cron.AddFunc("0 2 * * *", func() {
 		m.CleanupOldLogs()
+		m.CleanupExpiredSessions()
 	})
 
 	// Run initial cleanup
-	go m.CleanupOldLogs()
+	go func() {
+		m.CleanupOldLogs()
+		m.CleanupExpiredSessions()
+	}()
 }
 
+// Stop waits for running checks, writes their queued logs and closes the connections kept
+// open for the next checks
 func (m *MonitorService) Stop() {
-	m.Cron.Stop()
+	<-m.Cron.Stop().Done()
+	m.Results.Close()
+	utils.CloseTransports()
 }
 
 func (m *MonitorService) LoadActiveEndpoints() {
-	rows, err := m.DB.Query(`
-		SELECT e.id, e.name, e.url, e.method, COALESCE(e.headers, '{}'), COALESCE(e.body, ''), 
-		       e.timeout_seconds, e.check_interval_seconds, e.proxy_id,
-		       p.host, p.port, p.username, p.password
-		FROM api_endpoints e
-		LEFT JOIN proxies p ON e.proxy_id = p.id AND p.is_active = true
-		WHERE e.is_active = true`)
+	rows, err := m.DB.Query(EndpointSelect + ` WHERE e.is_active = true`)
 	if err != nil {
 		log.Printf("Error loading active endpoints: %v", err)
 		return
@@ -60,35 +76,12 @@ func (m *MonitorService) LoadActiveEndpoints() {
 	defer rows.Close()
 
 	for rows.Next() {
-		var endpoint models.APIEndpoint
-		var proxy models.Proxy
-		var headersJSON string
-		var proxyID sql.NullInt64
-		var proxyHost, proxyUsername, proxyPassword sql.NullString
-		var proxyPort sql.NullInt64
-
-		err := rows.Scan(&endpoint.ID, &endpoint.Name, &endpoint.URL, &endpoint.Method,
-			&headersJSON, &endpoint.Body, &endpoint.TimeoutSeconds, &endpoint.CheckIntervalSeconds, &proxyID,
-			&proxyHost, &proxyPort, &proxyUsername, &proxyPassword)
+		endpoint, err := ScanEndpoint(rows)
 		if err != nil {
 			log.Printf("Error scanning endpoint: %v", err)
 			continue
 		}
 
-		json.Unmarshal([]byte(headersJSON), &endpoint.Headers)
-
-		// Set proxy data if available
-		if proxyID.Valid {
-			endpoint.ProxyID = &[]int{int(proxyID.Int64)}[0]
-			if proxyHost.Valid {
-				proxy.Host = proxyHost.String
-				proxy.Port = int(proxyPort.Int64)
-				proxy.Username = proxyUsername.String
-				proxy.Password = proxyPassword.String
-				endpoint.Proxy = &proxy
-			}
-		}
-
 		m.ScheduleEndpoint(endpoint)
 	}
 }
@@ -100,6 +93,13 @@ func (m *MonitorService) ScheduleEndpoint(endpoint models.APIEndpoint) {
 	// Remove existing job if any
 	if entryID, exists := m.ActiveJobs[endpoint.ID]; exists {
 		m.Cron.Remove(entryID)
+		delete(m.ActiveJobs, endpoint.ID)
+	}
+
+	// Heartbeats are not polled, CheckHeartbeats watches for missing pings
+	if endpoint.Type == models.EndpointTypeHeartbeat {
+		log.Printf("Heartbeat %s expects a ping every %d seconds", endpoint.Name, endpoint.CheckIntervalSeconds)
+		return
 	}
 
 	// Schedule new job
@@ -125,26 +125,85 @@ func (m *MonitorService) UnscheduleEndpoint(endpointID int) {
 		m.Cron.Remove(entryID)
 		delete(m.ActiveJobs, endpointID)
 	}
+
+	m.statusMutex.Lock()
+	delete(m.lastStatus, endpointID)
+	m.statusMutex.Unlock()
+}
+
+// PrepareRequest renders the endpoint templates, applies its auth profile and
+// attaches its TLS profile to the endpoint
+func (m *MonitorService) PrepareRequest(endpoint *models.APIEndpoint) (*utils.RenderedRequest, error) {
+	if endpoint.TLSProfileID != nil {
+		profile, err := FindTLSProfile(m.DB, *endpoint.TLSProfileID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading TLS profile %d: %v", *endpoint.TLSProfileID, err)
+		}
+		endpoint.TLSProfile = &profile
+	}
+
+	rendered, err := utils.RenderRequest(*endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.Tokens.Apply(*endpoint, rendered); err != nil {
+		return rendered, err
+	}
+
+	return rendered, nil
 }
 
 func (m *MonitorService) checkEndpoint(endpoint models.APIEndpoint) {
-	statusCode, responseTimeMs, responseBody, responseHeaders, err := utils.CheckEndpoint(endpoint)
+	rendered, err := m.PrepareRequest(&endpoint)
+	if err != nil {
+		// Credential problems are reported separately from endpoint failures
+		status := models.EndpointStatusDown
+		var authErr *AuthError
+		if errors.As(err, &authErr) {
+			status = models.EndpointStatusAuthError
+			log.Printf("Auth error for endpoint %s: %v", endpoint.Name, err)
+		} else {
+			log.Printf("Error preparing request for endpoint %s: %v", endpoint.Name, err)
+		}
+		m.logCheck(endpoint, status, 0, 0, "", "", err.Error(), nil, nil)
+		return
+	}
+
+	result, err := utils.CheckRenderedRequest(endpoint, rendered)
+	statusCode, responseTimeMs, responseBody := result.StatusCode, result.DurationMs, result.Body
 
 	errorMessage := ""
+	var schemaErrors []models.SchemaError
 	if err != nil {
-		errorMessage = err.Error()
-		log.Printf("Error checking endpoint %s: %v", endpoint.Name, err)
+		errorMessage = rendered.Redact(err.Error())
+		log.Printf("Error checking endpoint %s: %s", endpoint.Name, errorMessage)
 	} else {
 		log.Printf("Checked %s: %d (%dms)", endpoint.Name, statusCode, responseTimeMs)
+
+		// A successful response with the wrong shape fails the check
+		schemaErrors, errorMessage = CheckResponseSchema(m.DB, endpoint, statusCode, responseBody)
+		errorMessage = rendered.Redact(errorMessage)
+		for i := range schemaErrors {
+			schemaErrors[i].Message = rendered.Redact(schemaErrors[i].Message)
+		}
 	}
 
-	m.logCheck(endpoint.ID, statusCode, responseTimeMs, responseBody, responseHeaders, errorMessage)
+	// Secret template values and credentials must never reach the check logs
+	rendered.RedactDetails(result.Details)
+	m.logCheck(endpoint, CheckStatus(statusCode, errorMessage), statusCode, responseTimeMs,
+		rendered.Redact(responseBody), rendered.Redact(result.Headers), errorMessage, schemaErrors, result.Details)
 }
 
-func (m *MonitorService) logCheck(endpointID, statusCode, responseTimeMs int, responseBody, responseHeaders, errorMessage string) {
+// logCheck queues a check result, together with the endpoint version that produced it,
+// for the result writer. A failed check is stored as blocked while a dependency of the
+// endpoint is down, and status changes are reported unless the endpoint is blocked.
+func (m *MonitorService) logCheck(endpoint models.APIEndpoint, status string, statusCode, responseTimeMs int, responseBody, responseHeaders, errorMessage string, schemaErrors []models.SchemaError, details *models.CheckDetails) {
 	// Clean strings to ensure UTF-8 compatibility
 	cleanResponseBody := utils.ValidateUTF8(responseBody)
+	fullBody := cleanResponseBody
 	cleanResponseHeaders := utils.ValidateUTF8(responseHeaders)
+	fullHeaders := cleanResponseHeaders
 	cleanErrorMessage := utils.ValidateUTF8(errorMessage)
 
 	// Limit response body size to prevent database issues
@@ -157,13 +216,128 @@ func (m *MonitorService) logCheck(endpointID, statusCode, responseTimeMs int, re
 		cleanResponseHeaders = cleanResponseHeaders[:2000] + "..."
 	}
 
-	_, err := m.DB.Exec(`
-		INSERT INTO api_check_logs (endpoint_id, status_code, response_time_ms, response_body, response_headers, error_message)
-		VALUES ($1, $2, $3, $4, $5, $6)`,
-		endpointID, statusCode, responseTimeMs, cleanResponseBody, cleanResponseHeaders, cleanErrorMessage)
+	// NULL when the response was not validated
+	var schemaErrorsJSON interface{}
+	if schemaErrors != nil {
+		encoded, _ := json.Marshal(schemaErrors)
+		schemaErrorsJSON = string(encoded)
+	}
+
+	// NULL when no request was sent
+	var detailsJSON interface{}
+	if details != nil {
+		encoded, _ := json.Marshal(details)
+		detailsJSON = utils.ValidateUTF8(string(encoded))
+	}
+
+	var blocker *models.EndpointGraphNode
+	var blockedBy *int
+	if status == models.EndpointStatusDown {
+		var err error
+		if blocker, err = BlockingDependency(m.DB, endpoint.ID, m.knownStatus); err != nil {
+			log.Printf("Error checking the dependencies of endpoint %s: %v", endpoint.Name, err)
+		} else if blocker != nil {
+			status = models.EndpointStatusBlocked
+			blockedBy = &blocker.ID
+		}
+	}
+
+	previous := m.swapStatus(endpoint, status)
+
+	row := checkLogRow{
+		EndpointID:      endpoint.ID,
+		EndpointVersion: endpoint.Version,
+		StatusCode:      statusCode,
+		ResponseTimeMs:  responseTimeMs,
+		ResponseBody:    cleanResponseBody,
+		ResponseHeaders: cleanResponseHeaders,
+		ErrorMessage:    cleanErrorMessage,
+		Status:          status,
+		BlockedBy:       blockedBy,
+		SchemaErrors:    schemaErrorsJSON,
+		Details:         detailsJSON,
+		CheckedAt:       time.Now(),
+	}
+
+	// The log keeps an excerpt, the full response is stored apart when the endpoint asks for it
+	if capturesResponse(endpoint.ResponseCapture, status) {
+		row.Capture = &responseCapture{
+			Endpoint:   endpoint,
+			StatusCode: statusCode,
+			Headers:    fullHeaders,
+			Body:       fullBody,
+		}
+	}
+
+	// Only successful responses are compared, error pages would look like changes. Changes
+	// point at the check log, so the comparison waits until the log is written.
+	if status == models.EndpointStatusUp && endpoint.ContentTracking.Enabled && endpoint.Type == models.EndpointTypeHTTP {
+		row.Stored = func(logID int) {
+			m.trackContent(endpoint, logID, fullBody)
+		}
+	}
+	m.Results.Write(row)
+
+	if status != previous {
+		m.statusChanged(endpoint, previous, status, blocker)
+	}
+}
+
+// swapStatus records the status of an endpoint's latest check and returns the one before.
+// Statuses are kept in memory because check logs are written in batches; the first check
+// of an endpoint after a restart reads the previous status from its logs.
+func (m *MonitorService) swapStatus(endpoint models.APIEndpoint, status string) string {
+	m.statusMutex.Lock()
+	previous, ok := m.lastStatus[endpoint.ID]
+	if ok {
+		m.lastStatus[endpoint.ID] = status
+	}
+	m.statusMutex.Unlock()
+	if ok {
+		return previous
+	}
 
+	// Loaded without holding the lock, so checks of other endpoints do not wait for it
+	stored, err := LastCheckStatus(m.DB, endpoint.ID)
 	if err != nil {
-		log.Printf("Error logging check: %v", err)
+		log.Printf("Error loading the last status of endpoint %s: %v", endpoint.Name, err)
+	}
+
+	m.statusMutex.Lock()
+	defer m.statusMutex.Unlock()
+	previous, ok = m.lastStatus[endpoint.ID]
+	if !ok {
+		previous = stored
+	}
+	m.lastStatus[endpoint.ID] = status
+	return previous
+}
+
+// knownStatus returns the status of an endpoint's latest check when it was made since start
+func (m *MonitorService) knownStatus(endpointID int) (string, bool) {
+	m.statusMutex.Lock()
+	defer m.statusMutex.Unlock()
+	status, ok := m.lastStatus[endpointID]
+	return status, ok
+}
+
+// statusChanged reports an endpoint going down or recovering. Blocked endpoints are not
+// reported: the alert for the dependency that is down covers them. Auth errors are
+// reported as a problem of the auth profile, not as an outage of the endpoint.
+func (m *MonitorService) statusChanged(endpoint models.APIEndpoint, previous, status string, blocker *models.EndpointGraphNode) {
+	switch {
+	case status == models.EndpointStatusBlocked:
+		log.Printf("Endpoint %s is blocked by dependency %s, alert suppressed", endpoint.Name, blocker.Name)
+	case status == models.EndpointStatusAuthError:
+		log.Printf("AUTH: credentials of endpoint %s could not be acquired, endpoint not checked", endpoint.Name)
+	case status == models.EndpointStatusDown:
+		log.Printf("ALERT: endpoint %s is down", endpoint.Name)
+	case previous == models.EndpointStatusDown:
+		log.Printf("ALERT: endpoint %s recovered", endpoint.Name)
+	case previous == models.EndpointStatusBlocked:
+		log.Printf("Endpoint %s is no longer blocked", endpoint.Name)
+	case previous == models.EndpointStatusAuthError:
+		log.Printf("AUTH: credentials of endpoint %s work again", endpoint.Name)
 	}
 }
 
@@ -179,4 +353,46 @@ func (m *MonitorService) CleanupOldLogs() {
 		rowsAffected, _ := result.RowsAffected()
 		log.Printf("Cleaned up %d logs older than 30 days", rowsAffected)
 	}
+
+	// Stored responses go with their logs
+	result, err = m.DB.Exec(`
+		DELETE FROM response_captures
+		WHERE captured_at < NOW() - INTERVAL '30 days'`)
+	if err != nil {
+		log.Printf("Error cleaning up old stored responses: %v", err)
+	} else {
+		rowsAffected, _ := result.RowsAffected()
+		log.Printf("Cleaned up %d stored responses older than 30 days", rowsAffected)
+	}
+}
+
+// CleanupExpiredSessions removes sessions that can no longer be refreshed and
+// blacklist entries for access tokens that have expired anyway
+func (m *MonitorService) CleanupExpiredSessions() {
+	result, err := m.DB.Exec(`
+		DELETE FROM user_sessions
+		WHERE expires_at < NOW()
+		   OR (revoked_at IS NOT NULL AND (access_expires_at IS NULL OR access_expires_at < NOW()))`)
+	if err != nil {
+		log.Printf("Error cleaning up expired sessions: %v", err)
+	} else {
+		rowsAffected, _ := result.RowsAffected()
+		log.Printf("Cleaned up %d expired sessions", rowsAffected)
+	}
+
+	if _, err := m.DB.Exec("DELETE FROM blacklisted_tokens WHERE expires_at < NOW()"); err != nil {
+		log.Printf("Error cleaning up blacklisted tokens: %v", err)
+	}
+
+	if _, err := m.DB.Exec("DELETE FROM oidc_logins WHERE expires_at < NOW()"); err != nil {
+		log.Printf("Error cleaning up OIDC logins: %v", err)
+	}
+
+	if _, err := m.DB.Exec("DELETE FROM login_challenges WHERE expires_at < NOW()"); err != nil {
+		log.Printf("Error cleaning up login challenges: %v", err)
+	}
+
+	if err := NewLoginThrottle(m.DB).Cleanup(); err != nil {
+		log.Printf("Error cleaning up login throttles: %v", err)
+	}
 }
@@ -0,0 +1,604 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"api-monitor/app/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Database defaults of api_endpoints, used when a document leaves the values out
+const (
+	defaultTimeoutSeconds       = 30
+	defaultCheckIntervalSeconds = 300
+)
+
+// ParseMonitorDocument reads a monitor document in JSON or YAML. Unknown fields are
+// rejected so a typo does not silently drop a setting.
+func ParseMonitorDocument(data []byte) (models.MonitorDocument, error) {
+	var document models.MonitorDocument
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&document); err != nil {
+			return document, fmt.Errorf("invalid JSON: %v", err)
+		}
+		return document, nil
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&document); err != nil {
+		return document, fmt.Errorf("invalid YAML: %v", err)
+	}
+	return document, nil
+}
+
+// ExportMonitorDocument returns the endpoints and proxies of a team as a monitor document,
+// sorted by key and name so repeated exports of the same state are identical
+func ExportMonitorDocument(db *sql.DB, teamID int) (models.MonitorDocument, error) {
+	now := time.Now().UTC()
+	document := models.MonitorDocument{
+		Version:    models.MonitorDocumentVersion,
+		ExportedAt: &now,
+		Proxies:    []models.DocumentProxy{},
+		Endpoints:  []models.DocumentEndpoint{},
+	}
+
+	refs, err := loadDocumentRefs(db, teamID)
+	if err != nil {
+		return document, err
+	}
+
+	for _, proxy := range refs.proxies {
+		if proxy.TeamID == nil || *proxy.TeamID != teamID {
+			continue
+		}
+		documentProxy := DocumentProxyOf(proxy)
+		documentProxy.Password = ""
+		document.Proxies = append(document.Proxies, documentProxy)
+	}
+	sort.Slice(document.Proxies, func(i, j int) bool { return document.Proxies[i].Name < document.Proxies[j].Name })
+
+	endpoints, err := teamEndpoints(db, teamID)
+	if err != nil {
+		return document, err
+	}
+	for _, endpoint := range endpoints {
+		document.Endpoints = append(document.Endpoints, refs.documentEndpointOf(endpoint))
+	}
+	sort.Slice(document.Endpoints, func(i, j int) bool { return document.Endpoints[i].Key < document.Endpoints[j].Key })
+
+	return document, nil
+}
+
+// PlanImport compares a monitor document with the endpoints and proxies of a team and
+// returns the changes importing it would make. Existing endpoints are matched by key and
+// proxies by name; resources missing from the document are left alone.
+func PlanImport(db *sql.DB, teamID int, document models.MonitorDocument) (models.ImportPlan, error) {
+	plan := models.ImportPlan{
+		Summary: map[string]int{
+			models.ImportActionCreate:    0,
+			models.ImportActionUpdate:    0,
+			models.ImportActionUnchanged: 0,
+		},
+		Changes: []models.ImportChange{},
+		Errors:  ValidateMonitorDocument(document),
+	}
+	if len(plan.Errors) > 0 {
+		return plan, nil
+	}
+
+	refs, err := loadDocumentRefs(db, teamID)
+	if err != nil {
+		return plan, err
+	}
+
+	documentProxies := map[string]bool{}
+	for i := range document.Proxies {
+		desired := NormalizeDocumentProxy(document.Proxies[i])
+		documentProxies[desired.Name] = true
+
+		change := models.ImportChange{ResourceType: "proxy", Key: desired.Name, Proxy: &desired}
+
+		current, exists := refs.proxiesByName[desired.Name]
+		switch {
+		case !exists:
+			change.Action = models.ImportActionCreate
+		case current.TeamID == nil || *current.TeamID != teamID:
+			plan.Errors = append(plan.Errors, fmt.Sprintf("proxy %q: the name is used by a proxy of another team", desired.Name))
+			continue
+		default:
+			if desired.Password == "" {
+				desired.Password = current.Password
+			}
+			change.ID = current.ID
+			change.Changes = AuditDiff(DocumentState(DocumentProxyOf(current)), DocumentState(desired))
+			change.Action = models.ImportActionUpdate
+			if len(change.Changes) == 0 {
+				change.Action = models.ImportActionUnchanged
+			}
+		}
+
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	endpoints, err := teamEndpoints(db, teamID)
+	if err != nil {
+		return plan, err
+	}
+	currentByKey := map[string]models.APIEndpoint{}
+	for _, endpoint := range endpoints {
+		currentByKey[endpoint.Key] = endpoint
+	}
+
+	for i := range document.Endpoints {
+		desired := NormalizeDocumentEndpoint(document.Endpoints[i])
+		change := models.ImportChange{ResourceType: "endpoint", Key: desired.Key, Endpoint: &desired}
+		where := fmt.Sprintf("endpoint %q", desired.Key)
+
+		if desired.Proxy != "" && !documentProxies[desired.Proxy] {
+			proxy, exists := refs.proxiesByName[desired.Proxy]
+			if !exists || proxy.TeamID == nil || *proxy.TeamID != teamID {
+				plan.Errors = append(plan.Errors, fmt.Sprintf("%s: proxy %q not found in the team", where, desired.Proxy))
+			}
+		}
+		if desired.AuthProfile != "" {
+			id, exists := refs.authProfileIDs[desired.AuthProfile]
+			if !exists {
+				plan.Errors = append(plan.Errors, fmt.Sprintf("%s: auth profile %q not found in the team", where, desired.AuthProfile))
+			}
+			change.AuthProfileID = &id
+		}
+		if desired.TLSProfile != "" {
+			id, exists := refs.tlsProfileIDs[desired.TLSProfile]
+			if !exists {
+				plan.Errors = append(plan.Errors, fmt.Sprintf("%s: TLS profile %q not found in the team", where, desired.TLSProfile))
+			}
+			change.TLSProfileID = &id
+		}
+		if desired.Schema != "" {
+			id, exists := refs.schemaIDs[desired.Schema]
+			if !exists {
+				plan.Errors = append(plan.Errors, fmt.Sprintf("%s: JSON schema %q not found in the team", where, desired.Schema))
+			}
+			change.SchemaID = &id
+		}
+
+		if current, exists := currentByKey[desired.Key]; exists {
+			change.ID = current.ID
+			change.Changes = AuditDiff(DocumentState(refs.documentEndpointOf(current)), DocumentState(desired))
+			change.Action = models.ImportActionUpdate
+			if len(change.Changes) == 0 {
+				change.Action = models.ImportActionUnchanged
+			}
+		} else {
+			change.Action = models.ImportActionCreate
+		}
+
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	for _, change := range plan.Changes {
+		plan.Summary[change.Action]++
+	}
+	return plan, nil
+}
+
+// ProxyFromDocument returns the proxy row for a planned proxy change
+func ProxyFromDocument(change models.ImportChange, teamID int) models.Proxy {
+	return models.Proxy{
+		Name:     change.Proxy.Name,
+		Host:     change.Proxy.Host,
+		Port:     change.Proxy.Port,
+		Username: change.Proxy.Username,
+		Password: change.Proxy.Password,
+		IsActive: *change.Proxy.IsActive,
+		TeamID:   &teamID,
+	}
+}
+
+// EndpointFromDocument returns the endpoint row for a planned endpoint change; proxyID is
+// the id of the proxy named in the document, if any
+func EndpointFromDocument(change models.ImportChange, teamID int, proxyID *int) models.APIEndpoint {
+	desired := change.Endpoint
+	endpointType := desired.Type
+	if endpointType == "" {
+		endpointType = models.EndpointTypeHTTP
+	}
+	var tracking models.ContentTracking
+	if desired.ContentTracking != nil {
+		tracking = *desired.ContentTracking
+	}
+	var capture models.ResponseCapture
+	if desired.ResponseCapture != nil {
+		capture = *desired.ResponseCapture
+	}
+	var transport models.TransportOptions
+	if desired.Transport != nil {
+		transport = *desired.Transport
+	}
+
+	return models.APIEndpoint{
+		ID:                   change.ID,
+		Key:                  desired.Key,
+		Type:                 endpointType,
+		Name:                 desired.Name,
+		URL:                  desired.URL,
+		Method:               desired.Method,
+		Headers:              desired.Headers,
+		Body:                 desired.Body,
+		TimeoutSeconds:       desired.TimeoutSeconds,
+		CheckIntervalSeconds: desired.CheckIntervalSeconds,
+		GraceSeconds:         desired.GraceSeconds,
+		IsActive:             *desired.IsActive,
+		ProxyID:              proxyID,
+		AuthProfileID:        change.AuthProfileID,
+		TLSProfileID:         change.TLSProfileID,
+		TeamID:               &teamID,
+		Labels:               desired.Labels,
+		Group:                desired.Group,
+		ContentTracking:      tracking,
+		ResponseCapture:      capture,
+		Transport:            transport,
+		ResponseSchema:       desired.ResponseSchema,
+		ResponseSchemaID:     change.SchemaID,
+	}
+}
+
+// ValidateMonitorDocument checks a document on its own, before it is compared with the
+// existing resources, and returns its problems
+func ValidateMonitorDocument(document models.MonitorDocument) []string {
+	errors := []string{}
+	if document.Version != models.MonitorDocumentVersion {
+		errors = append(errors, fmt.Sprintf("unsupported document version %d, expected %d",
+			document.Version, models.MonitorDocumentVersion))
+	}
+
+	proxyNames := map[string]bool{}
+	for i, proxy := range document.Proxies {
+		where := fmt.Sprintf("proxies[%d]", i)
+		if proxy.Name != "" {
+			where = fmt.Sprintf("proxy %q", proxy.Name)
+		}
+
+		switch {
+		case proxy.Name == "" || proxy.Host == "":
+			errors = append(errors, where+": name and host are required")
+		case proxy.Port < 1 || proxy.Port > 65535:
+			errors = append(errors, where+": port must be between 1 and 65535")
+		case proxyNames[proxy.Name]:
+			errors = append(errors, where+": duplicate proxy name")
+		}
+		proxyNames[proxy.Name] = true
+	}
+
+	keys := map[string]bool{}
+	for i, endpoint := range document.Endpoints {
+		where := fmt.Sprintf("endpoints[%d]", i)
+		if endpoint.Key != "" {
+			where = fmt.Sprintf("endpoint %q", endpoint.Key)
+		}
+
+		switch {
+		case !ValidEndpointKey(endpoint.Key):
+			errors = append(errors, where+": key is required and may only contain lower case letters, digits, '.', '-' and '_'")
+		case keys[endpoint.Key]:
+			errors = append(errors, where+": duplicate key")
+		case endpoint.Type != "" && endpoint.Type != models.EndpointTypeHTTP && endpoint.Type != models.EndpointTypeHeartbeat:
+			errors = append(errors, where+": type must be http or heartbeat")
+		case endpoint.Name == "" || (endpoint.URL == "" && endpoint.Type != models.EndpointTypeHeartbeat):
+			errors = append(errors, where+": name and url are required")
+		case endpoint.TimeoutSeconds < 0 || endpoint.CheckIntervalSeconds < 0 || endpoint.GraceSeconds < 0:
+			errors = append(errors, where+": timeout_seconds, check_interval_seconds and grace_seconds cannot be negative")
+		}
+
+		if tracking := endpoint.ContentTracking; tracking != nil {
+			if tracking.Enabled && endpoint.Type == models.EndpointTypeHeartbeat {
+				errors = append(errors, where+": content_tracking is only available for http endpoints")
+			}
+			if err := ValidateContentTracking(*tracking); err != nil {
+				errors = append(errors, where+": "+err.Error())
+			}
+		}
+
+		if endpoint.ResponseCapture != nil {
+			if err := ValidateResponseCapture(*endpoint.ResponseCapture); err != nil {
+				errors = append(errors, where+": "+err.Error())
+			}
+		}
+
+		if transport := endpoint.Transport; transport != nil {
+			if endpoint.Type == models.EndpointTypeHeartbeat && !UsesDefaultTransport(*transport) {
+				errors = append(errors, where+": transport is only available for http endpoints")
+			}
+			if err := ValidateTransportOptions(NormalizeTransportOptions(*transport)); err != nil {
+				errors = append(errors, where+": "+err.Error())
+			}
+		}
+
+		if endpoint.ResponseSchema != nil || endpoint.Schema != "" {
+			switch {
+			case endpoint.Type == models.EndpointTypeHeartbeat:
+				errors = append(errors, where+": response schemas are only available for http endpoints")
+			case endpoint.ResponseSchema != nil && endpoint.Schema != "":
+				errors = append(errors, where+": use either response_schema or schema")
+			case endpoint.ResponseSchema != nil:
+				if _, err := CompileSchema(endpoint.ResponseSchema); err != nil {
+					errors = append(errors, where+": response_schema is not a valid JSON Schema: "+err.Error())
+				}
+			}
+		}
+
+		if err := ValidateLabels(endpoint.Labels); err != nil {
+			errors = append(errors, where+": "+err.Error())
+		}
+		if _, err := NormalizeGroup(endpoint.Group); err != nil {
+			errors = append(errors, where+": "+err.Error())
+		}
+		keys[endpoint.Key] = true
+
+		if endpoint.URL != "" {
+			if parsed, err := url.Parse(endpoint.URL); err != nil || parsed.Host == "" {
+				errors = append(errors, where+": url must be absolute")
+			}
+		}
+	}
+
+	return errors
+}
+
+// NormalizeDocumentProxy fills in the defaults of a document proxy
+func NormalizeDocumentProxy(proxy models.DocumentProxy) models.DocumentProxy {
+	if proxy.IsActive == nil {
+		active := true
+		proxy.IsActive = &active
+	}
+	return proxy
+}
+
+// NormalizeDocumentEndpoint fills in the defaults of a document endpoint so it can be
+// compared with a stored one
+func NormalizeDocumentEndpoint(endpoint models.DocumentEndpoint) models.DocumentEndpoint {
+	// http is the default and left out, like in exports
+	if endpoint.Type == models.EndpointTypeHTTP {
+		endpoint.Type = ""
+	}
+	endpoint.Method = strings.ToUpper(endpoint.Method)
+	if endpoint.Method == "" {
+		endpoint.Method = "GET"
+	}
+	if endpoint.Headers == nil {
+		endpoint.Headers = map[string]string{}
+	}
+	if endpoint.Labels == nil {
+		endpoint.Labels = map[string]string{}
+	}
+	if group, err := NormalizeGroup(endpoint.Group); err == nil {
+		endpoint.Group = group
+	}
+	if endpoint.TimeoutSeconds == 0 {
+		endpoint.TimeoutSeconds = defaultTimeoutSeconds
+	}
+	if endpoint.CheckIntervalSeconds == 0 {
+		endpoint.CheckIntervalSeconds = defaultCheckIntervalSeconds
+	}
+	if endpoint.IsActive == nil {
+		active := true
+		endpoint.IsActive = &active
+	}
+	if endpoint.ContentTracking != nil && !endpoint.ContentTracking.Enabled {
+		endpoint.ContentTracking = nil
+	}
+	if endpoint.ResponseCapture != nil {
+		capture := *endpoint.ResponseCapture
+		if capture.Mode == models.CaptureNone {
+			capture.Mode = ""
+		}
+		endpoint.ResponseCapture = &capture
+		if capture == (models.ResponseCapture{}) {
+			endpoint.ResponseCapture = nil
+		}
+	}
+	if endpoint.Transport != nil {
+		transport := NormalizeTransportOptions(*endpoint.Transport)
+		endpoint.Transport = &transport
+		if UsesDefaultTransport(transport) {
+			endpoint.Transport = nil
+		}
+	}
+	return endpoint
+}
+
+// DocumentState turns a normalized document entry into the generic form compared by
+// AuditDiff, which also redacts secrets such as proxy passwords and Authorization headers
+func DocumentState(value interface{}) map[string]interface{} {
+	encoded, _ := json.Marshal(value)
+
+	var state map[string]interface{}
+	json.Unmarshal(encoded, &state)
+
+	// Omitted values are compared as empty so clearing a field shows up as a change
+	for _, field := range []string{"username", "password", "body", "proxy", "auth_profile", "tls_profile", "schema", "group", "type", "url"} {
+		if _, ok := state[field]; !ok {
+			state[field] = ""
+		}
+	}
+	for _, field := range []string{"headers", "labels"} {
+		if _, ok := state[field]; !ok {
+			state[field] = map[string]interface{}{}
+		}
+	}
+	return state
+}
+
+// DocumentProxyOf returns a stored proxy as a document entry, including its password
+func DocumentProxyOf(proxy models.Proxy) models.DocumentProxy {
+	active := proxy.IsActive
+	return models.DocumentProxy{
+		Name:     proxy.Name,
+		Host:     proxy.Host,
+		Port:     proxy.Port,
+		Username: proxy.Username,
+		Password: proxy.Password,
+		IsActive: &active,
+	}
+}
+
+// DocumentEndpointOf returns a stored endpoint as a normalized document entry; the proxy,
+// profiles and library schema are given by name
+func DocumentEndpointOf(endpoint models.APIEndpoint, proxy, authProfile, tlsProfile, schema string) models.DocumentEndpoint {
+	active := endpoint.IsActive
+	return NormalizeDocumentEndpoint(models.DocumentEndpoint{
+		Key:                  endpoint.Key,
+		Type:                 endpoint.Type,
+		Name:                 endpoint.Name,
+		URL:                  endpoint.URL,
+		Method:               endpoint.Method,
+		Headers:              endpoint.Headers,
+		Body:                 endpoint.Body,
+		TimeoutSeconds:       endpoint.TimeoutSeconds,
+		CheckIntervalSeconds: endpoint.CheckIntervalSeconds,
+		GraceSeconds:         endpoint.GraceSeconds,
+		IsActive:             &active,
+		Proxy:                proxy,
+		AuthProfile:          authProfile,
+		TLSProfile:           tlsProfile,
+		Group:                endpoint.Group,
+		Labels:               endpoint.Labels,
+		ContentTracking:      &endpoint.ContentTracking,
+		ResponseCapture:      &endpoint.ResponseCapture,
+		Transport:            &endpoint.Transport,
+		ResponseSchema:       endpoint.ResponseSchema,
+		Schema:               schema,
+	})
+}
+
+// documentRefs translates between the ids stored on endpoints and the names used in
+// documents. Profiles and schemas are those of the team; names of proxies are unique
+// across teams, so all proxies are loaded.
+type documentRefs struct {
+	proxies        []models.Proxy
+	proxiesByName  map[string]models.Proxy
+	proxyNames     map[int]string
+	authProfileIDs map[string]int
+	authProfiles   map[int]string
+	tlsProfileIDs  map[string]int
+	tlsProfiles    map[int]string
+	schemaIDs      map[string]int
+	schemas        map[int]string
+}
+
+func loadDocumentRefs(db *sql.DB, teamID int) (*documentRefs, error) {
+	refs := &documentRefs{
+		proxiesByName:  map[string]models.Proxy{},
+		proxyNames:     map[int]string{},
+		authProfileIDs: map[string]int{},
+		authProfiles:   map[int]string{},
+		tlsProfileIDs:  map[string]int{},
+		tlsProfiles:    map[int]string{},
+		schemaIDs:      map[string]int{},
+		schemas:        map[int]string{},
+	}
+
+	rows, err := db.Query(`
+		SELECT id, name, host, port, COALESCE(username, ''), COALESCE(password, ''),
+		       COALESCE(is_active, true), team_id
+		FROM proxies`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var proxy models.Proxy
+		var teamID sql.NullInt64
+		if err := rows.Scan(&proxy.ID, &proxy.Name, &proxy.Host, &proxy.Port, &proxy.Username,
+			&proxy.Password, &proxy.IsActive, &teamID); err != nil {
+			return nil, err
+		}
+		if teamID.Valid {
+			teamIDInt := int(teamID.Int64)
+			proxy.TeamID = &teamIDInt
+		}
+
+		refs.proxies = append(refs.proxies, proxy)
+		refs.proxiesByName[proxy.Name] = proxy
+		refs.proxyNames[proxy.ID] = proxy.Name
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, profiles := range []struct {
+		table string
+		ids   map[string]int
+		names map[int]string
+	}{
+		{"auth_profiles", refs.authProfileIDs, refs.authProfiles},
+		{"tls_profiles", refs.tlsProfileIDs, refs.tlsProfiles},
+		{"json_schemas", refs.schemaIDs, refs.schemas},
+	} {
+		rows, err := db.Query(`SELECT id, name FROM `+profiles.table+` WHERE team_id = $1`, teamID)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			profiles.ids[name] = id
+			profiles.names[id] = name
+		}
+		rows.Close()
+	}
+
+	return refs, nil
+}
+
+func (refs *documentRefs) documentEndpointOf(endpoint models.APIEndpoint) models.DocumentEndpoint {
+	var proxy, authProfile, tlsProfile, schema string
+	if endpoint.ProxyID != nil {
+		proxy = refs.proxyNames[*endpoint.ProxyID]
+	}
+	if endpoint.AuthProfileID != nil {
+		authProfile = refs.authProfiles[*endpoint.AuthProfileID]
+	}
+	if endpoint.TLSProfileID != nil {
+		tlsProfile = refs.tlsProfiles[*endpoint.TLSProfileID]
+	}
+	if endpoint.ResponseSchemaID != nil {
+		schema = refs.schemas[*endpoint.ResponseSchemaID]
+	}
+	return DocumentEndpointOf(endpoint, proxy, authProfile, tlsProfile, schema)
+}
+
+func teamEndpoints(db *sql.DB, teamID int) ([]models.APIEndpoint, error) {
+	rows, err := db.Query(EndpointSelect+` WHERE e.team_id = $1 ORDER BY e.key`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []models.APIEndpoint{}
+	for rows.Next() {
+		endpoint, err := ScanEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, rows.Err()
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"api-monitor/app/models"
+)
+
+func TestParseMonitorDocument(t *testing.T) {
+	jsonDocument := `{"version": 1, "proxies": [], "endpoints": [{"key": "orders", "name": "Orders", "url": "https://api.local/orders"}]}`
+	yamlDocument := `
+version: 1
+endpoints:
+  - key: orders
+    name: Orders
+    url: https://api.local/orders
+`
+	for name, data := range map[string]string{"JSON": jsonDocument, "YAML": yamlDocument} {
+		document, err := ParseMonitorDocument([]byte(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if document.Version != 1 || len(document.Endpoints) != 1 || document.Endpoints[0].URL != "https://api.local/orders" {
+			t.Errorf("%s: document = %+v", name, document)
+		}
+	}
+
+	// A typo must not silently drop a setting
+	for name, data := range map[string]string{
+		"JSON": `{"version": 1, "endpoints": [{"key": "a", "timeout_secs": 5}]}`,
+		"YAML": "version: 1\nendpoints:\n  - key: a\n    timeout_secs: 5\n",
+	} {
+		if _, err := ParseMonitorDocument([]byte(data)); err == nil {
+			t.Errorf("%s: an unknown field was accepted", name)
+		}
+	}
+}
+
+func TestValidateMonitorDocument(t *testing.T) {
+	valid := models.DocumentEndpoint{Key: "orders", Name: "Orders", URL: "https://api.local/orders"}
+
+	tests := []struct {
+		name     string
+		document models.MonitorDocument
+		want     []string // Parts of the expected errors, in order
+	}{
+		{"valid", models.MonitorDocument{
+			Version:   1,
+			Proxies:   []models.DocumentProxy{{Name: "corp", Host: "proxy.local", Port: 3128}},
+			Endpoints: []models.DocumentEndpoint{valid, {Key: "beat", Name: "Beat", Type: models.EndpointTypeHeartbeat}},
+		}, nil},
+		{"version", models.MonitorDocument{Version: 2}, []string{"unsupported document version 2"}},
+		{"proxies", models.MonitorDocument{Version: 1, Proxies: []models.DocumentProxy{
+			{Host: "proxy.local", Port: 3128},
+			{Name: "corp", Host: "proxy.local", Port: 70000},
+			{Name: "dup", Host: "a", Port: 1},
+			{Name: "dup", Host: "b", Port: 2},
+		}}, []string{"proxies[0]: name and host are required", `proxy "corp": port`, `proxy "dup": duplicate proxy name`}},
+		{"keys", models.MonitorDocument{Version: 1, Endpoints: []models.DocumentEndpoint{
+			valid, valid, {Key: "Orders!", Name: "x", URL: "https://a.local"},
+		}}, []string{`endpoint "orders": duplicate key`, `endpoint "Orders!": key is required`}},
+		{"fields", models.MonitorDocument{Version: 1, Endpoints: []models.DocumentEndpoint{
+			{Key: "a", Name: "A", URL: "https://a.local", Type: "grpc"},
+			{Key: "b", Name: "B"},
+			{Key: "c", Name: "C", URL: "https://a.local", TimeoutSeconds: -1},
+			{Key: "d", Name: "D", URL: "/relative"},
+		}}, []string{`"a": type must be http or heartbeat`, `"b": name and url are required`, `"c": timeout_seconds`, `"d": url must be absolute`}},
+	}
+	for _, tt := range tests {
+		errors := ValidateMonitorDocument(tt.document)
+		if len(errors) != len(tt.want) {
+			t.Errorf("%s: errors = %q, want %d", tt.name, errors, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.Contains(errors[i], want) {
+				t.Errorf("%s: error %q does not mention %q", tt.name, errors[i], want)
+			}
+		}
+	}
+}
+
+func TestNormalizeDocumentEndpoint(t *testing.T) {
+	normalized := NormalizeDocumentEndpoint(models.DocumentEndpoint{
+		Key:             "orders",
+		Type:            models.EndpointTypeHTTP,
+		Method:          "post",
+		ContentTracking: &models.ContentTracking{},
+		ResponseCapture: &models.ResponseCapture{Mode: models.CaptureNone},
+		Transport:       &models.TransportOptions{},
+	})
+
+	active := true
+	want := models.DocumentEndpoint{
+		Key:                  "orders",
+		Method:               "POST",
+		Headers:              map[string]string{},
+		Labels:               map[string]string{},
+		TimeoutSeconds:       defaultTimeoutSeconds,
+		CheckIntervalSeconds: defaultCheckIntervalSeconds,
+		IsActive:             &active,
+	}
+	if !reflect.DeepEqual(normalized, want) {
+		t.Errorf("NormalizeDocumentEndpoint =\n%+v\nwant\n%+v", normalized, want)
+	}
+
+	// A document that spells out the defaults compares equal to one that leaves them out
+	minimal := NormalizeDocumentEndpoint(models.DocumentEndpoint{Key: "orders", Method: "POST"})
+	if changes := AuditDiff(DocumentState(normalized), DocumentState(minimal)); len(changes) != 0 {
+		t.Errorf("spelled out defaults differ in %v", changes)
+	}
+}
+
+func TestEndpointKeys(t *testing.T) {
+	for name, want := range map[string]string{
+		"Orders API":            "orders-api",
+		"  GET /users/{id}  ":   "get-users-id",
+		"!!!":                   "endpoint",
+		strings.Repeat("a", 90): strings.Repeat("a", 80),
+	} {
+		got := Slugify(name)
+		if got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", name, got, want)
+		}
+		if !ValidEndpointKey(got) {
+			t.Errorf("Slugify(%q) = %q is not a valid key", name, got)
+		}
+	}
+
+	for key, want := range map[string]bool{"orders.v2_a-b": true, "": false, "-orders": false, "Orders": false, "a b": false} {
+		if got := ValidEndpointKey(key); got != want {
+			t.Errorf("ValidEndpointKey(%q) = %t, want %t", key, got, want)
+		}
+	}
+}
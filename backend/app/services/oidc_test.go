@@ -0,0 +1,227 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api-monitor/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIssuer is an OpenID provider with discovery, signing keys and a token endpoint
+// that checks the PKCE verifier of the code it issued
+type fakeIssuer struct {
+	*httptest.Server
+	mu         sync.Mutex
+	keys       map[string]*rsa.PrivateKey // Published signing keys by kid
+	keyFetches int
+	challenges map[string]string // Authorization code -> code challenge
+	idToken    string            // Returned by the token endpoint
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	issuer := &fakeIssuer{keys: map[string]*rsa.PrivateKey{}, challenges: map[string]string{}}
+	issuer.keys["key-1"] = newRSAKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                issuer.URL,
+			AuthorizationEndpoint: issuer.URL + "/authorize",
+			TokenEndpoint:         issuer.URL + "/token",
+			JWKSURI:               issuer.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		defer issuer.mu.Unlock()
+		issuer.keyFetches++
+		keys := []jsonWebKey{}
+		for kid, key := range issuer.keys {
+			keys = append(keys, jsonWebKey{Kid: kid, Kty: "RSA", Use: "sig",
+				N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		defer issuer.mu.Unlock()
+		challenge, exists := issuer.challenges[r.FormValue("code")]
+		if !exists || PKCEChallenge(r.FormValue("code_verifier")) != challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		delete(issuer.challenges, r.FormValue("code"))
+		json.NewEncoder(w).Encode(map[string]string{"id_token": issuer.idToken})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func (issuer *fakeIssuer) provider() *OIDCProvider {
+	return NewOIDCProvider(config.OIDCConfig{Issuer: issuer.URL, ClientID: "api-monitor",
+		RedirectURL: "https://monitor.test/callback"})
+}
+
+// validClaims are the claims of an ID token the provider accepts
+func (issuer *fakeIssuer) validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":   issuer.URL,
+		"aud":   "api-monitor",
+		"sub":   "user-1",
+		"nonce": "nonce-1",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+	}
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	provider := issuer.provider()
+	key := issuer.keys["key-1"]
+
+	claims := issuer.validClaims()
+	verified, err := provider.VerifyIDToken(signIDToken(t, key, "key-1", claims), "nonce-1")
+	if err != nil || ClaimString(verified, "sub") != "user-1" {
+		t.Fatalf("valid token: %v, %v", verified, err)
+	}
+
+	cases := []struct {
+		name   string
+		change func(jwt.MapClaims)
+		key    *rsa.PrivateKey
+		nonce  string
+		want   string
+	}{
+		{name: "signed by another key", key: newRSAKey(t), want: "verification error"},
+		{name: "other issuer", change: func(c jwt.MapClaims) { c["iss"] = "https://evil.test" }, want: "invalid issuer"},
+		{name: "other audience", change: func(c jwt.MapClaims) { c["aud"] = "other-client" }, want: "invalid audience"},
+		{name: "expired", change: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() }, want: "expired"},
+		{name: "no expiry", change: func(c jwt.MapClaims) { delete(c, "exp") }, want: "exp claim is required"},
+		{name: "other nonce", nonce: "nonce-2", want: "nonce mismatch"},
+		{name: "no subject", change: func(c jwt.MapClaims) { delete(c, "sub") }, want: "missing sub claim"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := issuer.validClaims()
+			if tc.change != nil {
+				tc.change(claims)
+			}
+			signer, nonce := key, "nonce-1"
+			if tc.key != nil {
+				signer = tc.key
+			}
+			if tc.nonce != "" {
+				nonce = tc.nonce
+			}
+			if _, err := provider.VerifyIDToken(signIDToken(t, signer, "key-1", claims), nonce); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+
+	// HS256 signed with the public key must not pass as RS256
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, issuer.validClaims())
+	hmac.Header["kid"] = "key-1"
+	signed, _ := hmac.SignedString(key.N.Bytes())
+	if _, err := provider.VerifyIDToken(signed, "nonce-1"); err == nil {
+		t.Error("HS256 token was accepted")
+	}
+}
+
+func TestOIDCExchangeUsesPKCE(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	provider := issuer.provider()
+	issuer.idToken = signIDToken(t, issuer.keys["key-1"], "key-1", issuer.validClaims())
+
+	authURL, err := provider.AuthCodeURL("state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	if query.Get("code_challenge") != PKCEChallenge("verifier-1") || query.Get("code_challenge_method") != "S256" ||
+		query.Get("state") != "state-1" || query.Get("nonce") != "nonce-1" || query.Get("scope") != "openid" {
+		t.Errorf("authorization URL = %s", authURL)
+	}
+	if strings.Contains(authURL, "verifier-1") {
+		t.Error("the code verifier was sent in the authorization URL")
+	}
+
+	issuer.challenges["code-1"] = query.Get("code_challenge")
+	if _, err := provider.Exchange("code-1", "other-verifier", "nonce-1"); err == nil || !strings.Contains(err.Error(), "returned 400") {
+		t.Errorf("exchange with the wrong verifier: %v", err)
+	}
+	claims, err := provider.Exchange("code-1", "verifier-1", "nonce-1")
+	if err != nil || ClaimString(claims, "sub") != "user-1" {
+		t.Errorf("exchange = %v, %v", claims, err)
+	}
+}
+
+func TestOIDCUnknownKeyRefetch(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	provider := issuer.provider()
+	if _, err := provider.VerifyIDToken(signIDToken(t, issuer.keys["key-1"], "key-1", issuer.validClaims()), "nonce-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotated keys are picked up once the last fetch is older than the interval
+	issuer.mu.Lock()
+	issuer.keys["key-2"] = newRSAKey(t)
+	issuer.mu.Unlock()
+	provider.fetchedAt = provider.fetchedAt.Add(-keyRefetchInterval)
+	rotated := signIDToken(t, issuer.keys["key-2"], "key-2", issuer.validClaims())
+	if _, err := provider.VerifyIDToken(rotated, "nonce-1"); err != nil {
+		t.Fatalf("token of a rotated key: %v", err)
+	}
+	if issuer.keyFetches != 2 {
+		t.Fatalf("keys fetched %d times, want 2", issuer.keyFetches)
+	}
+
+	// Tokens with unknown key IDs do not fetch the keys again within the interval
+	provider.fetchedAt = provider.fetchedAt.Add(-keyRefetchInterval)
+	provider.refetchAt = provider.refetchAt.Add(-keyRefetchInterval)
+	for i := 0; i < 5; i++ {
+		forged := signIDToken(t, newRSAKey(t), "forged", issuer.validClaims())
+		if _, err := provider.VerifyIDToken(forged, "nonce-1"); err == nil || !strings.Contains(err.Error(), `unknown signing key "forged"`) {
+			t.Errorf("forged token: %v", err)
+		}
+	}
+	if issuer.keyFetches != 3 {
+		t.Errorf("keys fetched %d times for forged tokens, want a single refetch", issuer.keyFetches)
+	}
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"api-monitor/app/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPIImportOptions control which monitors are generated from an OpenAPI spec
+type OpenAPIImportOptions struct {
+	BaseURL              string   // Replaces absolute server URLs of the spec, prefixes relative ones
+	Operations           []string // operationIds or "GET /path"; empty selects every GET operation
+	KeyPrefix            string   // Prepended to the generated endpoint keys
+	TimeoutSeconds       int
+	CheckIntervalSeconds int
+}
+
+// The parts of an OpenAPI 3 document needed to build GET monitors
+type openAPISpec struct {
+	OpenAPI    string                     `json:"openapi" yaml:"openapi"`
+	Servers    []openAPIServer            `json:"servers" yaml:"servers"`
+	Paths      map[string]openAPIPathItem `json:"paths" yaml:"paths"`
+	Components struct {
+		Parameters map[string]openAPIParameter `json:"parameters" yaml:"parameters"`
+	} `json:"components" yaml:"components"`
+}
+
+type openAPIServer struct {
+	URL       string `json:"url" yaml:"url"`
+	Variables map[string]struct {
+		Default string `json:"default" yaml:"default"`
+	} `json:"variables" yaml:"variables"`
+}
+
+type openAPIPathItem struct {
+	Servers    []openAPIServer    `json:"servers" yaml:"servers"`
+	Parameters []openAPIParameter `json:"parameters" yaml:"parameters"`
+	Get        *openAPIOperation  `json:"get" yaml:"get"`
+}
+
+type openAPIOperation struct {
+	OperationID string             `json:"operationId" yaml:"operationId"`
+	Summary     string             `json:"summary" yaml:"summary"`
+	Servers     []openAPIServer    `json:"servers" yaml:"servers"`
+	Parameters  []openAPIParameter `json:"parameters" yaml:"parameters"`
+}
+
+type openAPIParameter struct {
+	Ref      string      `json:"$ref" yaml:"$ref"`
+	Name     string      `json:"name" yaml:"name"`
+	In       string      `json:"in" yaml:"in"`
+	Required bool        `json:"required" yaml:"required"`
+	Example  interface{} `json:"example" yaml:"example"`
+	Examples map[string]struct {
+		Value interface{} `json:"value" yaml:"value"`
+	} `json:"examples" yaml:"examples"`
+	Schema *struct {
+		Example interface{}   `json:"example" yaml:"example"`
+		Default interface{}   `json:"default" yaml:"default"`
+		Enum    []interface{} `json:"enum" yaml:"enum"`
+	} `json:"schema" yaml:"schema"`
+}
+
+var serverVariablePattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// MonitorsFromOpenAPI generates GET monitors for the selected operations of an OpenAPI 3
+// spec in JSON or YAML. Path, query and header parameters are filled in from the examples,
+// defaults or enums of the spec; only required parameters are sent. Operations that need a
+// parameter without any example are skipped and reported in the returned list.
+func MonitorsFromOpenAPI(data []byte, options OpenAPIImportOptions) (models.MonitorDocument, []string, error) {
+	document := models.MonitorDocument{
+		Version:   models.MonitorDocumentVersion,
+		Proxies:   []models.DocumentProxy{},
+		Endpoints: []models.DocumentEndpoint{},
+	}
+	skipped := []string{}
+
+	var spec openAPISpec
+	var err error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		// Numbers stay json.Number so large example ids are not printed in exponent form
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.UseNumber()
+		err = decoder.Decode(&spec)
+	} else {
+		err = yaml.Unmarshal(data, &spec)
+	}
+	if err != nil {
+		return document, skipped, fmt.Errorf("invalid OpenAPI spec: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		return document, skipped, fmt.Errorf("only OpenAPI 3 specs are supported")
+	}
+
+	selected := map[string]bool{}
+	for _, operation := range options.Operations {
+		if operation = strings.TrimSpace(operation); operation != "" {
+			selected[operation] = false
+		}
+	}
+
+	paths := make([]string, 0, len(spec.Paths))
+	for path := range spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	keys := map[string]bool{}
+	for _, path := range paths {
+		item := spec.Paths[path]
+		operation := item.Get
+		if operation == nil {
+			continue
+		}
+
+		label := "GET " + path
+		if len(selected) > 0 {
+			matched := false
+			if _, ok := selected[operation.OperationID]; ok && operation.OperationID != "" {
+				selected[operation.OperationID] = true
+				matched = true
+			}
+			if _, ok := selected[label]; ok {
+				selected[label] = true
+				matched = true
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		// base_url replaces absolute server URLs and is prepended to relative ones
+		baseURL := serverURL(operation.Servers, item.Servers, spec.Servers)
+		if options.BaseURL != "" {
+			if parsed, err := url.Parse(baseURL); err == nil && parsed.Host == "" {
+				baseURL = strings.TrimRight(options.BaseURL, "/") + "/" + strings.TrimLeft(baseURL, "/")
+			} else {
+				baseURL = options.BaseURL
+			}
+		}
+		if parsed, err := url.Parse(baseURL); err != nil || parsed.Host == "" {
+			return document, skipped, fmt.Errorf("the spec has no absolute server URL for %s, set base_url", label)
+		}
+
+		endpoint, reason := spec.monitorFor(baseURL, path, item, operation)
+		if reason != "" {
+			skipped = append(skipped, label+": "+reason)
+			continue
+		}
+
+		base := operation.OperationID
+		if base == "" {
+			base = "get " + path
+		}
+		base = Slugify(options.KeyPrefix + " " + base)
+		endpoint.Key = base
+		for i := 2; keys[endpoint.Key]; i++ {
+			endpoint.Key = fmt.Sprintf("%s-%d", base, i)
+		}
+		keys[endpoint.Key] = true
+
+		endpoint.TimeoutSeconds = options.TimeoutSeconds
+		endpoint.CheckIntervalSeconds = options.CheckIntervalSeconds
+		document.Endpoints = append(document.Endpoints, endpoint)
+	}
+
+	missing := []string{}
+	for operation, found := range selected {
+		if !found {
+			missing = append(missing, operation)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return document, skipped, fmt.Errorf("GET operations not found in the spec: %s", strings.Join(missing, ", "))
+	}
+
+	return document, skipped, nil
+}
+
+// monitorFor builds the monitor of one operation, or returns why it cannot be monitored
+func (spec *openAPISpec) monitorFor(baseURL, path string, item openAPIPathItem, operation *openAPIOperation) (models.DocumentEndpoint, string) {
+	endpoint := models.DocumentEndpoint{
+		Name:    operation.Summary,
+		Method:  "GET",
+		Headers: map[string]string{},
+	}
+	if endpoint.Name == "" {
+		endpoint.Name = operation.OperationID
+	}
+	if endpoint.Name == "" {
+		endpoint.Name = "GET " + path
+	}
+
+	// Operation parameters override path item parameters with the same name and location
+	parameters := map[string]openAPIParameter{}
+	order := []string{}
+	for _, list := range [][]openAPIParameter{item.Parameters, operation.Parameters} {
+		for _, parameter := range list {
+			parameter, ok := spec.resolveParameter(parameter)
+			if !ok {
+				return endpoint, "unresolved parameter reference " + parameter.Ref
+			}
+			id := parameter.In + ":" + parameter.Name
+			if _, exists := parameters[id]; !exists {
+				order = append(order, id)
+			}
+			parameters[id] = parameter
+		}
+	}
+
+	query := url.Values{}
+	for _, id := range order {
+		parameter := parameters[id]
+		if !parameter.Required && parameter.In != "path" {
+			continue
+		}
+
+		value, ok := exampleValue(parameter)
+		if !ok {
+			return endpoint, fmt.Sprintf("no example for required %s parameter %q", parameter.In, parameter.Name)
+		}
+
+		switch parameter.In {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+parameter.Name+"}", url.PathEscape(value))
+		case "query":
+			query.Set(parameter.Name, value)
+		case "header":
+			endpoint.Headers[parameter.Name] = value
+		case "cookie":
+			return endpoint, fmt.Sprintf("required cookie parameter %q is not supported", parameter.Name)
+		}
+	}
+
+	endpoint.URL = strings.TrimRight(baseURL, "/") + path
+	if len(query) > 0 {
+		endpoint.URL += "?" + query.Encode()
+	}
+	return endpoint, ""
+}
+
+// resolveParameter follows a local "#/components/parameters/..." reference
+func (spec *openAPISpec) resolveParameter(parameter openAPIParameter) (openAPIParameter, bool) {
+	if parameter.Ref == "" {
+		return parameter, true
+	}
+	name, ok := strings.CutPrefix(parameter.Ref, "#/components/parameters/")
+	if !ok {
+		return parameter, false
+	}
+	resolved, ok := spec.Components.Parameters[name]
+	if !ok {
+		return parameter, false
+	}
+	return resolved, resolved.Ref == ""
+}
+
+// serverURL returns the most specific server URL with its variables set to their defaults
+func serverURL(candidates ...[]openAPIServer) string {
+	for _, servers := range candidates {
+		if len(servers) == 0 {
+			continue
+		}
+		server := servers[0]
+		return serverVariablePattern.ReplaceAllStringFunc(server.URL, func(match string) string {
+			if variable, ok := server.Variables[match[1:len(match)-1]]; ok {
+				return variable.Default
+			}
+			return match
+		})
+	}
+	return ""
+}
+
+// exampleValue picks the value sent for a parameter: its example, the first of its named
+// examples, or the example, default or first enum value of its schema
+func exampleValue(parameter openAPIParameter) (string, bool) {
+	candidates := []interface{}{parameter.Example}
+
+	names := make([]string, 0, len(parameter.Examples))
+	for name := range parameter.Examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		candidates = append(candidates, parameter.Examples[name].Value)
+	}
+
+	if parameter.Schema != nil {
+		candidates = append(candidates, parameter.Schema.Example, parameter.Schema.Default)
+		if len(parameter.Schema.Enum) > 0 {
+			candidates = append(candidates, parameter.Schema.Enum[0])
+		}
+	}
+
+	for _, candidate := range candidates {
+		switch value := candidate.(type) {
+		case nil, map[string]interface{}:
+			continue
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			return strings.Join(items, ","), true
+		default:
+			return fmt.Sprint(value), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+const petstoreSpec = `
+openapi: 3.0.3
+servers:
+  - url: https://{region}.pets.local/v1
+    variables:
+      region:
+        default: eu
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      summary: List pets
+      parameters:
+        - name: limit
+          in: query
+          schema: {default: 20}
+        - $ref: '#/components/parameters/Tenant'
+  /pets/{petId}:
+    parameters:
+      - name: petId
+        in: path
+        required: true
+        example: 12345678901
+    get:
+      operationId: showPet
+  /owners/{ownerId}:
+    get:
+      parameters:
+        - name: ownerId
+          in: path
+          required: true
+  /orders:
+    post:
+      operationId: createOrder
+components:
+  parameters:
+    Tenant:
+      name: X-Tenant
+      in: header
+      required: true
+      schema:
+        enum: [acme, globex]
+`
+
+func TestMonitorsFromOpenAPI(t *testing.T) {
+	document, skipped, err := MonitorsFromOpenAPI([]byte(petstoreSpec), OpenAPIImportOptions{KeyPrefix: "pets", TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(skipped) != 1 || !strings.Contains(skipped[0], `GET /owners/{ownerId}: no example for required path parameter "ownerId"`) {
+		t.Errorf("skipped = %q", skipped)
+	}
+	if len(document.Endpoints) != 2 {
+		t.Fatalf("endpoints = %+v, want listPets and showPet", document.Endpoints)
+	}
+
+	list, show := document.Endpoints[0], document.Endpoints[1]
+	if list.Key != "pets-listpets" || list.Name != "List pets" || list.URL != "https://eu.pets.local/v1/pets" ||
+		list.Headers["X-Tenant"] != "acme" || list.TimeoutSeconds != 5 {
+		t.Errorf("listPets = %+v", list)
+	}
+	if show.Key != "pets-showpet" || show.URL != "https://eu.pets.local/v1/pets/12345678901" {
+		t.Errorf("showPet = %+v", show)
+	}
+	if errors := ValidateMonitorDocument(document); len(errors) != 0 {
+		t.Errorf("generated document is invalid: %q", errors)
+	}
+}
+
+func TestMonitorsFromOpenAPIOptions(t *testing.T) {
+	document, _, err := MonitorsFromOpenAPI([]byte(petstoreSpec), OpenAPIImportOptions{
+		BaseURL:    "https://staging.local/api",
+		Operations: []string{"GET /pets/{petId}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Endpoints) != 1 || document.Endpoints[0].URL != "https://staging.local/api/pets/12345678901" {
+		t.Errorf("endpoints = %+v, want showPet against the base URL", document.Endpoints)
+	}
+
+	_, _, err = MonitorsFromOpenAPI([]byte(petstoreSpec), OpenAPIImportOptions{Operations: []string{"listPets", "createOrder"}})
+	if err == nil || !strings.Contains(err.Error(), "createOrder") {
+		t.Errorf("err = %v, want createOrder reported as not found", err)
+	}
+
+	if _, _, err := MonitorsFromOpenAPI([]byte(`{"swagger": "2.0"}`), OpenAPIImportOptions{}); err == nil {
+		t.Error("a Swagger 2 spec was accepted")
+	}
+	if _, _, err := MonitorsFromOpenAPI([]byte("openapi: 3.1.0\npaths:\n  /a:\n    get: {}\n"), OpenAPIImportOptions{}); err == nil {
+		t.Error("a spec without server URL was accepted without base_url")
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"api-monitor/app/models"
+	"api-monitor/utils"
+)
+
+// Limits on the stored body of a captured response
+const (
+	DefaultCaptureMaxBytes = 1 << 20
+	MaxCaptureBytes        = 10 << 20
+)
+
+// ValidateResponseCapture checks the capture settings of an endpoint
+func ValidateResponseCapture(capture models.ResponseCapture) error {
+	switch capture.Mode {
+	case "", models.CaptureNone, models.CaptureOnFailure, models.CaptureAlways:
+	default:
+		return fmt.Errorf("response_capture.mode must be none, on_failure or always")
+	}
+
+	if capture.MaxBytes < 0 || capture.MaxBytes > MaxCaptureBytes {
+		return fmt.Errorf("response_capture.max_bytes must be between 0 (default %d) and %d", DefaultCaptureMaxBytes, MaxCaptureBytes)
+	}
+	if capture.ReadLimitBytes < 0 || capture.ReadLimitBytes > utils.MaxReadLimitBytes {
+		return fmt.Errorf("response_capture.read_limit_bytes must be between 0 (default %d) and %d", utils.DefaultReadLimitBytes, utils.MaxReadLimitBytes)
+	}
+	return nil
+}
+
+// capturesResponse reports whether the full response of a check with the given status is kept
+func capturesResponse(capture models.ResponseCapture, status string) bool {
+	switch capture.Mode {
+	case models.CaptureAlways:
+		return true
+	case models.CaptureOnFailure:
+		return status != models.EndpointStatusUp
+	default:
+		return false
+	}
+}
+
+// responseCapture is a full response waiting to be stored along with its check log
+type responseCapture struct {
+	Endpoint   models.APIEndpoint
+	StatusCode int
+	Headers    string
+	Body       string
+}
+
+// storeResponse saves a full response compressed and returns its id. Bodies are cut at
+// the endpoint's max_bytes; they are marked truncated when that happened or when the
+// body filled the read limit, so more may have followed.
+func storeResponse(db *sql.DB, capture responseCapture) (int, error) {
+	endpoint, body := capture.Endpoint, capture.Body
+	maxBytes := endpoint.ResponseCapture.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultCaptureMaxBytes
+	}
+
+	truncated := int64(len(body)) >= utils.ReadLimit(endpoint)
+	if len(body) > maxBytes {
+		body = body[:maxBytes]
+		truncated = true
+	}
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write([]byte(body)); err != nil {
+		return 0, err
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO response_captures (endpoint_id, status_code, headers, body, body_size, compressed_size, truncated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		endpoint.ID, capture.StatusCode, capture.Headers, compressed.Bytes(), len(body), compressed.Len(), truncated).Scan(&id)
+	return id, err
+}
+
+// FindStoredResponse loads and decompresses the full response kept for a check log
+func FindStoredResponse(db *sql.DB, endpointID, checkLogID int) (models.StoredResponse, error) {
+	var response models.StoredResponse
+	var compressed []byte
+
+	err := db.QueryRow(`
+		SELECT c.id, c.endpoint_id, l.id, c.status_code, c.headers, c.body, c.body_size,
+		       c.compressed_size, c.truncated, c.captured_at
+		FROM api_check_logs l
+		JOIN response_captures c ON c.id = l.response_capture_id
+		WHERE l.id = $1 AND l.endpoint_id = $2`, checkLogID, endpointID).Scan(
+		&response.ID, &response.EndpointID, &response.CheckLogID, &response.StatusCode, &response.Headers,
+		&compressed, &response.BodySize, &response.CompressedSize, &response.Truncated, &response.CapturedAt)
+	if err != nil {
+		return response, err
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return response, err
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return response, err
+	}
+
+	response.Body = string(body)
+	return response, nil
+}
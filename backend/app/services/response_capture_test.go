@@ -0,0 +1,114 @@
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"api-monitor/app/fakedb"
+	"api-monitor/app/models"
+	"api-monitor/utils"
+)
+
+func TestValidateResponseCapture(t *testing.T) {
+	for _, capture := range []models.ResponseCapture{
+		{},
+		{Mode: models.CaptureNone},
+		{Mode: models.CaptureOnFailure, MaxBytes: MaxCaptureBytes},
+		{Mode: models.CaptureAlways, ReadLimitBytes: utils.MaxReadLimitBytes},
+	} {
+		if err := ValidateResponseCapture(capture); err != nil {
+			t.Errorf("%+v rejected: %v", capture, err)
+		}
+	}
+
+	for _, capture := range []models.ResponseCapture{
+		{Mode: "sometimes"},
+		{Mode: "ALWAYS"},
+		{MaxBytes: -1},
+		{MaxBytes: MaxCaptureBytes + 1},
+		{ReadLimitBytes: utils.MaxReadLimitBytes + 1},
+	} {
+		if err := ValidateResponseCapture(capture); err == nil {
+			t.Errorf("%+v accepted", capture)
+		}
+	}
+}
+
+func TestCapturesResponse(t *testing.T) {
+	tests := []struct {
+		mode, status string
+		want         bool
+	}{
+		{"", models.EndpointStatusDown, false},
+		{models.CaptureNone, models.EndpointStatusDown, false},
+		{models.CaptureOnFailure, models.EndpointStatusUp, false},
+		{models.CaptureOnFailure, models.EndpointStatusDown, true},
+		{models.CaptureOnFailure, models.EndpointStatusBlocked, true},
+		{models.CaptureAlways, models.EndpointStatusUp, true},
+	}
+	for _, tt := range tests {
+		if got := capturesResponse(models.ResponseCapture{Mode: tt.mode}, tt.status); got != tt.want {
+			t.Errorf("capturesResponse(%q, %s) = %t, want %t", tt.mode, tt.status, got, tt.want)
+		}
+	}
+}
+
+// fakeCaptures keeps the single response capture written through the fake database and
+// returns it to FindStoredResponse
+func fakeCaptures() func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+	var stored []driver.Value
+	return func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "INSERT INTO response_captures"):
+			stored = args
+			return []string{"id"}, [][]driver.Value{{int64(7)}}, nil
+		case strings.Contains(query, "FROM api_check_logs l"):
+			// The INSERT wrote endpoint_id, status_code, headers, body, body_size,
+			// compressed_size and truncated; the check log id is the first argument
+			columns := []string{"id", "endpoint_id", "check_log_id", "status_code", "headers", "body",
+				"body_size", "compressed_size", "truncated", "captured_at"}
+			row := []driver.Value{int64(7), stored[0], args[0]}
+			row = append(row, stored[1:7]...)
+			return columns, [][]driver.Value{append(row, time.Now())}, nil
+		}
+		return nil, nil, errors.New("unexpected query: " + query)
+	}
+}
+
+func TestStoreResponseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name          string
+		capture       models.ResponseCapture
+		body          string
+		wantBody      string
+		wantTruncated bool
+	}{
+		{"whole body", models.ResponseCapture{Mode: models.CaptureAlways}, "hello", "hello", false},
+		{"cut at max_bytes", models.ResponseCapture{Mode: models.CaptureAlways, MaxBytes: 4}, "hello", "hell", true},
+		{"filled the read limit", models.ResponseCapture{Mode: models.CaptureAlways, ReadLimitBytes: 5}, "hello", "hello", true},
+	}
+	for _, tt := range tests {
+		db, _ := fakedb.Open(t, fakeCaptures())
+
+		endpoint := models.APIEndpoint{ID: 3, ResponseCapture: tt.capture}
+		id, err := storeResponse(db, responseCapture{Endpoint: endpoint, StatusCode: 502, Headers: `{"X":["1"]}`, Body: tt.body})
+		if err != nil || id != 7 {
+			t.Fatalf("%s: storeResponse = %d, %v", tt.name, id, err)
+		}
+
+		response, err := FindStoredResponse(db, 3, 11)
+		if err != nil {
+			t.Fatalf("%s: FindStoredResponse: %v", tt.name, err)
+		}
+		if response.Body != tt.wantBody || response.BodySize != len(tt.wantBody) || response.Truncated != tt.wantTruncated {
+			t.Errorf("%s: got body %q of %d bytes, truncated %t; want %q, truncated %t",
+				tt.name, response.Body, response.BodySize, response.Truncated, tt.wantBody, tt.wantTruncated)
+		}
+		if response.StatusCode != 502 || response.Headers != `{"X":["1"]}` || response.CheckLogID != 11 || response.CompressedSize == 0 {
+			t.Errorf("%s: response = %+v", tt.name, response)
+		}
+	}
+}
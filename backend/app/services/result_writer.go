@@ -0,0 +1,255 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Batching of check logs. A batch is written when it is full or when the oldest row has
+// waited for the flush interval; checks wait once the queue is full.
+const (
+	resultBatchSize     = 200
+	resultFlushInterval = time.Second
+	resultQueueSize     = 5000
+)
+
+// checkLogColumns are the api_check_logs columns written for every check
+var checkLogColumns = []string{
+	"id", "endpoint_id", "endpoint_version", "status_code", "response_time_ms", "response_body",
+	"response_headers", "error_message", "status", "blocked_by", "schema_errors",
+	"response_capture_id", "details", "checked_at",
+}
+
+// checkLogRow is a check log waiting to be written. The writer stores Capture first and
+// points the row at it; Stored runs after the row was written, with its id.
+type checkLogRow struct {
+	EndpointID        int
+	EndpointVersion   int
+	StatusCode        int
+	ResponseTimeMs    int
+	ResponseBody      string
+	ResponseHeaders   string
+	ErrorMessage      string
+	Status            string
+	BlockedBy         *int
+	SchemaErrors      interface{} // JSON, nil for NULL
+	ResponseCaptureID *int
+	Details           interface{} // JSON, nil for NULL
+	CheckedAt         time.Time
+	Capture           *responseCapture
+	Stored            func(id int)
+}
+
+func (r checkLogRow) values(id int) []interface{} {
+	return []interface{}{
+		id, r.EndpointID, r.EndpointVersion, r.StatusCode, r.ResponseTimeMs, r.ResponseBody,
+		r.ResponseHeaders, r.ErrorMessage, r.Status, r.BlockedBy, r.SchemaErrors,
+		r.ResponseCaptureID, r.Details, r.CheckedAt,
+	}
+}
+
+// ResultWriter writes check logs in batches from a goroutine of its own, so checks do not
+// wait for the database. When the database falls behind and the queue fills up, Write
+// blocks until there is room again; checks slow down rather than pile up in memory.
+// Stored callbacks, such as content tracking, run on another goroutine so they do not hold
+// up the next batch.
+type ResultWriter struct {
+	DB *sql.DB
+
+	queue      chan checkLogRow
+	done       chan struct{}
+	stored     chan func()
+	storedDone chan struct{}
+	mu         sync.RWMutex
+	closed     bool
+}
+
+// NewResultWriter starts a writer; Close it to write the queued rows
+func NewResultWriter(db *sql.DB) *ResultWriter {
+	w := &ResultWriter{
+		DB:         db,
+		queue:      make(chan checkLogRow, resultQueueSize),
+		done:       make(chan struct{}),
+		stored:     make(chan func(), resultQueueSize),
+		storedDone: make(chan struct{}),
+	}
+	go w.run()
+	go w.runStored()
+	return w
+}
+
+// Write queues a check log. Once the writer is closed rows are written right away.
+func (w *ResultWriter) Write(row checkLogRow) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		w.flush([]checkLogRow{row}, func(fn func()) { fn() })
+		return
+	}
+
+	select {
+	case w.queue <- row:
+	default:
+		start := time.Now()
+		w.queue <- row
+		log.Printf("Check log queue was full, waited %s for the database", time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// Close writes the queued rows, waits for their Stored callbacks and stops the writer
+func (w *ResultWriter) Close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	<-w.done
+	<-w.storedDone
+}
+
+func (w *ResultWriter) run() {
+	defer close(w.done)
+	defer close(w.stored)
+
+	ticker := time.NewTicker(resultFlushInterval)
+	defer ticker.Stop()
+
+	after := func(fn func()) { w.stored <- fn }
+	batch := make([]checkLogRow, 0, resultBatchSize)
+	for {
+		select {
+		case row, ok := <-w.queue:
+			if !ok {
+				w.flush(batch, after)
+				return
+			}
+			batch = append(batch, row)
+			if len(batch) == resultBatchSize {
+				w.flush(batch, after)
+				batch = batch[:0]
+				ticker.Reset(resultFlushInterval)
+			}
+		case <-ticker.C:
+			w.flush(batch, after)
+			batch = batch[:0]
+		}
+	}
+}
+
+// runStored runs the Stored callbacks of written rows in the order they were written
+func (w *ResultWriter) runStored() {
+	defer close(w.storedDone)
+
+	for fn := range w.stored {
+		fn()
+	}
+}
+
+// flush writes a batch with one statement and hands the Stored callbacks to after. A row
+// the database rejects, e.g. of an endpoint deleted since it was checked, fails the
+// statement, so the rows are then written one by one and only the rejected ones are lost.
+func (w *ResultWriter) flush(batch []checkLogRow, after func(func())) {
+	if len(batch) == 0 {
+		return
+	}
+
+	for i := range batch {
+		if batch[i].Capture == nil {
+			continue
+		}
+		id, err := storeResponse(w.DB, *batch[i].Capture)
+		if err != nil {
+			log.Printf("Error storing the response of endpoint %d: %v", batch[i].EndpointID, err)
+		} else {
+			batch[i].ResponseCaptureID = &id
+		}
+		batch[i].Capture = nil
+	}
+
+	ids, err := w.insert(batch)
+	if err != nil {
+		if len(batch) > 1 {
+			log.Printf("Error writing %d check logs, writing them one by one: %v", len(batch), err)
+		}
+		ids = make([]int, len(batch))
+		for i := range batch {
+			rowIDs, err := w.insert(batch[i : i+1])
+			if err != nil {
+				log.Printf("Error logging check of endpoint %d: %v", batch[i].EndpointID, err)
+				continue
+			}
+			ids[i] = rowIDs[0]
+		}
+	}
+
+	for i, row := range batch {
+		if ids[i] != 0 && row.Stored != nil {
+			stored, id := row.Stored, ids[i]
+			after(func() { stored(id) })
+		}
+	}
+}
+
+// insert writes rows with a multi-row INSERT and returns their ids in the order of the
+// rows. The ids are taken from the sequence beforehand and written with the rows, so they
+// do not depend on the order in which the database returns inserted rows.
+func (w *ResultWriter) insert(rows []checkLogRow) ([]int, error) {
+	ids, err := w.reserveIDs(len(rows))
+	if err != nil {
+		return nil, err
+	}
+
+	placeholders := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(checkLogColumns))
+	for i, row := range rows {
+		values := row.values(ids[i])
+		params := make([]string, len(values))
+		for j := range values {
+			params[j] = fmt.Sprintf("$%d", len(args)+j+1)
+		}
+		placeholders = append(placeholders, "("+strings.Join(params, ", ")+")")
+		args = append(args, values...)
+	}
+
+	_, err = w.DB.Exec(`
+		INSERT INTO api_check_logs (`+strings.Join(checkLogColumns, ", ")+`)
+		VALUES `+strings.Join(placeholders, ", "), args...)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// reserveIDs takes n ids from the api_check_logs sequence
+func (w *ResultWriter) reserveIDs(n int) ([]int, error) {
+	rows, err := w.DB.Query(`
+		SELECT nextval(pg_get_serial_sequence('api_check_logs', 'id'))
+		FROM generate_series(1, $1)`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0, n)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) != n {
+		return nil, fmt.Errorf("expected %d check log ids, got %d", n, len(ids))
+	}
+	return ids, nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-monitor/app/fakedb"
+)
+
+// fakeCheckLogs plays the api_check_logs and response_captures tables for the writer
+type fakeCheckLogs struct {
+	mu       sync.Mutex
+	nextID   int64
+	logs     map[int64]int64        // check log id -> endpoint id
+	capture  map[int64]driver.Value // check log id -> response_capture_id
+	captures int64
+	batches  []int          // rows of each successful INSERT
+	reject   map[int64]bool // endpoint ids whose rows fail like a foreign key violation
+}
+
+func newFakeCheckLogs() *fakeCheckLogs {
+	return &fakeCheckLogs{
+		nextID:  100,
+		logs:    map[int64]int64{},
+		capture: map[int64]driver.Value{},
+		reject:  map[int64]bool{},
+	}
+}
+
+func (f *fakeCheckLogs) handle(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case strings.Contains(query, "nextval"):
+		// Handed out in descending order, ids must not depend on the order of result rows
+		n := args[0].(int64)
+		rows := make([][]driver.Value, n)
+		for i := n - 1; i >= 0; i-- {
+			f.nextID++
+			rows[i] = []driver.Value{f.nextID}
+		}
+		return []string{"nextval"}, rows, nil
+
+	case strings.Contains(query, "INSERT INTO response_captures"):
+		f.captures++
+		return []string{"id"}, [][]driver.Value{{f.captures}}, nil
+
+	case strings.Contains(query, "INSERT INTO api_check_logs"):
+		width := len(checkLogColumns)
+		for i := 0; i < len(args); i += width {
+			if f.reject[args[i+1].(int64)] {
+				return nil, nil, errors.New(`insert or update on table "api_check_logs" violates foreign key constraint`)
+			}
+		}
+		for i := 0; i < len(args); i += width {
+			id := args[i].(int64)
+			f.logs[id] = args[i+1].(int64)
+			f.capture[id] = args[i+11]
+		}
+		f.batches = append(f.batches, len(args)/width)
+		return nil, nil, nil
+	}
+
+	return nil, nil, errors.New("unexpected query: " + query)
+}
+
+// idOf returns the id of the check log written for an endpoint
+func (f *fakeCheckLogs) idOf(endpointID int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, endpoint := range f.logs {
+		if endpoint == int64(endpointID) {
+			return int(id)
+		}
+	}
+	return 0
+}
+
+func inline(fn func()) { fn() }
+
+// storedIDs makes rows for the endpoints that record the id Stored was called with
+func storedIDs(endpointIDs ...int) ([]checkLogRow, map[int]int) {
+	stored := map[int]int{}
+	rows := make([]checkLogRow, len(endpointIDs))
+	for i, endpointID := range endpointIDs {
+		endpointID := endpointID
+		rows[i] = checkLogRow{
+			EndpointID: endpointID,
+			Status:     "up",
+			CheckedAt:  time.Now(),
+			Stored:     func(id int) { stored[endpointID] = id },
+		}
+	}
+	return rows, stored
+}
+
+func TestResultWriterFlushMatchesIDsToRows(t *testing.T) {
+	logs := newFakeCheckLogs()
+	db, _ := fakedb.Open(t, logs.handle)
+	w := &ResultWriter{DB: db}
+
+	rows, stored := storedIDs(1, 2, 3)
+	w.flush(rows, inline)
+
+	if len(logs.batches) != 1 || logs.batches[0] != 3 {
+		t.Fatalf("batches = %v, want one INSERT of 3 rows", logs.batches)
+	}
+	for _, endpointID := range []int{1, 2, 3} {
+		if want := logs.idOf(endpointID); stored[endpointID] != want || want == 0 {
+			t.Errorf("Stored of endpoint %d got id %d, its log has id %d", endpointID, stored[endpointID], want)
+		}
+	}
+}
+
+func TestResultWriterFlushFallsBackToSingleRows(t *testing.T) {
+	logs := newFakeCheckLogs()
+	logs.reject[2] = true
+	db, _ := fakedb.Open(t, logs.handle)
+	w := &ResultWriter{DB: db}
+
+	rows, stored := storedIDs(1, 2, 3)
+	w.flush(rows, inline)
+
+	if len(logs.logs) != 2 || logs.idOf(2) != 0 {
+		t.Fatalf("written logs = %v, want the rows of endpoints 1 and 3", logs.logs)
+	}
+	if len(logs.batches) != 2 || logs.batches[0] != 1 || logs.batches[1] != 1 {
+		t.Errorf("batches = %v, want the rows written one by one", logs.batches)
+	}
+	if _, ok := stored[2]; ok {
+		t.Error("Stored ran for the rejected row")
+	}
+	for _, endpointID := range []int{1, 3} {
+		if want := logs.idOf(endpointID); stored[endpointID] != want {
+			t.Errorf("Stored of endpoint %d got id %d, its log has id %d", endpointID, stored[endpointID], want)
+		}
+	}
+}
+
+func TestResultWriterStoresCapturesOnce(t *testing.T) {
+	logs := newFakeCheckLogs()
+	logs.reject[2] = true
+	db, _ := fakedb.Open(t, logs.handle)
+	w := &ResultWriter{DB: db}
+
+	rows, _ := storedIDs(1, 2)
+	rows[0].Capture = &responseCapture{StatusCode: 500, Body: "full body"}
+	rows[0].Capture.Endpoint.ID = 1
+	w.flush(rows, inline)
+
+	if logs.captures != 1 {
+		t.Errorf("stored %d captures, want 1 even though the batch was retried", logs.captures)
+	}
+	if got := logs.capture[int64(logs.idOf(1))]; got != int64(1) {
+		t.Errorf("response_capture_id = %v, want 1", got)
+	}
+}
+
+func TestResultWriterCloseWritesQueuedRows(t *testing.T) {
+	logs := newFakeCheckLogs()
+	db, _ := fakedb.Open(t, logs.handle)
+	w := NewResultWriter(db)
+
+	var stored atomic.Int32
+	total := resultBatchSize + 50
+	for i := 1; i <= total; i++ {
+		w.Write(checkLogRow{EndpointID: i, CheckedAt: time.Now(), Stored: func(int) { stored.Add(1) }})
+	}
+	w.Close()
+
+	if len(logs.logs) != total || int(stored.Load()) != total {
+		t.Fatalf("after Close %d logs written and %d Stored callbacks run, want %d", len(logs.logs), stored.Load(), total)
+	}
+
+	// Rows of checks still running during shutdown are written right away
+	w.Write(checkLogRow{EndpointID: total + 1, CheckedAt: time.Now(), Stored: func(int) { stored.Add(1) }})
+	if len(logs.logs) != total+1 || int(stored.Load()) != total+1 {
+		t.Errorf("a row written after Close was not written and stored right away")
+	}
+}
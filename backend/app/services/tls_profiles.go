@@ -0,0 +1,65 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"api-monitor/app/models"
+	"api-monitor/utils"
+)
+
+// TLSProfileSelect loads TLS profiles; read rows with ScanTLSProfile
+const TLSProfileSelect = `
+	SELECT id, name, COALESCE(client_cert, ''), COALESCE(client_key, ''), COALESCE(ca_bundle, ''),
+	       COALESCE(server_name, ''), COALESCE(min_version, ''), insecure_skip_verify, team_id,
+	       created_at, updated_at
+	FROM tls_profiles`
+
+// ScanTLSProfile reads one row produced by TLSProfileSelect and decrypts the PEM material
+func ScanTLSProfile(row rowScanner) (models.TLSProfile, error) {
+	var profile models.TLSProfile
+	var clientCert, clientKey, caBundle string
+	var teamID sql.NullInt64
+
+	err := row.Scan(&profile.ID, &profile.Name, &clientCert, &clientKey, &caBundle,
+		&profile.ServerName, &profile.MinVersion, &profile.InsecureSkipVerify, &teamID,
+		&profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		return profile, err
+	}
+	profile.TeamID = nullableInt(teamID)
+
+	if profile.ClientCert, err = utils.DecryptString(clientCert); err != nil {
+		return profile, fmt.Errorf("client certificate: %v", err)
+	}
+	if profile.ClientKey, err = utils.DecryptString(clientKey); err != nil {
+		return profile, fmt.Errorf("client key: %v", err)
+	}
+	if profile.CABundle, err = utils.DecryptString(caBundle); err != nil {
+		return profile, fmt.Errorf("CA bundle: %v", err)
+	}
+
+	return profile, nil
+}
+
+// FindTLSProfile loads a decrypted TLS profile by ID
+func FindTLSProfile(db *sql.DB, profileID int) (models.TLSProfile, error) {
+	return ScanTLSProfile(db.QueryRow(TLSProfileSelect+` WHERE id = $1`, profileID))
+}
+
+// EncryptTLSProfile returns the encrypted client cert, client key and CA bundle for storage
+func EncryptTLSProfile(profile models.TLSProfile) (string, string, string, error) {
+	clientCert, err := utils.EncryptString(profile.ClientCert)
+	if err != nil {
+		return "", "", "", err
+	}
+	clientKey, err := utils.EncryptString(profile.ClientKey)
+	if err != nil {
+		return "", "", "", err
+	}
+	caBundle, err := utils.EncryptString(profile.CABundle)
+	if err != nil {
+		return "", "", "", err
+	}
+	return clientCert, clientKey, caBundle, nil
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"api-monitor/app/models"
+)
+
+// Limits on the transport settings of an endpoint
+const (
+	maxRedirectsLimit = 30
+	maxResolveEntries = 20
+)
+
+// NormalizeTransportOptions lower-cases the pinned host names, DNS names are not case
+// sensitive and requests are matched on the lower-case name
+func NormalizeTransportOptions(options models.TransportOptions) models.TransportOptions {
+	if len(options.Resolve) == 0 {
+		options.Resolve = nil
+		return options
+	}
+	resolve := make(map[string]string, len(options.Resolve))
+	for host, ip := range options.Resolve {
+		resolve[strings.ToLower(strings.TrimSpace(host))] = strings.TrimSpace(ip)
+	}
+	options.Resolve = resolve
+	return options
+}
+
+// ValidateTransportOptions checks the transport settings of an endpoint
+func ValidateTransportOptions(options models.TransportOptions) error {
+	if options.MaxRedirects < 0 || options.MaxRedirects > maxRedirectsLimit {
+		return fmt.Errorf("transport.max_redirects must be between 0 (default 10) and %d", maxRedirectsLimit)
+	}
+	if options.DisableRedirects && options.MaxRedirects > 0 {
+		return fmt.Errorf("transport.max_redirects cannot be set when redirects are disabled")
+	}
+
+	switch options.HTTPVersion {
+	case "", models.HTTPVersion11, models.HTTPVersion2:
+	default:
+		return fmt.Errorf("transport.http_version must be 1.1 or 2")
+	}
+
+	if strings.ContainsAny(options.UserAgent, "\r\n") {
+		return fmt.Errorf("transport.user_agent cannot contain line breaks")
+	}
+
+	if len(options.Resolve) > maxResolveEntries {
+		return fmt.Errorf("transport.resolve can pin at most %d hosts", maxResolveEntries)
+	}
+	for host, ip := range options.Resolve {
+		if host == "" || strings.ContainsAny(host, ":/") {
+			return fmt.Errorf("transport.resolve: %q must be a host name without scheme or port", host)
+		}
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("transport.resolve: %q for %s is not an IP address", ip, host)
+		}
+	}
+	return nil
+}
+
+// UsesDefaultTransport reports whether an endpoint uses the default transport settings
+func UsesDefaultTransport(options models.TransportOptions) bool {
+	return !options.DisableRedirects && options.MaxRedirects == 0 && options.HTTPVersion == "" &&
+		!options.DisableKeepAlives && !options.DisableCompression && options.UserAgent == "" &&
+		len(options.Resolve) == 0
+}
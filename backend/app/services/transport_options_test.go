@@ -0,0 +1,80 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"api-monitor/app/models"
+)
+
+func TestValidateTransportOptions(t *testing.T) {
+	for _, options := range []models.TransportOptions{
+		{},
+		{DisableRedirects: true},
+		{MaxRedirects: maxRedirectsLimit},
+		{HTTPVersion: models.HTTPVersion11, UserAgent: "probe/1.0"},
+		{HTTPVersion: models.HTTPVersion2, DisableKeepAlives: true, DisableCompression: true},
+		{Resolve: map[string]string{"api.example.com": "10.0.0.5", "v6.example.com": "::1"}},
+	} {
+		if err := ValidateTransportOptions(options); err != nil {
+			t.Errorf("%+v rejected: %v", options, err)
+		}
+	}
+
+	tooMany := map[string]string{}
+	for i := 0; i <= maxResolveEntries; i++ {
+		tooMany[strings.Repeat("a", i+1)+".test"] = "127.0.0.1"
+	}
+	for name, options := range map[string]models.TransportOptions{
+		"negative max_redirects":       {MaxRedirects: -1},
+		"too many redirects":           {MaxRedirects: maxRedirectsLimit + 1},
+		"max_redirects while disabled": {DisableRedirects: true, MaxRedirects: 3},
+		"unknown HTTP version":         {HTTPVersion: "3"},
+		"line break in user agent":     {UserAgent: "probe\r\nX-Injected: 1"},
+		"too many pinned hosts":        {Resolve: tooMany},
+		"host with port":               {Resolve: map[string]string{"api.example.com:443": "10.0.0.5"}},
+		"host with scheme":             {Resolve: map[string]string{"https://api.example.com": "10.0.0.5"}},
+		"empty host":                   {Resolve: map[string]string{"": "10.0.0.5"}},
+		"name instead of IP":           {Resolve: map[string]string{"api.example.com": "backend.local"}},
+	} {
+		if err := ValidateTransportOptions(options); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestNormalizeTransportOptions(t *testing.T) {
+	options := NormalizeTransportOptions(models.TransportOptions{
+		UserAgent: "probe/1.0",
+		Resolve:   map[string]string{" API.Example.COM ": " 10.0.0.5 "},
+	})
+	want := models.TransportOptions{UserAgent: "probe/1.0", Resolve: map[string]string{"api.example.com": "10.0.0.5"}}
+	if !reflect.DeepEqual(options, want) {
+		t.Errorf("NormalizeTransportOptions = %+v, want %+v", options, want)
+	}
+
+	// An empty map is stored like a missing one
+	if options := NormalizeTransportOptions(models.TransportOptions{Resolve: map[string]string{}}); options.Resolve != nil {
+		t.Errorf("Resolve = %#v, want nil", options.Resolve)
+	}
+}
+
+func TestUsesDefaultTransport(t *testing.T) {
+	if !UsesDefaultTransport(models.TransportOptions{Resolve: map[string]string{}}) {
+		t.Error("the zero options do not use the default transport")
+	}
+	for _, options := range []models.TransportOptions{
+		{DisableRedirects: true},
+		{MaxRedirects: 5},
+		{HTTPVersion: models.HTTPVersion11},
+		{DisableKeepAlives: true},
+		{DisableCompression: true},
+		{UserAgent: "probe/1.0"},
+		{Resolve: map[string]string{"api.example.com": "10.0.0.5"}},
+	} {
+		if UsesDefaultTransport(options) {
+			t.Errorf("%+v uses the default transport", options)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// A minimal OpenID Connect provider for trying out single sign-on locally. It supports
+// the authorization-code flow with PKCE (S256 only) and signs ID tokens with a key
+// generated at startup.
+//
+//	go run cmd/mock-oidc/main.go -addr :9000 -client-id api-monitor
+//
+// then start the backend with
+//
+//	OIDC_ISSUER=http://localhost:9000 OIDC_CLIENT_ID=api-monitor OIDC_ADMIN_GROUPS=monitor-admins
+//
+// The login page lets you pick any username and groups. Pass -auto to skip it and log in
+// as -user with -groups straight away (useful with curl).
+
+type authCode struct {
+	ClientID    string
+	RedirectURI string
+	Challenge   string
+	Nonce       string
+	Username    string
+	Groups      []string
+	ExpiresAt   time.Time
+}
+
+type provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+	defaultUser  string
+	defaultGroup string
+	auto         bool
+
+	mutex sync.Mutex
+	codes map[string]authCode
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><head><title>Mock OIDC login</title></head>
+<body style="font-family: sans-serif; max-width: 420px; margin: 60px auto">
+<h2>Mock OIDC provider</h2>
+<form method="POST" action="/authorize">
+  {{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+  {{end}}
+  <p><label>Username<br><input name="username" value="{{.Username}}"></label></p>
+  <p><label>Groups (comma separated)<br><input name="groups" value="{{.Groups}}"></label></p>
+  <p><button type="submit">Sign in</button></p>
+</form>
+</body></html>`))
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "", "issuer URL (default http://localhost<addr>)")
+	clientID := flag.String("client-id", "api-monitor", "accepted client ID")
+	clientSecret := flag.String("client-secret", "", "client secret required at the token endpoint (empty for a public client)")
+	user := flag.String("user", "alice", "default username")
+	groups := flag.String("groups", "monitor-admins", "default comma separated groups")
+	auto := flag.Bool("auto", false, "skip the login page and sign in as -user")
+	flag.Parse()
+
+	if *issuer == "" {
+		*issuer = "http://localhost" + *addr
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal("Failed to generate signing key:", err)
+	}
+
+	p := &provider{
+		issuer:       strings.TrimSuffix(*issuer, "/"),
+		clientID:     *clientID,
+		clientSecret: *clientSecret,
+		key:          key,
+		defaultUser:  *user,
+		defaultGroup: *groups,
+		auto:         *auto,
+		codes:        make(map[string]authCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+
+	fmt.Printf("🔑 Mock OIDC provider on %s (issuer %s, client %s)\n", *addr, p.issuer, p.clientID)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if r.Form.Get("response_type") != "code" || r.Form.Get("client_id") != p.clientID {
+		http.Error(w, "unsupported response_type or unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("code_challenge") == "" || r.Form.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	username, groups := r.Form.Get("username"), r.Form.Get("groups")
+	if r.Method == http.MethodGet {
+		if !p.auto {
+			params := map[string]string{}
+			for _, name := range []string{"response_type", "client_id", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+				params[name] = r.Form.Get(name)
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			loginPage.Execute(w, map[string]interface{}{
+				"Params":   params,
+				"Username": p.defaultUser,
+				"Groups":   p.defaultGroup,
+			})
+			return
+		}
+		username, groups = p.defaultUser, p.defaultGroup
+	}
+
+	code := randomString(24)
+	p.mutex.Lock()
+	p.codes[code] = authCode{
+		ClientID:    p.clientID,
+		RedirectURI: r.Form.Get("redirect_uri"),
+		Challenge:   r.Form.Get("code_challenge"),
+		Nonce:       r.Form.Get("nonce"),
+		Username:    username,
+		Groups:      splitGroups(groups),
+		ExpiresAt:   time.Now().Add(time.Minute),
+	}
+	p.mutex.Unlock()
+
+	query := redirectURI.Query()
+	query.Set("code", code)
+	query.Set("state", r.Form.Get("state"))
+	redirectURI.RawQuery = query.Encode()
+
+	log.Printf("Issued authorization code for %s (groups %v)", username, splitGroups(groups))
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	if p.clientSecret != "" {
+		clientID, secret, ok := r.BasicAuth()
+		if ok {
+			clientID, _ = url.QueryUnescape(clientID)
+			secret, _ = url.QueryUnescape(secret)
+		} else {
+			clientID, secret = r.Form.Get("client_id"), r.Form.Get("client_secret")
+		}
+		if clientID != p.clientID || secret != p.clientSecret {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+	}
+
+	if r.Form.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	p.mutex.Lock()
+	code, exists := p.codes[r.Form.Get("code")]
+	delete(p.codes, r.Form.Get("code"))
+	p.mutex.Unlock()
+
+	if !exists || time.Now().After(code.ExpiresAt) || code.RedirectURI != r.Form.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != code.Challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                p.issuer,
+		"sub":                "mock|" + code.Username,
+		"aud":                code.ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              code.Nonce,
+		"preferred_username": code.Username,
+		"email":              code.Username + "@example.com",
+		"groups":             code.Groups,
+	})
+	idToken.Header["kid"] = "mock-1"
+
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(24),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	public := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": "mock-1",
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func splitGroups(value string) []string {
+	groups := []string{}
+	for _, group := range strings.Split(value, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+func randomString(n int) string {
+	bytes := make([]byte, n)
+	rand.Read(bytes)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
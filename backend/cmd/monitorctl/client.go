@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"api-monitor/app/models"
+)
+
+// apiClient calls the monitor REST API with an API key
+type apiClient struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+func newAPIClient(baseURL, apiKey string) *apiClient {
+	return &apiClient{
+		baseURL: strings.TrimRight(baseURL, "/") + "/api/v1",
+		apiKey:  apiKey,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do sends body as JSON and decodes the "data" field of the response into out, if given
+func (c *apiClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-Key", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error string `json:"error"`
+			Scope string `json:"scope"`
+		}
+		if json.Unmarshal(raw, &failure) == nil && failure.Error != "" {
+			if failure.Scope != "" {
+				return fmt.Errorf("%s %s: %s (%s)", method, path, failure.Error, failure.Scope)
+			}
+			return fmt.Errorf("%s %s: %s", method, path, failure.Error)
+		}
+		return fmt.Errorf("%s %s: HTTP %d", method, path, resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("%s %s: invalid response: %v", method, path, err)
+	}
+	if len(envelope.Data) == 0 || string(envelope.Data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+func (c *apiClient) teams() ([]models.Team, error) {
+	var teams []models.Team
+	return teams, c.do(http.MethodGet, "/teams", nil, &teams)
+}
+
+func (c *apiClient) endpoints() ([]models.APIEndpoint, error) {
+	var endpoints []models.APIEndpoint
+	return endpoints, c.do(http.MethodGet, "/endpoints", nil, &endpoints)
+}
+
+func (c *apiClient) proxies() ([]models.Proxy, error) {
+	var proxies []models.Proxy
+	return proxies, c.do(http.MethodGet, "/proxies", nil, &proxies)
+}
+
+// profileNames returns the auth or TLS profiles or JSON schemas ("auth-profiles",
+// "tls-profiles", "schemas") by id
+func (c *apiClient) profileNames(resource string) (map[int]string, error) {
+	var profiles []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := c.do(http.MethodGet, "/"+resource, nil, &profiles); err != nil {
+		return nil, err
+	}
+
+	names := map[int]string{}
+	for _, profile := range profiles {
+		names[profile.ID] = profile.Name
+	}
+	return names, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+)
+
+// monitorctl keeps the monitors of a team in sync with a directory of YAML (or JSON)
+// definitions, in the monitor document format of the import/export API. It reads the
+// current endpoints and proxies through the REST API, prints a plan and then creates,
+// updates and disables or deletes resources until the server matches the files.
+//
+//	export MONITORCTL_URL=https://monitor.example.com MONITORCTL_API_KEY=amk_...
+//	go run ./cmd/monitorctl -dir monitors -team 3              # plan, confirm, apply
+//	go run ./cmd/monitorctl -dir monitors -team 3 -check       # CI: exit 2 on drift
+//	go run ./cmd/monitorctl -dir monitors -extras delete -auto-approve
+//
+// The API key needs endpoints:read/write and proxies:read/write, plus profiles:read when
+// endpoints use auth or TLS profiles, and teams:read when -team is not given.
+//
+// Exit codes: 0 in sync or applied, 1 error, 2 drift found with -check.
+
+func main() {
+	dir := flag.String("dir", "monitors", "directory (or single file) with monitor definitions")
+	server := flag.String("server", envOr("MONITORCTL_URL", "http://localhost:8080"), "API server URL")
+	apiKey := flag.String("api-key", os.Getenv("MONITORCTL_API_KEY"), "API key (default $MONITORCTL_API_KEY)")
+	teamID := flag.Int("team", envInt("MONITORCTL_TEAM"), "team id (default $MONITORCTL_TEAM, or your only team)")
+	extras := flag.String("extras", extrasDisable, "endpoints and proxies missing from the definitions: keep, disable (endpoints only) or delete")
+	check := flag.Bool("check", false, "only print the plan and exit 2 when the server differs from the definitions")
+	autoApprove := flag.Bool("auto-approve", false, "apply without asking for confirmation")
+	flag.Parse()
+
+	if *apiKey == "" {
+		fail("an API key is required: set -api-key or MONITORCTL_API_KEY")
+	}
+	if *extras != extrasKeep && *extras != extrasDisable && *extras != extrasDelete {
+		fail("-extras must be keep, disable or delete")
+	}
+
+	desired, err := loadDefinitions(*dir)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	client := newAPIClient(*server, *apiKey)
+	if *teamID == 0 {
+		if *teamID, err = defaultTeam(client); err != nil {
+			fail(err.Error())
+		}
+	}
+
+	state, err := loadServerState(client, *teamID, desired)
+	if err != nil {
+		fail("reading the server state: " + err.Error())
+	}
+
+	changes, problems := plan(state, desired, *extras)
+	if len(problems) > 0 {
+		fail("the definitions have errors:\n  " + strings.Join(problems, "\n  "))
+	}
+
+	printPlan(os.Stdout, *teamID, changes)
+	if len(changes) == 0 {
+		return
+	}
+	if *check {
+		os.Exit(2)
+	}
+
+	if !*autoApprove && !confirm() {
+		fmt.Println("Apply cancelled.")
+		return
+	}
+
+	fmt.Println()
+	if err := apply(client, state, changes, os.Stdout); err != nil {
+		fail("apply stopped: " + err.Error())
+	}
+	fmt.Printf("\nApply complete: %d changes.\n", len(changes))
+}
+
+// loadDefinitions reads every .yaml, .yml and .json file below path into one document
+func loadDefinitions(path string) (models.MonitorDocument, error) {
+	merged := models.MonitorDocument{Version: models.MonitorDocumentVersion}
+
+	files := []string{}
+	err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml", ".json":
+			if !entry.IsDir() {
+				files = append(files, file)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return merged, err
+	}
+	if len(files) == 0 {
+		return merged, fmt.Errorf("no .yaml, .yml or .json files found in %s", path)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return merged, err
+		}
+
+		document, err := services.ParseMonitorDocument(data)
+		if err != nil {
+			return merged, fmt.Errorf("%s: %v", file, err)
+		}
+		if document.Version != models.MonitorDocumentVersion {
+			return merged, fmt.Errorf("%s: unsupported document version %d, expected %d",
+				file, document.Version, models.MonitorDocumentVersion)
+		}
+
+		merged.Proxies = append(merged.Proxies, document.Proxies...)
+		merged.Endpoints = append(merged.Endpoints, document.Endpoints...)
+	}
+
+	if problems := services.ValidateMonitorDocument(merged); len(problems) > 0 {
+		return merged, fmt.Errorf("the definitions have errors:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return merged, nil
+}
+
+// defaultTeam returns the only team the API key's owner can edit
+func defaultTeam(client *apiClient) (int, error) {
+	teams, err := client.teams()
+	if err != nil {
+		return 0, fmt.Errorf("listing teams: %v", err)
+	}
+
+	editable := []models.Team{}
+	for _, team := range teams {
+		if services.RoleAtLeast(team.Role, models.TeamRoleEditor) {
+			editable = append(editable, team)
+		}
+	}
+	if len(editable) != 1 {
+		return 0, fmt.Errorf("you can edit %d teams, choose one with -team", len(editable))
+	}
+	return editable[0].ID, nil
+}
+
+func confirm() bool {
+	fmt.Print("\nDo you want to apply these changes? Only 'yes' will be accepted: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envInt(name string) int {
+	value, _ := strconv.Atoi(os.Getenv(name))
+	return value
+}
+
+func fail(message string) {
+	fmt.Fprintln(os.Stderr, "monitorctl: "+message)
+	os.Exit(1)
+}
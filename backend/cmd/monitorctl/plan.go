@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"api-monitor/app/models"
+	"api-monitor/app/services"
+)
+
+// Actions for resources that exist on the server but not in the definitions
+const (
+	actionDelete  = "delete"
+	actionDisable = "disable"
+)
+
+// What to do with endpoints and proxies that are not in the definitions
+const (
+	extrasKeep    = "keep"
+	extrasDisable = "disable" // Endpoints are disabled, proxies kept
+	extrasDelete  = "delete"
+)
+
+var actionSymbols = map[string]string{
+	models.ImportActionCreate: "+",
+	models.ImportActionUpdate: "~",
+	actionDisable:             "!",
+	actionDelete:              "-",
+}
+
+// serverState is what the team currently has on the server
+type serverState struct {
+	teamID       int
+	proxies      map[string]models.Proxy // Every visible proxy by name; names are unique across teams
+	proxyNames   map[int]string
+	endpoints    map[string]models.APIEndpoint // Endpoints of the team by key
+	authProfiles map[int]string
+	tlsProfiles  map[int]string
+	schemas      map[int]string
+}
+
+func loadServerState(client *apiClient, teamID int, desired models.MonitorDocument) (*serverState, error) {
+	state := &serverState{
+		teamID:       teamID,
+		proxies:      map[string]models.Proxy{},
+		proxyNames:   map[int]string{},
+		endpoints:    map[string]models.APIEndpoint{},
+		authProfiles: map[int]string{},
+		tlsProfiles:  map[int]string{},
+		schemas:      map[int]string{},
+	}
+
+	proxies, err := client.proxies()
+	if err != nil {
+		return nil, err
+	}
+	for _, proxy := range proxies {
+		state.proxies[proxy.Name] = proxy
+		state.proxyNames[proxy.ID] = proxy.Name
+	}
+
+	endpoints, err := client.endpoints()
+	if err != nil {
+		return nil, err
+	}
+	needsProfiles := false
+	for _, endpoint := range endpoints {
+		if endpoint.TeamID != nil && *endpoint.TeamID == teamID {
+			state.endpoints[endpoint.Key] = endpoint
+			needsProfiles = needsProfiles || endpoint.AuthProfileID != nil || endpoint.TLSProfileID != nil ||
+				endpoint.ResponseSchemaID != nil
+		}
+	}
+	for _, endpoint := range desired.Endpoints {
+		needsProfiles = needsProfiles || endpoint.AuthProfile != "" || endpoint.TLSProfile != "" || endpoint.Schema != ""
+	}
+
+	// Profiles and schemas need the profiles:read scope, so they are only fetched when used
+	if needsProfiles {
+		if state.authProfiles, err = client.profileNames("auth-profiles"); err != nil {
+			return nil, err
+		}
+		if state.tlsProfiles, err = client.profileNames("tls-profiles"); err != nil {
+			return nil, err
+		}
+		if state.schemas, err = client.profileNames("schemas"); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// plan compares the definitions with the server. Changes are ordered so they can be
+// applied top to bottom: proxies are created before the endpoints using them and deleted
+// after them.
+func plan(state *serverState, desired models.MonitorDocument, extras string) ([]models.ImportChange, []string) {
+	changes := []models.ImportChange{}
+	problems := []string{}
+
+	desiredProxies := map[string]bool{}
+	for i := range desired.Proxies {
+		proxy := services.NormalizeDocumentProxy(desired.Proxies[i])
+		desiredProxies[proxy.Name] = true
+		change := models.ImportChange{ResourceType: "proxy", Key: proxy.Name, Proxy: &proxy}
+
+		current, exists := state.proxies[proxy.Name]
+		switch {
+		case !exists:
+			change.Action = models.ImportActionCreate
+		case current.TeamID == nil || *current.TeamID != state.teamID:
+			problems = append(problems, fmt.Sprintf("proxy %q: the name is used by a proxy of another team", proxy.Name))
+			continue
+		default:
+			// The API only returns masked passwords, sending the mask back keeps the stored
+			// one. A password in the files is sent with other changes but cannot be compared.
+			if proxy.Password == "" {
+				proxy.Password = current.Password
+			}
+			stored := services.DocumentProxyOf(current)
+			stored.Password = proxy.Password
+			change.ID = current.ID
+			change.Changes = services.AuditDiff(services.DocumentState(stored), services.DocumentState(proxy))
+			if len(change.Changes) == 0 {
+				continue
+			}
+			change.Action = models.ImportActionUpdate
+		}
+		changes = append(changes, change)
+	}
+
+	authProfileIDs := reverse(state.authProfiles)
+	tlsProfileIDs := reverse(state.tlsProfiles)
+	schemaIDs := reverse(state.schemas)
+
+	desiredKeys := map[string]bool{}
+	for i := range desired.Endpoints {
+		endpoint := services.NormalizeDocumentEndpoint(desired.Endpoints[i])
+		desiredKeys[endpoint.Key] = true
+		change := models.ImportChange{ResourceType: "endpoint", Key: endpoint.Key, Endpoint: &endpoint}
+		where := fmt.Sprintf("endpoint %q", endpoint.Key)
+
+		if endpoint.Proxy != "" && !desiredProxies[endpoint.Proxy] {
+			proxy, exists := state.proxies[endpoint.Proxy]
+			if !exists || proxy.TeamID == nil || *proxy.TeamID != state.teamID {
+				problems = append(problems, fmt.Sprintf("%s: proxy %q not found in the team", where, endpoint.Proxy))
+			}
+		}
+		if endpoint.AuthProfile != "" {
+			id, exists := authProfileIDs[endpoint.AuthProfile]
+			if !exists {
+				problems = append(problems, fmt.Sprintf("%s: auth profile %q not found", where, endpoint.AuthProfile))
+			}
+			change.AuthProfileID = &id
+		}
+		if endpoint.TLSProfile != "" {
+			id, exists := tlsProfileIDs[endpoint.TLSProfile]
+			if !exists {
+				problems = append(problems, fmt.Sprintf("%s: TLS profile %q not found", where, endpoint.TLSProfile))
+			}
+			change.TLSProfileID = &id
+		}
+		if endpoint.Schema != "" {
+			id, exists := schemaIDs[endpoint.Schema]
+			if !exists {
+				problems = append(problems, fmt.Sprintf("%s: JSON schema %q not found", where, endpoint.Schema))
+			}
+			change.SchemaID = &id
+		}
+
+		if current, exists := state.endpoints[endpoint.Key]; exists {
+			change.ID = current.ID
+			change.Changes = services.AuditDiff(services.DocumentState(state.documentEndpointOf(current)),
+				services.DocumentState(endpoint))
+			if len(change.Changes) == 0 {
+				continue
+			}
+			change.Action = models.ImportActionUpdate
+		} else {
+			change.Action = models.ImportActionCreate
+		}
+		changes = append(changes, change)
+	}
+
+	if extras == extrasKeep {
+		return changes, problems
+	}
+
+	for _, key := range sortedKeys(state.endpoints) {
+		endpoint := state.endpoints[key]
+		if desiredKeys[key] {
+			continue
+		}
+
+		change := models.ImportChange{ResourceType: "endpoint", Key: key, ID: endpoint.ID, Action: actionDelete}
+		if extras == extrasDisable {
+			if !endpoint.IsActive {
+				continue
+			}
+			change.Action = actionDisable
+		}
+		changes = append(changes, change)
+	}
+
+	if extras == extrasDelete {
+		for _, name := range sortedKeys(state.proxies) {
+			proxy := state.proxies[name]
+			if desiredProxies[name] || proxy.TeamID == nil || *proxy.TeamID != state.teamID {
+				continue
+			}
+			changes = append(changes, models.ImportChange{ResourceType: "proxy", Key: name, ID: proxy.ID, Action: actionDelete})
+		}
+	}
+
+	return changes, problems
+}
+
+// printPlan writes the changes in the style of a terraform plan
+func printPlan(w io.Writer, teamID int, changes []models.ImportChange) {
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "No changes. Team %d matches the definitions.\n", teamID)
+		return
+	}
+
+	fmt.Fprintf(w, "monitorctl will perform the following actions on team %d:\n\n", teamID)
+
+	counts := map[string]int{}
+	for _, change := range changes {
+		counts[change.Action]++
+
+		suffix := ""
+		if change.Action == actionDisable {
+			suffix = " (disable)"
+		}
+		fmt.Fprintf(w, "  %s %s %s%s\n", actionSymbols[change.Action], change.ResourceType, change.Key, suffix)
+
+		for _, field := range sortedKeys(change.Changes) {
+			fmt.Fprintf(w, "        %s: %s -> %s\n", field, formatValue(change.Changes[field].Before),
+				formatValue(change.Changes[field].After))
+		}
+	}
+
+	fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to disable, %d to delete.\n",
+		counts[models.ImportActionCreate], counts[models.ImportActionUpdate], counts[actionDisable], counts[actionDelete])
+}
+
+// apply makes the planned changes through the REST API, in order. It stops at the first
+// failure; changes made before it stay applied and show up as done in the next plan.
+func apply(client *apiClient, state *serverState, changes []models.ImportChange, w io.Writer) error {
+	proxyIDs := map[string]int{}
+	for name, proxy := range state.proxies {
+		proxyIDs[name] = proxy.ID
+	}
+
+	for _, change := range changes {
+		var err error
+		path := "/" + map[string]string{"proxy": "proxies", "endpoint": "endpoints"}[change.ResourceType]
+		itemPath := path + "/" + strconv.Itoa(change.ID)
+
+		switch {
+		case change.Action == actionDelete:
+			err = client.do(http.MethodDelete, itemPath, nil, nil)
+		case change.Action == actionDisable:
+			err = client.do(http.MethodPost, itemPath+"/toggle", nil, nil)
+		case change.ResourceType == "proxy":
+			proxy := services.ProxyFromDocument(change, state.teamID)
+			if change.Action == models.ImportActionCreate {
+				err = client.do(http.MethodPost, path, proxy, &proxy)
+			} else {
+				err = client.do(http.MethodPut, itemPath, proxy, &proxy)
+			}
+			proxyIDs[proxy.Name] = proxy.ID
+		default:
+			var proxyID *int
+			if name := change.Endpoint.Proxy; name != "" {
+				id := proxyIDs[name]
+				proxyID = &id
+			}
+			endpoint := services.EndpointFromDocument(change, state.teamID, proxyID)
+			if change.Action == models.ImportActionCreate {
+				err = client.do(http.MethodPost, path, endpoint, &endpoint)
+			} else {
+				err = client.do(http.MethodPut, itemPath, endpoint, &endpoint)
+			}
+			change.PingURL = endpoint.PingURL
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", change.ResourceType, change.Key, err)
+		}
+		fmt.Fprintf(w, "  %s %s %s: %s done\n", actionSymbols[change.Action], change.ResourceType, change.Key, change.Action)
+
+		// Ping URLs are only shown when issued, so they must be copied from here
+		if change.PingURL != "" {
+			fmt.Fprintf(w, "      ping URL: %s\n", change.PingURL)
+		}
+	}
+	return nil
+}
+
+func (state *serverState) documentEndpointOf(endpoint models.APIEndpoint) models.DocumentEndpoint {
+	var proxy, authProfile, tlsProfile, schema string
+	if endpoint.ProxyID != nil {
+		proxy = state.proxyNames[*endpoint.ProxyID]
+	}
+	if endpoint.AuthProfileID != nil {
+		authProfile = state.authProfiles[*endpoint.AuthProfileID]
+	}
+	if endpoint.TLSProfileID != nil {
+		tlsProfile = state.tlsProfiles[*endpoint.TLSProfileID]
+	}
+	if endpoint.ResponseSchemaID != nil {
+		schema = state.schemas[*endpoint.ResponseSchemaID]
+	}
+	return services.DocumentEndpointOf(endpoint, proxy, authProfile, tlsProfile, schema)
+}
+
+func formatValue(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+func reverse(names map[int]string) map[string]int {
+	ids := make(map[string]int, len(names))
+	for id, name := range names {
+		ids[name] = id
+	}
+	return ids
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
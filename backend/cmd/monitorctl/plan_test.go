@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"api-monitor/app/models"
+)
+
+func intPtr(v int) *int { return &v }
+
+// testState is team 3 on the server: proxy egress, endpoints api and legacy, and a proxy
+// of team 5 whose name cannot be used
+func testState() *serverState {
+	return &serverState{
+		teamID: 3,
+		proxies: map[string]models.Proxy{
+			"egress": {ID: 1, Name: "egress", Host: "proxy.test", Port: 3128, Username: "probe", Password: "********",
+				IsActive: true, TeamID: intPtr(3)},
+			"shared": {ID: 2, Name: "shared", Host: "shared.test", Port: 8080, IsActive: true, TeamID: intPtr(5)},
+		},
+		proxyNames: map[int]string{1: "egress", 2: "shared"},
+		endpoints: map[string]models.APIEndpoint{
+			"api":    {ID: 10, Key: "api", Name: "API", URL: "https://api.test/health", Method: "GET", TimeoutSeconds: 30, CheckIntervalSeconds: 60, IsActive: true, TeamID: intPtr(3), ProxyID: intPtr(1), AuthProfileID: intPtr(20)},
+			"legacy": {ID: 11, Key: "legacy", Name: "Legacy", URL: "https://old.test/", Method: "GET", TimeoutSeconds: 30, CheckIntervalSeconds: 60, IsActive: true, TeamID: intPtr(3)},
+		},
+		authProfiles: map[int]string{20: "oauth"},
+		tlsProfiles:  map[int]string{},
+		schemas:      map[int]string{30: "health"},
+	}
+}
+
+// apiEndpoint is endpoint api of testState as a definition
+func apiEndpoint() models.DocumentEndpoint {
+	return models.DocumentEndpoint{Key: "api", Name: "API", URL: "https://api.test/health", TimeoutSeconds: 30,
+		CheckIntervalSeconds: 60, Proxy: "egress", AuthProfile: "oauth"}
+}
+
+type plannedChange struct {
+	Action, ResourceType, Key string
+	ID                        int
+}
+
+func summarize(changes []models.ImportChange) []plannedChange {
+	summary := []plannedChange{}
+	for _, change := range changes {
+		summary = append(summary, plannedChange{change.Action, change.ResourceType, change.Key, change.ID})
+	}
+	return summary
+}
+
+func TestPlanUnchanged(t *testing.T) {
+	desired := models.MonitorDocument{
+		Proxies:   []models.DocumentProxy{{Name: "egress", Host: "proxy.test", Port: 3128, Username: "probe"}},
+		Endpoints: []models.DocumentEndpoint{apiEndpoint()},
+	}
+
+	changes, problems := plan(testState(), desired, extrasKeep)
+	if len(changes) != 0 || len(problems) != 0 {
+		t.Fatalf("changes %+v, problems %v; want none", summarize(changes), problems)
+	}
+
+	var out bytes.Buffer
+	printPlan(&out, 3, changes)
+	if out.String() != "No changes. Team 3 matches the definitions.\n" {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestPlanCreateAndUpdate(t *testing.T) {
+	updated := apiEndpoint()
+	updated.URL = "https://api.test/ready"
+	desired := models.MonitorDocument{
+		Proxies: []models.DocumentProxy{
+			{Name: "egress", Host: "proxy.test", Port: 3129, Username: "probe"},
+			{Name: "internal", Host: "internal.test", Port: 8080},
+		},
+		Endpoints: []models.DocumentEndpoint{
+			updated,
+			{Key: "web", Name: "Web", URL: "https://web.test/", Proxy: "internal", Schema: "health"},
+		},
+	}
+
+	changes, problems := plan(testState(), desired, extrasKeep)
+	if len(problems) != 0 {
+		t.Fatalf("problems = %v", problems)
+	}
+	want := []plannedChange{
+		{models.ImportActionUpdate, "proxy", "egress", 1},
+		{models.ImportActionCreate, "proxy", "internal", 0},
+		{models.ImportActionUpdate, "endpoint", "api", 10},
+		{models.ImportActionCreate, "endpoint", "web", 0},
+	}
+	if got := summarize(changes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes = %+v, want %+v", got, want)
+	}
+
+	// Only what differs is listed; the masked password is not a difference
+	if got := changes[0].Changes; len(got) != 1 || got["port"].After != float64(3129) {
+		t.Errorf("proxy changes = %+v, want the port only", got)
+	}
+	if changes[0].Proxy.Password != "********" {
+		t.Errorf("proxy password = %q, want the mask so the stored password is kept", changes[0].Proxy.Password)
+	}
+	if got := changes[2].Changes; len(got) != 1 || got["url"].Before != "https://api.test/health" || got["url"].After != "https://api.test/ready" {
+		t.Errorf("endpoint changes = %+v, want the url only", got)
+	}
+	if id := changes[3].SchemaID; id == nil || *id != 30 {
+		t.Errorf("schema of web = %v, want 30", id)
+	}
+
+	var out bytes.Buffer
+	printPlan(&out, 3, changes)
+	wantOutput := `monitorctl will perform the following actions on team 3:
+
+  ~ proxy egress
+        port: 3128 -> 3129
+  + proxy internal
+  ~ endpoint api
+        url: "https://api.test/health" -> "https://api.test/ready"
+  + endpoint web
+
+Plan: 2 to create, 2 to update, 0 to disable, 0 to delete.
+`
+	if out.String() != wantOutput {
+		t.Errorf("output =\n%s\nwant\n%s", out.String(), wantOutput)
+	}
+}
+
+func TestPlanExtras(t *testing.T) {
+	state := testState()
+	state.proxies["spare"] = models.Proxy{ID: 4, Name: "spare", Host: "spare.test", Port: 3128, TeamID: intPtr(3)}
+	state.endpoints["paused"] = models.APIEndpoint{ID: 12, Key: "paused", Name: "Paused", URL: "https://paused.test/",
+		Method: "GET", TeamID: intPtr(3)}
+	desired := models.MonitorDocument{
+		Proxies:   []models.DocumentProxy{{Name: "egress", Host: "proxy.test", Port: 3128, Username: "probe"}},
+		Endpoints: []models.DocumentEndpoint{apiEndpoint()},
+	}
+
+	tests := map[string][]plannedChange{
+		extrasKeep: {},
+		// Inactive endpoints are already disabled, proxies are kept
+		extrasDisable: {{actionDisable, "endpoint", "legacy", 11}},
+		// Proxies of other teams are never deleted
+		extrasDelete: {
+			{actionDelete, "endpoint", "legacy", 11},
+			{actionDelete, "endpoint", "paused", 12},
+			{actionDelete, "proxy", "spare", 4},
+		},
+	}
+	for extras, want := range tests {
+		changes, problems := plan(state, desired, extras)
+		if got := summarize(changes); len(problems) != 0 || !reflect.DeepEqual(got, want) {
+			t.Errorf("-extras %s: changes %+v, problems %v; want %+v", extras, got, problems, want)
+		}
+	}
+
+	changes, _ := plan(state, desired, extrasDelete)
+	var out bytes.Buffer
+	printPlan(&out, 3, changes)
+	if !strings.Contains(out.String(), "  - endpoint legacy\n") ||
+		!strings.HasSuffix(out.String(), "Plan: 0 to create, 0 to update, 0 to disable, 3 to delete.\n") {
+		t.Errorf("output =\n%s", out.String())
+	}
+	changes, _ = plan(state, desired, extrasDisable)
+	out.Reset()
+	printPlan(&out, 3, changes)
+	if !strings.Contains(out.String(), "  ! endpoint legacy (disable)\n") {
+		t.Errorf("output =\n%s", out.String())
+	}
+}
+
+func TestPlanProblems(t *testing.T) {
+	desired := models.MonitorDocument{
+		Proxies: []models.DocumentProxy{{Name: "shared", Host: "mine.test", Port: 3128}},
+		Endpoints: []models.DocumentEndpoint{
+			{Key: "web", Name: "Web", URL: "https://web.test/", Proxy: "missing", AuthProfile: "basic",
+				TLSProfile: "mtls", Schema: "unknown"},
+			{Key: "admin", Name: "Admin", URL: "https://admin.test/", Proxy: "shared"},
+		},
+	}
+
+	_, problems := plan(testState(), desired, extrasKeep)
+	want := []string{
+		`proxy "shared": the name is used by a proxy of another team`,
+		`endpoint "web": proxy "missing" not found in the team`,
+		`endpoint "web": auth profile "basic" not found`,
+		`endpoint "web": TLS profile "mtls" not found`,
+		`endpoint "web": JSON schema "unknown" not found`,
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("problems =\n%s\nwant\n%s", strings.Join(problems, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestApplyStopsAtFirstFailure(t *testing.T) {
+	var requests []string
+	var endpointBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/api/v1/proxies":
+			w.Write([]byte(`{"data": {"id": 7, "name": "internal"}}`))
+		case "/api/v1/endpoints":
+			json.NewDecoder(r.Body).Decode(&endpointBody)
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "Auth profile not found in the endpoint's team"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	desired := models.MonitorDocument{
+		Proxies:   []models.DocumentProxy{{Name: "internal", Host: "internal.test", Port: 8080}},
+		Endpoints: []models.DocumentEndpoint{{Key: "web", Name: "Web", URL: "https://web.test/", Proxy: "internal"}},
+	}
+	state := testState()
+	changes, _ := plan(state, desired, extrasDisable)
+
+	var out bytes.Buffer
+	err := apply(newAPIClient(server.URL, "amk_test"), state, changes, &out)
+	if err == nil || err.Error() != "endpoint web: POST /endpoints: Auth profile not found in the endpoint's team" {
+		t.Fatalf("error = %v", err)
+	}
+	if out.String() != "  + proxy internal: create done\n" {
+		t.Errorf("output = %q, want the proxy created before the failure", out.String())
+	}
+	if endpointBody["proxy_id"] != float64(7) {
+		t.Errorf("endpoint proxy_id = %v, want the id of the proxy just created", endpointBody["proxy_id"])
+	}
+	// The disable of legacy planned after the failed change is not sent
+	if want := []string{"POST /api/v1/proxies", "POST /api/v1/endpoints"}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
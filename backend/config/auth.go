@@ -0,0 +1,86 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Registration modes for the public /auth/register route
+const (
+	RegistrationDisabled   = "disabled"
+	RegistrationInviteOnly = "invite"
+	RegistrationOpen       = "open"
+)
+
+// GetRegistrationMode returns REGISTRATION_MODE, defaulting to invite-only
+func GetRegistrationMode() string {
+	switch mode := strings.ToLower(GetEnv("REGISTRATION_MODE", RegistrationInviteOnly)); mode {
+	case RegistrationDisabled, RegistrationOpen:
+		return mode
+	default:
+		return RegistrationInviteOnly
+	}
+}
+
+// GetRegistrationTeam returns the team that open registrations join as viewers
+func GetRegistrationTeam() string {
+	return GetEnv("REGISTRATION_TEAM", "Default")
+}
+
+// GetAccessTokenTTL returns ACCESS_TOKEN_TTL, the lifetime of JWT access tokens (default 15m)
+func GetAccessTokenTTL() time.Duration {
+	return getDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// GetRefreshTokenTTL returns REFRESH_TOKEN_TTL, how long an idle session can still be refreshed (default 30 days)
+func GetRefreshTokenTTL() time.Duration {
+	return getDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// LoginThrottleConfig controls brute-force protection of password logins
+type LoginThrottleConfig struct {
+	MaxFailures     int           // Failed logins for one username before the account is locked
+	LockoutDuration time.Duration // How long a locked account stays locked
+	IPFreeAttempts  int           // Failed logins from one IP before backoff starts
+	BackoffBase     time.Duration // First backoff delay, doubled on every further failure
+	BackoffMax      time.Duration // Upper bound of the backoff delay
+}
+
+// GetLoginThrottleConfig reads the LOGIN_* environment variables
+func GetLoginThrottleConfig() LoginThrottleConfig {
+	return LoginThrottleConfig{
+		MaxFailures:     getInt("LOGIN_MAX_FAILURES", 5),
+		LockoutDuration: getDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		IPFreeAttempts:  getInt("LOGIN_IP_FREE_ATTEMPTS", 10),
+		BackoffBase:     getDuration("LOGIN_BACKOFF_BASE", time.Second),
+		BackoffMax:      getDuration("LOGIN_BACKOFF_MAX", 5*time.Minute),
+	}
+}
+
+func getInt(key string, fallback int) int {
+	value, err := strconv.Atoi(GetEnv(key, ""))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(GetEnv(key, ""))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// GetTwoFactorRequiredRoles returns TWO_FACTOR_REQUIRED_ROLES, the global roles that must
+// use two-factor authentication for password logins (e.g. "admin")
+func GetTwoFactorRequiredRoles() []string {
+	return splitList(GetEnv("TWO_FACTOR_REQUIRED_ROLES", ""))
+}
+
+// GetTOTPIssuer returns the issuer shown in authenticator apps
+func GetTOTPIssuer() string {
+	return GetEnv("TOTP_ISSUER", "API Monitor")
+}
@@ -23,6 +23,11 @@ func GetJWTSecret() []byte {
 	return []byte(GetEnv("JWT_SECRET", "your-secret-key-change-this-in-production"))
 }
 
+// GetEncryptionKey returns the key used to encrypt secrets at rest, falling back to the JWT secret
+func GetEncryptionKey() []byte {
+	return []byte(GetEnv("ENCRYPTION_KEY", string(GetJWTSecret())))
+}
+
 func ConnectDB() (*sql.DB, error) {
 	host := GetEnv("DB_HOST", "localhost")
 	port := GetEnv("DB_PORT", "5432")
@@ -133,9 +138,29 @@ func FreshMigrate(db *sql.DB) error {
 	// Drop all tables in the correct order to avoid foreign key constraints
 	dropStatements := []string{
 		"DROP TABLE IF EXISTS api_check_logs CASCADE;",
+		"DROP TABLE IF EXISTS response_captures CASCADE;",
+		"DROP TABLE IF EXISTS endpoint_versions CASCADE;",
+		"DROP TABLE IF EXISTS endpoint_dependencies CASCADE;",
+		"DROP TABLE IF EXISTS heartbeat_states CASCADE;",
+		"DROP TABLE IF EXISTS content_changes CASCADE;",
+		"DROP TABLE IF EXISTS response_snapshots CASCADE;",
 		"DROP TABLE IF EXISTS api_endpoints CASCADE;",
+		"DROP TABLE IF EXISTS auth_profiles CASCADE;",
+		"DROP TABLE IF EXISTS tls_profiles CASCADE;",
+		"DROP TABLE IF EXISTS json_schemas CASCADE;",
 		"DROP TABLE IF EXISTS users CASCADE;",
 		"DROP TABLE IF EXISTS proxies CASCADE;",
+		"DROP TABLE IF EXISTS audit_logs CASCADE;",
+		"DROP TABLE IF EXISTS login_throttles CASCADE;",
+		"DROP TABLE IF EXISTS login_challenges CASCADE;",
+		"DROP TABLE IF EXISTS user_recovery_codes CASCADE;",
+		"DROP TABLE IF EXISTS oidc_logins CASCADE;",
+		"DROP TABLE IF EXISTS api_keys CASCADE;",
+		"DROP TABLE IF EXISTS refresh_tokens CASCADE;",
+		"DROP TABLE IF EXISTS user_sessions CASCADE;",
+		"DROP TABLE IF EXISTS invitations CASCADE;",
+		"DROP TABLE IF EXISTS team_members CASCADE;",
+		"DROP TABLE IF EXISTS teams CASCADE;",
 	}
 
 	for _, stmt := range dropStatements {
@@ -0,0 +1,53 @@
+package config
+
+import "strings"
+
+// OIDCConfig configures single sign-on with an OpenID Connect identity provider
+type OIDCConfig struct {
+	Issuer         string
+	ClientID       string
+	ClientSecret   string   // Optional for public clients, PKCE is always used
+	RedirectURL    string   // Backend callback, e.g. http://localhost:8080/api/v1/auth/oidc/callback
+	FrontendURL    string   // Where the browser is sent after the callback with a one-time login code
+	Scopes         []string // Requested scopes, openid is always included
+	UsernameClaim  string   // Claim used as username for new users
+	GroupsClaim    string   // Claim holding the user's groups
+	AdminGroups    []string // Members of any of these groups get the admin role
+	AllowedGroups  []string // If set, only members of these groups may log in
+	LinkByUsername bool     // Link a first SSO login to an existing local user with the same username
+}
+
+// GetOIDCConfig reads the OIDC_* environment variables
+func GetOIDCConfig() OIDCConfig {
+	return OIDCConfig{
+		Issuer:         strings.TrimSuffix(GetEnv("OIDC_ISSUER", ""), "/"),
+		ClientID:       GetEnv("OIDC_CLIENT_ID", ""),
+		ClientSecret:   GetEnv("OIDC_CLIENT_SECRET", ""),
+		RedirectURL:    GetEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/auth/oidc/callback"),
+		FrontendURL:    GetEnv("OIDC_FRONTEND_URL", "http://localhost:3000/login"),
+		Scopes:         splitList(GetEnv("OIDC_SCOPES", "openid profile email")),
+		UsernameClaim:  GetEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+		GroupsClaim:    GetEnv("OIDC_GROUPS_CLAIM", "groups"),
+		AdminGroups:    splitList(GetEnv("OIDC_ADMIN_GROUPS", "")),
+		AllowedGroups:  splitList(GetEnv("OIDC_ALLOWED_GROUPS", "")),
+		LinkByUsername: strings.ToLower(GetEnv("OIDC_LINK_BY_USERNAME", "false")) == "true",
+	}
+}
+
+// Enabled reports whether an issuer and client are configured
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != ""
+}
+
+// LocalLoginEnabled reports whether username/password login and registration are allowed
+// (LOCAL_LOGIN_ENABLED, default true). Disable it once everyone signs in through OIDC.
+func LocalLoginEnabled() bool {
+	return strings.ToLower(GetEnv("LOCAL_LOGIN_ENABLED", "true")) != "false"
+}
+
+// splitList splits a comma or space separated list
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
@@ -0,0 +1,20 @@
+-- Create auth_profiles table for reusable endpoint credentials (OAuth2, basic auth, API keys)
+CREATE TABLE IF NOT EXISTS auth_profiles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    type VARCHAR(50) NOT NULL CHECK (type IN ('oauth2_client_credentials', 'oauth2_refresh_token', 'basic', 'api_key')),
+    config JSONB NOT NULL DEFAULT '{}',
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    last_error TEXT DEFAULT '',
+    last_error_at TIMESTAMP WITH TIME ZONE NULL, -- Last token acquisition failure
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Add auth_profile_id column to api_endpoints table
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS auth_profile_id INTEGER REFERENCES auth_profiles(id) ON DELETE SET NULL;
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_api_endpoints_auth_profile_id ON api_endpoints(auth_profile_id);
+CREATE INDEX IF NOT EXISTS idx_auth_profiles_active ON auth_profiles(is_active);
@@ -0,0 +1,20 @@
+-- Create tls_profiles table for client certificates and custom CA bundles
+CREATE TABLE IF NOT EXISTS tls_profiles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    client_cert TEXT DEFAULT '', -- Encrypted PEM
+    client_key TEXT DEFAULT '', -- Encrypted PEM
+    ca_bundle TEXT DEFAULT '', -- Encrypted PEM
+    server_name VARCHAR(255) DEFAULT '', -- SNI override
+    min_version VARCHAR(10) DEFAULT '' CHECK (min_version IN ('', '1.0', '1.1', '1.2', '1.3')),
+    insecure_skip_verify BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Add tls_profile_id column to api_endpoints table
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS tls_profile_id INTEGER REFERENCES tls_profiles(id) ON DELETE SET NULL;
+
+-- Create index for performance
+CREATE INDEX IF NOT EXISTS idx_api_endpoints_tls_profile_id ON api_endpoints(tls_profile_id);
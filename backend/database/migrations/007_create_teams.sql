@@ -0,0 +1,41 @@
+-- Create teams and per-team roles for endpoint and proxy ownership
+CREATE TABLE IF NOT EXISTS teams (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS team_members (
+    team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'viewer' CHECK (role IN ('viewer', 'editor', 'owner')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (team_id, user_id)
+);
+
+-- Endpoints and proxies belong to a team; a team cannot be deleted while it still owns resources
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS team_id INTEGER REFERENCES teams(id) ON DELETE RESTRICT;
+
+ALTER TABLE proxies
+ADD COLUMN IF NOT EXISTS team_id INTEGER REFERENCES teams(id) ON DELETE RESTRICT;
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_team_members_user_id ON team_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_api_endpoints_team_id ON api_endpoints(team_id);
+CREATE INDEX IF NOT EXISTS idx_proxies_team_id ON proxies(team_id);
+
+-- Move existing data into a default team
+INSERT INTO teams (name) VALUES ('Default') ON CONFLICT (name) DO NOTHING;
+
+UPDATE api_endpoints SET team_id = (SELECT id FROM teams WHERE name = 'Default') WHERE team_id IS NULL;
+UPDATE proxies SET team_id = (SELECT id FROM teams WHERE name = 'Default') WHERE team_id IS NULL;
+
+-- Existing users keep the access they had: admins own the default team, everyone else edits it.
+-- Only runs while no memberships exist so later membership changes are not overwritten.
+INSERT INTO team_members (team_id, user_id, role)
+SELECT t.id, u.id, CASE WHEN u.role = 'admin' THEN 'owner' ELSE 'editor' END
+FROM users u, teams t
+WHERE t.name = 'Default' AND NOT EXISTS (SELECT 1 FROM team_members)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+-- Allow admins to revoke every token of a user at once (force logout, deactivation, role change)
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS tokens_revoked_at TIMESTAMP WITH TIME ZONE NULL; -- Tokens issued before this are rejected
@@ -0,0 +1,16 @@
+-- Create invitations table for invite-only registration
+CREATE TABLE IF NOT EXISTS invitations (
+    id SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 of the invite token, the token itself is shown once
+    role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin')),
+    team_id INTEGER NULL REFERENCES teams(id) ON DELETE CASCADE,
+    team_role VARCHAR(20) NULL CHECK (team_role IN ('viewer', 'editor', 'owner')),
+    created_by INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+    used_by INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_invitations_expires_at ON invitations(expires_at);
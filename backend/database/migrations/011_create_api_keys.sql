@@ -0,0 +1,16 @@
+-- Create api_keys table for long-lived automation credentials
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- the key acts as this user
+    name VARCHAR(255) NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL, -- first characters of the key, to recognise it in listings
+    key_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 of the key, the key itself is shown once
+    scopes JSONB NOT NULL DEFAULT '[]',
+    expires_at TIMESTAMP WITH TIME ZONE NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
@@ -0,0 +1,20 @@
+-- Link users to their OIDC identity (the "sub" claim of the identity provider)
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS oidc_subject VARCHAR(255) NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_subject ON users(oidc_subject);
+
+-- Create oidc_logins table: pending authorization-code flows and their one-time handoff codes
+CREATE TABLE IF NOT EXISTS oidc_logins (
+    id SERIAL PRIMARY KEY,
+    state VARCHAR(64) UNIQUE NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL, -- PKCE verifier, only its S256 challenge is sent to the browser
+    user_id INTEGER NULL REFERENCES users(id) ON DELETE CASCADE, -- set once the callback succeeds
+    login_code_hash VARCHAR(64) UNIQUE NULL, -- SHA-256 of the code the frontend exchanges for tokens
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_oidc_logins_expires_at ON oidc_logins(expires_at);
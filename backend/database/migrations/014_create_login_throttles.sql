@@ -0,0 +1,29 @@
+-- Create login_throttles table: failed login counters shared by all backend replicas
+CREATE TABLE IF NOT EXISTS login_throttles (
+    throttle_key VARCHAR(255) PRIMARY KEY, -- "ip:<address>" or "user:<username>"
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    blocked_until TIMESTAMP WITH TIME ZONE NULL -- exponential backoff, no attempts before this
+);
+
+-- Temporary lockout after too many failed logins, lifted automatically or by an admin
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE NULL;
+
+-- Create audit_logs table for security relevant events
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id SERIAL PRIMARY KEY,
+    actor_id INTEGER NULL REFERENCES users(id) ON DELETE SET NULL, -- NULL for system events
+    actor_username VARCHAR(50) NOT NULL DEFAULT '', -- kept when the actor is deleted
+    action VARCHAR(100) NOT NULL,
+    resource_type VARCHAR(50) NOT NULL DEFAULT '',
+    resource_id VARCHAR(100) NOT NULL DEFAULT '',
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_login_throttles_last_failure_at ON login_throttles(last_failure_at);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_resource ON audit_logs(resource_type, resource_id);
@@ -0,0 +1,9 @@
+-- Configuration changes keep the resource state before and after the change.
+-- Secrets are redacted before they are stored.
+ALTER TABLE audit_logs
+ADD COLUMN IF NOT EXISTS before_state JSONB NULL, -- NULL for creations
+ADD COLUMN IF NOT EXISTS after_state JSONB NULL, -- NULL for deletions
+ADD COLUMN IF NOT EXISTS changes JSONB NOT NULL DEFAULT '{}'; -- field -> {"before": ..., "after": ...}
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_id ON audit_logs(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs(action);
@@ -0,0 +1,35 @@
+-- Create endpoint_versions table: every change of an endpoint definition is kept so a
+-- bad edit can be rolled back
+CREATE TABLE IF NOT EXISTS endpoint_versions (
+    id SERIAL PRIMARY KEY,
+    endpoint_id INTEGER NOT NULL REFERENCES api_endpoints(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    definition JSONB NOT NULL, -- name, url, method, headers, body, timeouts, proxy, profiles and team
+    change_type VARCHAR(20) NOT NULL, -- create, update or restore
+    restored_from INTEGER NULL, -- version a restore went back to
+    created_by INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+    created_by_username VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (endpoint_id, version)
+);
+
+-- Current version of each endpoint, and the version that produced each check log
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE api_check_logs
+ADD COLUMN IF NOT EXISTS endpoint_version INTEGER NULL;
+
+CREATE INDEX IF NOT EXISTS idx_api_check_logs_endpoint_version ON api_check_logs(endpoint_id, endpoint_version);
+
+-- Existing endpoints start their history with their current definition as version 1
+INSERT INTO endpoint_versions (endpoint_id, version, definition, change_type, created_at)
+SELECT e.id, e.version,
+       jsonb_build_object(
+           'name', e.name, 'url', e.url, 'method', e.method, 'headers', COALESCE(e.headers, '{}'),
+           'body', COALESCE(e.body, ''), 'timeout_seconds', e.timeout_seconds,
+           'check_interval_seconds', e.check_interval_seconds, 'proxy_id', e.proxy_id,
+           'auth_profile_id', e.auth_profile_id, 'tls_profile_id', e.tls_profile_id, 'team_id', e.team_id),
+       'create', e.created_at
+FROM api_endpoints e
+WHERE NOT EXISTS (SELECT 1 FROM endpoint_versions v WHERE v.endpoint_id = e.id);
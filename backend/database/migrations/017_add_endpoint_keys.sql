@@ -0,0 +1,26 @@
+-- Stable endpoint keys: import/export documents identify endpoints by key since ids differ
+-- between installations. Keys are unique within a team.
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS key VARCHAR(100) NULL;
+
+-- Existing endpoints get a key derived from their name, suffixed with the id when the team
+-- already has an endpoint with that name
+WITH slugs AS (
+    SELECT id, team_id,
+           COALESCE(NULLIF(RTRIM(LEFT(TRIM(BOTH '-' FROM LOWER(REGEXP_REPLACE(name, '[^a-zA-Z0-9]+', '-', 'g'))), 80), '-'), ''),
+                    'endpoint') AS slug
+    FROM api_endpoints
+    WHERE key IS NULL
+), numbered AS (
+    SELECT id, slug, ROW_NUMBER() OVER (PARTITION BY team_id, slug ORDER BY id) AS n
+    FROM slugs
+)
+UPDATE api_endpoints e
+SET key = numbered.slug || CASE WHEN numbered.n > 1 THEN '-' || e.id ELSE '' END
+FROM numbered
+WHERE numbered.id = e.id;
+
+ALTER TABLE api_endpoints
+ALTER COLUMN key SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_endpoints_team_key ON api_endpoints(team_id, key);
@@ -0,0 +1,10 @@
+-- Key/value labels (env=prod, service=checkout) and a folder-style group path
+-- ("payments/checkout") for organizing and selecting endpoints
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS group_path VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_api_endpoints_labels ON api_endpoints USING GIN (labels);
+CREATE INDEX IF NOT EXISTS idx_api_endpoints_group_path ON api_endpoints(group_path varchar_pattern_ops);
@@ -0,0 +1,21 @@
+-- Create endpoint_dependencies table: an endpoint whose dependency is down is reported as
+-- blocked instead of down, without an alert and without counting against its uptime
+CREATE TABLE IF NOT EXISTS endpoint_dependencies (
+    endpoint_id INTEGER NOT NULL REFERENCES api_endpoints(id) ON DELETE CASCADE,
+    depends_on_id INTEGER NOT NULL REFERENCES api_endpoints(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (endpoint_id, depends_on_id),
+    CHECK (endpoint_id <> depends_on_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_endpoint_dependencies_depends_on ON endpoint_dependencies(depends_on_id);
+
+-- Outcome of each check: up, down or blocked (down while a dependency was down). Older
+-- logs have no status and are classified by their status code and error.
+ALTER TABLE api_check_logs
+ADD COLUMN IF NOT EXISTS status VARCHAR(10) NULL;
+
+ALTER TABLE api_check_logs
+ADD COLUMN IF NOT EXISTS blocked_by INTEGER NULL REFERENCES api_endpoints(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_api_check_logs_endpoint_checked_at ON api_check_logs(endpoint_id, checked_at DESC);
@@ -0,0 +1,21 @@
+-- Heartbeat endpoints are not polled: jobs ping a secret URL and the endpoint is down when
+-- no ping arrived within check_interval_seconds plus grace_seconds
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS type VARCHAR(20) NOT NULL DEFAULT 'http';
+
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS grace_seconds INTEGER NOT NULL DEFAULT 0;
+
+-- SHA-256 of the ping URL token, the token itself is only shown when it is issued
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS ping_token_hash VARCHAR(64) NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_endpoints_ping_token_hash ON api_endpoints(ping_token_hash);
+
+-- Latest ping of each heartbeat, kept apart from api_endpoints so pings do not touch
+-- updated_at
+CREATE TABLE IF NOT EXISTS heartbeat_states (
+    endpoint_id INTEGER PRIMARY KEY REFERENCES api_endpoints(id) ON DELETE CASCADE,
+    last_ping_at TIMESTAMP WITH TIME ZONE NULL,
+    started_at TIMESTAMP WITH TIME ZONE NULL -- set by a start ping until the job finishes
+);
@@ -0,0 +1,34 @@
+-- Opt-in content tracking: {"enabled": true, "ignore_paths": ["meta.generated_at"]}
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS content_tracking JSONB NOT NULL DEFAULT '{}';
+
+-- Distinct normalized response bodies of endpoints with content tracking. The newest
+-- snapshot of an endpoint is the baseline the next successful check is compared with.
+CREATE TABLE IF NOT EXISTS response_snapshots (
+    id SERIAL PRIMARY KEY,
+    endpoint_id INTEGER NOT NULL REFERENCES api_endpoints(id) ON DELETE CASCADE,
+    content_hash VARCHAR(64) NOT NULL,
+    shape_hash VARCHAR(64) NOT NULL DEFAULT '', -- empty for bodies that are not JSON
+    body TEXT NULL, -- normalized body, NULL when it was too large to keep
+    shape JSONB NULL,
+    first_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_response_snapshots_endpoint ON response_snapshots(endpoint_id, id DESC);
+
+-- Content changed events: the check that saw the new content and the differences
+CREATE TABLE IF NOT EXISTS content_changes (
+    id SERIAL PRIMARY KEY,
+    endpoint_id INTEGER NOT NULL REFERENCES api_endpoints(id) ON DELETE CASCADE,
+    check_log_id INTEGER NULL REFERENCES api_check_logs(id) ON DELETE SET NULL,
+    change_type VARCHAR(10) NOT NULL, -- shape or content
+    previous_snapshot_id INTEGER NULL REFERENCES response_snapshots(id) ON DELETE SET NULL,
+    snapshot_id INTEGER NULL REFERENCES response_snapshots(id) ON DELETE SET NULL,
+    diff JSONB NOT NULL DEFAULT '[]',
+    diff_truncated BOOLEAN NOT NULL DEFAULT false,
+    detected_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_changes_endpoint ON content_changes(endpoint_id, detected_at DESC);
+CREATE INDEX IF NOT EXISTS idx_content_changes_check_log ON content_changes(check_log_id);
@@ -0,0 +1,21 @@
+-- Reusable JSON Schemas that endpoints validate their responses against
+CREATE TABLE IF NOT EXISTS json_schemas (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    schema JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- An endpoint has either its own schema or one from the library. Schemas in use cannot be
+-- deleted, dropping them would silently stop the validation.
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS response_schema JSONB NULL,
+ADD COLUMN IF NOT EXISTS response_schema_id INTEGER NULL REFERENCES json_schemas(id) ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS idx_api_endpoints_response_schema_id ON api_endpoints(response_schema_id);
+
+-- Validation errors of the response, NULL when the endpoint has no schema
+ALTER TABLE api_check_logs
+ADD COLUMN IF NOT EXISTS schema_errors JSONB NULL;
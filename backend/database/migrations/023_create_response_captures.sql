@@ -0,0 +1,23 @@
+-- Per-endpoint capture settings: {"mode": "on_failure", "max_bytes": 1048576, "read_limit_bytes": 10485760}
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS response_capture JSONB NOT NULL DEFAULT '{}';
+
+-- Full responses of checks, gzip compressed, kept apart from the check logs which only
+-- hold an excerpt
+CREATE TABLE IF NOT EXISTS response_captures (
+    id SERIAL PRIMARY KEY,
+    endpoint_id INTEGER NOT NULL REFERENCES api_endpoints(id) ON DELETE CASCADE,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    headers TEXT NOT NULL DEFAULT '',
+    body BYTEA NOT NULL, -- gzip
+    body_size INTEGER NOT NULL DEFAULT 0, -- Uncompressed size of the stored body
+    compressed_size INTEGER NOT NULL DEFAULT 0,
+    truncated BOOLEAN NOT NULL DEFAULT false, -- The body hit the read limit or max_bytes
+    captured_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_response_captures_endpoint ON response_captures(endpoint_id);
+CREATE INDEX IF NOT EXISTS idx_response_captures_captured_at ON response_captures(captured_at);
+
+ALTER TABLE api_check_logs
+ADD COLUMN IF NOT EXISTS response_capture_id INTEGER NULL REFERENCES response_captures(id) ON DELETE SET NULL;
@@ -0,0 +1,5 @@
+-- What each check sent and received: the effective request headers (secrets redacted),
+-- redirect chain, final URL, protocol, remote IP and every response header value.
+-- response_headers keeps the first value of each header for existing clients.
+ALTER TABLE api_check_logs
+ADD COLUMN IF NOT EXISTS details JSONB NULL;
@@ -0,0 +1,4 @@
+-- Per-endpoint connection settings: {"disable_redirects": true, "http_version": "2",
+-- "resolve": {"api.example.com": "10.0.0.12"}, "user_agent": "api-monitor", ...}
+ALTER TABLE api_endpoints
+ADD COLUMN IF NOT EXISTS transport JSONB NOT NULL DEFAULT '{}';
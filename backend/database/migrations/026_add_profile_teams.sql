@@ -0,0 +1,25 @@
+-- Auth profiles, TLS profiles and library schemas belong to a team like endpoints and proxies
+ALTER TABLE auth_profiles
+ADD COLUMN IF NOT EXISTS team_id INTEGER REFERENCES teams(id) ON DELETE RESTRICT;
+
+ALTER TABLE tls_profiles
+ADD COLUMN IF NOT EXISTS team_id INTEGER REFERENCES teams(id) ON DELETE RESTRICT;
+
+ALTER TABLE json_schemas
+ADD COLUMN IF NOT EXISTS team_id INTEGER REFERENCES teams(id) ON DELETE RESTRICT;
+
+-- Move existing profiles and schemas into the default team
+INSERT INTO teams (name) VALUES ('Default') ON CONFLICT (name) DO NOTHING;
+
+UPDATE auth_profiles SET team_id = (SELECT id FROM teams WHERE name = 'Default') WHERE team_id IS NULL;
+UPDATE tls_profiles SET team_id = (SELECT id FROM teams WHERE name = 'Default') WHERE team_id IS NULL;
+UPDATE json_schemas SET team_id = (SELECT id FROM teams WHERE name = 'Default') WHERE team_id IS NULL;
+
+-- Names are unique within a team, which is where monitor documents look them up
+ALTER TABLE auth_profiles DROP CONSTRAINT IF EXISTS auth_profiles_name_key;
+ALTER TABLE tls_profiles DROP CONSTRAINT IF EXISTS tls_profiles_name_key;
+ALTER TABLE json_schemas DROP CONSTRAINT IF EXISTS json_schemas_name_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_auth_profiles_team_name ON auth_profiles(team_id, name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tls_profiles_team_name ON tls_profiles(team_id, name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_json_schemas_team_name ON json_schemas(team_id, name);
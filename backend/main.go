@@ -2,6 +2,9 @@ package main
 
 import (
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"api-monitor/app/services"
 	"api-monitor/config"
@@ -39,6 +42,20 @@ func main() {
 	// Setup routes
 	routes.SetupRoutes(app, db, monitor)
 
+	// Stop on SIGINT/SIGTERM: requests in flight finish, then the monitor writes the
+	// queued check logs before the database is closed
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		log.Println("Shutting down...")
+		if err := app.Shutdown(); err != nil {
+			log.Printf("Error shutting down the server: %v", err)
+		}
+	}()
+
 	log.Println("🚀 API Monitor started on :8080")
-	log.Fatal(app.Listen(":8080"))
+	if err := app.Listen(":8080"); err != nil {
+		log.Printf("Server stopped: %v", err)
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"api-monitor/app/controllers"
 	"api-monitor/app/middleware"
 	"api-monitor/app/services"
+	"api-monitor/config"
 	"database/sql"
 
 	"github.com/gofiber/fiber/v2"
@@ -15,34 +16,85 @@ func SetupRoutes(app *fiber.App, db *sql.DB, monitor *services.MonitorService) {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
 		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-API-Key",
 	}))
 
 	// Initialize controllers
 	authController := controllers.NewAuthController(db)
 	endpointController := controllers.NewEndpointController(db, monitor)
 	proxyController := controllers.NewProxyController(db)
+	authProfileController := controllers.NewAuthProfileController(db, monitor)
+	tlsProfileController := controllers.NewTLSProfileController(db)
+	jsonSchemaController := controllers.NewJSONSchemaController(db)
+	teamController := controllers.NewTeamController(db)
+	userController := controllers.NewUserController(db)
+	invitationController := controllers.NewInvitationController(db)
+	sessionController := controllers.NewSessionController(db)
+	apiKeyController := controllers.NewAPIKeyController(db)
+	twoFactorController := controllers.NewTwoFactorController(db)
+	auditController := controllers.NewAuditController(db)
+	importController := controllers.NewImportController(db, monitor)
+	heartbeatController := controllers.NewHeartbeatController(db, monitor)
+	oidcController := controllers.NewOIDCController(db, services.NewOIDCProvider(config.GetOIDCConfig()))
 
 	// Public routes (no auth required)
 	auth := app.Group("/api/v1/auth")
 	auth.Post("/login", authController.Login)
+	auth.Get("/registration", authController.RegistrationInfo)
 	auth.Post("/register", authController.Register)
+	auth.Post("/refresh", authController.Refresh)
+	auth.Post("/2fa/setup", twoFactorController.Setup)
+	auth.Post("/2fa/verify", twoFactorController.Verify)
+	auth.Get("/providers", oidcController.Providers)
+	auth.Get("/oidc/login", oidcController.Login)
+	auth.Get("/oidc/callback", oidcController.Callback)
+	auth.Post("/oidc/exchange", oidcController.Exchange)
+
+	// Heartbeat pings (public, the token in the URL identifies the endpoint)
+	app.Get("/ping/:token/:status?", heartbeatController.Ping)
+	app.Post("/ping/:token/:status?", heartbeatController.Ping)
 
 	// Protected auth routes (require JWT)
 	authProtected := app.Group("/api/v1/auth")
 	authProtected.Use(middleware.JWTMiddleware())
 	authProtected.Post("/logout", authController.Logout)
+	authProtected.Get("/sessions", sessionController.GetSessions)
+	authProtected.Delete("/sessions/:id", sessionController.RevokeSession)
+	authProtected.Get("/2fa", twoFactorController.Status)
+	authProtected.Post("/2fa/enroll", twoFactorController.Enroll)
+	authProtected.Post("/2fa/activate", twoFactorController.Activate)
+	authProtected.Post("/2fa/disable", twoFactorController.Disable)
+	authProtected.Post("/2fa/recovery-codes", twoFactorController.RegenerateRecoveryCodes)
 
-	// Protected API endpoints (require JWT)
-	api := app.Group("/api/v1", middleware.JWTMiddleware())
+	// Protected API endpoints (require JWT or a scoped API key)
+	api := app.Group("/api/v1", middleware.AuthMiddleware())
 	{
 		// Endpoint management
 		api.Get("/endpoints", endpointController.GetEndpoints)
 		api.Post("/endpoints", endpointController.CreateEndpoint)
+		api.Post("/endpoints/test", endpointController.TestEndpoint)
+		api.Get("/endpoints/export", importController.ExportMonitors)
+		api.Post("/endpoints/import", importController.ImportMonitors)
+		api.Post("/endpoints/import/openapi", importController.ImportOpenAPI)
+		api.Get("/endpoints/groups", endpointController.GetEndpointGroups)
+		api.Get("/endpoints/labels", endpointController.GetEndpointLabels)
+		api.Post("/endpoints/bulk", endpointController.BulkEndpoints)
+		api.Get("/endpoints/graph", endpointController.GetEndpointGraph)
 		api.Put("/endpoints/:id", endpointController.UpdateEndpoint)
 		api.Delete("/endpoints/:id", endpointController.DeleteEndpoint)
 		api.Post("/endpoints/:id/toggle", endpointController.ToggleEndpoint)
 		api.Get("/endpoints/:id/logs", endpointController.GetEndpointLogs)
+		api.Get("/endpoints/:id/logs/:logId/response", endpointController.GetCheckResponse)
+		api.Get("/endpoints/:id/uptime", endpointController.GetEndpointUptime)
+		api.Get("/endpoints/:id/content-changes", endpointController.GetEndpointContentChanges)
+		api.Get("/endpoints/:id/snapshot", endpointController.GetEndpointSnapshot)
+		api.Get("/endpoints/:id/dependencies", endpointController.GetEndpointDependencies)
+		api.Put("/endpoints/:id/dependencies", endpointController.UpdateEndpointDependencies)
+		api.Post("/endpoints/:id/ping-url", endpointController.RegeneratePingURL)
+		api.Get("/endpoints/:id/versions", endpointController.GetEndpointVersions)
+		api.Get("/endpoints/:id/versions/:version", endpointController.GetEndpointVersion)
+		api.Post("/endpoints/:id/versions/:version/restore", endpointController.RestoreEndpointVersion)
+		api.Post("/endpoints/:id/test", endpointController.TestEndpoint)
 		// api.Post("/endpoints/:id/check", endpointController.ManualCheck)
 		// api.Post("/cleanup-logs", endpointController.ManualCleanup)
 
@@ -53,12 +105,64 @@ func SetupRoutes(app *fiber.App, db *sql.DB, monitor *services.MonitorService) {
 		api.Delete("/proxies/:id", proxyController.DeleteProxy)
 		api.Post("/proxies/:id/toggle", proxyController.ToggleProxy)
 
+		// Auth profiles (credentials used by monitored endpoints)
+		api.Get("/auth-profiles", authProfileController.GetAuthProfiles)
+		api.Post("/auth-profiles", authProfileController.CreateAuthProfile)
+		api.Put("/auth-profiles/:id", authProfileController.UpdateAuthProfile)
+		api.Delete("/auth-profiles/:id", authProfileController.DeleteAuthProfile)
+
+		// TLS profiles (client certificates and custom CAs)
+		api.Get("/tls-profiles", tlsProfileController.GetTLSProfiles)
+		api.Post("/tls-profiles", tlsProfileController.CreateTLSProfile)
+		api.Put("/tls-profiles/:id", tlsProfileController.UpdateTLSProfile)
+		api.Delete("/tls-profiles/:id", tlsProfileController.DeleteTLSProfile)
+
+		// JSON Schemas (response schemas shared by endpoints)
+		api.Get("/schemas", jsonSchemaController.GetJSONSchemas)
+		api.Post("/schemas", jsonSchemaController.CreateJSONSchema)
+		api.Get("/schemas/:id", jsonSchemaController.GetJSONSchema)
+		api.Put("/schemas/:id", jsonSchemaController.UpdateJSONSchema)
+		api.Delete("/schemas/:id", jsonSchemaController.DeleteJSONSchema)
+
+		// Teams (endpoints and proxies are scoped to the user's teams)
+		api.Get("/teams", teamController.GetTeams)
+		api.Post("/teams", middleware.AdminMiddleware(), teamController.CreateTeam)
+		api.Put("/teams/:id", teamController.UpdateTeam)
+		api.Delete("/teams/:id", middleware.AdminMiddleware(), teamController.DeleteTeam)
+		api.Get("/teams/:id/members", teamController.GetMembers)
+		api.Put("/teams/:id/members/:userId", teamController.SetMember)
+		api.Delete("/teams/:id/members/:userId", teamController.RemoveMember)
+
 		// User management (admin only)
 		users := api.Group("/users", middleware.AdminMiddleware())
-		_ = users
-		// users.Get("/", userController.GetUsers)
-		// users.Post("/", userController.CreateUser)
-		// users.Put("/:id", userController.UpdateUser)
-		// users.Delete("/:id", userController.DeleteUser)
+		users.Get("/", userController.GetUsers)
+		users.Post("/", userController.CreateUser)
+		users.Get("/:id", userController.GetUser)
+		users.Put("/:id", userController.UpdateUser)
+		users.Delete("/:id", userController.DeleteUser)
+		users.Put("/:id/role", userController.ChangeRole)
+		users.Post("/:id/activate", userController.ActivateUser)
+		users.Post("/:id/deactivate", userController.DeactivateUser)
+		users.Post("/:id/reset-password", userController.ResetPassword)
+		users.Post("/:id/logout", userController.ForceLogout)
+		users.Put("/:id/2fa/required", userController.RequireTwoFactor)
+		users.Post("/:id/2fa/reset", userController.ResetTwoFactor)
+		users.Post("/:id/unlock", userController.UnlockUser)
+
+		// API keys (JWT only, keys cannot manage keys)
+		api.Get("/api-keys", apiKeyController.GetAPIKeys)
+		api.Post("/api-keys", apiKeyController.CreateAPIKey)
+		api.Delete("/api-keys/:id", apiKeyController.RevokeAPIKey)
+
+		// Registration invitations (admin only)
+		invitations := api.Group("/invitations", middleware.AdminMiddleware())
+		invitations.Get("/", invitationController.GetInvitations)
+		invitations.Post("/", invitationController.CreateInvitation)
+		invitations.Delete("/:id", invitationController.DeleteInvitation)
+
+		// Audit log of configuration changes (admin only)
+		audit := api.Group("/audit", middleware.AdminMiddleware())
+		audit.Get("/", auditController.GetAuditLogs)
+		audit.Get("/:id", auditController.GetAuditLog)
 	}
 }
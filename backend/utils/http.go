@@ -1,80 +1,207 @@
 package utils
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"api-monitor/app/models"
 )
 
+// CheckResult is the outcome of a request sent by a check
+type CheckResult struct {
+	StatusCode int
+	DurationMs int
+	Body       string
+	Headers    string // JSON object with the first value of each response header
+	Details    *models.CheckDetails
+}
+
 // CheckEndpoint performs an HTTP check on the given endpoint
-func CheckEndpoint(endpoint models.APIEndpoint) (int, int, string, string, error) {
-	start := time.Now()
+func CheckEndpoint(endpoint models.APIEndpoint) (*CheckResult, error) {
+	rendered, err := RenderRequest(endpoint)
+	if err != nil {
+		return &CheckResult{}, err
+	}
+
+	result, err := CheckRenderedRequest(endpoint, rendered)
 
-	// Create HTTP client with optional proxy
-	client := &http.Client{
-		Timeout: time.Duration(endpoint.TimeoutSeconds) * time.Second,
+	// Secret template values must never reach the check logs
+	result.Body = rendered.Redact(result.Body)
+	result.Headers = rendered.Redact(result.Headers)
+	rendered.RedactDetails(result.Details)
+	if err != nil {
+		err = fmt.Errorf("%s", rendered.Redact(err.Error()))
 	}
 
-	// Configure proxy if specified
-	if endpoint.Proxy != nil && endpoint.Proxy.Host != "" {
-		proxyURL := fmt.Sprintf("http://%s:%d", endpoint.Proxy.Host, endpoint.Proxy.Port)
+	return result, err
+}
 
-		// Add authentication if provided
-		if endpoint.Proxy.Username != "" && endpoint.Proxy.Password != "" {
-			proxyURL = fmt.Sprintf("http://%s:%s@%s:%d",
-				endpoint.Proxy.Username, endpoint.Proxy.Password,
-				endpoint.Proxy.Host, endpoint.Proxy.Port)
-		}
+// Limits on how much of a response body is read, set per endpoint with
+// response_capture.read_limit_bytes
+const (
+	DefaultReadLimitBytes = 10 << 20
+	MaxReadLimitBytes     = 50 << 20
+)
 
-		proxy, err := url.Parse(proxyURL)
-		if err != nil {
-			log.Printf("Error parsing proxy URL for endpoint %s: %v", endpoint.Name, err)
-		} else {
-			client.Transport = &http.Transport{
-				Proxy: http.ProxyURL(proxy),
-			}
-		}
+// maxRedirects matches the limit of Go's default redirect policy
+const maxRedirects = 10
+
+// NewClient returns a client that connects like the checks of the endpoint: through its
+// proxy, with its TLS profile and transport settings. Call release when done with the
+// client, it closes the connections of a transport that is not shared.
+func NewClient(endpoint models.APIEndpoint, timeout time.Duration) (client *http.Client, release func(), err error) {
+	transport, shared, err := transportFor(endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	release = func() {}
+	if !shared {
+		release = transport.CloseIdleConnections
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, release, nil
+}
+
+// CheckRenderedRequest sends an already rendered request using the endpoint's timeout,
+// proxy and transport settings. The body is returned in full up to the endpoint's read
+// limit, callers shorten it for display with TruncateBody. The result is never nil; its
+// details are set once the request was sent, even when it failed, and hold the raw
+// header values, callers redact them with RedactDetails.
+func CheckRenderedRequest(endpoint models.APIEndpoint, rendered *RenderedRequest) (*CheckResult, error) {
+	result := &CheckResult{}
+	start := time.Now()
+
+	options := endpoint.Transport
+
+	// Create HTTP client with optional proxy, TLS and transport settings
+	client, release, err := NewClient(endpoint, time.Duration(endpoint.TimeoutSeconds)*time.Second)
+	if err != nil {
+		return result, err
 	}
+	defer release()
 
 	var req *http.Request
-	var err error
 
-	if endpoint.Body != "" {
-		req, err = http.NewRequest(endpoint.Method, endpoint.URL, strings.NewReader(endpoint.Body))
+	if rendered.Body != "" {
+		req, err = http.NewRequest(rendered.Method, rendered.URL, strings.NewReader(rendered.Body))
 	} else {
-		req, err = http.NewRequest(endpoint.Method, endpoint.URL, nil)
+		req, err = http.NewRequest(rendered.Method, rendered.URL, nil)
 	}
 
 	if err != nil {
-		return 0, 0, "", "", fmt.Errorf("error creating request: %v", err)
+		return result, fmt.Errorf("error creating request: %v", err)
 	}
 
 	// Add headers
-	for key, value := range endpoint.Headers {
+	for key, value := range rendered.Headers {
 		req.Header.Set(key, value)
 	}
+	// HTTP/2 is negotiated during the TLS handshake, plain text HTTP/2 is not supported
+	if options.HTTPVersion == models.HTTPVersion2 && req.URL.Scheme != "https" {
+		return result, fmt.Errorf("HTTP/2 requires an https URL")
+	}
+	if options.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", options.UserAgent)
+	}
+
+	details := &models.CheckDetails{
+		Request: models.CheckRequest{Method: req.Method, URL: req.URL.String()},
+	}
+	result.Details = details
+
+	// Every redirect is followed by a new request, the details describe the last one
+	var traceMu sync.Mutex
+	limit := maxRedirects
+	if options.MaxRedirects > 0 {
+		limit = options.MaxRedirects
+	}
+	client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		// The redirect itself becomes the response
+		if options.DisableRedirects {
+			return http.ErrUseLastResponse
+		}
+
+		traceMu.Lock()
+		defer traceMu.Unlock()
+		if next.Response != nil {
+			details.Redirects = append(details.Redirects, models.RedirectHop{
+				URL:        next.Response.Request.URL.String(),
+				StatusCode: next.Response.StatusCode,
+				Location:   next.Response.Header.Get("Location"),
+			})
+		}
+		details.Request = models.CheckRequest{Method: next.Method, URL: next.URL.String()}
+		if len(via) > limit {
+			return fmt.Errorf("stopped after %d redirects", limit)
+		}
+		return nil
+	}
+
+	// The transport adds headers of its own (Host, User-Agent, Accept-Encoding...), so
+	// the ones actually written are recorded rather than req.Header
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			traceMu.Lock()
+			defer traceMu.Unlock()
+			details.Request.Headers = map[string][]string{}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			traceMu.Lock()
+			defer traceMu.Unlock()
+			details.ReusedConnection = info.Reused
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				details.RemoteIP = host
+			}
+		},
+		WroteHeaderField: func(key string, values []string) {
+			// HTTP/2 pseudo-headers repeat the method and URL
+			if strings.HasPrefix(key, ":") {
+				return
+			}
+			traceMu.Lock()
+			defer traceMu.Unlock()
+			canonical := http.CanonicalHeaderKey(key)
+			details.Request.Headers[canonical] = append(details.Request.Headers[canonical], values...)
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
 
 	resp, err := client.Do(req)
 	duration := time.Since(start)
-	durationMs := int(duration.Milliseconds())
+	result.DurationMs = int(duration.Milliseconds())
+
+	traceMu.Lock()
+	defer traceMu.Unlock()
 
 	if err != nil {
-		return 0, durationMs, "", "", fmt.Errorf("request failed: %v", err)
+		return result, fmt.Errorf("request failed: %v", err)
 	}
 	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	bodyStr := string(body)
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, ReadLimit(endpoint)))
+	result.StatusCode = resp.StatusCode
+	result.Body = string(body)
+
+	details.FinalURL = resp.Request.URL.String()
+	details.Protocol = resp.Proto
+	details.ResponseHeaders = resp.Header
+
+	// Servers without HTTP/2 answer over HTTP/1.1, which fails the check
+	if options.HTTPVersion == models.HTTPVersion2 && resp.ProtoMajor != 2 {
+		return result, fmt.Errorf("server answered with %s, HTTP/2 is required", resp.Proto)
+	}
 
 	// Collect response headers
-	headersStr := ""
 	if resp.Header != nil {
 		headers := make(map[string]string)
 		for key, values := range resp.Header {
@@ -83,16 +210,97 @@ func CheckEndpoint(endpoint models.APIEndpoint) (int, int, string, string, error
 			}
 		}
 		if headersBytes, err := json.Marshal(headers); err == nil {
-			headersStr = string(headersBytes)
+			result.Headers = string(headersBytes)
 		}
 	}
 
-	// Truncate response body if too long
-	if len(bodyStr) > 1000 {
-		bodyStr = bodyStr[:1000] + "... (truncated)"
+	return result, nil
+}
+
+// buildTransport returns a new transport for the endpoint's proxy, TLS profile and
+// transport options
+func buildTransport(endpoint models.APIEndpoint) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxIdleConns
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.IdleConnTimeout = idleConnTimeout
+
+	// Configure proxy if specified
+	if endpoint.Proxy != nil && endpoint.Proxy.Host != "" {
+		proxyURL := fmt.Sprintf("http://%s:%d", endpoint.Proxy.Host, endpoint.Proxy.Port)
+
+		// Add authentication if provided
+		if endpoint.Proxy.Username != "" && endpoint.Proxy.Password != "" {
+			proxyURL = fmt.Sprintf("http://%s:%s@%s:%d",
+				endpoint.Proxy.Username, endpoint.Proxy.Password,
+				endpoint.Proxy.Host, endpoint.Proxy.Port)
+		}
+
+		proxy, err := url.Parse(proxyURL)
+		if err != nil {
+			log.Printf("Error parsing proxy URL for endpoint %s: %v", endpoint.Name, err)
+		} else {
+			transport.Proxy = http.ProxyURL(proxy)
+		}
+	}
+
+	// Configure client certificates, CA bundle and TLS options if specified
+	if endpoint.TLSProfile != nil {
+		tlsConfig, err := BuildTLSConfig(endpoint.TLSProfile)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring TLS: %v", err)
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	options := endpoint.Transport
+	switch options.HTTPVersion {
+	case models.HTTPVersion11:
+		// A non-nil empty map turns off HTTP/2 negotiation
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	case models.HTTPVersion2:
+		transport.ForceAttemptHTTP2 = true
+	}
+	if options.DisableKeepAlives {
+		transport.DisableKeepAlives = true
+	}
+	if options.DisableCompression {
+		transport.DisableCompression = true
+	}
+
+	// Pinned hosts are dialed at their IP, the request keeps the host name for Host and SNI.
+	// Through a proxy only the proxy's own address can be pinned, it resolves the rest.
+	if len(options.Resolve) > 0 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		resolve := options.Resolve
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if host, port, err := net.SplitHostPort(addr); err == nil {
+				if ip, ok := resolve[strings.ToLower(host)]; ok {
+					addr = net.JoinHostPort(ip, port)
+				}
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
 	}
 
-	return resp.StatusCode, durationMs, bodyStr, headersStr, nil
+	return transport, nil
+}
+
+// ReadLimit returns how many bytes of the endpoint's response bodies are read
+func ReadLimit(endpoint models.APIEndpoint) int64 {
+	if endpoint.ResponseCapture.ReadLimitBytes > 0 {
+		return int64(endpoint.ResponseCapture.ReadLimitBytes)
+	}
+	return DefaultReadLimitBytes
+}
+
+// TruncateBody shortens a response body for display
+func TruncateBody(body string) string {
+	if len(body) > 1000 {
+		return body[:1000] + "... (truncated)"
+	}
+	return body
 }
 
 // ValidateUTF8 cleans strings to ensure UTF-8 compatibility
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"api-monitor/app/models"
+)
+
+// redirectServer redirects /old to /new, which answers with repeated headers
+func redirectServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new?"+r.URL.RawQuery, http.StatusFound)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.Header().Set("X-Echo-Token", r.URL.Query().Get("token"))
+		w.Write([]byte(`{"ok":true}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckEndpointDetails(t *testing.T) {
+	server := redirectServer(t)
+	t.Cleanup(CloseTransports)
+
+	result, err := CheckEndpoint(models.APIEndpoint{
+		Method:         "GET",
+		URL:            server.URL + `/old?token={{ secret "s3cr3t" }}`,
+		TimeoutSeconds: 5,
+		Headers: map[string]string{
+			"Authorization": "Bearer static",
+			"X-Signature":   `{{ secret "sig" }}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	details := result.Details
+	if result.StatusCode != 200 || details == nil {
+		t.Fatalf("result = %+v", result)
+	}
+
+	wantRedirects := []models.RedirectHop{{
+		URL:        server.URL + "/old?token=[REDACTED]",
+		StatusCode: http.StatusFound,
+		Location:   "/new?token=[REDACTED]",
+	}}
+	if !reflect.DeepEqual(details.Redirects, wantRedirects) {
+		t.Errorf("Redirects = %+v, want %+v", details.Redirects, wantRedirects)
+	}
+	if details.FinalURL != server.URL+"/new?token=[REDACTED]" || details.Request.URL != details.FinalURL {
+		t.Errorf("FinalURL = %s, request URL = %s", details.FinalURL, details.Request.URL)
+	}
+
+	// The headers written for the last request, including those added by the transport
+	headers := details.Request.Headers
+	if got := headers["Authorization"]; len(got) != 1 || got[0] != "[REDACTED]" {
+		t.Errorf("Authorization = %q, want it hidden", got)
+	}
+	if got := headers["X-Signature"]; len(got) != 1 || got[0] != "[REDACTED]" {
+		t.Errorf("X-Signature = %q, want the secret redacted", got)
+	}
+	if len(headers["Host"]) != 1 || len(headers["User-Agent"]) != 1 {
+		t.Errorf("request headers = %v, want the Host and User-Agent the transport wrote", headers)
+	}
+
+	if got := details.ResponseHeaders["Set-Cookie"]; !reflect.DeepEqual(got, []string{"a=1", "b=2"}) {
+		t.Errorf("Set-Cookie = %q, want both values", got)
+	}
+	if got := details.ResponseHeaders["X-Echo-Token"]; len(got) != 1 || got[0] != "[REDACTED]" {
+		t.Errorf("X-Echo-Token = %q, want the secret redacted", got)
+	}
+	if details.Protocol != "HTTP/1.1" || details.RemoteIP != "127.0.0.1" {
+		t.Errorf("Protocol = %s, RemoteIP = %s", details.Protocol, details.RemoteIP)
+	}
+
+	// The flat header column keeps the first value only
+	var flat map[string]string
+	if err := json.Unmarshal([]byte(result.Headers), &flat); err != nil || flat["Set-Cookie"] != "a=1" || flat["X-Echo-Token"] != "[REDACTED]" {
+		t.Errorf("Headers = %s", result.Headers)
+	}
+}
+
+func TestCheckEndpointDetailsOnFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	result, err := CheckEndpoint(models.APIEndpoint{Method: "POST", URL: url + "/gone", TimeoutSeconds: 5})
+	if err == nil {
+		t.Fatal("check of a closed server succeeded")
+	}
+	if result.Details == nil || result.Details.Request.Method != "POST" || result.Details.Request.URL != url+"/gone" {
+		t.Errorf("details = %+v, want the request that failed", result.Details)
+	}
+}
+
+func TestRedactDetails(t *testing.T) {
+	rendered := &RenderedRequest{Secrets: []string{"s3cr3t"}}
+	responseHeaders := map[string][]string{"X-Token": {"s3cr3t", "other"}}
+	details := &models.CheckDetails{
+		Request: models.CheckRequest{
+			URL: "https://api.local/?t=s3cr3t",
+			Headers: map[string][]string{
+				"Cookie":    {"session=1"},
+				"X-Api-Key": {"k"},
+				"X-Trace":   {"s3cr3t-1"},
+			},
+		},
+		FinalURL:        "https://api.local/final?t=s3cr3t",
+		Redirects:       []models.RedirectHop{{URL: "https://api.local/?t=s3cr3t", Location: "/final?t=s3cr3t"}},
+		ResponseHeaders: responseHeaders,
+	}
+	rendered.RedactDetails(details)
+
+	want := &models.CheckDetails{
+		Request: models.CheckRequest{
+			URL: "https://api.local/?t=[REDACTED]",
+			Headers: map[string][]string{
+				"Cookie":    {"[REDACTED]"},
+				"X-Api-Key": {"[REDACTED]"},
+				"X-Trace":   {"[REDACTED]-1"},
+			},
+		},
+		FinalURL:        "https://api.local/final?t=[REDACTED]",
+		Redirects:       []models.RedirectHop{{URL: "https://api.local/?t=[REDACTED]", Location: "/final?t=[REDACTED]"}},
+		ResponseHeaders: map[string][]string{"X-Token": {"[REDACTED]", "other"}},
+	}
+	if !reflect.DeepEqual(details, want) {
+		t.Errorf("RedactDetails =\n%+v\nwant\n%+v", details, want)
+	}
+	if responseHeaders["X-Token"][0] != "s3cr3t" {
+		t.Error("RedactDetails changed the header map of the response")
+	}
+
+	rendered.RedactDetails(nil) // Checks that failed before sending have no details
+}
+
+func TestCheckEndpointRedirectOptions(t *testing.T) {
+	// /hop/N redirects N more times before answering
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		if _, err := fmt.Sscanf(r.URL.Path, "/hop/%d", &n); err == nil && n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/hop/%d", n-1), http.StatusFound)
+			return
+		}
+		w.Write([]byte("done"))
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(CloseTransports)
+
+	result, err := CheckEndpoint(models.APIEndpoint{Method: "GET", URL: server.URL + "/hop/2", TimeoutSeconds: 5,
+		Transport: models.TransportOptions{DisableRedirects: true}})
+	if err != nil || result.StatusCode != http.StatusFound || len(result.Details.Redirects) != 0 {
+		t.Errorf("disabled redirects: status %d, %v; want the redirect as the response", result.StatusCode, err)
+	}
+
+	if _, err := CheckEndpoint(models.APIEndpoint{Method: "GET", URL: server.URL + "/hop/3", TimeoutSeconds: 5,
+		Transport: models.TransportOptions{MaxRedirects: 2}}); err == nil || !strings.Contains(err.Error(), "stopped after 2 redirects") {
+		t.Errorf("max_redirects 2 over 3 redirects: %v", err)
+	}
+
+	result, err = CheckEndpoint(models.APIEndpoint{Method: "GET", URL: server.URL + "/hop/2", TimeoutSeconds: 5,
+		Transport: models.TransportOptions{MaxRedirects: 2}})
+	if err != nil || result.StatusCode != 200 || len(result.Details.Redirects) != 2 {
+		t.Errorf("max_redirects 2 over 2 redirects: status %d, %v", result.StatusCode, err)
+	}
+}
+
+func TestCheckEndpointConnectionOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Host", r.Host)
+		w.Header().Set("X-User-Agent", r.UserAgent())
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(CloseTransports)
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	// The pinned name is dialed at the server's address and still sent as Host
+	pinned := fmt.Sprintf("pinned.test:%d", port)
+	result, err := CheckEndpoint(models.APIEndpoint{Method: "GET", URL: "http://" + pinned + "/", TimeoutSeconds: 5,
+		Transport: models.TransportOptions{UserAgent: "probe/1.0", Resolve: map[string]string{"pinned.test": "127.0.0.1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host := http.Header(result.Details.ResponseHeaders).Get("X-Host"); host != pinned {
+		t.Errorf("Host = %s, want %s", host, pinned)
+	}
+	if agent := http.Header(result.Details.ResponseHeaders).Get("X-User-Agent"); agent != "probe/1.0" {
+		t.Errorf("User-Agent = %s, want the configured one", agent)
+	}
+
+	// A User-Agent header of the endpoint wins over the option
+	result, err = CheckEndpoint(models.APIEndpoint{Method: "GET", URL: server.URL, TimeoutSeconds: 5,
+		Headers: map[string]string{"User-Agent": "custom"}, Transport: models.TransportOptions{UserAgent: "probe/1.0"}})
+	if err != nil || http.Header(result.Details.ResponseHeaders).Get("X-User-Agent") != "custom" {
+		t.Errorf("User-Agent header = %v, %v; want custom", result.Details.ResponseHeaders, err)
+	}
+}
+
+func TestCheckEndpointHTTPVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	t.Cleanup(CloseTransports)
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	endpoint := func(url, version string) models.APIEndpoint {
+		return models.APIEndpoint{Method: "GET", URL: url, TimeoutSeconds: 5,
+			TLSProfile: &models.TLSProfile{CABundle: string(caPEM), ServerName: "example.com"},
+			Transport:  models.TransportOptions{HTTPVersion: version}}
+	}
+
+	for version, want := range map[string]string{"": "HTTP/2.0", models.HTTPVersion2: "HTTP/2.0", models.HTTPVersion11: "HTTP/1.1"} {
+		result, err := CheckEndpoint(endpoint(server.URL, version))
+		if err != nil || result.Details.Protocol != want {
+			t.Errorf("http_version %q: %s, %v; want %s", version, result.Details.Protocol, err, want)
+		}
+	}
+
+	plain := strings.Replace(server.URL, "https://", "http://", 1)
+	if _, err := CheckEndpoint(endpoint(plain, models.HTTPVersion2)); err == nil || !strings.Contains(err.Error(), "requires an https URL") {
+		t.Errorf("HTTP/2 over http: %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"text/template"
+	"time"
+
+	"api-monitor/app/models"
+
+	"github.com/google/uuid"
+)
+
+// RenderedRequest is the request produced by evaluating an endpoint's templates
+// for a single check
+type RenderedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+
+	// Secrets holds values produced by the secret template function. They are
+	// shown in test runs but must be redacted before anything is persisted.
+	Secrets []string `json:"-"`
+}
+
+// templateData is what templates can see while the request is being built.
+// Fields are filled in as rendering progresses: URL first, then body, then headers.
+type templateData struct {
+	Method   string
+	URL      string
+	Body     string
+	Headers  map[string]string
+	Endpoint models.APIEndpoint
+}
+
+// RenderRequest evaluates the templates in the endpoint URL, body and headers.
+// Strings without template actions are passed through untouched.
+func RenderRequest(endpoint models.APIEndpoint) (*RenderedRequest, error) {
+	rendered := &RenderedRequest{
+		Method:  endpoint.Method,
+		Headers: make(map[string]string, len(endpoint.Headers)),
+	}
+	if rendered.Method == "" {
+		rendered.Method = "GET"
+	}
+
+	data := &templateData{
+		Method:   rendered.Method,
+		Headers:  make(map[string]string, len(endpoint.Headers)),
+		Endpoint: endpoint,
+	}
+	for key, value := range endpoint.Headers {
+		data.Headers[key] = value
+	}
+
+	var err error
+	if rendered.URL, err = rendered.render("url", endpoint.URL, data); err != nil {
+		return nil, err
+	}
+	data.URL = rendered.URL
+
+	if rendered.Body, err = rendered.render("body", endpoint.Body, data); err != nil {
+		return nil, err
+	}
+	data.Body = rendered.Body
+
+	for key, value := range endpoint.Headers {
+		if rendered.Headers[key], err = rendered.render("header "+key, value, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return rendered, nil
+}
+
+// Redact replaces every secret value in s with a placeholder
+func (r *RenderedRequest) Redact(s string) string {
+	for _, secret := range r.Secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, "[REDACTED]")
+		}
+	}
+	return s
+}
+
+// sensitiveHeaders carry credentials whatever their value came from
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+
+// Redacted returns a copy of the request that can be shown: secret values are replaced and
+// headers that carry credentials, such as those added by auth profiles, are hidden
+func (r *RenderedRequest) Redacted() RenderedRequest {
+	redacted := RenderedRequest{
+		Method:  r.Method,
+		URL:     r.Redact(r.URL),
+		Headers: make(map[string]string, len(r.Headers)),
+		Body:    r.Redact(r.Body),
+	}
+	for key, value := range r.Headers {
+		redacted.Headers[key] = r.Redact(value)
+	}
+	for _, name := range sensitiveHeaders {
+		for key := range redacted.Headers {
+			if strings.EqualFold(key, name) {
+				redacted.Headers[key] = "[REDACTED]"
+			}
+		}
+	}
+	return redacted
+}
+
+// RedactDetails removes secret values from the details of a check, and hides the value
+// of request headers that carry credentials
+func (r *RenderedRequest) RedactDetails(details *models.CheckDetails) {
+	if details == nil {
+		return
+	}
+
+	details.Request.URL = r.Redact(details.Request.URL)
+	details.Request.Headers = r.redactHeaders(details.Request.Headers)
+	for _, name := range sensitiveHeaders {
+		for i := range details.Request.Headers[name] {
+			details.Request.Headers[name][i] = "[REDACTED]"
+		}
+	}
+
+	details.FinalURL = r.Redact(details.FinalURL)
+	for i := range details.Redirects {
+		details.Redirects[i].URL = r.Redact(details.Redirects[i].URL)
+		details.Redirects[i].Location = r.Redact(details.Redirects[i].Location)
+	}
+	details.ResponseHeaders = r.redactHeaders(details.ResponseHeaders)
+}
+
+// redactHeaders returns a copy of headers without secret values, the response's own
+// header map is left alone
+func (r *RenderedRequest) redactHeaders(headers map[string][]string) map[string][]string {
+	if headers == nil {
+		return nil
+	}
+	redacted := make(map[string][]string, len(headers))
+	for key, values := range headers {
+		for _, value := range values {
+			redacted[key] = append(redacted[key], r.Redact(value))
+		}
+	}
+	return redacted
+}
+
+func (r *RenderedRequest) render(name, text string, data *templateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New(name).Funcs(r.funcMap()).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("error parsing %s template: %v", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error rendering %s template: %v", name, err)
+	}
+	return buf.String(), nil
+}
+
+func (r *RenderedRequest) funcMap() template.FuncMap {
+	return template.FuncMap{
+		"now":  time.Now,
+		"uuid": func() string { return uuid.NewString() },
+		"randomInt": func(min, max int) (int, error) {
+			if max <= min {
+				return 0, fmt.Errorf("randomInt: max must be greater than min")
+			}
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(max-min)))
+			if err != nil {
+				return 0, err
+			}
+			return min + int(n.Int64()), nil
+		},
+		"base64": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"sha256": func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+		"hmacSHA256": func(secret, payload string) string {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(payload))
+			return hex.EncodeToString(mac.Sum(nil))
+		},
+		"secret": func(value string) string {
+			r.Secrets = append(r.Secrets, value)
+			return value
+		},
+	}
+}
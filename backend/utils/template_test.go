@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"api-monitor/app/models"
+)
+
+func TestRenderRequest(t *testing.T) {
+	rendered, err := RenderRequest(models.APIEndpoint{
+		Method: "POST",
+		URL:    "https://api.local/items/{{ .Endpoint.Name }}",
+		Body:   `{"url":"{{ .URL }}","digest":"{{ sha256 "abc" }}"}`,
+		Headers: map[string]string{
+			"X-Signature": `{{ hmacSHA256 "key" .Body }}`,
+			"X-Basic":     `{{ base64 "user:pass" }}`,
+			"X-Plain":     "no templates {here}",
+		},
+		Name: "orders",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rendered.URL != "https://api.local/items/orders" {
+		t.Errorf("URL = %q", rendered.URL)
+	}
+	wantBody := `{"url":"https://api.local/items/orders","digest":"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"}`
+	if rendered.Body != wantBody {
+		t.Errorf("Body = %q, want %q", rendered.Body, wantBody)
+	}
+	// The signature is computed over the rendered body, headers are rendered last
+	signed, _ := RenderRequest(models.APIEndpoint{
+		Body:    wantBody,
+		Headers: map[string]string{"X-Signature": `{{ hmacSHA256 "key" .Body }}`},
+	})
+	if rendered.Headers["X-Signature"] != signed.Headers["X-Signature"] || len(rendered.Headers["X-Signature"]) != 64 {
+		t.Errorf("X-Signature = %q, want the HMAC of the rendered body", rendered.Headers["X-Signature"])
+	}
+	if rendered.Headers["X-Basic"] != "dXNlcjpwYXNz" {
+		t.Errorf("X-Basic = %q", rendered.Headers["X-Basic"])
+	}
+	if rendered.Headers["X-Plain"] != "no templates {here}" {
+		t.Errorf("X-Plain = %q, strings without actions must pass through", rendered.Headers["X-Plain"])
+	}
+	if rendered.Method != "POST" {
+		t.Errorf("Method = %q", rendered.Method)
+	}
+}
+
+func TestRenderRequestErrors(t *testing.T) {
+	tests := map[string]models.APIEndpoint{
+		"parse error":      {URL: "https://api.local/{{ .URL"},
+		"unknown function": {Body: "{{ nope }}"},
+		"randomInt range":  {Headers: map[string]string{"X-N": "{{ randomInt 5 5 }}"}},
+	}
+	for name, endpoint := range tests {
+		if _, err := RenderRequest(endpoint); err == nil {
+			t.Errorf("%s: RenderRequest succeeded", name)
+		}
+	}
+
+	rendered, err := RenderRequest(models.APIEndpoint{URL: "https://api.local/?n={{ randomInt 3 4 }}&id={{ uuid }}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.Method != "GET" || !strings.HasPrefix(rendered.URL, "https://api.local/?n=3&id=") || len(rendered.URL) != len("https://api.local/?n=3&id=")+36 {
+		t.Errorf("got %s %s, want GET with n=3 and a UUID", rendered.Method, rendered.URL)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	rendered, err := RenderRequest(models.APIEndpoint{
+		URL:  `https://api.local/?token={{ secret "s3cr3t" }}`,
+		Body: `{"password":"{{ secret "hunter2" }}","empty":"{{ secret "" }}"}`,
+		Headers: map[string]string{
+			"authorization": `Bearer {{ secret "t0ken" }}`,
+			"X-Trace":       "s3cr3t-trace",
+			"Content-Type":  "application/json",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := rendered.Redact("token s3cr3t and hunter2, twice s3cr3t"); got != "token [REDACTED] and [REDACTED], twice [REDACTED]" {
+		t.Errorf("Redact = %q", got)
+	}
+	if got := rendered.Redact("nothing to hide"); got != "nothing to hide" {
+		t.Errorf("Redact changed a string without secrets: %q", got)
+	}
+
+	redacted := rendered.Redacted()
+	if redacted.URL != "https://api.local/?token=[REDACTED]" {
+		t.Errorf("URL = %q", redacted.URL)
+	}
+	if redacted.Body != `{"password":"[REDACTED]","empty":""}` {
+		t.Errorf("Body = %q", redacted.Body)
+	}
+	if redacted.Headers["authorization"] != "[REDACTED]" || redacted.Headers["X-Trace"] != "[REDACTED]-trace" ||
+		redacted.Headers["Content-Type"] != "application/json" {
+		t.Errorf("Headers = %v", redacted.Headers)
+	}
+	if redacted.Secrets != nil {
+		t.Error("Redacted kept the secret values")
+	}
+	if rendered.URL != "https://api.local/?token=s3cr3t" || rendered.Headers["authorization"] != "Bearer t0ken" {
+		t.Error("Redacted changed the request that is sent")
+	}
+}
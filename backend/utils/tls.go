@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	"api-monitor/app/models"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// BuildTLSConfig creates the client TLS configuration for a decrypted TLS profile
+func BuildTLSConfig(profile *models.TLSProfile) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         profile.ServerName,
+		InsecureSkipVerify: profile.InsecureSkipVerify,
+	}
+
+	if profile.MinVersion != "" {
+		version, ok := tlsVersions[profile.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported minimum TLS version %q", profile.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if profile.ClientCert != "" || profile.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(profile.ClientCert), []byte(profile.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if profile.CABundle != "" {
+		// Trust the system roots as well so a private CA can be added without losing public ones
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(profile.CABundle)) {
+			return nil, fmt.Errorf("invalid CA bundle: no certificates found")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
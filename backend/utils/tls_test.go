@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api-monitor/app/models"
+)
+
+// TestTLSProfiles runs TLS profiles against a local mTLS server that only speaks TLS 1.2
+// and presents a certificate for mtls.internal, issued by a throwaway CA
+func TestTLSProfiles(t *testing.T) {
+	caCert, caKey, caPEM := generateCA(t)
+	serverPEM, serverKeyPEM := generateCert(t, caCert, caKey, "mtls.internal", x509.ExtKeyUsageServerAuth)
+	clientPEM, clientKeyPEM := generateCert(t, caCert, caKey, "api-monitor", x509.ExtKeyUsageClientAuth)
+
+	serverCert, err := tls.X509KeyPair(serverPEM, serverKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"client":"%s"}`, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MaxVersion:   tls.VersionTLS12,
+	}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // The failing handshakes are expected
+	server.StartTLS()
+	defer server.Close()
+
+	CloseTransports()
+	t.Cleanup(CloseTransports)
+
+	tests := []struct {
+		name    string
+		profile *models.TLSProfile
+		wantErr bool
+	}{
+		{"no TLS profile, unknown CA", nil, true},
+		{"CA bundle without client certificate", &models.TLSProfile{
+			CABundle: string(caPEM), ServerName: "mtls.internal",
+		}, true},
+		{"CA bundle without server name, name mismatch", &models.TLSProfile{
+			CABundle: string(caPEM), ClientCert: string(clientPEM), ClientKey: string(clientKeyPEM),
+		}, true},
+		{"CA bundle, client certificate and server name", &models.TLSProfile{
+			CABundle: string(caPEM), ClientCert: string(clientPEM), ClientKey: string(clientKeyPEM),
+			ServerName: "mtls.internal",
+		}, false},
+		{"insecure skip verify with client certificate", &models.TLSProfile{
+			ClientCert: string(clientPEM), ClientKey: string(clientKeyPEM), InsecureSkipVerify: true,
+		}, false},
+		{"minimum TLS 1.3 against a TLS 1.2 server", &models.TLSProfile{
+			CABundle: string(caPEM), ClientCert: string(clientPEM), ClientKey: string(clientKeyPEM),
+			ServerName: "mtls.internal", MinVersion: "1.3",
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CheckEndpoint(models.APIEndpoint{
+				Name:           tt.name,
+				URL:            server.URL,
+				Method:         "GET",
+				TimeoutSeconds: 5,
+				TLSProfile:     tt.profile,
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("check succeeded with status %d, want a handshake error", result.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("check failed: %v", err)
+			}
+			if result.StatusCode != http.StatusOK || result.Body != `{"client":"api-monitor"}` {
+				t.Errorf("got %d %s, want 200 with the client certificate seen by the server", result.StatusCode, result.Body)
+			}
+		})
+	}
+}
+
+func TestBuildTLSConfigRejectsInvalidProfiles(t *testing.T) {
+	caCert, caKey, caPEM := generateCA(t)
+	clientPEM, _ := generateCert(t, caCert, caKey, "api-monitor", x509.ExtKeyUsageClientAuth)
+	_, otherKeyPEM := generateCert(t, caCert, caKey, "other", x509.ExtKeyUsageClientAuth)
+
+	tests := map[string]*models.TLSProfile{
+		"unknown minimum version":    {MinVersion: "1.4"},
+		"CA bundle without PEM":      {CABundle: "not a certificate"},
+		"client key of another cert": {ClientCert: string(clientPEM), ClientKey: string(otherKeyPEM)},
+		"client key only":            {CABundle: string(caPEM), ClientKey: string(otherKeyPEM)},
+	}
+	for name, profile := range tests {
+		if _, err := BuildTLSConfig(profile); err == nil {
+			t.Errorf("%s: BuildTLSConfig accepted the profile", name)
+		}
+	}
+
+	config, err := BuildTLSConfig(&models.TLSProfile{CABundle: string(caPEM), ServerName: "mtls.internal", MinVersion: "1.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ServerName != "mtls.internal" || config.MinVersion != tls.VersionTLS12 || config.RootCAs == nil {
+		t.Errorf("BuildTLSConfig did not apply the profile: %+v", config)
+	}
+}
+
+// Stored PEM material must survive the encryption round trip
+func TestEncryptPEMRoundTrip(t *testing.T) {
+	caCert, caKey, _ := generateCA(t)
+	_, keyPEM := generateCert(t, caCert, caKey, "api-monitor", x509.ExtKeyUsageClientAuth)
+
+	encrypted, err := EncryptString(string(keyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := DecryptString(encrypted)
+	if err != nil || decrypted != string(keyPEM) {
+		t.Errorf("DecryptString = %q, %v; want the original key", decrypted, err)
+	}
+}
+
+func generateCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "API Monitor Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func generateCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
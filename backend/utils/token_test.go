@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestRandomToken(t *testing.T) {
+	a, err := RandomToken(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := RandomToken(32)
+	if a == b {
+		t.Error("two tokens are equal")
+	}
+	if decoded, err := base64.RawURLEncoding.DecodeString(a); err != nil || len(decoded) != 32 {
+		t.Errorf("token %q is not 32 URL-safe base64 bytes", a)
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	// SHA-256 of "abc"
+	if got := HashToken("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("HashToken(%q) = %s", "abc", got)
+	}
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// The last six digits of the RFC 6238 appendix B values
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		got, err := TOTPCode(rfc6238Secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("TOTPCode at %d = %s, want %s", unix, got, want)
+		}
+	}
+
+	// Secrets typed in lower case or with padding still work
+	if got, _ := TOTPCode(strings.ToLower(rfc6238Secret)+"==", time.Unix(59, 0)); got != "287082" {
+		t.Errorf("TOTPCode with a lower case padded secret = %s", got)
+	}
+	if _, err := TOTPCode("not base32!", time.Now()); err == nil {
+		t.Error("TOTPCode accepted an invalid secret")
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, _ := TOTPCode(secret, now)
+
+	step, ok := VerifyTOTP(secret, code[:3]+" "+code[3:], 0)
+	if !ok || step != now.Unix()/totpPeriod {
+		t.Fatalf("VerifyTOTP = %d, %t; want the current step", step, ok)
+	}
+	if _, ok := VerifyTOTP(secret, code, step); ok {
+		t.Error("a code was accepted twice")
+	}
+
+	previous, _ := TOTPCode(secret, now.Add(-totpPeriod*time.Second))
+	if _, ok := VerifyTOTP(secret, previous, 0); !ok {
+		t.Error("the code of the previous period was rejected, clock drift must be allowed")
+	}
+	old, _ := TOTPCode(secret, now.Add(-3*totpPeriod*time.Second))
+	if _, ok := VerifyTOTP(secret, old, 0); ok && old != code && old != previous {
+		t.Error("a code of three periods ago was accepted")
+	}
+
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := VerifyTOTP(secret, bad, 0); ok {
+			t.Errorf("VerifyTOTP accepted %q", bad)
+		}
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI("API Monitor", "ops@example.com", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/API Monitor:ops@example.com" {
+		t.Errorf("URI = %s", uri)
+	}
+	query := uri.Query()
+	if query.Get("secret") != rfc6238Secret || query.Get("issuer") != "API Monitor" ||
+		query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("query = %v", query)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || code != strings.ToLower(code) {
+			t.Errorf("recovery code %q is not formatted as xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("recovery code %q generated twice", code)
+		}
+		seen[code] = true
+
+		typed := " " + strings.ToUpper(strings.Replace(code, "-", " ", 1)) + " "
+		if NormalizeRecoveryCode(typed) != NormalizeRecoveryCode(code) {
+			t.Errorf("%q and %q normalize differently", typed, code)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api-monitor/app/models"
+)
+
+// Bounds of the shared transports. Idle connections are kept per transport and host, and
+// the least recently used transport is closed when the cache is full.
+const (
+	maxCachedTransports = 256
+	maxIdleConns        = 64
+	maxIdleConnsPerHost = 4
+	idleConnTimeout     = 90 * time.Second
+)
+
+type cachedTransport struct {
+	transport *http.Transport
+	lastUsed  time.Time
+}
+
+var (
+	transportsMu sync.Mutex
+	transports   = map[string]*cachedTransport{}
+)
+
+// transportFor returns the transport used to check an endpoint. Endpoints with the same
+// proxy, TLS profile and connection settings share a transport and its idle connections,
+// so checks skip the dial and TLS handshake. Endpoints with keep-alives disabled get a
+// transport of their own for every check: each one is timed from a cold connection.
+// The second return value reports whether the transport is shared; callers close the
+// idle connections of transports that are not.
+func transportFor(endpoint models.APIEndpoint) (*http.Transport, bool, error) {
+	if endpoint.Transport.DisableKeepAlives {
+		transport, err := buildTransport(endpoint)
+		return transport, false, err
+	}
+
+	key := transportKey(endpoint)
+
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	if cached, ok := transports[key]; ok {
+		cached.lastUsed = time.Now()
+		return cached.transport, true, nil
+	}
+
+	transport, err := buildTransport(endpoint)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(transports) >= maxCachedTransports {
+		evictTransport()
+	}
+	transports[key] = &cachedTransport{transport: transport, lastUsed: time.Now()}
+	return transport, true, nil
+}
+
+// evictTransport closes the least recently used transport. Checks still using it finish,
+// their connections are closed once they are returned to the idle pool.
+func evictTransport() {
+	var oldestKey string
+	var oldest *cachedTransport
+	for key, cached := range transports {
+		if oldest == nil || cached.lastUsed.Before(oldest.lastUsed) {
+			oldestKey, oldest = key, cached
+		}
+	}
+	if oldest != nil {
+		oldest.transport.CloseIdleConnections()
+		delete(transports, oldestKey)
+	}
+}
+
+// CloseTransports drops every shared transport and closes their idle connections, e.g.
+// on shutdown
+func CloseTransports() {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	for key, cached := range transports {
+		cached.transport.CloseIdleConnections()
+		delete(transports, key)
+	}
+}
+
+// CachedTransports returns the number of shared transports
+func CachedTransports() int {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	return len(transports)
+}
+
+// transportKey identifies the settings buildTransport uses. It is a hash, so proxy
+// passwords and client keys are not kept around in the cache keys. Settings applied to
+// the client or request (redirects, user agent, timeout) are not part of it.
+func transportKey(endpoint models.APIEndpoint) string {
+	var b strings.Builder
+
+	if proxy := endpoint.Proxy; proxy != nil && proxy.Host != "" {
+		fmt.Fprintf(&b, "proxy %q %d %q %q\n", proxy.Host, proxy.Port, proxy.Username, proxy.Password)
+	}
+	if profile := endpoint.TLSProfile; profile != nil {
+		fmt.Fprintf(&b, "tls %q %q %q %q %q %t\n", profile.ClientCert, profile.ClientKey, profile.CABundle,
+			profile.ServerName, profile.MinVersion, profile.InsecureSkipVerify)
+	}
+
+	options := endpoint.Transport
+	fmt.Fprintf(&b, "http %q %t\n", options.HTTPVersion, options.DisableCompression)
+
+	hosts := make([]string, 0, len(options.Resolve))
+	for host := range options.Resolve {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		fmt.Fprintf(&b, "resolve %q %q\n", host, options.Resolve[host])
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-monitor/app/models"
+)
+
+func TestTransportKey(t *testing.T) {
+	base := models.APIEndpoint{
+		Proxy:      &models.Proxy{Host: "proxy.local", Port: 3128, Username: "u", Password: "p"},
+		TLSProfile: &models.TLSProfile{CABundle: "ca", ServerName: "api.local", MinVersion: "1.2"},
+		Transport: models.TransportOptions{
+			HTTPVersion: models.HTTPVersion11,
+			Resolve:     map[string]string{"a.local": "10.0.0.1", "b.local": "10.0.0.2"},
+		},
+	}
+	key := transportKey(base)
+
+	// Settings applied per request or client share the transport
+	same := base
+	same.Name, same.URL, same.TimeoutSeconds = "other", "https://b.local/", 5
+	same.Transport.UserAgent = "probe"
+	same.Transport.MaxRedirects = 3
+	same.Transport.Resolve = map[string]string{"b.local": "10.0.0.2", "a.local": "10.0.0.1"}
+	if transportKey(same) != key {
+		t.Error("endpoints differing only in request settings got different transport keys")
+	}
+
+	variants := map[string]func(e *models.APIEndpoint){
+		"proxy password": func(e *models.APIEndpoint) {
+			e.Proxy = &models.Proxy{Host: "proxy.local", Port: 3128, Username: "u", Password: "q"}
+		},
+		"no proxy": func(e *models.APIEndpoint) { e.Proxy = nil },
+		"CA bundle": func(e *models.APIEndpoint) {
+			e.TLSProfile = &models.TLSProfile{CABundle: "other", ServerName: "api.local", MinVersion: "1.2"}
+		},
+		"min version": func(e *models.APIEndpoint) {
+			e.TLSProfile = &models.TLSProfile{CABundle: "ca", ServerName: "api.local", MinVersion: "1.3"}
+		},
+		"http version": func(e *models.APIEndpoint) { e.Transport.HTTPVersion = models.HTTPVersion2 },
+		"compression":  func(e *models.APIEndpoint) { e.Transport.DisableCompression = true },
+		"resolve":      func(e *models.APIEndpoint) { e.Transport.Resolve = map[string]string{"a.local": "10.0.0.9"} },
+	}
+	for name, change := range variants {
+		endpoint := base
+		change(&endpoint)
+		if transportKey(endpoint) == key {
+			t.Errorf("changing the %s kept the transport key", name)
+		}
+	}
+}
+
+func TestTransportForSharesTransports(t *testing.T) {
+	CloseTransports()
+	t.Cleanup(CloseTransports)
+
+	endpoint := models.APIEndpoint{URL: "http://a.local/"}
+	first, shared, err := transportFor(endpoint)
+	if err != nil || !shared {
+		t.Fatalf("transportFor = shared %t, %v; want a shared transport", shared, err)
+	}
+	again, _, _ := transportFor(endpoint)
+	if again != first || CachedTransports() != 1 {
+		t.Error("the same settings did not reuse the cached transport")
+	}
+
+	endpoint.Transport.DisableKeepAlives = true
+	fresh, shared, err := transportFor(endpoint)
+	if err != nil || shared || fresh == first || !fresh.DisableKeepAlives {
+		t.Error("an endpoint with keep-alives disabled did not get a transport of its own")
+	}
+	if CachedTransports() != 1 {
+		t.Errorf("%d transports cached, transports without keep-alives must not be", CachedTransports())
+	}
+}
+
+func TestTransportForEvictsLeastRecentlyUsed(t *testing.T) {
+	CloseTransports()
+	t.Cleanup(CloseTransports)
+
+	endpointN := func(i int) models.APIEndpoint {
+		return models.APIEndpoint{Transport: models.TransportOptions{
+			Resolve: map[string]string{"a.local": "10.0.0." + strconv.Itoa(i%250+1), "b.local": strconv.Itoa(i)},
+		}}
+	}
+	for i := 0; i < maxCachedTransports; i++ {
+		if _, _, err := transportFor(endpointN(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Make the first transport the least recently used, then touch the second so it is not
+	transportsMu.Lock()
+	transports[transportKey(endpointN(0))].lastUsed = time.Now().Add(-time.Hour)
+	transports[transportKey(endpointN(1))].lastUsed = time.Now().Add(-time.Minute)
+	transportsMu.Unlock()
+	transportFor(endpointN(1))
+
+	transportFor(endpointN(maxCachedTransports))
+
+	if CachedTransports() != maxCachedTransports {
+		t.Errorf("%d transports cached, want at most %d", CachedTransports(), maxCachedTransports)
+	}
+	transportsMu.Lock()
+	_, kept0 := transports[transportKey(endpointN(0))]
+	_, kept1 := transports[transportKey(endpointN(1))]
+	transportsMu.Unlock()
+	if kept0 || !kept1 {
+		t.Errorf("evicted the wrong transport: first kept %t, recently used kept %t", kept0, kept1)
+	}
+}
+
+// BenchmarkCheckEndpoint compares checks on shared transports with checks that open a fresh
+// connection every time (transport.disable_keep_alives), against a local HTTPS server and
+// through a local CONNECT proxy that adds dial latency:
+//
+//	go test ./utils -run '^$' -bench CheckEndpoint -benchtime 2000x
+func BenchmarkCheckEndpoint(b *testing.B) {
+	var serverConns atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status":"ok"}`)
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			serverConns.Add(1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	proxyServer := httptest.NewServer(connectProxy(10 * time.Millisecond))
+	defer proxyServer.Close()
+	host, port, _ := net.SplitHostPort(proxyServer.Listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	proxy := &models.Proxy{Host: host, Port: portNumber, IsActive: true}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	for _, via := range []struct {
+		name  string
+		proxy *models.Proxy
+	}{{"direct", nil}, {"proxy", proxy}} {
+		for _, fresh := range []bool{false, true} {
+			mode := "shared"
+			if fresh {
+				mode = "fresh"
+			}
+
+			b.Run(via.name+"/"+mode, func(b *testing.B) {
+				CloseTransports()
+				defer CloseTransports()
+
+				// Every endpoint gets a TLS profile of its own, like different client
+				// certificates would, so the checks are spread over several transports
+				endpoints := make([]models.APIEndpoint, 4)
+				for i := range endpoints {
+					endpoints[i] = models.APIEndpoint{
+						Name:           fmt.Sprintf("bench-%d", i),
+						URL:            server.URL + "/health",
+						Method:         "GET",
+						TimeoutSeconds: 10,
+						Proxy:          via.proxy,
+						TLSProfile: &models.TLSProfile{
+							CABundle:   fmt.Sprintf("%s# endpoint %d\n", caPEM, i),
+							ServerName: "example.com",
+						},
+						Transport: models.TransportOptions{DisableKeepAlives: fresh},
+					}
+				}
+
+				var next atomic.Int64
+				serverConns.Store(0)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						endpoint := endpoints[next.Add(1)%int64(len(endpoints))]
+						result, err := CheckEndpoint(endpoint)
+						if err != nil || result.StatusCode != http.StatusOK {
+							b.Errorf("check failed: %d %v", result.StatusCode, err)
+							return
+						}
+					}
+				})
+				b.ReportMetric(float64(serverConns.Load())/float64(b.N), "conns/op")
+			})
+		}
+	}
+}
+
+// connectProxy tunnels CONNECT requests, waiting delay before each upstream dial
+func connectProxy(delay time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		time.Sleep(delay)
+
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, buffered, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		fmt.Fprint(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+		go func() {
+			io.Copy(upstream, buffered)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	})
+}
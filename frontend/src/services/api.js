@@ -24,13 +24,47 @@ apiClient.interceptors.request.use(
   }
 )
 
+// Refresh tokens are single use, so concurrent 401s share one refresh request
+let refreshPromise = null
+
+const refreshTokens = () => {
+  if (!refreshPromise) {
+    const refreshToken = localStorage.getItem('api-monitor-refresh-token')
+    refreshPromise = axios
+      .post(`${API_BASE_URL}/auth/refresh`, { refresh_token: refreshToken })
+      .then((response) => {
+        localStorage.setItem('api-monitor-token', response.data.token)
+        localStorage.setItem('api-monitor-refresh-token', response.data.refresh_token)
+        return response.data.token
+      })
+      .finally(() => {
+        refreshPromise = null
+      })
+  }
+  return refreshPromise
+}
+
 // Add response interceptor to handle errors
 apiClient.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const request = error.config
     if (error.response?.status === 401) {
+      // Access token expired, try once to refresh it and replay the request
+      if (request && !request._retried && localStorage.getItem('api-monitor-refresh-token')) {
+        request._retried = true
+        try {
+          const token = await refreshTokens()
+          request.headers.Authorization = `Bearer ${token}`
+          return apiClient(request)
+        } catch (refreshError) {
+          // Fall through to login
+        }
+      }
+
       // Token expired or invalid, redirect to login
       localStorage.removeItem('api-monitor-token')
+      localStorage.removeItem('api-monitor-refresh-token')
       localStorage.removeItem('api-monitor-user')
       window.location.href = '/login'
     }
@@ -44,7 +78,8 @@ export const authAPI = {
 }
 
 export const endpointsAPI = {
-  getAll: () => apiClient.get('/endpoints'),
+  getAll: (params = {}) => apiClient.get('/endpoints', { params }),
+  bulk: (request) => apiClient.post('/endpoints/bulk', request),
   create: (endpoint) => apiClient.post('/endpoints', endpoint),
   update: (id, endpoint) => apiClient.put(`/endpoints/${id}`, endpoint),
   delete: (id) => apiClient.delete(`/endpoints/${id}`),
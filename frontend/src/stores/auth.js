@@ -22,19 +22,11 @@ export const useAuthStore = defineStore('auth', {
         })
 
         if (response.data && response.data.token) {
-          const { token, user } = response.data
-          
-          this.isAuthenticated = true
-          this.user = user
-          this.token = token
-          
-          localStorage.setItem('api-monitor-token', token)
-          localStorage.setItem('api-monitor-user', JSON.stringify(user))
-          
-          // Set axios default header
-          axios.defaults.headers.common['Authorization'] = `Bearer ${token}`
-          
+          this.setSession(response.data)
           return { success: true }
+        } else if (response.data && response.data.challenge_token) {
+          // Password accepted, a second factor (or its enrollment) is needed
+          return { success: false, twoFactor: response.data }
         } else {
           throw new Error('Invalid response from server')
         }
@@ -47,12 +39,68 @@ export const useAuthStore = defineStore('auth', {
       }
     },
 
+    // Exchange the one-time code from the single sign-on callback for tokens
+    async loginWithSSOCode(code) {
+      try {
+        const response = await axios.post('http://localhost:8080/api/v1/auth/oidc/exchange', { code })
+        this.setSession(response.data)
+        return { success: true }
+      } catch (error) {
+        const errorMessage = error.response?.data?.error || error.message || 'Single sign-on failed'
+        return {
+          success: false,
+          error: errorMessage
+        }
+      }
+    },
+
+    // Start authenticator enrollment during a login that requires two-factor authentication
+    async setupTwoFactor(challengeToken) {
+      const response = await axios.post('http://localhost:8080/api/v1/auth/2fa/setup', {
+        challenge_token: challengeToken
+      })
+      return response.data.data
+    },
+
+    // Finish a two-factor login with an authenticator or recovery code
+    async verifyTwoFactor(challengeToken, code, recoveryCode) {
+      try {
+        const response = await axios.post('http://localhost:8080/api/v1/auth/2fa/verify', {
+          challenge_token: challengeToken,
+          code: code || '',
+          recovery_code: recoveryCode || ''
+        })
+        this.setSession(response.data)
+        return { success: true, recoveryCodes: response.data.recovery_codes || [] }
+      } catch (error) {
+        const errorMessage = error.response?.data?.error || error.message || 'Verification failed'
+        return {
+          success: false,
+          error: errorMessage
+        }
+      }
+    },
+
+    setSession({ token, refresh_token, user }) {
+      this.isAuthenticated = true
+      this.user = user
+      this.token = token
+      
+      localStorage.setItem('api-monitor-token', token)
+      localStorage.setItem('api-monitor-refresh-token', refresh_token)
+      localStorage.setItem('api-monitor-user', JSON.stringify(user))
+      
+      // Set axios default header
+      axios.defaults.headers.common['Authorization'] = `Bearer ${token}`
+    },
+
     logout() {
       this.isAuthenticated = false
       this.user = null
       this.token = null
       
       localStorage.removeItem('api-monitor-token')
+      localStorage.removeItem('api-monitor-refresh-token')
       localStorage.removeItem('api-monitor-user')
       
       delete axios.defaults.headers.common['Authorization']